@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"enrich-fio/internal/config"
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/enrich-fio/storage/cache"
+	"enrich-fio/internal/models"
+)
+
+const _adminUsage = `Usage: %s admin [-tenant ID] <command>
+
+Flags:
+  -tenant ID            tenant, people of which command acts on, the default one if omitted
+
+Commands:
+  erase ID              remove person with all its history, leaving a tombstone
+  anonymize ID          replace FIO of person with irreversible hashes
+  retention [-dry-run]  apply retention rules from RETENTION_RULES
+  rotate-keys           reencrypt FIO with the current encryption key, and encrypt plaintext FIO
+`
+
+// keyRotator is a storage, which encrypts FIO and can reencrypt it with the current key.
+type keyRotator interface {
+	// RotateKeys reencrypts FIO, encrypted with other keys than the current one. Returns the number of rotated rows.
+	RotateKeys(ctx context.Context) (int64, error)
+	// EncryptPlaintext encrypts FIO of people, kept in plaintext, so filters by FIO match them.
+	// Returns the number of encrypted people.
+	EncryptPlaintext(ctx context.Context) (int64, error)
+}
+
+// runAdmin runs admin command with given arguments against configured storage, and prints its result as JSON.
+func runAdmin(ctx context.Context, dbConfig *config.DBConfig, retentionConfig *config.RetentionConfig, args []string) error {
+	adminFlags := flag.NewFlagSet("admin", flag.ContinueOnError)
+	tenant := adminFlags.String("tenant", models.DefaultTenant, "tenant, people of which command acts on")
+	err := adminFlags.Parse(args)
+	if err != nil {
+		return err
+	}
+	args = adminFlags.Args()
+	if len(args) == 0 || args[0] == "help" {
+		fmt.Printf(_adminUsage, os.Args[0])
+		if len(args) == 0 {
+			return errors.New("admin command is missing")
+		}
+		return nil
+	}
+	rules, err := enrichfio.ParseRetentionRules(retentionConfig.Rules)
+	if err != nil {
+		return errors.Wrap(err, "parsing retention rules")
+	}
+	// Storage is cached the same way as server's, so cached copies of people are removed too.
+	s, err := newStorage(ctx, dbConfig, config.NewCacheConfig(), config.NewEncryptionConfig())
+	if err != nil {
+		return errors.Wrap(err, "creating storage")
+	}
+	tenancy, err := newTenancy(config.NewTenantConfig(), &http.Client{})
+	if err != nil {
+		return errors.Wrap(err, "parsing tenants")
+	}
+	// Admin commands don't enrich people.
+	service := enrichfio.New(s, nil, nil, nil)
+	service.RetentionRules = rules
+	service.Tenancy = tenancy
+	err = service.CheckTenant(*tenant)
+	if err != nil {
+		return err
+	}
+	ctx = models.WithTenant(ctx, *tenant)
+	ctx = models.WithAudit(ctx, models.Audit{Actor: os.Getenv("USER"), Source: models.SourceCLI})
+
+	command, args := args[0], args[1:]
+	var result any
+	switch command {
+	case "erase", "anonymize":
+		if len(args) != 1 {
+			return errors.Errorf("%s needs exactly one argument", command)
+		}
+		id, err := uuid.Parse(args[0])
+		if err != nil {
+			return errors.Errorf("%s needs ID of person, got %q", command, args[0])
+		}
+		if command == "erase" {
+			result, err = service.ErasePerson(ctx, id)
+		} else {
+			result, err = service.AnonymizePerson(ctx, id)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "admin %s", command)
+		}
+	case "retention":
+		flags := flag.NewFlagSet("retention", flag.ContinueOnError)
+		dryRun := flags.Bool("dry-run", false, "only count people, rules apply to")
+		err := flags.Parse(args)
+		if err != nil {
+			return err
+		}
+		result, err = service.ApplyRetention(ctx, *dryRun)
+		if err != nil {
+			return errors.Wrap(err, "admin retention")
+		}
+	case "rotate-keys":
+		rotator, ok := uncached(s).(keyRotator)
+		if !ok {
+			return errors.Errorf("storage driver %q doesn't encrypt FIO", dbConfig.Driver)
+		}
+		rotated, err := rotator.RotateKeys(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "admin rotate-keys, %d rows rotated", rotated)
+		}
+		result = map[string]int64{"rotated": rotated}
+	default:
+		fmt.Printf(_adminUsage, os.Args[0])
+		return errors.Errorf("unknown admin command %q", command)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(result)
+}
+
+// applyRetentionPeriodically applies retention rules of service to people of every tenant every interval, until ctx is done.
+func applyRetentionPeriodically(ctx context.Context, service *enrichfio.Service, interval time.Duration) {
+	logger := zap.L()
+	logger.Info(fmt.Sprintf("retention rules are applied every %s", interval))
+	ctx = models.WithAudit(ctx, models.Audit{Actor: "retention", Source: models.SourceRetention})
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, tenant := range service.TenantIDs() {
+			results, err := service.ApplyRetention(models.WithTenant(ctx, tenant), false)
+			if err != nil {
+				logger.Error(fmt.Sprintf("applying retention rules to tenant %q failed. err: %v", tenant, err))
+			}
+			for _, result := range results {
+				logger.Info(fmt.Sprintf("retention rule %s after %d days %q of tenant %q: %d matched, %d applied, %d failed",
+					result.Rule.Action, result.Rule.AfterDays, result.Rule.Filter, tenant, result.Matched, result.Applied, result.Failed))
+			}
+		}
+	}
+}
+
+// uncached returns storage, cached one is backed by, or s itself, if it's not cached.
+// People, changed by it, are evicted from caches by change notifications of storage itself.
+func uncached(s enrichfio.Storage) enrichfio.Storage {
+	if cached, ok := s.(*cache.CacheStorage); ok {
+		return cached.Storage
+	}
+	return s
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/config"
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/fieldcrypt"
+	"enrich-fio/internal/filterexpr"
+	"enrich-fio/internal/models"
+)
+
+const _exportUsage = `Usage: %s export [flags]
+
+Writes people, matching the filter, to a file or stdout, in order of IDs.
+
+Flags:
+  -tenant ID            tenant, people of which are exported, the default one if omitted
+  -format FORMAT        csv, ndjson or parquet, csv if omitted
+  -filter EXPRESSION    filter expression, like: age>30 and nationality in ("RU","KZ"), all people if omitted
+  -o FILE               file to write, stdout if omitted
+`
+
+// runExport exports people from configured storage with given arguments.
+func runExport(ctx context.Context, dbConfig *config.DBConfig, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Printf(_exportUsage, os.Args[0]) }
+	tenant := flags.String("tenant", models.DefaultTenant, "tenant, people of which are exported")
+	format := flags.String("format", string(models.ExportCSV), "csv, ndjson or parquet")
+	expression := flags.String("filter", "", "filter expression")
+	output := flags.String("o", "", "file to write")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errors.Errorf("unexpected arguments %q", flags.Args())
+	}
+	err = models.ExportFormat(*format).Validate()
+	if err != nil {
+		return err
+	}
+	filter := models.FilterConfig{}
+	if *expression != "" {
+		filter.Expr, err = filterexpr.Parse(*expression)
+		if err != nil {
+			return errors.Wrap(err, "parsing filter")
+		}
+	}
+
+	// Export only reads people, so there is nothing to evict from caches.
+	keyring, err := fieldcrypt.Load(config.NewEncryptionConfig())
+	if err != nil {
+		return errors.Wrap(err, "loading encryption keys")
+	}
+	s, err := openStorage(ctx, dbConfig, keyring)
+	if err != nil {
+		return errors.Wrap(err, "creating storage")
+	}
+	tenancy, err := newTenancy(config.NewTenantConfig(), &http.Client{})
+	if err != nil {
+		return errors.Wrap(err, "parsing tenants")
+	}
+	// Export doesn't enrich people.
+	service := enrichfio.New(s, nil, nil, nil)
+	service.Tenancy = tenancy
+	err = service.CheckTenant(*tenant)
+	if err != nil {
+		return err
+	}
+	ctx = models.WithTenant(ctx, *tenant)
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return errors.Wrap(err, "creating output file")
+		}
+		defer file.Close()
+		w = file
+	}
+	exported, err := service.ExportPeople(ctx, filter, models.ExportFormat(*format), w)
+	if err != nil {
+		if *output != "" {
+			// Incomplete file mustn't be taken for the whole export.
+			os.Remove(*output)
+		}
+		return errors.Wrapf(err, "export, %d people exported", exported)
+	}
+	// Stdout may be the export itself, so the summary goes to stderr.
+	fmt.Fprintf(os.Stderr, "%d people exported\n", exported)
+	return nil
+}
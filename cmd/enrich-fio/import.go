@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/config"
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/models"
+)
+
+const _importUsage = `Usage: %s import [flags] FILE
+       %s import [flags] -resume ID
+
+Imports people from CSV or NDJSON file, or stdin if FILE is -, and prints the import job.
+Paused job, like one stopped by unavailable enrichment API, is resumed by its ID.
+
+Flags:
+  -tenant ID            tenant, people are imported to, the default one if omitted
+  -format FORMAT        csv or ndjson, csv if omitted
+  -name COLUMN          column of names, "name" if omitted
+  -surname COLUMN       column of surnames, "surname" if omitted
+  -patronymic COLUMN    column of patronymics, "patronymic" if omitted
+  -enrich               enrich people with age, gender and nationality
+  -resume ID            resume import job with given ID instead of importing a file
+  -report FILE          file to write result of every row to
+  -report-format FORMAT csv or ndjson, csv if omitted
+`
+
+// runImport imports people to configured storage with given arguments.
+func runImport(ctx context.Context, dbConfig *config.DBConfig, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Printf(_importUsage, os.Args[0], os.Args[0]) }
+	tenant := flags.String("tenant", models.DefaultTenant, "tenant, people are imported to")
+	format := flags.String("format", string(models.ImportCSV), "csv or ndjson")
+	name := flags.String("name", "", "column of names")
+	surname := flags.String("surname", "", "column of surnames")
+	patronymic := flags.String("patronymic", "", "column of patronymics")
+	enrich := flags.Bool("enrich", false, "enrich people with age, gender and nationality")
+	resume := flags.String("resume", "", "ID of import job to resume")
+	report := flags.String("report", "", "file to write result of every row to")
+	reportFormat := flags.String("report-format", string(models.ImportCSV), "csv or ndjson")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *resume == "" && flags.NArg() != 1 || *resume != "" && flags.NArg() != 0 {
+		flags.Usage()
+		return errors.Errorf("import needs either a file or -resume, got %q", flags.Args())
+	}
+
+	// Storage is cached the same way as server's, so cached copies of overwritten people are removed too.
+	s, err := newStorage(ctx, dbConfig, config.NewCacheConfig(), config.NewEncryptionConfig())
+	if err != nil {
+		return errors.Wrap(err, "creating storage")
+	}
+	client := &http.Client{}
+	tenancy, err := newTenancy(config.NewTenantConfig(), client)
+	if err != nil {
+		return errors.Wrap(err, "parsing tenants")
+	}
+	providers := newProviders(client, models.ProviderConfig{})
+	service := enrichfio.New(s, providers.Age, providers.Gender, providers.Nationality)
+	service.Tenancy = tenancy
+	err = service.CheckTenant(*tenant)
+	if err != nil {
+		return err
+	}
+	ctx = models.WithTenant(ctx, *tenant)
+	ctx = models.WithAudit(ctx, models.Audit{Actor: os.Getenv("USER"), Source: models.SourceCLI})
+
+	var id uuid.UUID
+	if *resume != "" {
+		id, err = uuid.Parse(*resume)
+		if err != nil {
+			return errors.Errorf("-resume needs ID of import job, got %q", *resume)
+		}
+	} else {
+		var r io.Reader = os.Stdin
+		if path := flags.Arg(0); path != "-" {
+			file, err := os.Open(path)
+			if err != nil {
+				return errors.Wrap(err, "opening input file")
+			}
+			defer file.Close()
+			r = file
+		}
+		job, err := service.CreateImport(ctx, r, models.ImportOptions{
+			Format:  models.ImportFormat(*format),
+			Columns: models.ImportColumns{Name: *name, Surname: *surname, Patronymic: *patronymic},
+			Enrich:  *enrich,
+		})
+		if err != nil {
+			return errors.Wrap(err, "creating import")
+		}
+		id = job.ID
+		// Stdout is the job, so progress goes to stderr.
+		fmt.Fprintf(os.Stderr, "import %s created, %d rows read\n", job.ID, job.Rows)
+	}
+
+	job, err := service.ClaimImport(ctx, id)
+	if err != nil {
+		return errors.Wrap(err, "claiming import")
+	}
+	job, runErr := service.RunImport(ctx, job)
+	if runErr != nil && job.ID == uuid.Nil {
+		return errors.Wrap(runErr, "running import")
+	}
+	// Report is written even for paused job, so failed rows can be fixed meanwhile.
+	if *report != "" {
+		err = writeImportReport(ctx, service, id, models.ImportFormat(*reportFormat), *report)
+		if err != nil {
+			return err
+		}
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode(job)
+	if err != nil {
+		return err
+	}
+	if errors.Is(runErr, models.ErrImportClaimed) {
+		return errors.Wrap(runErr, "import is left to another run")
+	}
+	if runErr != nil {
+		return errors.Wrapf(runErr, "import paused, resume it with -resume %s", id)
+	}
+	return nil
+}
+
+// writeImportReport writes results of rows of import job with given ID to file at path.
+func writeImportReport(ctx context.Context, service *enrichfio.Service, id uuid.UUID, format models.ImportFormat, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "creating report file")
+	}
+	defer file.Close()
+	err = service.ImportReport(ctx, id, format, file)
+	if err != nil {
+		// Incomplete report mustn't be taken for the whole one.
+		os.Remove(path)
+		return errors.Wrap(err, "writing report")
+	}
+	return nil
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -19,6 +21,10 @@ import (
 	probablenationality "enrich-fio/internal/enrich-fio/api/probable-nationality"
 	"enrich-fio/internal/enrich-fio/storage"
 	"enrich-fio/internal/enrich-fio/storage/cache"
+	"enrich-fio/internal/enrich-fio/storage/memory"
+	"enrich-fio/internal/enrich-fio/storage/sqlite"
+	"enrich-fio/internal/fieldcrypt"
+	"enrich-fio/internal/models"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -39,6 +45,11 @@ func main() {
 func run() error {
 	// load .env file
 	godotenv.Load()
+	dbConfig := config.NewDBConfig()
+	autoMigrate := flag.Bool("auto-migrate", dbConfig.AutoMigrate, "migrate storage to the last version on start")
+	flag.Usage = usage
+	flag.Parse()
+
 	// Collecting prerequisites.
 	gin.SetMode(gin.ReleaseMode)
 	ctx := context.Background()
@@ -50,39 +61,66 @@ func run() error {
 	zap.ReplaceGlobals(logger)
 	defer logger.Sync()
 
-	// Creating cached storage with cache realisation via redis and storage realisation via postgres/pgx.
-	cacheConfig := config.NewCacheConfig()
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     cacheConfig.Host,
-		Password: "",
-		DB:       0,
-	})
-	dbConfig := config.NewDBConfig()
-	pgxConfig, err := pgxpool.ParseConfig(fmt.Sprintf("postgresql://%s:%s@%s/%s", dbConfig.User, dbConfig.Password, dbConfig.Host, dbConfig.DBName))
+	switch flag.Arg(0) {
+	case "":
+	case "migrate":
+		return runMigrate(ctx, dbConfig, flag.Args()[1:])
+	case "admin":
+		return runAdmin(ctx, dbConfig, config.NewRetentionConfig(), flag.Args()[1:])
+	case "export":
+		return runExport(ctx, dbConfig, flag.Args()[1:])
+	case "import":
+		return runImport(ctx, dbConfig, flag.Args()[1:])
+	default:
+		flag.Usage()
+		return errors.Errorf("unknown command %q", flag.Arg(0))
+	}
+
+	// Checking retention rules and tenants before anything is started.
+	retentionConfig := config.NewRetentionConfig()
+	retentionRules, err := enrichfio.ParseRetentionRules(retentionConfig.Rules)
 	if err != nil {
-		return errors.Wrap(err, "parsing pgx config")
+		return errors.Wrap(err, "parsing retention rules")
 	}
-	pgxConfig.MaxConnIdleTime = time.Minute
-	pool, err := pgxpool.NewWithConfig(ctx, pgxConfig)
+	tenancy, err := newTenancy(config.NewTenantConfig(), client)
 	if err != nil {
-		return errors.Wrap(err, "creating new pgx pool")
+		return errors.Wrap(err, "parsing tenants")
 	}
-	var cacheTTL time.Duration = time.Hour
-	s := cache.NewCacheStorage(storage.New(pool, dbConfig), redisClient, cacheTTL)
 
-	// Applying the last version of storage schema.
-	err = s.MigrateUp(ctx)
+	// Creating storage, cached with redis, if it is configured.
+	s, err := newStorage(ctx, dbConfig, config.NewCacheConfig(), config.NewEncryptionConfig())
 	if err != nil {
-		return errors.Wrap(err, "migrating storage up")
+		return errors.Wrap(err, "creating storage")
+	}
+
+	// Applying the last version of storage schema.
+	if *autoMigrate {
+		err = s.MigrateUp(ctx)
+		if err != nil {
+			return errors.Wrap(err, "migrating storage up")
+		}
+	} else {
+		logger.Info("auto migration is disabled, storage schema is left as is")
+	}
+
+	// Encrypting FIO of people, saved before encryption was enabled, as filters by FIO match blind indexes only.
+	if encrypter, ok := uncached(s).(keyRotator); ok {
+		encrypted, err := encrypter.EncryptPlaintext(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "encrypting plaintext FIO, %d people encrypted", encrypted)
+		}
+		if encrypted != 0 {
+			logger.Info(fmt.Sprintf("FIO of %d people, kept in plaintext, is encrypted", encrypted))
+		}
 	}
 
 	// Creating probable age/gender/nationality realisations.
-	pa := probableage.New(client)
-	pg := probablegender.New(client)
-	pn := probablenationality.New(client)
+	providers := newProviders(client, models.ProviderConfig{})
 
 	// Creating enrich-fio service from collected dependencies.
-	service := enrichfio.New(s, pa, pg, pn)
+	service := enrichfio.New(s, providers.Age, providers.Gender, providers.Nationality)
+	service.RetentionRules = retentionRules
+	service.Tenancy = tenancy
 
 	// Creating controllers.
 	graphQLHandler := graphql.NewGraphQLHandler(service, config.NewGraphQLConfig())
@@ -90,12 +128,34 @@ func run() error {
 	router := gin.Default()
 	httpHandler := rest.NewHTTPHandler(router, service, config.NewRestConfig())
 
-	kafkaHandler := kafka.NewHandler(service, config.NewKafkaConfig())
+	kafkaConfig := config.NewKafkaConfig()
+	kafkaHandler := kafka.NewHandler(service, kafkaConfig)
 
 	// Starting all the controllers.
 	var wg sync.WaitGroup
 	wg.Add(3)
 
+	// Publishing events about changes of people, if there is a topic for them.
+	outboxConfig := config.NewOutboxConfig()
+	if outboxConfig.Topic != "" {
+		relay := kafka.NewRelay(s, kafkaConfig, outboxConfig)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := relay.Start(ctx)
+			if err != nil {
+				logger.Error(fmt.Sprintf("outbox relay died. err: %v", err))
+			}
+		}()
+	} else {
+		logger.Info("outbox topic is not set, events are kept in outbox")
+	}
+
+	// Anonymizing and erasing people, kept too long, if there are rules for them.
+	if len(retentionRules) != 0 && retentionConfig.Interval > 0 {
+		go applyRetentionPeriodically(ctx, service, retentionConfig.Interval)
+	}
+
 	go func() {
 		defer wg.Done()
 		err = graphQLHandler.Start(ctx)
@@ -126,3 +186,103 @@ func run() error {
 	}
 	return nil
 }
+
+// usage prints how to run the binary.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage:\n")
+	fmt.Fprintf(out, "  %s [flags]                     run the server\n", os.Args[0])
+	fmt.Fprintf(out, "  %s [flags] migrate <command>   manage storage schema, see %s migrate help\n", os.Args[0], os.Args[0])
+	fmt.Fprintf(out, "  %s [flags] admin <command>     erase and anonymize people, see %s admin help\n", os.Args[0], os.Args[0])
+	fmt.Fprintf(out, "  %s [flags] export [flags]      export people as csv, ndjson or parquet, see %s export -h\n", os.Args[0], os.Args[0])
+	fmt.Fprintf(out, "  %s [flags] import [flags] FILE import people from csv or ndjson, see %s import -h\n", os.Args[0], os.Args[0])
+	fmt.Fprintf(out, "Flags:\n")
+	flag.PrintDefaults()
+}
+
+// newProviders returns providers of age, gender and nationality with given config.
+func newProviders(client *http.Client, config models.ProviderConfig) enrichfio.Providers {
+	return enrichfio.Providers{
+		Age:         probableage.New(client, config.AgeURL, config.APIKey),
+		Gender:      probablegender.New(client, config.GenderURL, config.APIKey),
+		Nationality: probablenationality.New(client, config.NationalityURL, config.APIKey),
+	}
+}
+
+// newTenancy returns tenancy of configured tenants, or nil if there are none, so everything belongs to the default tenant.
+func newTenancy(tenantConfig *config.TenantConfig, client *http.Client) (*enrichfio.Tenancy, error) {
+	tenants, err := enrichfio.ParseTenants(tenantConfig.Tenants)
+	if err != nil {
+		return nil, err
+	}
+	if len(tenants) == 0 {
+		return nil, nil
+	}
+	return enrichfio.NewTenancy(tenants, tenantConfig.JWTSecret, tenantConfig.JWTClaim, func(config models.ProviderConfig) enrichfio.Providers {
+		return newProviders(client, config)
+	}), nil
+}
+
+// newStorage returns storage with configured driver. Storage is cached with redis, unless redis host is empty.
+// Cached storage is invalidated on changes, made by other instances, until ctx is done.
+// FIO is encrypted both in storage and in cache, if encryption keys are configured.
+func newStorage(ctx context.Context, dbConfig *config.DBConfig, cacheConfig *config.CacheConfig, encryptionConfig *config.EncryptionConfig) (enrichfio.Storage, error) {
+	keyring, err := fieldcrypt.Load(encryptionConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading encryption keys")
+	}
+	s, err := openStorage(ctx, dbConfig, keyring)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheConfig.Host == "" {
+		return s, nil
+	}
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     cacheConfig.Host,
+		Password: "",
+		DB:       0,
+	})
+	var cacheTTL time.Duration = time.Hour
+	cached := cache.NewCacheStorage(s, redisClient, cacheTTL, cacheConfig.StatsTTL, keyring)
+
+	// Evicting people, changed by other instances of the service.
+	go func() {
+		err := cached.Listen(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			zap.L().Error(fmt.Sprintf("cache invalidation listener died. err: %v", err))
+		}
+	}()
+	return cached, nil
+}
+
+// openStorage returns storage with configured driver. FIO is encrypted with keyring, unless it's nil.
+// Only postgres driver supports encryption.
+func openStorage(ctx context.Context, dbConfig *config.DBConfig, keyring *fieldcrypt.Keyring) (enrichfio.Storage, error) {
+	if keyring != nil && dbConfig.Driver != config.DriverPostgres {
+		return nil, errors.Errorf("storage driver %q doesn't support encryption", dbConfig.Driver)
+	}
+	switch dbConfig.Driver {
+	case config.DriverMemory:
+		return memory.New(dbConfig), nil
+	case config.DriverPostgres:
+		pgxConfig, err := pgxpool.ParseConfig(fmt.Sprintf("postgresql://%s:%s@%s/%s", dbConfig.User, dbConfig.Password, dbConfig.Host, dbConfig.DBName))
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing pgx config")
+		}
+		pgxConfig.MaxConnIdleTime = time.Minute
+		pool, err := pgxpool.NewWithConfig(ctx, pgxConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "creating new pgx pool")
+		}
+		return storage.New(pool, dbConfig, keyring), nil
+	case config.DriverSQLite:
+		db, err := sql.Open("sqlite", dbConfig.SQLitePath)
+		if err != nil {
+			return nil, errors.Wrap(err, "opening sqlite database")
+		}
+		return sqlite.New(db, dbConfig), nil
+	}
+	return nil, errors.Errorf("unknown storage driver %q", dbConfig.Driver)
+}
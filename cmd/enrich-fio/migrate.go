@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/config"
+)
+
+// migrator is a storage with schema, managed by golang-migrate.
+type migrator interface {
+	// Migrate returns migrate instance for storage schema, which must be closed after use.
+	Migrate() (*migrate.Migrate, error)
+}
+
+const _migrateUsage = `Usage: %s migrate <command>
+
+Commands:
+  up          migrate to the last version
+  down N      roll back N last migrations
+  goto V      migrate up or down to version V
+  force V     set version V without migrating, after a failed migration left schema dirty
+  status      print current version
+`
+
+// runMigrate runs migrate command with given arguments against configured storage.
+func runMigrate(ctx context.Context, dbConfig *config.DBConfig, args []string) error {
+	if len(args) == 0 || args[0] == "help" {
+		fmt.Printf(_migrateUsage, os.Args[0])
+		if len(args) == 0 {
+			return errors.New("migrate command is missing")
+		}
+		return nil
+	}
+
+	// Migrations don't touch FIO, so they need no encryption keys.
+	s, err := openStorage(ctx, dbConfig, nil)
+	if err != nil {
+		return errors.Wrap(err, "creating storage")
+	}
+	storageMigrator, ok := s.(migrator)
+	if !ok {
+		return errors.Errorf("storage driver %q has no schema to migrate", dbConfig.Driver)
+	}
+	m, err := storageMigrator.Migrate()
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "up":
+		err = m.Up()
+	case "down":
+		var n int
+		n, err = migrateArg(command, args)
+		if err == nil && n <= 0 {
+			err = errors.Errorf("down needs a positive number of migrations, got %d", n)
+		}
+		if err == nil {
+			err = m.Steps(-n)
+		}
+	case "goto":
+		var version int
+		version, err = migrateArg(command, args)
+		if err == nil && version <= 0 {
+			err = errors.Errorf("goto needs a positive version, got %d; use down to roll back all migrations", version)
+		}
+		if err == nil {
+			err = m.Migrate(uint(version))
+		}
+	case "force":
+		var version int
+		version, err = migrateArg(command, args)
+		if err == nil {
+			err = m.Force(version)
+		}
+	case "status":
+	default:
+		fmt.Printf(_migrateUsage, os.Args[0])
+		return errors.Errorf("unknown migrate command %q", command)
+	}
+	if errors.Is(err, migrate.ErrNoChange) {
+		fmt.Println("no change")
+	} else if err != nil {
+		return errors.Wrapf(err, "migrate %s", command)
+	}
+	return printMigrationStatus(m)
+}
+
+// migrateArg returns the only integer argument of migrate command.
+func migrateArg(command string, args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, errors.Errorf("%s needs exactly one argument", command)
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, errors.Errorf("%s needs an integer argument, got %q", command, args[0])
+	}
+	return n, nil
+}
+
+// printMigrationStatus prints current version of storage schema.
+func printMigrationStatus(m *migrate.Migrate) error {
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		fmt.Println("no migrations applied")
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "get version")
+	}
+	if dirty {
+		fmt.Printf("version %d (dirty: the last migration failed, fix schema and run force)\n", version)
+		return nil
+	}
+	fmt.Printf("version %d\n", version)
+	return nil
+}
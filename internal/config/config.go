@@ -2,37 +2,70 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"time"
 )
 
 // Cached is config with sensitive data, needed for working with cache.
 type CacheConfig struct {
 	Host string
+	// StatsTTL is how long statistics over people are cached.
+	StatsTTL time.Duration
 }
 
 // NewCacheConfig return CacheConfig with sensitive data, needed for working with cache.
 func NewCacheConfig() *CacheConfig {
 	return &CacheConfig{
-		Host: os.Getenv("REDIS_HOST"),
+		Host:     os.Getenv("REDIS_HOST"),
+		StatsTTL: getEnvDuration("CACHE_STATS_TTL", time.Minute),
 	}
 }
 
+// Storage drivers, service can keep people with.
+const (
+	DriverPostgres = "postgres"
+	// DriverMemory keeps people in process memory, and loses them on restart.
+	DriverMemory = "memory"
+	// DriverSQLite keeps people in a single file, for deployments without postgres.
+	DriverSQLite = "sqlite"
+)
+
 // DBConfig is config with sensitive data, needed for working with db.
 type DBConfig struct {
-	User         string
-	Host         string
-	DBName       string
-	Password     string
+	// Driver is a storage to keep people with, one of DriverPostgres, DriverMemory and DriverSQLite.
+	Driver string
+	// SQLitePath is a path to database file of DriverSQLite.
+	SQLitePath string
+	User       string
+	Host       string
+	DBName     string
+	Password   string
+	// MigrationURL overrides migrations, embedded into binary, if not empty.
 	MigrationURL string
+	// AutoMigrate tells if storage is migrated to the last version on server start.
+	AutoMigrate bool
+	// DefaultPageSize is a number of people on a page, if client didn't choose one.
+	DefaultPageSize int
+	// MaxPageSize is the largest number of people on a page client can choose.
+	MaxPageSize int
+	// EstimateTotalAbove is a number of rows, starting from which total may be taken from table statistics.
+	EstimateTotalAbove int
 }
 
 // NewDBConfig return DBConfig with sensitive data, needed for working with db.
 func NewDBConfig() *DBConfig {
 	return &DBConfig{
-		User:         os.Getenv("POSTGRES_USER"),
-		Host:         os.Getenv("POSTGRES_HOST"),
-		DBName:       os.Getenv("POSTGRES_DB"),
-		Password:     os.Getenv("POSTGRES_PASSWORD"),
-		MigrationURL: os.Getenv("MIGRATION_URL"),
+		Driver:             getEnv("STORAGE_DRIVER", DriverPostgres),
+		SQLitePath:         getEnv("SQLITE_PATH", "enrich-fio.db"),
+		User:               os.Getenv("POSTGRES_USER"),
+		Host:               os.Getenv("POSTGRES_HOST"),
+		DBName:             os.Getenv("POSTGRES_DB"),
+		Password:           os.Getenv("POSTGRES_PASSWORD"),
+		MigrationURL:       os.Getenv("MIGRATION_URL"),
+		AutoMigrate:        getEnvBool("AUTO_MIGRATE", true),
+		DefaultPageSize:    getEnvInt("PAGE_SIZE_DEFAULT", 5),
+		MaxPageSize:        getEnvInt("PAGE_SIZE_MAX", 100),
+		EstimateTotalAbove: getEnvInt("ESTIMATE_TOTAL_ABOVE", 100000),
 	}
 }
 
@@ -51,12 +84,15 @@ func NewGraphQLConfig() *GraphQLConfig {
 // RestConfig is config with sensitive data, needed for rest API.
 type RestConfig struct {
 	Host string
+	// AdminToken is a bearer token, admin API requires. Admin API is disabled if it's empty.
+	AdminToken string
 }
 
 // NewRestConfig returns RestConfig with sensitive data, needed for rest API.
 func NewRestConfig() *RestConfig {
 	return &RestConfig{
-		Host: os.Getenv("REST_API_HOST"),
+		Host:       os.Getenv("REST_API_HOST"),
+		AdminToken: os.Getenv("ADMIN_TOKEN"),
 	}
 }
 
@@ -71,3 +107,121 @@ func NewKafkaConfig() *KafkaConfig {
 		Host: os.Getenv("KAFKA_HOST"),
 	}
 }
+
+// OutboxConfig is config of relay, publishing events about changes of people from outbox to kafka.
+type OutboxConfig struct {
+	// Topic is kafka topic to publish events to. Relay is not started if it's empty.
+	Topic string
+	// PollInterval is how often outbox is checked for pending events.
+	PollInterval time.Duration
+	// BatchSize is the largest number of events published at once.
+	BatchSize int
+	// RetryMax is the longest pause between attempts to publish events, after kafka failed.
+	RetryMax time.Duration
+	// Retention is how long delivered events are kept in outbox.
+	Retention time.Duration
+}
+
+// NewOutboxConfig returns OutboxConfig.
+func NewOutboxConfig() *OutboxConfig {
+	return &OutboxConfig{
+		Topic:        os.Getenv("OUTBOX_TOPIC"),
+		PollInterval: getEnvDuration("OUTBOX_POLL_INTERVAL", time.Second),
+		BatchSize:    getEnvInt("OUTBOX_BATCH_SIZE", 100),
+		RetryMax:     getEnvDuration("OUTBOX_RETRY_MAX", time.Minute),
+		Retention:    getEnvDuration("OUTBOX_RETENTION", 24*time.Hour),
+	}
+}
+
+// EncryptionConfig is config of encryption of FIO at rest, in postgres storage and redis cache.
+// People, kept in plaintext, like ones saved before encryption was enabled, are encrypted on start of the server,
+// or by admin rotate-keys command, as filters by FIO match only encrypted people then.
+type EncryptionConfig struct {
+	// KeyFile is a path to JSON keyring, see fieldcrypt.Parse. It takes precedence over Keys.
+	KeyFile string
+	// Keys is JSON keyring itself. FIO is kept in plaintext if both KeyFile and Keys are empty.
+	Keys string
+}
+
+// NewEncryptionConfig returns EncryptionConfig with sensitive data, needed for encryption of FIO.
+func NewEncryptionConfig() *EncryptionConfig {
+	return &EncryptionConfig{
+		KeyFile: os.Getenv("ENCRYPTION_KEYFILE"),
+		Keys:    os.Getenv("ENCRYPTION_KEYS"),
+	}
+}
+
+// RetentionConfig is config of retention rules, anonymizing and erasing people, kept too long.
+type RetentionConfig struct {
+	// Rules is JSON array of retention rules, see enrichfio.ParseRetentionRules. Empty means no rules.
+	Rules string
+	// Interval is how often the rules are applied in background. Zero disables background runs.
+	Interval time.Duration
+}
+
+// NewRetentionConfig returns RetentionConfig.
+func NewRetentionConfig() *RetentionConfig {
+	return &RetentionConfig{
+		Rules:    os.Getenv("RETENTION_RULES"),
+		Interval: getEnvDuration("RETENTION_INTERVAL", 24*time.Hour),
+	}
+}
+
+// TenantConfig is config with sensitive data, needed to tell tenants of requests apart.
+type TenantConfig struct {
+	// Tenants is JSON array of tenants, see enrichfio.ParseTenants. Everything belongs to the default tenant if it's empty.
+	Tenants string
+	// JWTSecret is a key of HS256 signature of JWTs, requests may be authenticated with. JWTs are rejected if it's empty.
+	JWTSecret string
+	// JWTClaim is a claim of JWT, which holds ID of tenant.
+	JWTClaim string
+}
+
+// NewTenantConfig returns TenantConfig with sensitive data, needed to tell tenants of requests apart.
+func NewTenantConfig() *TenantConfig {
+	return &TenantConfig{
+		Tenants:   os.Getenv("TENANTS"),
+		JWTSecret: os.Getenv("TENANT_JWT_SECRET"),
+		JWTClaim:  getEnv("TENANT_JWT_CLAIM", "tenant"),
+	}
+}
+
+// getEnv returns value of environment variable with given key.
+// Returns fallback if variable is not set.
+func getEnv(key string, fallback string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// getEnvInt returns integer value of environment variable with given key.
+// Returns fallback if variable is not set or is not an integer.
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvBool returns boolean value, like "true" or "0", of environment variable with given key.
+// Returns fallback if variable is not set or is not a boolean.
+func getEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvDuration returns duration value, like "30s", of environment variable with given key.
+// Returns fallback if variable is not set or is not a duration.
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,382 @@
+package graphql
+
+import (
+	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/filterexpr"
+	"enrich-fio/internal/models"
+)
+
+// conditionInputType is an input type for a single filter condition.
+var conditionInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "ConditionInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"field": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"op": &graphql.InputObjectFieldConfig{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "One of eq, in, gt, gte, lt, lte, unknown",
+		},
+		"values": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewList(graphql.String),
+		},
+		"not": &graphql.InputObjectFieldConfig{
+			Type: graphql.Boolean,
+		},
+	},
+})
+
+// filterArgs returns arguments of people filter.
+// Library doesn't support operators, I don't have time to rewrite or think of anything, so age filter is ugly.
+func filterArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"id": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"name": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"surname": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"patronymic": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"age": &graphql.ArgumentConfig{
+			Type: graphql.Int,
+		},
+		"ageMin": &graphql.ArgumentConfig{
+			Type: graphql.Int,
+		},
+		"ageMax": &graphql.ArgumentConfig{
+			Type: graphql.Int,
+		},
+		"gender": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"nationality": &graphql.ArgumentConfig{
+			Type: graphql.String,
+		},
+		"nationalityMatch": &graphql.ArgumentConfig{
+			Type:        graphql.String,
+			Description: "Whether nationality matches only the primary nationality of person (primary), or any of probable ones (any)",
+		},
+		"where": &graphql.ArgumentConfig{
+			Type:        graphql.NewList(conditionInputType),
+			Description: "Conditions, all of which must hold",
+		},
+		"anyOf": &graphql.ArgumentConfig{
+			Type:        graphql.NewList(graphql.NewList(conditionInputType)),
+			Description: "Groups of conditions. Each group holds, if any of its conditions holds",
+		},
+		"filter": &graphql.ArgumentConfig{
+			Type:        graphql.String,
+			Description: `Filter expression, like: age>30 and nationality in ("RU","KZ") and not gender="male"`,
+		},
+		"tags": &graphql.ArgumentConfig{
+			Type:        graphql.NewList(graphql.NewNonNull(graphql.String)),
+			Description: "Tags, person must have all of",
+		},
+		"attributes": &graphql.ArgumentConfig{
+			Type:        graphql.NewList(attributeInputType),
+			Description: "Attributes, person must have with the same values",
+		},
+	}
+}
+
+// filterFromArgs returns people filter, described by arguments from filterArgs.
+func filterFromArgs(args map[string]interface{}) (models.FilterConfig, error) {
+	filter := models.FilterConfig{}
+	id, idOK := args["id"].(string)
+	if idOK {
+		uuid, err := uuid.Parse(id)
+		if err != nil {
+			return models.FilterConfig{}, errors.Wrap(err, "parsing id into uuid")
+		}
+		filter.ID = uuid
+	}
+	name, nameOK := args["name"].(string)
+	if nameOK {
+		filter.Name = name
+	}
+	surname, surnameOK := args["surname"].(string)
+	if surnameOK {
+		filter.Surname = surname
+	}
+	patronymic, patronymicOK := args["patronymic"].(string)
+	if patronymicOK {
+		filter.Patronymic = patronymic
+	}
+	age, ageOK := args["age"].(int)
+	if ageOK {
+		filter.Age.Min = &age
+		filter.Age.Max = &age
+	}
+	ageMin, AgeMinOk := args["ageMin"].(int)
+	if AgeMinOk {
+		filter.Age.Min = &ageMin
+	}
+	ageMax, AgeMaxOk := args["ageMax"].(int)
+	if AgeMaxOk {
+		filter.Age.Max = &ageMax
+	}
+	gender, genderOK := args["gender"].(string)
+	if genderOK {
+		switch gender {
+		case "male":
+			filter.Gender = models.GenderMale
+		case "female":
+			filter.Gender = models.GenderFemale
+		}
+	}
+	nationality, nationalityOK := args["nationality"].(string)
+	if nationalityOK {
+		filter.Nationality = nationality
+	}
+	nationalityMatch, _ := args["nationalityMatch"].(string)
+	filter.NationalityMatch = models.NationalityMatch(nationalityMatch)
+	where, _ := args["where"].([]interface{})
+	filter.Conditions = conditionsFromInput(where)
+	anyOf, _ := args["anyOf"].([]interface{})
+	for _, group := range anyOf {
+		group, _ := group.([]interface{})
+		filter.AnyOf = append(filter.AnyOf, conditionsFromInput(group))
+	}
+	expression, expressionOK := args["filter"].(string)
+	if expressionOK && expression != "" {
+		expr, err := filterexpr.Parse(expression)
+		if err != nil {
+			return models.FilterConfig{}, err
+		}
+		filter.Expr = expr
+	}
+	tags, _ := args["tags"].([]interface{})
+	filter.Tags = stringsFromInput(tags)
+	attributes, _ := args["attributes"].([]interface{})
+	for key, value := range attributesFromInput(attributes) {
+		if filter.Attributes == nil {
+			filter.Attributes = map[string]string{}
+		}
+		filter.Attributes[key] = ""
+		if value != nil {
+			filter.Attributes[key] = *value
+		}
+	}
+	return filter, nil
+}
+
+// conditionsFromInput returns conditions, described by list of conditionInputType values.
+func conditionsFromInput(input []interface{}) []models.Condition {
+	conditions := make([]models.Condition, 0, len(input))
+	for _, item := range input {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		condition := models.Condition{}
+		condition.Field, _ = fields["field"].(string)
+		op, _ := fields["op"].(string)
+		condition.Op = models.Operator(op)
+		values, _ := fields["values"].([]interface{})
+		for _, value := range values {
+			if value, ok := value.(string); ok {
+				condition.Values = append(condition.Values, value)
+			}
+		}
+		condition.Not, _ = fields["not"].(bool)
+		conditions = append(conditions, condition)
+	}
+	return conditions
+}
+
+// attributeInputType is an input type for a single attribute of person.
+var attributeInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "AttributeInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"key": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"value": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Attribute without value is removed by update, and matches empty value in filter",
+		},
+	},
+})
+
+// attributesFromInput returns attributes, described by list of attributeInputType values. Absent values are nil.
+func attributesFromInput(input []interface{}) map[string]*string {
+	attributes := make(map[string]*string, len(input))
+	for _, item := range input {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		key, _ := fields["key"].(string)
+		var value *string
+		if v, ok := fields["value"].(string); ok {
+			value = &v
+		}
+		attributes[key] = value
+	}
+	return attributes
+}
+
+// nationalityInputType is an input type for a single probable nationality of person.
+var nationalityInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "NationalityInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"country": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"probability": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.Float),
+		},
+	},
+})
+
+// nationalitiesFromInput returns nationalities, described by list of nationalityInputType values, in the same order.
+func nationalitiesFromInput(input []interface{}) []models.Nationality {
+	nationalities := make([]models.Nationality, 0, len(input))
+	for _, item := range input {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		nationality := models.Nationality{}
+		nationality.Country, _ = fields["country"].(string)
+		nationality.Probability, _ = fields["probability"].(float64)
+		nationalities = append(nationalities, nationality)
+	}
+	return nationalities
+}
+
+// stringsFromInput returns strings from list argument.
+func stringsFromInput(input []interface{}) []string {
+	values := make([]string, 0, len(input))
+	for _, item := range input {
+		if value, ok := item.(string); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// sortInputType is an input type for a single sort key.
+var sortInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "SortInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"field": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"desc": &graphql.InputObjectFieldConfig{
+			Type: graphql.Boolean,
+		},
+	},
+})
+
+// withPaginationArgs returns given arguments along with pagination arguments.
+func withPaginationArgs(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	args["page"] = &graphql.ArgumentConfig{
+		Type: graphql.Int,
+	}
+	args["pageSize"] = &graphql.ArgumentConfig{
+		Type: graphql.Int,
+	}
+	args["cursor"] = &graphql.ArgumentConfig{
+		Type: graphql.String,
+	}
+	args["sort"] = &graphql.ArgumentConfig{
+		Type:        graphql.NewList(sortInputType),
+		Description: "Person fields to order people by",
+	}
+	args["total"] = &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "How to count all matching people: exact or estimated",
+	}
+	return args
+}
+
+// listOptionsFromArgs returns listing options, described by arguments from withPaginationArgs.
+func listOptionsFromArgs(args map[string]interface{}) models.ListOptions {
+	opts := models.ListOptions{}
+	opts.Page, _ = args["page"].(int)
+	opts.PageSize, _ = args["pageSize"].(int)
+	opts.Cursor, _ = args["cursor"].(string)
+	total, _ := args["total"].(string)
+	opts.Total = models.TotalMode(total)
+	sort, _ := args["sort"].([]interface{})
+	for _, item := range sort {
+		key, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		field, _ := key["field"].(string)
+		desc, _ := key["desc"].(bool)
+		opts.Sort = append(opts.Sort, models.SortKey{Field: field, Desc: desc})
+	}
+	return opts
+}
+
+// withSearchArgs returns given arguments along with search query arguments.
+func withSearchArgs(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	args["q"] = &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(graphql.String),
+	}
+	args["mode"] = &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "How to match FIO: similar (default) or prefix",
+	}
+	args["fields"] = &graphql.ArgumentConfig{
+		Type:        graphql.NewList(graphql.String),
+		Description: "Fields to search in: name, surname, patronymic",
+	}
+	args["minSimilarity"] = &graphql.ArgumentConfig{
+		Type: graphql.Float,
+	}
+	return args
+}
+
+// searchQueryFromArgs returns search query, described by arguments from withSearchArgs.
+func searchQueryFromArgs(args map[string]interface{}) models.SearchQuery {
+	query := models.SearchQuery{}
+	query.Text, _ = args["q"].(string)
+	mode, _ := args["mode"].(string)
+	query.Mode = models.SearchMode(mode)
+	fields, _ := args["fields"].([]interface{})
+	for _, field := range fields {
+		if field, ok := field.(string); ok {
+			query.Fields = append(query.Fields, field)
+		}
+	}
+	query.MinSimilarity, _ = args["minSimilarity"].(float64)
+	return query
+}
+
+// withStatsArgs returns given arguments along with stats query arguments.
+func withStatsArgs(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	args["groupBy"] = &graphql.ArgumentConfig{
+		Type:        graphql.NewList(graphql.String),
+		Description: "Characteristics to group people by: gender, nationality, age",
+	}
+	args["ageBucket"] = &graphql.ArgumentConfig{
+		Type:        graphql.Int,
+		Description: "Number of years in an age bucket, 10 by default",
+	}
+	return args
+}
+
+// statsQueryFromArgs returns stats query, described by arguments from withStatsArgs.
+func statsQueryFromArgs(args map[string]interface{}) models.StatsQuery {
+	query := models.StatsQuery{}
+	groupBy, _ := args["groupBy"].([]interface{})
+	for _, group := range groupBy {
+		if group, ok := group.(string); ok {
+			query.GroupBy = append(query.GroupBy, models.StatsGroup(group))
+		}
+	}
+	query.AgeBucketSize, _ = args["ageBucket"].(int)
+	return query
+}
@@ -5,9 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
@@ -16,6 +20,9 @@ import (
 	"enrich-fio/internal/models"
 )
 
+// _apiKeyHeader is a header with API key of tenant, making the request.
+const _apiKeyHeader = "X-API-Key"
+
 // GraphQLHandler is a mess...
 type GraphQLHandler struct {
 	service *enrichfio.Service
@@ -33,15 +40,11 @@ func NewGraphQLHandler(service *enrichfio.Service, config *config.GraphQLConfig)
 // Start starts GraphQL handler.
 func (h *GraphQLHandler) Start(ctx context.Context) error {
 	logger := zap.L()
-	schema, err := h.createSchema(ctx)
+	handler, err := h.Handler()
 	if err != nil {
-		return errors.Wrap(err, "creating graphQL schema")
+		return err
 	}
-
-	http.HandleFunc("/person", func(w http.ResponseWriter, r *http.Request) {
-		result := executeQuery(r.URL.Query().Get("query"), schema)
-		json.NewEncoder(w).Encode(result)
-	})
+	http.Handle("/person", handler)
 
 	logger.Info(fmt.Sprintf("GraphQL is up and running on %s", h.config.Host))
 	http.ListenAndServe(h.config.Host, nil)
@@ -49,20 +52,139 @@ func (h *GraphQLHandler) Start(ctx context.Context) error {
 	return nil
 }
 
+// Handler returns http handler, executing GraphQL query from "query" URL parameter.
+func (h *GraphQLHandler) Handler() (http.Handler, error) {
+	schema, err := h.createSchema()
+	if err != nil {
+		return nil, errors.Wrap(err, "creating graphQL schema")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		principal, err := h.service.Authenticate(r.Header.Get(_apiKeyHeader), token)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(&graphql.Result{Errors: []gqlerrors.FormattedError{{
+				Message:    err.Error(),
+				Extensions: map[string]interface{}{"code": models.CodeOf(err)},
+			}}})
+			return
+		}
+		ctx := models.WithAudit(models.WithTenant(r.Context(), principal.Tenant), models.Audit{
+			Actor:  principal.Actor,
+			Source: models.SourceGraphQL,
+		})
+		result := executeQuery(ctx, r.URL.Query().Get("query"), schema)
+		json.NewEncoder(w).Encode(result)
+	}), nil
+}
+
 // executeQuery executes GraphQL query.
-func executeQuery(query string, schema graphql.Schema) *graphql.Result {
+// Every error gets "code" extension, the same as code of REST error responses.
+func executeQuery(ctx context.Context, query string, schema graphql.Schema) *graphql.Result {
 	result := graphql.Do(graphql.Params{
 		Schema:        schema,
 		RequestString: query,
+		Context:       ctx,
 	})
+	for i, err := range result.Errors {
+		result.Errors[i].Extensions = map[string]interface{}{"code": errorCode(err)}
+	}
 	if len(result.Errors) > 0 {
 		fmt.Printf("errors: %v", result.Errors)
 	}
 	return result
 }
 
+// errorCode returns code of GraphQL error. Errors in query itself, rather than returned by resolvers, are invalid.
+func errorCode(err gqlerrors.FormattedError) models.ErrorCode {
+	located, ok := err.OriginalError().(*gqlerrors.Error)
+	if !ok || located.OriginalError == nil {
+		return models.CodeValidation
+	}
+	return models.CodeOf(located.OriginalError)
+}
+
+// invalid returns err, marked as caused by malformed arguments.
+func invalid(err error) error {
+	return models.WithCode(models.CodeValidation, err)
+}
+
+// clearField makes changes clear given field of person. GraphQL arguments can't be null, so cleared fields are listed instead.
+func clearField(changes *models.ChangeConfig, field string) error {
+	var set bool
+	switch field {
+	case "name":
+		set, changes.Name = changes.Name.Present(), models.Null[string]()
+	case "surname":
+		set, changes.Surname = changes.Surname.Present(), models.Null[string]()
+	case "patronymic":
+		set, changes.Patronymic = changes.Patronymic.Present(), models.Null[string]()
+	case "age":
+		set, changes.Age = changes.Age.Present(), models.Null[int]()
+	case "gender":
+		set, changes.Gender = changes.Gender.Present(), models.Null[models.Gender]()
+	case "nationality":
+		set, changes.Nationality = changes.Nationality.Present(), models.Null[string]()
+	case "nationalities":
+		set, changes.Nationalities = changes.Nationalities.Present(), models.Null[[]models.Nationality]()
+	case "attributes":
+		set, changes.Attributes = changes.Attributes.Present(), models.Null[map[string]*string]()
+	case "tags":
+		set, changes.Tags = changes.Tags.Present(), models.Null[[]string]()
+	default:
+		return errors.Errorf("unknown field %q to clear", field)
+	}
+	if set {
+		return errors.Errorf("field %q is both set and cleared", field)
+	}
+	return nil
+}
+
+// attributeList returns attributes of person as a list of key-value objects, ordered by key.
+// GraphQL has no maps, so attributes can't be an object.
+func attributeList(attributes map[string]string) []map[string]string {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	list := make([]map[string]string, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, map[string]string{"key": key, "value": attributes[key]})
+	}
+	return list
+}
+
 // createSchema creates GraphQL schema.
-func (h *GraphQLHandler) createSchema(ctx context.Context) (graphql.Schema, error) {
+func (h *GraphQLHandler) createSchema() (graphql.Schema, error) {
+	var attributeType = graphql.NewObject(
+		graphql.ObjectConfig{
+			Name: "Attribute",
+			Fields: graphql.Fields{
+				"key": &graphql.Field{
+					Type: graphql.String,
+				},
+				"value": &graphql.Field{
+					Type: graphql.String,
+				},
+			},
+		},
+	)
+
+	var nationalityType = graphql.NewObject(
+		graphql.ObjectConfig{
+			Name: "Nationality",
+			Fields: graphql.Fields{
+				"country": &graphql.Field{
+					Type: graphql.String,
+				},
+				"probability": &graphql.Field{
+					Type: graphql.Float,
+				},
+			},
+		},
+	)
+
 	var personType = graphql.NewObject(
 		graphql.ObjectConfig{
 			Name: "Person",
@@ -86,8 +208,160 @@ func (h *GraphQLHandler) createSchema(ctx context.Context) (graphql.Schema, erro
 					Type: graphql.String,
 				},
 				"nationality": &graphql.Field{
+					Type:        graphql.String,
+					Description: "The most probable nationality of person",
+				},
+				"nationalities": &graphql.Field{
+					Type:        graphql.NewList(nationalityType),
+					Description: "Probable nationalities of person, the most probable first",
+				},
+				"attributes": &graphql.Field{
+					Type: graphql.NewList(attributeType),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						person, ok := p.Source.(models.Person)
+						if !ok {
+							return nil, nil
+						}
+						return attributeList(person.Attributes), nil
+					},
+				},
+				"tags": &graphql.Field{
+					Type: graphql.NewList(graphql.String),
+				},
+				"version": &graphql.Field{
+					Type: graphql.Int,
+				},
+			},
+		},
+	)
+
+	var revisionType = graphql.NewObject(
+		graphql.ObjectConfig{
+			Name: "Revision",
+			Fields: graphql.Fields{
+				"personId": &graphql.Field{
 					Type: graphql.String,
 				},
+				"revision": &graphql.Field{
+					Type: graphql.Int,
+				},
+				"operation": &graphql.Field{
+					Type: graphql.String,
+				},
+				"oldValue": &graphql.Field{
+					Type: personType,
+				},
+				"newValue": &graphql.Field{
+					Type: personType,
+				},
+				"actor": &graphql.Field{
+					Type: graphql.String,
+				},
+				"source": &graphql.Field{
+					Type: graphql.String,
+				},
+				"changedAt": &graphql.Field{
+					Type: graphql.DateTime,
+				},
+			},
+		},
+	)
+
+	/* Get person's history
+	   http://localhost:4000/person?query={person(id:"id"){name, history{revision, operation, changedAt}}}
+	*/
+	personType.AddFieldConfig("history", &graphql.Field{
+		Type:        graphql.NewList(revisionType),
+		Description: "All recorded revisions of person, oldest first",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			person, ok := p.Source.(models.Person)
+			if !ok {
+				return nil, nil
+			}
+			revisions, err := h.service.History(p.Context, person.ID)
+			if err != nil {
+				return nil, errors.Wrap(err, "get history")
+			}
+			return revisions, nil
+		},
+	})
+
+	var peoplePageType = graphql.NewObject(
+		graphql.ObjectConfig{
+			Name: "PeoplePage",
+			Fields: graphql.Fields{
+				"people": &graphql.Field{
+					Type: graphql.NewList(personType),
+				},
+				"nextCursor": &graphql.Field{
+					Type: graphql.String,
+				},
+				"prevCursor": &graphql.Field{
+					Type: graphql.String,
+				},
+				"page": &graphql.Field{
+					Type: graphql.Int,
+				},
+				"pageSize": &graphql.Field{
+					Type: graphql.Int,
+				},
+				"hasMore": &graphql.Field{
+					Type: graphql.Boolean,
+				},
+				"total": &graphql.Field{
+					Type:        graphql.Int,
+					Description: "Number of all people, matching the filter. Null unless requested with total argument",
+				},
+				"totalEstimated": &graphql.Field{
+					Type: graphql.Boolean,
+				},
+			},
+		},
+	)
+
+	var searchResultType = graphql.NewObject(
+		graphql.ObjectConfig{
+			Name: "SearchResult",
+			Fields: graphql.Fields{
+				"person": &graphql.Field{
+					Type: personType,
+				},
+				"score": &graphql.Field{
+					Type: graphql.Float,
+				},
+			},
+		},
+	)
+
+	var statsRowType = graphql.NewObject(
+		graphql.ObjectConfig{
+			Name: "StatsRow",
+			Fields: graphql.Fields{
+				"gender": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						row, ok := p.Source.(models.StatsRow)
+						if !ok || row.Gender == nil {
+							return nil, nil
+						}
+						return string(*row.Gender), nil
+					},
+				},
+				"nationality": &graphql.Field{
+					Type: graphql.String,
+				},
+				"ageFrom": &graphql.Field{
+					Type: graphql.Int,
+				},
+				"ageTo": &graphql.Field{
+					Type: graphql.Int,
+				},
+				"count": &graphql.Field{
+					Type: graphql.Int,
+				},
+				"averageAge": &graphql.Field{
+					Type: graphql.Float,
+				},
 			},
 		},
 	)
@@ -112,9 +386,9 @@ func (h *GraphQLHandler) createSchema(ctx context.Context) (graphql.Schema, erro
 						if ok {
 							uuid, err := uuid.Parse(id)
 							if err != nil {
-								return models.Person{}, errors.Wrap(err, "parsing id into uuid")
+								return models.Person{}, invalid(errors.Wrap(err, "parsing id into uuid"))
 							}
-							person, err := h.service.Storage.GetByID(ctx, uuid)
+							person, err := h.service.Storage.GetByID(p.Context, uuid)
 							if err != nil {
 								return models.Person{}, errors.Wrap(err, "get person by id")
 							}
@@ -123,119 +397,131 @@ func (h *GraphQLHandler) createSchema(ctx context.Context) (graphql.Schema, erro
 						return nil, nil
 					},
 				},
+				/* Get (read) single person by id as it was at given moment
+				   http://localhost:4000/person?query={personAsOf(id:"id",at:"2023-10-01T00:00:00Z"){name, age}}
+				*/
+				"personAsOf": &graphql.Field{
+					Type:        personType,
+					Description: "Get person by id as it was at given moment",
+					Args: graphql.FieldConfigArgument{
+						"id": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(graphql.String),
+						},
+						"at": &graphql.ArgumentConfig{
+							Type: graphql.NewNonNull(graphql.DateTime),
+						},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						id, err := uuid.Parse(p.Args["id"].(string))
+						if err != nil {
+							return nil, invalid(errors.Wrap(err, "parsing id into uuid"))
+						}
+						at, ok := p.Args["at"].(time.Time)
+						if !ok {
+							return nil, invalid(errors.New("at must be a RFC3339 timestamp"))
+						}
+						person, err := h.service.PersonAsOf(p.Context, id, at)
+						if err != nil {
+							return nil, errors.Wrap(err, "get person as of")
+						}
+						return person, nil
+					},
+				},
 				/* Get (read) person list
 				http://localhost:4000/person?query={list(page:page){id,name,surname, patronymic, age}}
 				*/
 				"list": &graphql.Field{
 					Type:        graphql.NewList(personType),
 					Description: "Get All people",
-					Args: graphql.FieldConfigArgument{
-						"page": &graphql.ArgumentConfig{
-							Type: graphql.Int,
-						},
-					},
+					Args:        withPaginationArgs(graphql.FieldConfigArgument{}),
 					Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-						page := params.Args["page"].(int)
-						people, err := h.service.Storage.GetWithFilter(ctx, models.FilterConfig{}, page)
+						people, err := h.service.Storage.GetWithFilter(params.Context, models.FilterConfig{}, listOptionsFromArgs(params.Args))
 						if err != nil {
 							return models.Person{}, errors.Wrap(err, "GetWithFilter")
 						}
-						return people, nil
+						return people.People, nil
 					},
 				},
 				/* Get (read) person list with filter
 				   http://localhost:4000/person?query={filter{page, name,gender, ageMin, ageMax}{id, age}}
+				   http://localhost:4000/person?query={filter(where:[{field:"nationality",op:"in",values:["RU","UA"]},{field:"age",op:"gte",values:["30"]}]){id, age}}
+				   http://localhost:4000/person?query={filter(nationality:"KZ",nationalityMatch:"any"){id, nationalities{country, probability}}}
 				*/
-				// Library doesn't support operators, I don't have time to rewrite or think of anything, so age filter is ugly.
 				"filter": &graphql.Field{
 					Type:        graphql.NewList(personType),
 					Description: "Get people, that match the given filter",
-					Args: graphql.FieldConfigArgument{
-						"id": &graphql.ArgumentConfig{
-							Type: graphql.String,
-						},
-						"name": &graphql.ArgumentConfig{
-							Type: graphql.String,
-						},
-						"surname": &graphql.ArgumentConfig{
-							Type: graphql.String,
-						},
-						"patronymic": &graphql.ArgumentConfig{
-							Type: graphql.String,
-						},
-						"age": &graphql.ArgumentConfig{
-							Type: graphql.Int,
-						},
-						"ageMin": &graphql.ArgumentConfig{
-							Type: graphql.Int,
-						},
-						"ageMax": &graphql.ArgumentConfig{
-							Type: graphql.Int,
-						},
-						"gender": &graphql.ArgumentConfig{
-							Type: graphql.String,
-						},
-						"nationality": &graphql.ArgumentConfig{
-							Type: graphql.String,
-						},
-						"page": &graphql.ArgumentConfig{
-							Type: graphql.Int,
-						},
-					},
+					Args:        withPaginationArgs(filterArgs()),
 					Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-						page := params.Args["page"].(int)
-						filter := models.FilterConfig{}
-						id, idOK := params.Args["id"].(string)
-						if idOK {
-							uuid, err := uuid.Parse(id)
-							if err != nil {
-								return models.Person{}, errors.Wrap(err, "parsing id into uuid")
-							}
-							filter.ID = uuid
-						}
-						name, nameOK := params.Args["name"].(string)
-						if nameOK {
-							filter.Name = name
-						}
-						surname, surnameOK := params.Args["surname"].(string)
-						if surnameOK {
-							filter.Surname = surname
+						filter, err := filterFromArgs(params.Args)
+						if err != nil {
+							return models.Person{}, invalid(errors.Wrap(err, "parsing filter"))
 						}
-						patronymic, patronymicOK := params.Args["patronymic"].(string)
-						if patronymicOK {
-							filter.Patronymic = patronymic
+						people, err := h.service.Storage.GetWithFilter(params.Context, filter, listOptionsFromArgs(params.Args))
+						if err != nil {
+							return models.Person{}, errors.Wrap(err, "GetWithFilter")
 						}
-						age, ageOK := params.Args["age"].(int)
-						if ageOK {
-							filter.Age.Min = age
-							filter.Age.Max = age
+						return people.People, nil
+					},
+				},
+				/* Get (read) page of people, that match the given filter, with cursors to neighbouring pages
+				   http://localhost:4000/person?query={people(pageSize:20,cursor:"cursor",gender:"male"){people{id,name},nextCursor,prevCursor}}
+				   http://localhost:4000/person?query={people(total:"exact"){people{id,name},total,hasMore}}
+				   http://localhost:4000/person?query={people(sort:[{field:"age",desc:true},{field:"surname"}]){people{id,name,age}}}
+				*/
+				"people": &graphql.Field{
+					Type:        peoplePageType,
+					Description: "Get page of people, that match the given filter",
+					Args:        withPaginationArgs(filterArgs()),
+					Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+						filter, err := filterFromArgs(params.Args)
+						if err != nil {
+							return nil, invalid(errors.Wrap(err, "parsing filter"))
 						}
-						ageMin, AgeMinOk := params.Args["ageMin"].(int)
-						if AgeMinOk {
-							filter.Age.Min = ageMin
+						people, err := h.service.Storage.GetWithFilter(params.Context, filter, listOptionsFromArgs(params.Args))
+						if err != nil {
+							return nil, errors.Wrap(err, "GetWithFilter")
 						}
-						ageMax, AgeMaxOk := params.Args["ageMax"].(int)
-						if AgeMaxOk {
-							filter.Age.Max = ageMax
+						return people, nil
+					},
+				},
+				/* Search people by FIO, the best matches first
+				   http://localhost:4000/person?query={search(q:"Ivan"){score,person{id,name,surname}}}
+				   http://localhost:4000/person?query={search(q:"Iva",mode:"prefix",fields:["name"],gender:"male"){score,person{id,name}}}
+				*/
+				"search": &graphql.Field{
+					Type:        graphql.NewList(searchResultType),
+					Description: "Search people, that match the given filter, by FIO",
+					Args:        withSearchArgs(withPaginationArgs(filterArgs())),
+					Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+						filter, err := filterFromArgs(params.Args)
+						if err != nil {
+							return nil, invalid(errors.Wrap(err, "parsing filter"))
 						}
-						gender, genderOK := params.Args["gender"].(string)
-						if genderOK {
-							switch gender {
-							case "male":
-								filter.Gender = models.GenderMale
-							case "female":
-								filter.Gender = models.GenderFemale
-							}
+						results, err := h.service.Storage.Search(params.Context, searchQueryFromArgs(params.Args), filter, listOptionsFromArgs(params.Args))
+						if err != nil {
+							return nil, errors.Wrap(err, "search")
 						}
-						nationality, nationalityOK := params.Args["nationality"].(string)
-						if nationalityOK {
-							filter.Nationality = nationality
+						return results.Results, nil
+					},
+				},
+				/* Get statistics over people, that match the given filter, the largest groups first
+				   http://localhost:4000/person?query={stats(groupBy:["nationality"]){nationality,count,averageAge}}
+				   http://localhost:4000/person?query={stats(groupBy:["gender","age"],ageBucket:5,nationality:"RU"){gender,ageFrom,ageTo,count}}
+				*/
+				"stats": &graphql.Field{
+					Type:        graphql.NewList(statsRowType),
+					Description: "Get statistics over people, that match the given filter",
+					Args:        withStatsArgs(filterArgs()),
+					Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+						filter, err := filterFromArgs(params.Args)
+						if err != nil {
+							return nil, invalid(errors.Wrap(err, "parsing filter"))
 						}
-						people, err := h.service.Storage.GetWithFilter(ctx, filter, page)
+						stats, err := h.service.Stats(params.Context, filter, statsQueryFromArgs(params.Args))
 						if err != nil {
-							return models.Person{}, errors.Wrap(err, "GetWithFilter")
+							return nil, errors.Wrap(err, "stats")
 						}
-						return people, nil
+						return stats.Rows, nil
 					},
 				},
 			},
@@ -246,6 +532,7 @@ func (h *GraphQLHandler) createSchema(ctx context.Context) (graphql.Schema, erro
 		Fields: graphql.Fields{
 			/* Create new person
 			http://localhost:4000/person?query=mutation{create(name:"Name",surname:"Surname",patronymic:"Patronymic"){name,surname,patronymic}}
+			http://localhost:4000/person?query=mutation{create(name:"Name",surname:"Surname",tags:["vip"],attributes:[{key:"source",value:"crm"}]){name,tags}}
 			*/
 			"create": &graphql.Field{
 				Type:        personType,
@@ -260,20 +547,47 @@ func (h *GraphQLHandler) createSchema(ctx context.Context) (graphql.Schema, erro
 					"patronymic": &graphql.ArgumentConfig{
 						Type: graphql.String,
 					},
+					"attributes": &graphql.ArgumentConfig{
+						Type: graphql.NewList(attributeInputType),
+					},
+					"tags": &graphql.ArgumentConfig{
+						Type: graphql.NewList(graphql.NewNonNull(graphql.String)),
+					},
 				},
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-					err := h.service.AddPerson(ctx, params.Args["name"].(string),
-						params.Args["surname"].(string), params.Args["patronymic"].(string))
+					attributesInput, _ := params.Args["attributes"].([]interface{})
+					var attributes map[string]string
+					for key, value := range attributesFromInput(attributesInput) {
+						if attributes == nil {
+							attributes = map[string]string{}
+						}
+						if value == nil {
+							return models.Person{}, invalid(errors.Errorf("attribute %q has no value", key))
+						}
+						attributes[key] = *value
+					}
+					tagsInput, _ := params.Args["tags"].([]interface{})
+					var tags []string
+					if len(tagsInput) != 0 {
+						tags = stringsFromInput(tagsInput)
+					}
+					err := h.service.AddPerson(params.Context, params.Args["name"].(string),
+						params.Args["surname"].(string), params.Args["patronymic"].(string), attributes, tags)
 					if err != nil {
 						return models.Person{}, errors.Wrap(err, "add person to storage")
 					}
 					return models.Person{Name: params.Args["name"].(string),
-						Surname: params.Args["surname"].(string), Patronymic: params.Args["patronymic"].(string)}, nil
+						Surname: params.Args["surname"].(string), Patronymic: params.Args["patronymic"].(string),
+						Attributes: attributes, Tags: tags}, nil
 				},
 			},
 
 			/* Update person by id
 			http://localhost:4000/person?query=mutation{update(id:"id",age:69){id,age}}
+			http://localhost:4000/person?query=mutation{update(id:"id",age:69,expectedVersion:3){id,age}}
+			http://localhost:4000/person?query=mutation{update(id:"id",clear:["patronymic","age"]){id,patronymic,age}}
+			http://localhost:4000/person?query=mutation{update(id:"id",nationalities:[{country:"KZ",probability:0.6},{country:"RU",probability:0.3}]){id,nationality}}
+			http://localhost:4000/person?query=mutation{update(id:"id",attributes:[{key:"source",value:"crm"},{key:"region"}],tags:["vip"]){id,attributes{key,value},tags}}
 			*/
 			"update": &graphql.Field{
 				Type:        personType,
@@ -303,56 +617,150 @@ func (h *GraphQLHandler) createSchema(ctx context.Context) (graphql.Schema, erro
 					"nationality": &graphql.ArgumentConfig{
 						Type: graphql.String,
 					},
+					"nationalities": &graphql.ArgumentConfig{
+						Type:        graphql.NewList(nationalityInputType),
+						Description: "Nationalities to replace person's ones with, the most probable first. The first becomes nationality",
+					},
+					"attributes": &graphql.ArgumentConfig{
+						Type:        graphql.NewList(attributeInputType),
+						Description: "Attributes to merge into person's ones. Attribute without value is removed",
+					},
+					"tags": &graphql.ArgumentConfig{
+						Type:        graphql.NewList(graphql.NewNonNull(graphql.String)),
+						Description: "Tags to replace person's ones with",
+					},
+					"clear": &graphql.ArgumentConfig{
+						Type:        graphql.NewList(graphql.NewNonNull(graphql.String)),
+						Description: "Fields to clear, like patronymic, age or tags",
+					},
+					"expectedVersion": &graphql.ArgumentConfig{
+						Type:        graphql.Int,
+						Description: "Version person must have for changes to be applied",
+					},
 				},
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
 					id, _ := params.Args["id"].(string)
 					currentUUID, err := uuid.Parse(id)
 					if err != nil {
-						return models.Person{}, errors.Wrap(err, "parsing id into uuid")
+						return models.Person{}, invalid(errors.Wrap(err, "parsing id into uuid"))
 					}
 					changes := models.ChangeConfig{}
 					newID, newIDOk := params.Args["newID"].(string)
 					if newIDOk {
 						newUUID, err := uuid.Parse(newID)
 						if err != nil {
-							return models.Person{}, errors.Wrap(err, "parsing newID into newUUID")
+							return models.Person{}, invalid(errors.Wrap(err, "parsing newID into newUUID"))
 						}
-						changes.ID = newUUID
+						changes.ID = models.Some(newUUID)
 					}
 					name, nameOk := params.Args["name"].(string)
 					if nameOk {
-						changes.Name = name
+						changes.Name = models.Some(name)
 					}
 					surname, surnameOk := params.Args["surname"].(string)
 					if surnameOk {
-						changes.Surname = surname
+						changes.Surname = models.Some(surname)
 					}
 					patronymic, patronymicOk := params.Args["patronymic"].(string)
 					if patronymicOk {
-						changes.Patronymic = patronymic
+						changes.Patronymic = models.Some(patronymic)
 					}
 					age, ageOk := params.Args["age"].(int)
 					if ageOk {
-						changes.Age = age
+						changes.Age = models.Some(age)
 					}
 					gender, genderOk := params.Args["gender"].(string)
 					if genderOk {
 						switch gender {
 						case "male":
-							changes.Gender = models.GenderMale
+							changes.Gender = models.Some(models.GenderMale)
 						case "female":
-							changes.Gender = models.GenderFemale
+							changes.Gender = models.Some(models.GenderFemale)
 						}
 					}
 					nationality, nationalityOk := params.Args["nationality"].(string)
 					if nationalityOk {
-						changes.Nationality = nationality
+						changes.Nationality = models.Some(nationality)
+					}
+					nationalities, nationalitiesOk := params.Args["nationalities"].([]interface{})
+					if nationalitiesOk {
+						changes.Nationalities = models.Some(nationalitiesFromInput(nationalities))
+					}
+					attributes, attributesOk := params.Args["attributes"].([]interface{})
+					if attributesOk {
+						changes.Attributes = models.Some(attributesFromInput(attributes))
 					}
-					err = h.service.Storage.ChangeByID(ctx, currentUUID, changes)
+					tags, tagsOk := params.Args["tags"].([]interface{})
+					if tagsOk {
+						changes.Tags = models.Some(stringsFromInput(tags))
+					}
+					expectedVersion, expectedVersionOk := params.Args["expectedVersion"].(int)
+					if expectedVersionOk {
+						changes.ExpectedVersion = int64(expectedVersion)
+					}
+					clear, _ := params.Args["clear"].([]interface{})
+					for _, field := range clear {
+						err = clearField(&changes, field.(string))
+						if err != nil {
+							return models.Person{}, invalid(err)
+						}
+					}
+					person, err := h.service.ChangePerson(params.Context, currentUUID, changes)
 					if err != nil {
 						return models.Person{}, errors.Wrap(err, "changing person by id")
 					}
-					return changes, nil
+					return person, nil
+				},
+			},
+
+			/* Revert person by id to the given revision
+			http://localhost:4000/person?query=mutation{revert(id:"id",revision:2){id,name,age}}
+			*/
+			"revert": &graphql.Field{
+				Type:        personType,
+				Description: "Revert person by id to the given revision",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"revision": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.Int),
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					id, err := uuid.Parse(params.Args["id"].(string))
+					if err != nil {
+						return models.Person{}, invalid(errors.Wrap(err, "parsing id into uuid"))
+					}
+					person, err := h.service.RevertPerson(params.Context, id, params.Args["revision"].(int))
+					if err != nil {
+						return models.Person{}, errors.Wrap(err, "reverting person")
+					}
+					return person, nil
+				},
+			},
+
+			/* Enrich already stored person by id once again
+			http://localhost:4000/person?query=mutation{enrich(id:"id"){id,age,gender,nationality}}
+			*/
+			"enrich": &graphql.Field{
+				Type:        personType,
+				Description: "Enrich already stored person by id once again",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					id, err := uuid.Parse(params.Args["id"].(string))
+					if err != nil {
+						return models.Person{}, invalid(errors.Wrap(err, "parsing id into uuid"))
+					}
+					person, err := h.service.EnrichPerson(params.Context, id)
+					if err != nil {
+						return models.Person{}, errors.Wrap(err, "enriching person")
+					}
+					return person, nil
 				},
 			},
 
@@ -371,9 +779,9 @@ func (h *GraphQLHandler) createSchema(ctx context.Context) (graphql.Schema, erro
 					id, _ := params.Args["id"].(string)
 					uuid, err := uuid.Parse(id)
 					if err != nil {
-						return models.Person{}, errors.Wrap(err, "parsing id into uuid")
+						return models.Person{}, invalid(errors.Wrap(err, "parsing id into uuid"))
 					}
-					err = h.service.Storage.DeleteByID(ctx, uuid)
+					err = h.service.Storage.DeleteByID(params.Context, uuid)
 					if err != nil {
 						return models.Person{}, errors.Wrap(err, "deleting person by id")
 					}
@@ -0,0 +1,126 @@
+package graphql_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"enrich-fio/internal/config"
+	graphql "enrich-fio/internal/controllers/graphQL"
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/enrich-fio/storage/memory"
+	"enrich-fio/internal/models"
+)
+
+// provider enriches every person the same way.
+type provider struct{}
+
+func (provider) Get(ctx context.Context, name string, surname string, patronymic string) (int, error) {
+	return 30, nil
+}
+
+// genderProvider enriches every person as male.
+type genderProvider struct{}
+
+func (genderProvider) Get(ctx context.Context, name string, surname string, patronymic string) (models.Gender, error) {
+	return models.GenderMale, nil
+}
+
+// nationalityProvider enriches every person as russian.
+type nationalityProvider struct{}
+
+func (nationalityProvider) Get(ctx context.Context, name string, surname string, patronymic string) ([]models.Nationality, error) {
+	return []models.Nationality{{Country: "RU", Probability: 0.9}}, nil
+}
+
+// response is a response to GraphQL query.
+type response struct {
+	Data   map[string]models.Person `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+func newHandler(t *testing.T) (http.Handler, *enrichfio.Service) {
+	service := enrichfio.New(memory.New(&config.DBConfig{DefaultPageSize: 5, MaxPageSize: 100}), provider{},
+		genderProvider{}, nationalityProvider{})
+	handler, err := graphql.NewGraphQLHandler(service, &config.GraphQLConfig{}).Handler()
+	if err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	return handler, service
+}
+
+func execute(t *testing.T, handler http.Handler, query string) response {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/person?query="+url.QueryEscape(query), nil))
+	result := response{}
+	err := json.Unmarshal(recorder.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatalf("unmarshal %s: %v", recorder.Body, err)
+	}
+	return result
+}
+
+func TestCreate(t *testing.T) {
+	handler, service := newHandler(t)
+
+	result := execute(t, handler,
+		`mutation{create(name:"Ivan",surname:"Ivanov",patronymic:"Ivanovich",tags:["vip"]){name,surname,patronymic,tags}}`)
+	if len(result.Errors) != 0 {
+		t.Fatalf("got errors %+v", result.Errors)
+	}
+	created := result.Data["create"]
+	if created.Name != "Ivan" || created.Surname != "Ivanov" || created.Patronymic != "Ivanovich" ||
+		len(created.Tags) != 1 || created.Tags[0] != "vip" {
+		t.Fatalf("got created %+v", created)
+	}
+	count, err := service.Storage.CountPeople(context.Background())
+	if err != nil || count != 1 {
+		t.Fatalf("got %d people stored and error %v, want 1", count, err)
+	}
+
+	result = execute(t, handler, `mutation{create(name:"Ivan",surname:"Ivanov",patronymic:"",tags:[""]){name}}`)
+	if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != string(models.CodeValidation) {
+		t.Fatalf("got errors %+v creating person with empty tag, want %s", result.Errors, models.CodeValidation)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	handler, service := newHandler(t)
+	person := models.Person{ID: uuid.New(), Name: "Ivan", Surname: "Ivanov", Age: 30}
+	err := service.Storage.Save(context.Background(), person)
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	stored, err := service.Storage.GetByID(context.Background(), person.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+
+	result := execute(t, handler, fmt.Sprintf(`mutation{update(id:"%s",age:40,gender:"female",expectedVersion:%d){id,age,gender,version}}`,
+		person.ID, stored.Version))
+	if len(result.Errors) != 0 {
+		t.Fatalf("got errors %+v", result.Errors)
+	}
+	updated := result.Data["update"]
+	if updated.ID != person.ID || updated.Age != 40 || updated.Gender != models.GenderFemale || updated.Version <= stored.Version {
+		t.Fatalf("got updated %+v, want age 40, female and version after %d", updated, stored.Version)
+	}
+
+	result = execute(t, handler, fmt.Sprintf(`mutation{update(id:"%s",age:50,expectedVersion:%d){age}}`, person.ID, stored.Version))
+	if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != string(models.CodeConflict) {
+		t.Fatalf("got errors %+v updating with stale version, want %s", result.Errors, models.CodeConflict)
+	}
+	result = execute(t, handler, `mutation{update(id:"not-uuid",age:50){age}}`)
+	if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != string(models.CodeValidation) {
+		t.Fatalf("got errors %+v updating person with invalid id, want %s", result.Errors, models.CodeValidation)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"enrich-fio/internal/config"
 	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/models"
 	"fmt"
+	"time"
 
 	"github.com/pkg/errors"
 	kafkago "github.com/segmentio/kafka-go"
@@ -18,6 +20,23 @@ const (
 	_topicFailed = "FIO_FAILED"
 )
 
+const (
+	// _actorHeader is a message header, identifying who sent the message.
+	_actorHeader = "actor"
+	// _tenantHeader is a message header with ID of tenant, the message is sent by.
+	// Messages without it are sent by the default tenant.
+	_tenantHeader = "tenant"
+)
+
+const (
+	// _batchSize is the largest number of people saved at once.
+	_batchSize = 500
+	// _batchInterval is the longest time valid message waits for its batch to be saved.
+	_batchInterval = time.Second
+	// _retryMax is the longest pause before messages, which could not be processed, are retried.
+	_retryMax = time.Minute
+)
+
 // kafkaHandler is a kafka handler.
 type KafkaHandler struct {
 	reader  *Reader
@@ -36,11 +55,22 @@ func NewHandler(service *enrichfio.Service, config *config.KafkaConfig) *KafkaHa
 	}
 }
 
+// Close closes connections of handler to kafka.
+func (h *KafkaHandler) Close() error {
+	err := h.reader.Reader.Close()
+	if err != nil {
+		return errors.Wrap(err, "close reader")
+	}
+	return errors.Wrap(h.writer.Writer.Close(), "close writer")
+}
+
 // request is expected request from kafka.
 type request struct {
-	Name       string `json:"name"`
-	Surname    string `json:"surname"`
-	Patronymic string `json:"patronymic"`
+	Name       string            `json:"name"`
+	Surname    string            `json:"surname"`
+	Patronymic string            `json:"patronymic"`
+	Attributes map[string]string `json:"attributes"`
+	Tags       []string          `json:"tags"`
 }
 
 // Start starts kafka handler.
@@ -63,7 +93,7 @@ func (h *KafkaHandler) Start(ctx context.Context) error {
 	})
 
 	g.Go(func() error {
-		return h.fetchValidMessage(ctx, messages)
+		return h.fetchValidMessage(ctx, messages, invalidMessages, messageCommitChan)
 	})
 
 	err := g.Wait()
@@ -78,43 +108,208 @@ func validMessage(msg *kafkago.Message) bool {
 	person := request{}
 	err := json.Unmarshal(msg.Value, &person)
 	if err != nil {
-		msg.WriterData = fmt.Sprintf("Invalid request: %v\nInvalid format\nError: %v", string(msg.Value), err.Error())
+		msg.WriterData = fmt.Sprintf("Invalid request: %v\nReason: %s\nInvalid format\nError: %v",
+			string(msg.Value), models.CodeValidation, err.Error())
 		return false
 
 	}
 	if person.Name == "" {
-		msg.WriterData = fmt.Sprintf("Invalid request: %v\nName required", string(msg.Value))
+		msg.WriterData = fmt.Sprintf("Invalid request: %v\nReason: %s\nName required", string(msg.Value), models.CodeValidation)
 		return false
 	}
 	if person.Surname == "" {
-		msg.WriterData = fmt.Sprintf("Invalid request: %v\nSurname required", string(msg.Value))
+		msg.WriterData = fmt.Sprintf("Invalid request: %v\nReason: %s\nSurname required", string(msg.Value), models.CodeValidation)
+		return false
 	}
 	return true
 }
 
-// fetchValidMessage fetches valid message.
-func (h *KafkaHandler) fetchValidMessage(ctx context.Context, messageChan <-chan kafkago.Message) error {
+// fetchValidMessage fetches valid messages and adds people from them in batches.
+// Batch is added, when it's full or when _batchInterval passes.
+func (h *KafkaHandler) fetchValidMessage(ctx context.Context, messageChan <-chan kafkago.Message,
+	invalidMessages chan<- kafkago.Message, messageCommitChan chan<- kafkago.Message) error {
+	ticker := time.NewTicker(_batchInterval)
+	defer ticker.Stop()
+	batch := make([]kafkago.Message, 0, _batchSize)
 	for {
 		select {
+		case <-ctx.Done():
+			return ctx.Err()
 		case message := <-messageChan:
-			err := h.AddPerson(ctx, message)
+			batch = append(batch, message)
+			if len(batch) < _batchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		err := h.addBatch(ctx, batch, invalidMessages, messageCommitChan)
+		if err != nil {
+			return errors.Wrap(err, "fetch valid message")
+		}
+		batch = batch[:0]
+	}
+}
+
+// addBatch adds people from given messages. Messages, which could not be processed for a reason, which may go away,
+// are retried with growing pauses, so unavailable enrichment APIs or storage only hold ingestion back.
+// Messages are not committed till they are processed. Returns error only if ctx is done, or batch can't be processed at all.
+func (h *KafkaHandler) addBatch(ctx context.Context, msgs []kafkago.Message,
+	invalidMessages chan<- kafkago.Message, messageCommitChan chan<- kafkago.Message) error {
+	retry := _retryMin
+	for {
+		rest, err := h.AddPeople(ctx, msgs, invalidMessages, messageCommitChan)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || len(rest) == 0 {
+			return err
+		}
+		zap.L().Warn(fmt.Sprintf("could not add people from %d messages, retrying in %s. Err: %v", len(rest), retry, err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retry):
+		}
+		retry = min(retry*2, _retryMax)
+		msgs = rest
+	}
+}
+
+// sender is who sent a message.
+type sender struct {
+	tenant string
+	actor  string
+}
+
+// AddPeople enriches people from given messages and saves them at once.
+// Messages, which person is invalid, could not be enriched, or could not be saved because of the quota, are sent
+// to invalidMessages with the reason and its error code. Messages, which person is saved, are sent to messageCommitChan.
+// If enrichment or saving fails for a reason, which may go away, people enriched before are saved, and the error is
+// returned along with messages, which are left unprocessed, in the order they came, so they can be retried.
+func (h *KafkaHandler) AddPeople(ctx context.Context, msgs []kafkago.Message,
+	invalidMessages chan<- kafkago.Message, messageCommitChan chan<- kafkago.Message) ([]kafkago.Message, error) {
+	// People of different tenants and actors are saved separately, so history tells who added whom.
+	people := map[sender][]models.Person{}
+	// enriched are indexes of messages, people of which are enriched, by their senders.
+	enriched := map[sender][]int{}
+	// senders are in order of their first messages.
+	senders := []sender{}
+	retry := make([]bool, len(msgs))
+	var retryErr error
+	for i, msg := range msgs {
+		person := request{}
+		err := json.Unmarshal(msg.Value, &person)
+		if err != nil {
+			return nil, errors.Wrap(err, "unmarshal request")
+		}
+		from := sender{tenant: headerValue(msg, _tenantHeader), actor: headerValue(msg, _actorHeader)}
+		if from.tenant == "" {
+			from.tenant = models.DefaultTenant
+		}
+		err = h.service.CheckTenant(from.tenant)
+		if err != nil {
+			msg.WriterData = fmt.Sprintf("Invalid request: %v\nReason: %s\nUnknown tenant\nError: %v",
+				string(msg.Value), models.CodeOf(err), err.Error())
+			err = send(ctx, invalidMessages, msg)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		newPerson, err := h.service.NewPerson(models.WithTenant(ctx, from.tenant), person.Name, person.Surname, person.Patronymic,
+			person.Attributes, person.Tags)
+		if err != nil && !invalidPerson(err) {
+			for j := i; j < len(msgs); j++ {
+				retry[j] = true
+			}
+			retryErr = errors.Wrap(err, "enrich person")
+			break
+		}
+		if err != nil {
+			msg.WriterData = fmt.Sprintf("Invalid request: %v\nReason: %s\nCould not enrich\nError: %v",
+				string(msg.Value), models.CodeOf(err), err.Error())
+			err = send(ctx, invalidMessages, msg)
 			if err != nil {
-				return errors.Wrap(err, "fetch valid message")
+				return nil, err
 			}
+			continue
 		}
+		if _, ok := people[from]; !ok {
+			senders = append(senders, from)
+		}
+		people[from] = append(people[from], newPerson)
+		enriched[from] = append(enriched[from], i)
 	}
+
+	for _, from := range senders {
+		senderCtx := models.WithAudit(models.WithTenant(ctx, from.tenant), models.Audit{
+			Actor:  from.actor,
+			Source: models.SourceKafka,
+		})
+		err := h.service.AddPeople(senderCtx, people[from])
+		if errors.Is(err, models.ErrQuotaExceeded) {
+			// None of the people are saved, and retrying doesn't help till tenant's quota is raised.
+			for _, i := range enriched[from] {
+				msg := msgs[i]
+				msg.WriterData = fmt.Sprintf("Invalid request: %v\nReason: %s\nCould not save\nError: %v",
+					string(msg.Value), models.CodeOf(err), err.Error())
+				err := send(ctx, invalidMessages, msg)
+				if err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if err != nil {
+			// None of the people are saved, so they are retried, while people of other senders are not held back.
+			for _, i := range enriched[from] {
+				retry[i] = true
+			}
+			retryErr = errors.Wrap(err, "add people")
+			continue
+		}
+		for _, i := range enriched[from] {
+			err = send(ctx, messageCommitChan, msgs[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var rest []kafkago.Message
+	for i, msg := range msgs {
+		if retry[i] {
+			rest = append(rest, msg)
+		}
+	}
+	return rest, retryErr
 }
 
-// AddPerson sends person to buisness logic of service.
-func (h *KafkaHandler) AddPerson(ctx context.Context, msg kafkago.Message) error {
-	person := request{}
-	err := json.Unmarshal(msg.Value, &person)
-	if err != nil {
-		return errors.Wrap(err, "unmarshal request")
+// invalidPerson tells if person could not be enriched because of the message itself, so reading it again won't help.
+func invalidPerson(err error) bool {
+	code := models.CodeOf(err)
+	return code == models.CodeValidation || code == models.CodeEnrichmentFailed
+}
+
+// send sends message to given channel, unless ctx is done first.
+func send(ctx context.Context, messages chan<- kafkago.Message, msg kafkago.Message) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case messages <- msg:
+		return nil
 	}
-	err = h.service.AddPerson(ctx, person.Name, person.Surname, person.Patronymic)
-	if err != nil {
-		return errors.Wrap(err, "add person")
+}
+
+// headerValue returns value of message header with given key, or empty string if there is no such header.
+func headerValue(msg kafkago.Message, key string) string {
+	for _, header := range msg.Headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
 	}
-	return nil
+	return ""
 }
@@ -0,0 +1,165 @@
+package kafka_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"enrich-fio/internal/config"
+	"enrich-fio/internal/controllers/kafka"
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/enrich-fio/storage/memory"
+	"enrich-fio/internal/models"
+)
+
+// provider enriches people, unless it's down or knows nothing about the name.
+type provider struct {
+	down bool
+}
+
+func (p *provider) Get(ctx context.Context, name string, surname string, patronymic string) (int, error) {
+	if p.down {
+		return 0, models.ErrUpstreamUnavailable
+	}
+	if name == "Nobody" {
+		return 0, models.ErrCouldNotEnrich
+	}
+	return 30, nil
+}
+
+// genderProvider enriches every person as male.
+type genderProvider struct{}
+
+func (genderProvider) Get(ctx context.Context, name string, surname string, patronymic string) (models.Gender, error) {
+	return models.GenderMale, nil
+}
+
+// nationalityProvider enriches every person as russian.
+type nationalityProvider struct{}
+
+func (nationalityProvider) Get(ctx context.Context, name string, surname string, patronymic string) ([]models.Nationality, error) {
+	return []models.Nationality{{Country: "RU", Probability: 0.9}}, nil
+}
+
+func newHandler(t *testing.T, age *provider) (*kafka.KafkaHandler, *enrichfio.Service) {
+	service := enrichfio.New(memory.New(&config.DBConfig{DefaultPageSize: 5, MaxPageSize: 100}), age, genderProvider{},
+		nationalityProvider{})
+	service.Tenancy = enrichfio.NewTenancy([]models.Tenant{
+		{ID: "acme", Quota: models.Quota{MaxPeople: 1}},
+		{ID: "beta"},
+	}, "", "tenant", nil)
+	handler := kafka.NewHandler(service, &config.KafkaConfig{Host: "localhost:0"})
+	t.Cleanup(func() {
+		handler.Close()
+	})
+	return handler, service
+}
+
+func message(t *testing.T, tenant string, name string) kafkago.Message {
+	value, err := json.Marshal(map[string]string{"name": name, "surname": "Ivanov", "patronymic": "Ivanovich"})
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+	return kafkago.Message{Value: value, Headers: []kafkago.Header{{Key: "tenant", Value: []byte(tenant)}}}
+}
+
+// received returns names of people from messages, sent to given channel, and their reasons, if any.
+func received(t *testing.T, messages chan kafkago.Message) map[string]string {
+	got := map[string]string{}
+	for len(messages) > 0 {
+		msg := <-messages
+		person := map[string]string{}
+		err := json.Unmarshal(msg.Value, &person)
+		if err != nil {
+			t.Fatalf("unmarshal message: %v", err)
+		}
+		reason, _ := msg.WriterData.(string)
+		got[person["name"]] = reason
+	}
+	return got
+}
+
+func TestAddPeopleDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	handler, service := newHandler(t, &provider{})
+	invalidMessages := make(chan kafkago.Message, 10)
+	messageCommitChan := make(chan kafkago.Message, 10)
+
+	rest, err := handler.AddPeople(ctx, []kafkago.Message{
+		message(t, "acme", "Anna"),
+		message(t, "beta", "Nobody"),
+		message(t, "acme", "Olga"),
+		message(t, "ghost", "Petr"),
+		message(t, "beta", "Ivan"),
+	}, invalidMessages, messageCommitChan)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("got %d messages to retry and error %v, want none", len(rest), err)
+	}
+
+	invalid := received(t, invalidMessages)
+	for name, code := range map[string]models.ErrorCode{
+		"Anna":   models.CodeQuotaExceeded,
+		"Olga":   models.CodeQuotaExceeded,
+		"Nobody": models.CodeEnrichmentFailed,
+		"Petr":   models.CodeUnauthorized,
+	} {
+		if !strings.Contains(invalid[name], "Reason: "+string(code)) {
+			t.Errorf("got dead letter %q of %s, want reason %s", invalid[name], name, code)
+		}
+	}
+	if len(invalid) != 4 {
+		t.Errorf("got dead letters of %v, want 4", invalid)
+	}
+	committed := received(t, messageCommitChan)
+	if _, ok := committed["Ivan"]; !ok || len(committed) != 1 {
+		t.Errorf("got committed messages of %v, want of Ivan", committed)
+	}
+	count, err := service.Storage.CountPeople(models.WithTenant(ctx, "acme"))
+	if err != nil || count != 0 {
+		t.Errorf("got %d people of acme and error %v, want none saved over quota", count, err)
+	}
+}
+
+func TestAddPeopleRetry(t *testing.T) {
+	ctx := context.Background()
+	age := &provider{}
+	handler, service := newHandler(t, age)
+	invalidMessages := make(chan kafkago.Message, 10)
+	messageCommitChan := make(chan kafkago.Message, 10)
+	ivan, anna, petr := message(t, "beta", "Ivan"), message(t, "beta", "Anna"), message(t, "beta", "Petr")
+
+	// Provider goes down after Ivan is enriched.
+	rest, err := handler.AddPeople(ctx, []kafkago.Message{ivan}, invalidMessages, messageCommitChan)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("got %d messages to retry and error %v, want none", len(rest), err)
+	}
+	age.down = true
+	rest, err = handler.AddPeople(ctx, []kafkago.Message{anna, petr}, invalidMessages, messageCommitChan)
+	if !errors.Is(err, models.ErrUpstreamUnavailable) {
+		t.Fatalf("got error %v, want %v", err, models.ErrUpstreamUnavailable)
+	}
+	if len(rest) != 2 || string(rest[0].Value) != string(anna.Value) || string(rest[1].Value) != string(petr.Value) {
+		t.Fatalf("got %d messages to retry, want Anna and Petr in order", len(rest))
+	}
+	if len(invalidMessages) != 0 {
+		t.Fatalf("got %v dead letters, want messages to retry kept", received(t, invalidMessages))
+	}
+
+	age.down = false
+	rest, err = handler.AddPeople(ctx, rest, invalidMessages, messageCommitChan)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("got %d messages to retry and error %v after provider is up, want none", len(rest), err)
+	}
+	committed := received(t, messageCommitChan)
+	if len(committed) != 3 {
+		t.Errorf("got committed messages of %v, want of Ivan, Anna and Petr", committed)
+	}
+	count, err := service.Storage.CountPeople(models.WithTenant(ctx, "beta"))
+	if err != nil || count != 3 {
+		t.Errorf("got %d people of beta and error %v, want 3", count, err)
+	}
+}
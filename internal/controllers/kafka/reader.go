@@ -2,6 +2,7 @@ package kafka
 
 import (
 	"context"
+	"sync"
 
 	"github.com/pkg/errors"
 	kafkago "github.com/segmentio/kafka-go"
@@ -10,6 +11,8 @@ import (
 // Reader is kafka reader implementation.
 type Reader struct {
 	Reader *kafkago.Reader
+	// offsets are offsets of fetched messages, which are not committed yet.
+	offsets *offsetTracker
 }
 
 // NewKafkaReader returns reader implementation.
@@ -21,7 +24,8 @@ func NewKafkaReader(topic string, host string) *Reader {
 	})
 
 	return &Reader{
-		Reader: reader,
+		Reader:  reader,
+		offsets: newOffsetTracker(),
 	}
 }
 
@@ -32,6 +36,7 @@ func (k *Reader) FetchMessage(ctx context.Context, invalidMessages chan<- kafkag
 		if err != nil {
 			return errors.Wrap(err, "Reader.FetchMessage")
 		}
+		k.offsets.fetched(message)
 
 		if !validMessage(&message) {
 			select {
@@ -49,12 +54,19 @@ func (k *Reader) FetchMessage(ctx context.Context, invalidMessages chan<- kafkag
 	}
 }
 
-// CommitMessages commits messages from kafka, so they wouldn't be sent again.
+// CommitMessages commits processed messages from kafka, so they wouldn't be sent again.
+// Messages are processed out of order, and committing a message commits every message before it in the partition,
+// so message is committed only once all messages, fetched before it from the same partition, are processed.
 func (k *Reader) CommitMessages(ctx context.Context, invalidMessageCommitChan <-chan kafkago.Message) error {
 	for {
 		select {
 		case <-ctx.Done():
-		case msg := <-invalidMessageCommitChan:
+			return ctx.Err()
+		case processed := <-invalidMessageCommitChan:
+			msg, ok := k.offsets.processed(processed)
+			if !ok {
+				continue
+			}
 			err := k.Reader.CommitMessages(ctx, msg)
 			if err != nil {
 				return errors.Wrap(err, "Reader.CommitMessages")
@@ -62,3 +74,51 @@ func (k *Reader) CommitMessages(ctx context.Context, invalidMessageCommitChan <-
 		}
 	}
 }
+
+// offsetTracker tracks fetched messages of each partition till they are processed.
+type offsetTracker struct {
+	mu sync.Mutex
+	// pending are fetched messages of each partition, which are not committed yet, in the order they were fetched.
+	pending map[int][]trackedMessage
+}
+
+// trackedMessage is a fetched message, which may be processed already.
+type trackedMessage struct {
+	msg  kafkago.Message
+	done bool
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{pending: map[int][]trackedMessage{}}
+}
+
+// fetched starts tracking given message. Messages must be fetched before they may be processed.
+func (t *offsetTracker) fetched(msg kafkago.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending[msg.Partition] = append(t.pending[msg.Partition], trackedMessage{msg: msg})
+}
+
+// processed marks given message processed, and returns the last message of its partition, which may be committed,
+// as it and all the messages before it are processed. Returns false if there is no such message.
+func (t *offsetTracker) processed(msg kafkago.Message) (kafkago.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pending := t.pending[msg.Partition]
+	for i := range pending {
+		if pending[i].msg.Offset == msg.Offset {
+			pending[i].done = true
+			break
+		}
+	}
+	done := 0
+	for done < len(pending) && pending[done].done {
+		done++
+	}
+	if done == 0 {
+		return kafkago.Message{}, false
+	}
+	last := pending[done-1].msg
+	t.pending[msg.Partition] = pending[done:]
+	return last, true
+}
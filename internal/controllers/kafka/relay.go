@@ -0,0 +1,145 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	kafkago "github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+
+	"enrich-fio/internal/config"
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/models"
+)
+
+const (
+	// _eventTypeHeader is a message header with type of event in message.
+	_eventTypeHeader = "type"
+	// _retryMin is the pause before the first retry to publish events.
+	_retryMin = time.Second
+	// _cleanupInterval is how often delivered events are deleted from outbox.
+	_cleanupInterval = time.Hour
+)
+
+// Relay publishes events about changes of people from outbox to kafka.
+// Events are delivered at least once, and events about the same person are kept in order.
+// Replicas share the outbox, and only the one, which holds it, publishes, while the others wait for their next poll.
+type Relay struct {
+	outbox enrichfio.Outbox
+	writer *Writer
+	config *config.OutboxConfig
+}
+
+// NewRelay returns Relay, publishing events from outbox to topic in config.
+func NewRelay(outbox enrichfio.Outbox, kafkaConfig *config.KafkaConfig, config *config.OutboxConfig) *Relay {
+	writer := NewKafkaWriter(config.Topic, kafkaConfig.Host)
+	// Events about a person have the same key, so they get to the same partition and stay in order.
+	writer.Writer.Balancer = &kafkago.Hash{}
+	// Event is marked delivered once it's written, so it must not be lost after that.
+	writer.Writer.RequiredAcks = kafkago.RequireAll
+	writer.Writer.BatchSize = config.BatchSize
+	writer.Writer.BatchTimeout = 10 * time.Millisecond
+	return &Relay{
+		outbox: outbox,
+		writer: writer,
+		config: config,
+	}
+}
+
+// Start publishes pending events, until ctx is done.
+// If publishing fails, the same events are retried with growing pauses, so no later event overtakes them.
+func (r *Relay) Start(ctx context.Context) error {
+	logger := zap.L()
+	logger.Info(fmt.Sprintf("outbox relay is publishing events to %s", r.config.Topic))
+	retry := _retryMin
+	lastCleanup := time.Time{}
+	for {
+		if time.Since(lastCleanup) >= _cleanupInterval {
+			deleted, err := r.outbox.DeleteDelivered(ctx, time.Now().Add(-r.config.Retention))
+			if err != nil {
+				logger.Warn(fmt.Sprintf("could not delete delivered events. Err: %v", err))
+			} else if deleted > 0 {
+				logger.Info(fmt.Sprintf("deleted %d delivered events from outbox", deleted))
+			}
+			lastCleanup = time.Now()
+		}
+
+		published, err := r.publishPending(ctx)
+		wait := r.config.PollInterval
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			logger.Warn(fmt.Sprintf("could not publish events, retrying in %s. Err: %v", retry, err))
+			wait = retry
+			retry = min(retry*2, r.config.RetryMax)
+		case published == r.config.BatchSize:
+			// There may be more pending events.
+			retry = _retryMin
+			continue
+		default:
+			retry = _retryMin
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// publishPending publishes a batch of pending events, marks them delivered and returns how many were published.
+// Nothing is published, if another relay holds the outbox.
+func (r *Relay) publishPending(ctx context.Context) (int, error) {
+	published := 0
+	err := r.outbox.LockOutbox(ctx, func(outbox enrichfio.Outbox) error {
+		var err error
+		published, err = r.publishBatch(ctx, outbox)
+		return err
+	})
+	if errors.Is(err, models.ErrOutboxLocked) {
+		return 0, nil
+	}
+	return published, err
+}
+
+// publishBatch publishes a batch of pending events from outbox, marks them delivered and returns how many were published.
+func (r *Relay) publishBatch(ctx context.Context, outbox enrichfio.Outbox) (int, error) {
+	events, err := outbox.PendingEvents(ctx, r.config.BatchSize)
+	if err != nil {
+		return 0, errors.Wrap(err, "get pending events")
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+	messages := make([]kafkago.Message, 0, len(events))
+	ids := make([]int64, 0, len(events))
+	for _, event := range events {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return 0, errors.Wrap(err, "marshal event")
+		}
+		messages = append(messages, kafkago.Message{
+			Key:   []byte(models.PersonKey(event.Tenant, event.PersonID)),
+			Value: value,
+			Headers: []kafkago.Header{
+				{Key: _eventTypeHeader, Value: []byte(event.Type)},
+				{Key: _tenantHeader, Value: []byte(event.Tenant)},
+			},
+		})
+		ids = append(ids, event.ID)
+	}
+	err = r.writer.Writer.WriteMessages(ctx, messages...)
+	if err != nil {
+		return 0, errors.Wrap(err, "write messages")
+	}
+	err = outbox.MarkDelivered(ctx, ids)
+	if err != nil {
+		return 0, errors.Wrap(err, "mark events delivered")
+	}
+	return len(events), nil
+}
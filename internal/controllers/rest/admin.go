@@ -0,0 +1,111 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"enrich-fio/internal/models"
+)
+
+// responseRetention is a structure of retention response.
+type responseRetention struct {
+	DryRun  bool                     `json:"dryRun"`
+	Results []models.RetentionResult `json:"results"`
+}
+
+// _adminActor is actor of admin requests, as admin token is shared by every admin.
+const _adminActor = "admin"
+
+// startAdmin registers admin API handlers in group.
+func (h *HTTPHandler) startAdmin(group *gin.RouterGroup) {
+	group.POST("/people/:id/erase", h.erasePerson)
+	group.POST("/people/:id/anonymize", h.anonymizePerson)
+	group.POST("/retention", h.applyRetention)
+}
+
+// requireAdmin lets only requests with admin token in Authorization header through, and records admin as their actor.
+func (h *HTTPHandler) requireAdmin(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.config.AdminToken)) != 1 {
+		respondError(c, models.ErrUnauthorized)
+		c.Abort()
+		return
+	}
+	c.Request = c.Request.WithContext(models.WithActor(c.Request.Context(), _adminActor))
+	c.Next()
+}
+
+// withAdminTenant attaches tenant from X-Tenant header to request's context, as admin acts on behalf of any tenant.
+// Requests without the header act on the default tenant.
+func (h *HTTPHandler) withAdminTenant(c *gin.Context) {
+	tenant := c.GetHeader(_tenantHeader)
+	if tenant == "" {
+		tenant = models.DefaultTenant
+	}
+	err := h.service.CheckTenant(tenant)
+	if err != nil {
+		respondError(c, models.WithCode(models.CodeValidation, err))
+		c.Abort()
+		return
+	}
+	c.Request = c.Request.WithContext(models.WithTenant(c.Request.Context(), tenant))
+	c.Next()
+}
+
+// erasePerson removes person with all its history, leaving a tombstone.
+// localhost:8080/admin/people/id/erase
+func (h *HTTPHandler) erasePerson(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	tombstone, err := h.service.ErasePerson(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tombstone)
+}
+
+// anonymizePerson replaces FIO of person with hashes.
+// localhost:8080/admin/people/id/anonymize
+func (h *HTTPHandler) anonymizePerson(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	person, err := h.service.AnonymizePerson(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Header("ETag", etag(person.Version))
+	c.JSON(http.StatusOK, person)
+}
+
+// applyRetention applies configured retention rules.
+// localhost:8080/admin/retention | localhost:8080/admin/retention?dryRun=true only counts people, rules apply to.
+func (h *HTTPHandler) applyRetention(c *gin.Context) {
+	dryRun := false
+	if query := c.Query("dryRun"); query != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(query)
+		if err != nil {
+			badRequest(c, err)
+			return
+		}
+	}
+	results, err := h.service.ApplyRetention(c.Request.Context(), dryRun)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, responseRetention{DryRun: dryRun, Results: results})
+}
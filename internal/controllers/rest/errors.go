@@ -0,0 +1,55 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"enrich-fio/internal/models"
+)
+
+// responseError is a structure of error response.
+type responseError struct {
+	Error errorBody `json:"error"`
+}
+
+// errorBody describes what went wrong. Code is the same as in GraphQL errors and kafka failures.
+type errorBody struct {
+	Code    models.ErrorCode `json:"code"`
+	Message string           `json:"message"`
+}
+
+// _statusCodes are HTTP status codes for error codes.
+var _statusCodes = map[models.ErrorCode]int{
+	models.CodeNotFound:            http.StatusNotFound,
+	models.CodeConflict:            http.StatusConflict,
+	models.CodeValidation:          http.StatusBadRequest,
+	models.CodeUpstreamUnavailable: http.StatusServiceUnavailable,
+	models.CodeEnrichmentFailed:    http.StatusUnprocessableEntity,
+	models.CodeUnauthorized:        http.StatusUnauthorized,
+	models.CodeQuotaExceeded:       http.StatusTooManyRequests,
+	models.CodeInternal:            http.StatusInternalServerError,
+}
+
+// respondError responds with err, with status code matching err's code.
+func respondError(c *gin.Context, err error) {
+	respondErrorStatus(c, _statusCodes[models.CodeOf(err)], err)
+}
+
+// respondErrorStatus responds with err and given status code.
+// Internal errors are logged, and their details are hidden from client.
+func respondErrorStatus(c *gin.Context, status int, err error) {
+	code := models.CodeOf(err)
+	message := err.Error()
+	if code == models.CodeInternal {
+		zap.L().Error("request failed", zap.String("method", c.Request.Method), zap.String("path", c.Request.URL.Path), zap.Error(err))
+		message = "internal error"
+	}
+	c.JSON(status, responseError{Error: errorBody{Code: code, Message: message}})
+}
+
+// badRequest responds, that request is malformed, as err says.
+func badRequest(c *gin.Context, err error) {
+	respondError(c, models.WithCode(models.CodeValidation, err))
+}
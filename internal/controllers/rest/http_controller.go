@@ -3,8 +3,11 @@ package rest
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -13,27 +16,62 @@ import (
 
 	"enrich-fio/internal/config"
 	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/enrich-fio/export"
+	"enrich-fio/internal/filterexpr"
+	"enrich-fio/internal/jsonpatch"
 	"enrich-fio/internal/models"
 )
 
 // requestPOST is a structure of expected POST request.
 type requestPOST struct {
-	Name       string `json:"name"`
-	Surname    string `json:"surname"`
-	Patronymic string `json:"patronymic"`
+	Name       string            `json:"name"`
+	Surname    string            `json:"surname"`
+	Patronymic string            `json:"patronymic"`
+	Attributes map[string]string `json:"attributes"`
+	Tags       []string          `json:"tags"`
 }
 
 // requestPUT is a structure of expected PUT request.
+// Absent members are left as they are, and null members are cleared.
 type requestPUT struct {
-	ID          uuid.UUID     `json:"id"`
-	Name        string        `json:"name"`
-	Surname     string        `json:"surname"`
-	Patronymic  string        `json:"patronymic"`
-	Age         int           `json:"age"`
-	Gender      models.Gender `json:"gender"`
-	Nationality string        `json:"nationality"`
+	ID          models.Opt[uuid.UUID]     `json:"id"`
+	Name        models.Opt[string]        `json:"name"`
+	Surname     models.Opt[string]        `json:"surname"`
+	Patronymic  models.Opt[string]        `json:"patronymic"`
+	Age         models.Opt[int]           `json:"age"`
+	Gender      models.Opt[models.Gender] `json:"gender"`
+	Nationality models.Opt[string]        `json:"nationality"`
+	// Nationalities replace person's ones, and the first of them becomes nationality.
+	Nationalities models.Opt[[]models.Nationality] `json:"nationalities"`
+	// Attributes are merged into person's ones, and null attribute is removed.
+	Attributes models.Opt[map[string]*string] `json:"attributes"`
+	Tags       models.Opt[[]string]           `json:"tags"`
 }
 
+// responsePeople is a structure of people listing response.
+type responsePeople struct {
+	People         []models.Person `json:"people"`
+	Total          *int64          `json:"total,omitempty"`
+	TotalEstimated bool            `json:"totalEstimated,omitempty"`
+	Page           *int            `json:"page,omitempty"`
+	PageSize       int             `json:"pageSize"`
+	HasMore        bool            `json:"hasMore"`
+	NextCursor     string          `json:"nextCursor,omitempty"`
+	PrevCursor     string          `json:"prevCursor,omitempty"`
+}
+
+// requestRevert is a structure of expected revert request.
+type requestRevert struct {
+	Revision int `json:"revision"`
+}
+
+const (
+	// _apiKeyHeader is a header with API key of tenant, making the request.
+	_apiKeyHeader = "X-API-Key"
+	// _tenantHeader is a header with ID of tenant, admin request acts on.
+	_tenantHeader = "X-Tenant"
+)
+
 // HTTPHandler is http request handler.
 type HTTPHandler struct {
 	router  *gin.Engine
@@ -52,11 +90,7 @@ func NewHTTPHandler(router *gin.Engine, service *enrichfio.Service, config *conf
 
 // Start starts http handler.
 func (h *HTTPHandler) Start() error {
-	h.router.GET("/people", h.getPeople)
-	h.router.GET("people/:id", h.getPerson)
-	h.router.POST("/people", h.addPerson)
-	h.router.DELETE("/people/:id", h.deletePerson)
-	h.router.PUT("/people/:id", h.changePerson)
+	h.Routes()
 	logger := zap.L()
 	logger.Info(fmt.Sprintf("http server is up and running on %s", h.config.Host))
 	err := h.router.Run(h.config.Host)
@@ -66,74 +100,334 @@ func (h *HTTPHandler) Start() error {
 	return nil
 }
 
+// Routes registers handlers of the API in router.
+func (h *HTTPHandler) Routes() {
+	h.router.Use(withAudit)
+	people := h.router.Group("", h.withTenant)
+	people.GET("/people", h.getPeople)
+	people.GET("/people/stats", h.getStats)
+	people.GET("/people/export", h.exportPeople)
+	people.GET("people/:id", h.getPerson)
+	people.GET("/people/:id/history", h.getHistory)
+	people.POST("/people", h.addPerson)
+	people.POST("/people/:id/revert", h.revertPerson)
+	people.POST("/people/:id/enrich", h.enrichPerson)
+	people.DELETE("/people/:id", h.deletePerson)
+	people.PUT("/people/:id", h.changePerson)
+	people.PATCH("/people/:id", h.patchPerson)
+	h.startImport(people)
+	if h.config.AdminToken != "" {
+		h.startAdmin(h.router.Group("/admin", h.requireAdmin, h.withAdminTenant))
+	} else {
+		zap.L().Info("admin token is not set, admin API is disabled")
+	}
+}
+
+// withAudit attaches source of the request to request's context. Actor is attached once request is authenticated.
+func withAudit(c *gin.Context) {
+	ctx := models.WithAudit(c.Request.Context(), models.Audit{
+		Source: models.SourceREST,
+	})
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+}
+
+// withTenant attaches tenant and actor, authenticated by API key in X-API-Key header or by JWT in Authorization header,
+// to request's context.
+func (h *HTTPHandler) withTenant(c *gin.Context) {
+	token, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	principal, err := h.service.Authenticate(c.GetHeader(_apiKeyHeader), token)
+	if err != nil {
+		respondError(c, err)
+		c.Abort()
+		return
+	}
+	ctx := models.WithActor(models.WithTenant(c.Request.Context(), principal.Tenant), principal.Actor)
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+}
+
 // getPerson gets a single person by id.
+// localhost:8080/people/id | localhost:8080/people/id?asOf=2023-10-01T00:00:00Z
 func (h *HTTPHandler) getPerson(c *gin.Context) {
 	idURL := c.Param("id")
 	if idURL != "" {
 		id, err := uuid.Parse(idURL)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			badRequest(c, err)
+			return
+		}
+		if asOfQuery := c.Query("asOf"); asOfQuery != "" {
+			asOf, err := time.Parse(time.RFC3339, asOfQuery)
+			if err != nil {
+				badRequest(c, err)
+				return
+			}
+			person, err := h.service.PersonAsOf(c.Request.Context(), id, asOf)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, person)
 			return
 		}
 		person, err := h.service.Storage.GetByID(c.Request.Context(), id)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
+		c.Header("ETag", etag(person.Version))
 		c.JSON(http.StatusOK, person)
 		return
 	}
 }
 
+// getHistory gets all recorded revisions of a person by id.
+func (h *HTTPHandler) getHistory(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	revisions, err := h.service.History(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, revisions)
+}
+
+// revertPerson brings person back to the revision from request's body.
+func (h *HTTPHandler) revertPerson(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	request := requestRevert{}
+	err = c.ShouldBind(&request)
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	person, err := h.service.RevertPerson(c.Request.Context(), id, request.Revision)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, person)
+}
+
+// enrichPerson enriches already stored person by id once again.
+func (h *HTTPHandler) enrichPerson(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	person, err := h.service.EnrichPerson(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, person)
+}
+
 // getPeople gets people list with filters, described in URL query.
-// localhost:8080/people | localhost:8080/people?name=Name&age=min:max
+// localhost:8080/people | localhost:8080/people?name=Name&age=min:max | localhost:8080/people?pageSize=20&cursor=cursor
+// localhost:8080/people?sort=-age,surname orders by age descending, then by surname.
+// localhost:8080/people?q=Ivan searches people by FIO, see searchPeople.
+// localhost:8080/people?age=30: | localhost:8080/people?nationality[in]=RU,UA,BY&gender[!eq]=male&patronymic[unknown]
+// localhost:8080/people?or=age[gte]:60|nationality[in]:RU,KZ holds if any of "|" separated conditions holds.
+// localhost:8080/people?filter=age>30 and nationality in ("RU","KZ") and not gender="male", see filterexpr.Parse.
+// localhost:8080/people?tag=vip&tag=new&attr.source=crm holds for people with all the tags and attributes.
+// localhost:8080/people?nationality=KZ&nationalityMatch=any matches any of probable nationalities, not only the primary one.
+// Total isn't counted by default, ?total=exact counts precisely, ?total=estimated takes it from table statistics,
+// if people are not filtered, and counts them otherwise.
+// People are wrapped in envelope with pagination metadata, and ?envelope=false returns bare list with metadata in headers.
 func (h *HTTPHandler) getPeople(c *gin.Context) {
-	idQuery := c.Request.URL.Query().Get("id")
 	page, err := strconv.Atoi(c.Request.URL.Query().Get("page"))
 	if err != nil {
 		page = 0
 	}
+	if page < 0 {
+		badRequest(c, errors.Errorf("page %d is negative", page))
+		return
+	}
+	pageSize := 0
+	if pageSizeQuery := c.Request.URL.Query().Get("pageSize"); pageSizeQuery != "" {
+		pageSize, err = strconv.Atoi(pageSizeQuery)
+		if err != nil {
+			badRequest(c, err)
+			return
+		}
+	}
+	// Counting filtered people is as slow as listing all of them, so it's done only for clients, which ask for it.
+	total := models.TotalMode(c.Request.URL.Query().Get("total"))
+	opts := models.ListOptions{
+		Page:     page,
+		PageSize: pageSize,
+		Cursor:   c.Request.URL.Query().Get("cursor"),
+		Total:    total,
+		Sort:     models.ParseSort(c.Request.URL.Query().Get("sort")),
+	}
+	filter, err := filterFromQuery(c.Request.URL.Query())
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if text := c.Request.URL.Query().Get("q"); text != "" {
+		h.searchPeople(c, text, filter, opts)
+		return
+	}
+
+	people, err := h.service.Storage.GetWithFilter(c.Request.Context(), filter, opts)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	links := []string{}
+	if people.NextCursor != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, cursorURL(c.Request.URL, people.NextCursor)))
+	}
+	if people.PrevCursor != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, cursorURL(c.Request.URL, people.PrevCursor)))
+	}
+	if len(links) != 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+
+	// Old clients expect bare list of people, so metadata goes to headers only.
+	if c.Request.URL.Query().Get("envelope") == "false" {
+		if people.Total != nil {
+			c.Header("X-Total-Count", strconv.FormatInt(*people.Total, 10))
+			c.Header("X-Total-Estimated", strconv.FormatBool(people.TotalEstimated))
+		}
+		if people.Page != nil {
+			c.Header("X-Page", strconv.Itoa(*people.Page))
+		}
+		c.Header("X-Page-Size", strconv.Itoa(people.PageSize))
+		c.Header("X-Has-More", strconv.FormatBool(people.HasMore))
+		c.JSON(http.StatusOK, people.People)
+		return
+	}
+	c.JSON(http.StatusOK, responsePeople{
+		People:         people.People,
+		Total:          people.Total,
+		TotalEstimated: people.TotalEstimated,
+		Page:           people.Page,
+		PageSize:       people.PageSize,
+		HasMore:        people.HasMore,
+		NextCursor:     people.NextCursor,
+		PrevCursor:     people.PrevCursor,
+	})
+}
+
+// getStats gets statistics over people, matching filters, described in URL query the same way as in getPeople.
+// localhost:8080/people/stats | localhost:8080/people/stats?groupBy=nationality | localhost:8080/people/stats?groupBy=gender,age&ageBucket=5
+// localhost:8080/people/stats?groupBy=nationality&gender=female counts women per nationality.
+func (h *HTTPHandler) getStats(c *gin.Context) {
+	query := models.StatsQuery{
+		GroupBy: models.ParseStatsGroups(c.Request.URL.Query().Get("groupBy")),
+	}
+	if ageBucket := c.Request.URL.Query().Get("ageBucket"); ageBucket != "" {
+		var err error
+		query.AgeBucketSize, err = strconv.Atoi(ageBucket)
+		if err != nil {
+			badRequest(c, err)
+			return
+		}
+	}
+	filter, err := filterFromQuery(c.Request.URL.Query())
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	stats, err := h.service.Stats(c.Request.Context(), filter, query)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// exportPeople streams all people, matching filters, described in URL query the same way as in getPeople, as a file.
+// localhost:8080/people/export | localhost:8080/people/export?format=ndjson | localhost:8080/people/export?format=parquet&nationality=KZ
+// Format is csv by default.
+func (h *HTTPHandler) exportPeople(c *gin.Context) {
+	format := models.ExportFormat(c.DefaultQuery("format", string(models.ExportCSV)))
+	err := format.Validate()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	filter, err := filterFromQuery(c.Request.URL.Query())
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	c.Header("Content-Type", export.ContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="people.%s"`, format))
+	exported, err := h.service.ExportPeople(c.Request.Context(), filter, format, c.Writer)
+	if err != nil {
+		if !c.Writer.Written() {
+			// Error is a JSON document, not the file.
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Disposition")
+			respondError(c, err)
+			return
+		}
+		// Status is sent already, so client only sees the file cut short.
+		zap.L().Error("export failed", zap.Int64("exported", exported), zap.Error(err))
+	}
+}
+
+// filterFromQuery returns people filter, described in URL query, see getPeople.
+func filterFromQuery(query url.Values) (models.FilterConfig, error) {
+	idQuery := query.Get("id")
 	var id uuid.UUID
 	if idQuery != "" {
 		parsedID, err := uuid.Parse(idQuery)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
+			return models.FilterConfig{}, err
 		}
 		id = parsedID
 	}
-	name := c.Request.URL.Query().Get("name")
-	surname := c.Request.URL.Query().Get("surname")
-	patronymic := c.Request.URL.Query().Get("patronymic")
+	name := query.Get("name")
+	surname := query.Get("surname")
+	patronymic := query.Get("patronymic")
 
-	age := c.Request.URL.Query().Get("age")
+	age := query.Get("age")
 	ageFilter := models.FilterAge{}
 	if age != "" {
 		if strings.Index(age, ":") != -1 {
 			split := strings.Split(age, ":")
-			ageMin, err := strconv.Atoi(split[0])
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-				return
+			if split[0] != "" {
+				ageMin, err := strconv.Atoi(split[0])
+				if err != nil {
+					return models.FilterConfig{}, err
+				}
+				ageFilter.Min = &ageMin
 			}
-			ageFilter.Min = ageMin
-			ageMax, err := strconv.Atoi(split[1])
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-				return
+			if split[1] != "" {
+				ageMax, err := strconv.Atoi(split[1])
+				if err != nil {
+					return models.FilterConfig{}, err
+				}
+				ageFilter.Max = &ageMax
 			}
-			ageFilter.Max = ageMax
 		} else {
 			ageEqual, err := strconv.Atoi(age)
 			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-				return
+				return models.FilterConfig{}, err
 			}
-			ageFilter.Min = ageEqual
-			ageFilter.Max = ageEqual
+			ageFilter.Min = &ageEqual
+			ageFilter.Max = &ageEqual
 		}
 	}
-	genderQuery := c.Request.URL.Query().Get("gender")
+	genderQuery := query.Get("gender")
 	var gender models.Gender
 	if genderQuery != "" {
 		switch genderQuery {
@@ -142,11 +436,10 @@ func (h *HTTPHandler) getPeople(c *gin.Context) {
 		case "female":
 			gender = models.GenderFemale
 		default:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "unrecognized gender query parameter: " + genderQuery})
-			return
+			return models.FilterConfig{}, errors.New("unrecognized gender query parameter: " + genderQuery)
 		}
 	}
-	nationality := c.Request.URL.Query().Get("nationality")
+	nationality := query.Get("nationality")
 
 	filter := models.FilterConfig{
 		ID:          id,
@@ -156,14 +449,97 @@ func (h *HTTPHandler) getPeople(c *gin.Context) {
 		Age:         ageFilter,
 		Gender:      gender,
 		Nationality: nationality,
+		Tags:        query["tag"],
+		// Validated by storage along with the rest of the filter.
+		NationalityMatch: models.NationalityMatch(query.Get("nationalityMatch")),
+	}
+	for key, values := range query {
+		if attribute, ok := strings.CutPrefix(key, "attr."); ok {
+			if filter.Attributes == nil {
+				filter.Attributes = map[string]string{}
+			}
+			filter.Attributes[attribute] = values[0]
+		}
+	}
+	var err error
+	filter.Conditions, filter.AnyOf, err = parseConditions(query)
+	if err != nil {
+		return models.FilterConfig{}, err
+	}
+	if expression := query.Get("filter"); expression != "" {
+		filter.Expr, err = filterexpr.Parse(expression)
+		if err != nil {
+			return models.FilterConfig{}, err
+		}
+	}
+	return filter, nil
+}
+
+// parseConditions parses conditions with operators, like "age[gte]=30", and "or" groups of conditions from URL query.
+func parseConditions(query url.Values) ([]models.Condition, [][]models.Condition, error) {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		if strings.Contains(key, "[") {
+			keys = append(keys, key)
+		}
+	}
+	// Stable order keeps generated SQL the same for the same query.
+	sort.Strings(keys)
+	conditions := []models.Condition{}
+	for _, key := range keys {
+		for _, value := range query[key] {
+			condition, err := models.ParseCondition(key, value)
+			if err != nil {
+				return nil, nil, err
+			}
+			conditions = append(conditions, condition)
+		}
+	}
+	groups := [][]models.Condition{}
+	for _, value := range query["or"] {
+		group, err := models.ParseConditionGroup(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		groups = append(groups, group)
 	}
+	return conditions, groups, nil
+}
 
-	people, err := h.service.Storage.GetWithFilter(c.Request.Context(), filter, page)
+// searchPeople searches people, matching the filter, by FIO and responds with the best matches first.
+// localhost:8080/people?q=Ivan | localhost:8080/people?q=Iva&mode=prefix&fields=name,surname&minSimilarity=0.4
+func (h *HTTPHandler) searchPeople(c *gin.Context, text string, filter models.FilterConfig, opts models.ListOptions) {
+	query := models.SearchQuery{
+		Text: text,
+		Mode: models.SearchMode(c.Request.URL.Query().Get("mode")),
+	}
+	if fields := c.Request.URL.Query().Get("fields"); fields != "" {
+		query.Fields = strings.Split(fields, ",")
+	}
+	if minSimilarity := c.Request.URL.Query().Get("minSimilarity"); minSimilarity != "" {
+		var err error
+		query.MinSimilarity, err = strconv.ParseFloat(minSimilarity, 64)
+		if err != nil {
+			badRequest(c, err)
+			return
+		}
+	}
+	results, err := h.service.Storage.Search(c.Request.Context(), query, filter, opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
+		return
 	}
+	c.JSON(http.StatusOK, results)
+}
 
-	c.JSON(http.StatusOK, people)
+// cursorURL returns listing URL like the given one, but pointing to the page at given cursor.
+func cursorURL(listURL *url.URL, cursor string) string {
+	query := listURL.Query()
+	query.Del("page")
+	query.Set("cursor", cursor)
+	u := *listURL
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
 }
 
 // addPerson adds a new person with name, surname, patronymic from request's body.
@@ -171,20 +547,20 @@ func (h *HTTPHandler) addPerson(c *gin.Context) {
 	person := requestPOST{}
 	err := c.ShouldBind(&person)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(c, err)
 		return
 	}
 	if person.Name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "name required"})
+		badRequest(c, errors.New("name required"))
 		return
 	}
 	if person.Surname == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "surname required"})
+		badRequest(c, errors.New("surname required"))
 		return
 	}
-	err = h.service.AddPerson(c.Request.Context(), person.Name, person.Surname, person.Patronymic)
+	err = h.service.AddPerson(c.Request.Context(), person.Name, person.Surname, person.Patronymic, person.Attributes, person.Tags)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 	}
 
 }
@@ -195,52 +571,147 @@ func (h *HTTPHandler) deletePerson(c *gin.Context) {
 	if idURL != "" {
 		id, err := uuid.Parse(idURL)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			badRequest(c, err)
 			return
 		}
 		err = h.service.Storage.DeleteByID(c.Request.Context(), id)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 		return
 	}
-	c.JSON(http.StatusBadRequest, gin.H{"error": "no id parameter found in URL"})
+	badRequest(c, errors.New("no id parameter found in URL"))
 	return
 }
 
 // changePerson changes person's data with data from request's body.
-// WARNING: Doesn't support deleting data.
+// Null member clears the field, like {"patronymic": null}.
+// If-Match header with person's ETag makes change fail with 412, if person was changed since.
 func (h *HTTPHandler) changePerson(c *gin.Context) {
 	idURL := c.Param("id")
 	if idURL != "" {
 		id, err := uuid.Parse(idURL)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			badRequest(c, err)
 			return
 		}
 		request := requestPUT{}
 		err = c.ShouldBind(&request)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			badRequest(c, err)
+			return
+		}
+		expectedVersion, ok := parseIfMatch(c.GetHeader("If-Match"))
+		if !ok {
+			respondErrorStatus(c, http.StatusPreconditionFailed, models.WithCode(models.CodeValidation, errors.New("unrecognized If-Match header")))
 			return
 		}
 		changes := models.ChangeConfig{
-			ID:          request.ID,
-			Name:        request.Name,
-			Surname:     request.Surname,
-			Patronymic:  request.Patronymic,
-			Age:         request.Age,
-			Gender:      request.Gender,
-			Nationality: request.Nationality,
+			ID:              request.ID,
+			Name:            request.Name,
+			Surname:         request.Surname,
+			Patronymic:      request.Patronymic,
+			Age:             request.Age,
+			Gender:          request.Gender,
+			Nationality:     request.Nationality,
+			Nationalities:   request.Nationalities,
+			Attributes:      request.Attributes,
+			Tags:            request.Tags,
+			ExpectedVersion: expectedVersion,
 		}
 		err = h.service.Storage.ChangeByID(c.Request.Context(), id, changes)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			if errors.Is(err, models.ErrVersionConflict) {
+				// Version is only expected with If-Match, so it's the precondition that failed.
+				respondErrorStatus(c, http.StatusPreconditionFailed, err)
+				return
+			}
+			respondError(c, err)
 			return
 		}
 		return
 	}
-	c.JSON(http.StatusBadRequest, gin.H{"error": "no id parameter found in URL"})
+	badRequest(c, errors.New("no id parameter found in URL"))
 	return
 }
+
+// patchPerson changes person with patch from request's body, and responds with changed person.
+// Body is a JSON merge patch (RFC 7396) if Content-Type is application/merge-patch+json or application/json,
+// and a JSON patch (RFC 6902) if Content-Type is application/json-patch+json.
+// Null member of merge patch and removed member of JSON patch clear the field.
+// If-Match header with person's ETag makes change fail with 412, if person was changed since.
+// localhost:8080/people/id {"patronymic": null, "age": 30}
+// localhost:8080/people/id [{"op": "test", "path": "/age", "value": 29}, {"op": "remove", "path": "/patronymic"}]
+func (h *HTTPHandler) patchPerson(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	expectedVersion, ok := parseIfMatch(c.GetHeader("If-Match"))
+	if !ok {
+		respondErrorStatus(c, http.StatusPreconditionFailed, models.WithCode(models.CodeValidation, errors.New("unrecognized If-Match header")))
+		return
+	}
+	body, err := c.GetRawData()
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	var person models.Person
+	switch c.ContentType() {
+	case "application/merge-patch+json", "application/json":
+		var changes models.ChangeConfig
+		changes, err = models.ParseMergePatch(body)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		changes.ExpectedVersion = expectedVersion
+		person, err = h.service.ChangePerson(c.Request.Context(), id, changes)
+	case "application/json-patch+json":
+		var patch jsonpatch.Patch
+		patch, err = jsonpatch.Parse(body)
+		if err != nil {
+			respondError(c, models.WithCode(models.CodeValidation, errors.Wrap(err, "parse JSON patch")))
+			return
+		}
+		person, err = h.service.PatchPerson(c.Request.Context(), id, patch, expectedVersion)
+	default:
+		respondErrorStatus(c, http.StatusUnsupportedMediaType,
+			models.WithCode(models.CodeValidation, errors.Errorf("unsupported patch content type %q", c.ContentType())))
+		return
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrVersionConflict) && expectedVersion != 0 {
+			respondErrorStatus(c, http.StatusPreconditionFailed, err)
+			return
+		}
+		respondError(c, err)
+		return
+	}
+	c.Header("ETag", etag(person.Version))
+	c.JSON(http.StatusOK, person)
+}
+
+// etag returns ETag header value for given person's version.
+func etag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// parseIfMatch returns version, expected by If-Match header.
+// Zero version means any version matches. Returns false if header is not recognized.
+func parseIfMatch(header string) (int64, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, true
+	}
+	header = strings.TrimPrefix(header, "W/")
+	version, err := strconv.ParseInt(strings.Trim(header, `"`), 10, 64)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
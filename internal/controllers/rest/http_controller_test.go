@@ -0,0 +1,157 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"enrich-fio/internal/config"
+	"enrich-fio/internal/controllers/rest"
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/enrich-fio/storage/memory"
+	"enrich-fio/internal/models"
+)
+
+// listing is a people listing response.
+type listing struct {
+	People     []models.Person `json:"people"`
+	Total      *int64          `json:"total"`
+	PageSize   int             `json:"pageSize"`
+	HasMore    bool            `json:"hasMore"`
+	NextCursor string          `json:"nextCursor"`
+}
+
+// newRouter returns router of REST API over memory storage with given number of people, and their IDs.
+func newRouter(t *testing.T, count int) (*gin.Engine, []uuid.UUID) {
+	gin.SetMode(gin.TestMode)
+	service := enrichfio.New(memory.New(&config.DBConfig{DefaultPageSize: 5, MaxPageSize: 100}), nil, nil, nil)
+	ids := make([]uuid.UUID, count)
+	for i := range ids {
+		ids[i] = uuid.New()
+		err := service.Storage.Save(context.Background(), models.Person{
+			ID:      ids[i],
+			Name:    fmt.Sprintf("Name%d", i),
+			Surname: "Ivanov",
+			Age:     20 + i,
+		})
+		if err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	router := gin.New()
+	rest.NewHTTPHandler(router, service, &config.RestConfig{}).Routes()
+	return router, ids
+}
+
+func serve(router *gin.Engine, method string, target string, body string, header http.Header) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func decode(t *testing.T, recorder *httptest.ResponseRecorder, v any) {
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got status %d, body %s, want %d", recorder.Code, recorder.Body, http.StatusOK)
+	}
+	err := json.Unmarshal(recorder.Body.Bytes(), v)
+	if err != nil {
+		t.Fatalf("unmarshal %s: %v", recorder.Body, err)
+	}
+}
+
+func TestGetPeopleEnvelope(t *testing.T) {
+	router, _ := newRouter(t, 7)
+
+	first := listing{}
+	decode(t, serve(router, http.MethodGet, "/people", "", nil), &first)
+	if len(first.People) != 5 || first.PageSize != 5 || !first.HasMore || first.NextCursor == "" || first.Total != nil {
+		t.Fatalf("got first page %+v, want 5 of 7 people, cursor to the rest and no total", first)
+	}
+	next := listing{}
+	decode(t, serve(router, http.MethodGet, "/people?cursor="+url.QueryEscape(first.NextCursor), "", nil), &next)
+	if len(next.People) != 2 || next.HasMore {
+		t.Fatalf("got next page %+v, want the last 2 people", next)
+	}
+	seen := map[uuid.UUID]bool{}
+	for _, person := range append(first.People, next.People...) {
+		seen[person.ID] = true
+	}
+	if len(seen) != 7 {
+		t.Fatalf("got %d distinct people on both pages, want 7", len(seen))
+	}
+
+	counted := listing{}
+	decode(t, serve(router, http.MethodGet, "/people?total=exact", "", nil), &counted)
+	if counted.Total == nil || *counted.Total != 7 {
+		t.Fatalf("got total %v with ?total=exact, want 7", counted.Total)
+	}
+}
+
+func TestGetPeopleWithoutEnvelope(t *testing.T) {
+	router, _ := newRouter(t, 7)
+
+	recorder := serve(router, http.MethodGet, "/people?envelope=false&total=exact", "", nil)
+	people := []models.Person{}
+	decode(t, recorder, &people)
+	if len(people) != 5 {
+		t.Fatalf("got %d people, want 5", len(people))
+	}
+	for header, want := range map[string]string{"X-Total-Count": "7", "X-Page-Size": "5", "X-Has-More": "true"} {
+		if got := recorder.Header().Get(header); got != want {
+			t.Errorf("got %s %q, want %q", header, got, want)
+		}
+	}
+	if !strings.Contains(recorder.Header().Get("Link"), `rel="next"`) {
+		t.Errorf("got Link %q, want link to the next page", recorder.Header().Get("Link"))
+	}
+}
+
+func TestGetPeopleInvalid(t *testing.T) {
+	router, _ := newRouter(t, 1)
+
+	for _, target := range []string{"/people?page=-1", "/people?cursor=invalid", "/people?total=maybe"} {
+		recorder := serve(router, http.MethodGet, target, "", nil)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("got status %d for %s, want %d", recorder.Code, target, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestChangePersonETag(t *testing.T) {
+	router, ids := newRouter(t, 1)
+	target := "/people/" + ids[0].String()
+
+	recorder := serve(router, http.MethodGet, target, "", nil)
+	person := models.Person{}
+	decode(t, recorder, &person)
+	etag := recorder.Header().Get("ETag")
+	if etag != fmt.Sprintf(`"%d"`, person.Version) {
+		t.Fatalf("got ETag %q, want version %d", etag, person.Version)
+	}
+
+	recorder = serve(router, http.MethodPut, target, `{"age": 40}`, http.Header{"If-Match": {etag}})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got status %d, body %s, want %d", recorder.Code, recorder.Body, http.StatusOK)
+	}
+	recorder = serve(router, http.MethodPut, target, `{"age": 50}`, http.Header{"If-Match": {etag}})
+	if recorder.Code != http.StatusPreconditionFailed {
+		t.Fatalf("got status %d changing with stale ETag, want %d", recorder.Code, http.StatusPreconditionFailed)
+	}
+	decode(t, serve(router, http.MethodGet, target, "", nil), &person)
+	if person.Age != 40 {
+		t.Fatalf("got age %d, want 40 kept after stale change", person.Age)
+	}
+}
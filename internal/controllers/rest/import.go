@@ -0,0 +1,152 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"enrich-fio/internal/enrich-fio/importfile"
+	"enrich-fio/internal/models"
+)
+
+// startImport registers handlers of import jobs in group.
+func (h *HTTPHandler) startImport(group *gin.RouterGroup) {
+	group.POST("/people/import", h.createImport)
+	group.GET("/people/import/:id", h.getImport)
+	group.GET("/people/import/:id/report", h.getImportReport)
+	group.POST("/people/import/:id/resume", h.resumeImport)
+}
+
+// createImport reads people from file, uploaded as multipart form, and imports them in background.
+// Form has "file" with people and optional "format" (csv or ndjson), "nameColumn", "surnameColumn",
+// "patronymicColumn" and "enrich" fields. Responds with the created job, status of which is polled by getImport.
+// curl -F file=@people.csv -F enrich=true localhost:8080/people/import
+func (h *HTTPHandler) createImport(c *gin.Context) {
+	options := models.ImportOptions{
+		Format: models.ImportFormat(c.PostForm("format")),
+		Columns: models.ImportColumns{
+			Name:       c.PostForm("nameColumn"),
+			Surname:    c.PostForm("surnameColumn"),
+			Patronymic: c.PostForm("patronymicColumn"),
+		},
+	}
+	if enrich := c.PostForm("enrich"); enrich != "" {
+		var err error
+		options.Enrich, err = strconv.ParseBool(enrich)
+		if err != nil {
+			badRequest(c, err)
+			return
+		}
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	defer file.Close()
+	job, err := h.service.CreateImport(c.Request.Context(), file, options)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	job, err = h.service.ClaimImport(c.Request.Context(), job.ID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	h.runImport(c, job)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// getImport gets import job by id with counts of imported and failed rows.
+// localhost:8080/people/import/id
+func (h *HTTPHandler) getImport(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	job, err := h.service.GetImport(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// getImportReport downloads results of every row of import job as a file.
+// localhost:8080/people/import/id/report | localhost:8080/people/import/id/report?format=ndjson
+func (h *HTTPHandler) getImportReport(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	format := models.ImportFormat(c.DefaultQuery("format", string(models.ImportCSV)))
+	c.Header("Content-Type", importfile.ContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="import-%s.%s"`, id, format))
+	err = h.service.ImportReport(c.Request.Context(), id, format, c.Writer)
+	if err != nil {
+		if !c.Writer.Written() {
+			// Error is a JSON document, not the file.
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Disposition")
+			respondError(c, err)
+			return
+		}
+		// Status is sent already, so client only sees the file cut short.
+		zap.L().Error("import report failed", zap.Stringer("import", id), zap.Error(err))
+	}
+}
+
+// resumeImport imports rows of paused import job, which are still pending, in background.
+// Job, which is done already, is returned as it is. Job, which is run already, conflicts,
+// unless its run has stopped renewing the claim, like a crashed one.
+// localhost:8080/people/import/id/resume
+func (h *HTTPHandler) resumeImport(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	job, err := h.service.ClaimImport(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if job.Status == models.ImportDone {
+		c.JSON(http.StatusOK, job)
+		return
+	}
+	h.runImport(c, job)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// runImport runs claimed import job in background, on behalf of the tenant and actor of the request.
+func (h *HTTPHandler) runImport(c *gin.Context, job models.ImportJob) {
+	ctx := context.WithoutCancel(c.Request.Context())
+	id := job.ID
+	go func() {
+		job, err := h.service.RunImport(ctx, job)
+		if errors.Is(err, models.ErrImportClaimed) {
+			zap.L().Warn("import left to another run", zap.Stringer("import", id), zap.Error(err))
+			return
+		}
+		if err != nil {
+			zap.L().Warn("import paused", zap.Stringer("import", id), zap.Int("imported", job.Imported), zap.Error(err))
+			return
+		}
+		zap.L().Info("import done", zap.Stringer("import", id), zap.Int("imported", job.Imported), zap.Int("failed", job.Failed))
+	}()
+}
@@ -12,18 +12,28 @@ import (
 
 const (
 	_agifyURL = "https://api.agify.io/"
-	_nameKey  = "name"
+	// _apiKeyKey is a query parameter with API key, requests count against subscription of.
+	_apiKeyKey = "apikey"
+	_nameKey   = "name"
 )
 
 // ProbableAge is a part of service buisness logic, for getting probable age of a person.
 type ProbableAge struct {
 	client *http.Client
+	url    string
+	apiKey string
 }
 
 // New returns ProbableAge, for getting probable age of a person.
-func New(client *http.Client) *ProbableAge {
+// Empty url means the public API. API key is not sent, if it's empty.
+func New(client *http.Client, url string, apiKey string) *ProbableAge {
+	if url == "" {
+		url = _agifyURL
+	}
 	return &ProbableAge{
 		client: client,
+		url:    url,
+		apiKey: apiKey,
 	}
 }
 
@@ -34,24 +44,30 @@ type responce struct {
 
 // Get returns the most likely age for a given person.
 func (p *ProbableAge) Get(ctx context.Context, name string, surname string, patronymic string) (int, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, _agifyURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
 	if err != nil {
 		return 0, errors.Wrap(err, "make request")
 	}
 	q := req.URL.Query()
 	q.Add(_nameKey, name)
+	if p.apiKey != "" {
+		q.Add(_apiKeyKey, p.apiKey)
+	}
 	req.URL.RawQuery = q.Encode()
 
 	resp, err := p.client.Do(req)
 	if err != nil {
-		return 0, errors.Wrap(err, "send request")
+		return 0, errors.Wrapf(models.ErrUpstreamUnavailable, "send request: %v", err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, errors.Wrapf(models.ErrUpstreamUnavailable, "unexpected status %d", resp.StatusCode)
+	}
 
 	r := responce{}
 	err = json.NewDecoder(resp.Body).Decode(&r)
 	if err != nil {
-		return 0, errors.Wrap(err, "decode responce")
+		return 0, errors.Wrapf(models.ErrUpstreamUnavailable, "decode responce: %v", err)
 	}
 	if r.Age == 0 {
 		return 0, models.ErrCouldNotEnrich
@@ -12,18 +12,28 @@ import (
 
 const (
 	_genderizeURL = "https://api.genderize.io/"
-	_nameKey      = "name"
+	// _apiKeyKey is a query parameter with API key, requests count against subscription of.
+	_apiKeyKey = "apikey"
+	_nameKey   = "name"
 )
 
 // ProbableGender is a part of service buisness logic, for getting probable gender of a person.
 type ProbableGender struct {
 	client *http.Client
+	url    string
+	apiKey string
 }
 
 // New returns ProbableGender, for getting probable gedner of a person.
-func New(client *http.Client) *ProbableGender {
+// Empty url means the public API. API key is not sent, if it's empty.
+func New(client *http.Client, url string, apiKey string) *ProbableGender {
+	if url == "" {
+		url = _genderizeURL
+	}
 	return &ProbableGender{
 		client: client,
+		url:    url,
+		apiKey: apiKey,
 	}
 }
 
@@ -34,24 +44,30 @@ type responce struct {
 
 // Get returns the most likely gender for a given person.
 func (p *ProbableGender) Get(ctx context.Context, name string, surname string, patronymic string) (models.Gender, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, _genderizeURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
 	if err != nil {
 		return "", errors.Wrap(err, "make request")
 	}
 	q := req.URL.Query()
 	q.Add(_nameKey, name)
+	if p.apiKey != "" {
+		q.Add(_apiKeyKey, p.apiKey)
+	}
 	req.URL.RawQuery = q.Encode()
 
 	resp, err := p.client.Do(req)
 	if err != nil {
-		return "", errors.Wrap(err, "send request")
+		return "", errors.Wrapf(models.ErrUpstreamUnavailable, "send request: %v", err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Wrapf(models.ErrUpstreamUnavailable, "unexpected status %d", resp.StatusCode)
+	}
 
 	r := responce{}
 	err = json.NewDecoder(resp.Body).Decode(&r)
 	if err != nil {
-		return "", errors.Wrap(err, "decode responce")
+		return "", errors.Wrapf(models.ErrUpstreamUnavailable, "decode responce: %v", err)
 	}
 	switch r.Gender {
 	case "male":
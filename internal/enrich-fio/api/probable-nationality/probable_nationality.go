@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"sort"
 
 	"github.com/pkg/errors"
 
@@ -11,19 +12,29 @@ import (
 )
 
 const (
+	// _apiKeyKey is a query parameter with API key, requests count against subscription of.
+	_apiKeyKey      = "apikey"
 	_nameKey        = "name"
 	_nationalizeURL = "https://api.nationalize.io/"
 )
 
-// ProbableNationality is a part of service buisness logic, for getting probable nationality of a person.
+// ProbableNationality is a part of service buisness logic, for getting probable nationalities of a person.
 type ProbableNationality struct {
 	client *http.Client
+	url    string
+	apiKey string
 }
 
-// New returns ProbableNationality, for getting probable nationality of a person.
-func New(client *http.Client) *ProbableNationality {
+// New returns ProbableNationality, for getting probable nationalities of a person.
+// Empty url means the public API. API key is not sent, if it's empty.
+func New(client *http.Client, url string, apiKey string) *ProbableNationality {
+	if url == "" {
+		url = _nationalizeURL
+	}
 	return &ProbableNationality{
 		client: client,
+		url:    url,
+		apiKey: apiKey,
 	}
 }
 
@@ -38,37 +49,46 @@ type country struct {
 	Probability float64 `json:"probability"`
 }
 
-// Get returns the most likely nationality for a given person
-func (p *ProbableNationality) Get(ctx context.Context, name string, surname string, patronymic string) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, _nationalizeURL, nil)
+// Get returns probable nationalities for a given person, the most likely first.
+func (p *ProbableNationality) Get(ctx context.Context, name string, surname string, patronymic string) ([]models.Nationality, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
 	if err != nil {
-		return "", errors.Wrap(err, "make request")
+		return nil, errors.Wrap(err, "make request")
 	}
 	q := req.URL.Query()
 	q.Add(_nameKey, name)
+	if p.apiKey != "" {
+		q.Add(_apiKeyKey, p.apiKey)
+	}
 	req.URL.RawQuery = q.Encode()
 
 	resp, err := p.client.Do(req)
 	if err != nil {
-		return "", errors.Wrap(err, "send request")
+		return nil, errors.Wrapf(models.ErrUpstreamUnavailable, "send request: %v", err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Wrapf(models.ErrUpstreamUnavailable, "unexpected status %d", resp.StatusCode)
+	}
 
 	responce := responce{}
 	err = json.NewDecoder(resp.Body).Decode(&responce)
 	if err != nil {
-		return "", errors.Wrap(err, "decode responce")
+		return nil, errors.Wrapf(models.ErrUpstreamUnavailable, "decode responce: %v", err)
 	}
-	nationality := ""
-	probability := 0.0
+	nationalities := make([]models.Nationality, 0, len(responce.Country))
 	for _, country := range responce.Country {
-		if country.Probability > probability {
-			probability = country.Probability
-			nationality = country.CountryID
+		if country.CountryID == "" || country.Probability <= 0 {
+			continue
 		}
+		nationalities = append(nationalities, models.Nationality{Country: country.CountryID, Probability: country.Probability})
 	}
-	if nationality == "" {
-		return "", models.ErrCouldNotEnrich
+	if len(nationalities) == 0 {
+		return nil, models.ErrCouldNotEnrich
 	}
-	return nationality, nil
+	// API ranks countries already, but doesn't promise to.
+	sort.SliceStable(nationalities, func(i, j int) bool {
+		return nationalities[i].Probability > nationalities[j].Probability
+	})
+	return nationalities, nil
 }
@@ -0,0 +1,132 @@
+package enrichfio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/jsonpatch"
+	"enrich-fio/internal/models"
+)
+
+// ChangePerson applies changes to person with given ID and returns changed person.
+func (s *Service) ChangePerson(ctx context.Context, id uuid.UUID, changes models.ChangeConfig) (models.Person, error) {
+	err := s.Storage.ChangeByID(ctx, id, changes)
+	if err != nil {
+		return models.Person{}, errors.Wrap(err, "change person by id")
+	}
+	person, err := s.Storage.GetByID(ctx, changes.ID.Apply(id))
+	if err != nil {
+		return models.Person{}, errors.Wrap(err, "get changed person")
+	}
+	return person, nil
+}
+
+// PatchPerson applies JSON patch to person with given ID and returns changed person.
+// Patch sees person as it is returned by API, and can't change its version.
+// Patch, which changes nothing, like one of passed tests only, returns person as it is.
+// Zero expectedVersion means patch is applied to any version.
+func (s *Service) PatchPerson(ctx context.Context, id uuid.UUID, patch jsonpatch.Patch, expectedVersion int64) (models.Person, error) {
+	person, err := s.Storage.GetByID(ctx, id)
+	if err != nil {
+		return models.Person{}, errors.Wrap(err, "get person by id")
+	}
+	if expectedVersion != 0 && expectedVersion != person.Version {
+		return models.Person{}, models.ErrVersionConflict
+	}
+	changes, err := patchChanges(person, patch)
+	if err != nil {
+		return models.Person{}, err
+	}
+	if errors.Is(changes.Validate(), models.ErrNoChangesMade) {
+		return person, nil
+	}
+	// Patch was applied to the version just read, so it must not overwrite anything changed since.
+	changes.ExpectedVersion = person.Version
+	return s.ChangePerson(ctx, id, changes)
+}
+
+// patchChanges returns changes, JSON patch makes to person.
+// Members removed by patch are cleared.
+func patchChanges(person models.Person, patch jsonpatch.Patch) (models.ChangeConfig, error) {
+	data, err := json.Marshal(person)
+	if err != nil {
+		return models.ChangeConfig{}, errors.Wrap(err, "marshal person")
+	}
+	before, after := map[string]json.RawMessage{}, map[string]json.RawMessage{}
+	err = json.Unmarshal(data, &before)
+	if err != nil {
+		return models.ChangeConfig{}, errors.Wrap(err, "unmarshal person")
+	}
+	// Empty attributes and tags are omitted, but patch may add to them.
+	if _, ok := before["attributes"]; !ok {
+		before["attributes"] = json.RawMessage("{}")
+	}
+	if _, ok := before["tags"]; !ok {
+		before["tags"] = json.RawMessage("[]")
+	}
+	document, err := json.Marshal(before)
+	if err != nil {
+		return models.ChangeConfig{}, errors.Wrap(err, "marshal person")
+	}
+	patched, err := patch.Apply(document)
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		return models.ChangeConfig{}, errors.Wrapf(models.ErrPatchTestFailed, "%v", err)
+	}
+	if err != nil {
+		return models.ChangeConfig{}, errors.Wrapf(models.ErrInvalidPatch, "%v", err)
+	}
+
+	err = json.Unmarshal(patched, &after)
+	if err != nil {
+		return models.ChangeConfig{}, errors.Wrapf(models.ErrInvalidPatch, "patched person is not an object: %v", err)
+	}
+	mergePatch := diff(before, after)
+	if _, ok := mergePatch["version"]; ok {
+		return models.ChangeConfig{}, errors.Wrap(models.ErrInvalidPatch, "version can't be changed")
+	}
+	// Merge patch merges attributes, so the ones removed by patch must be cleared one by one.
+	if value, ok := mergePatch["attributes"]; ok && !bytes.Equal(value, []byte("null")) {
+		beforeAttributes, afterAttributes := map[string]json.RawMessage{}, map[string]json.RawMessage{}
+		err = json.Unmarshal(before["attributes"], &beforeAttributes)
+		if err != nil {
+			return models.ChangeConfig{}, errors.Wrap(err, "unmarshal attributes")
+		}
+		err = json.Unmarshal(value, &afterAttributes)
+		if err != nil {
+			return models.ChangeConfig{}, errors.Wrapf(models.ErrInvalidPatch, "patched attributes are not an object: %v", err)
+		}
+		mergePatch["attributes"], err = json.Marshal(diff(beforeAttributes, afterAttributes))
+		if err != nil {
+			return models.ChangeConfig{}, errors.Wrap(err, "marshal attributes merge patch")
+		}
+	}
+	data, err = json.Marshal(mergePatch)
+	if err != nil {
+		return models.ChangeConfig{}, errors.Wrap(err, "marshal merge patch")
+	}
+	return models.ParseMergePatch(data)
+}
+
+// diff returns merge patch, turning object with members before into object with members after.
+// It clears removed members and sets changed ones.
+func diff(before map[string]json.RawMessage, after map[string]json.RawMessage) map[string]json.RawMessage {
+	mergePatch := map[string]json.RawMessage{}
+	for member, value := range before {
+		newValue, ok := after[member]
+		if !ok {
+			mergePatch[member] = json.RawMessage("null")
+		} else if !bytes.Equal(value, newValue) {
+			mergePatch[member] = newValue
+		}
+	}
+	for member, value := range after {
+		if _, ok := before[member]; !ok {
+			mergePatch[member] = value
+		}
+	}
+	return mergePatch
+}
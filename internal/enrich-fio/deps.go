@@ -2,6 +2,7 @@ package enrichfio
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -9,12 +10,35 @@ import (
 )
 
 // Storage is interface to interact with storage.
+// Every change of a person is written to outbox together with the change itself.
 type Storage interface {
+	Outbox
+	Imports
 	// Save saves given person in storage.
 	Save(ctx context.Context, person models.Person) error
-	// GetWithFilter returns []models.Person that match the given filter.
+	// SaveBatch saves all given people at once, recording them in history.
+	// People, already stored, are overwritten. If the same ID is given several times, the last person wins.
+	SaveBatch(ctx context.Context, people []models.Person) error
+	// GetWithFilter returns a page of people that match the given filter.
 	// Returns models.ErrPersonNotFound if no such people found in the storage.
-	GetWithFilter(ctx context.Context, filter models.FilterConfig, page int) ([]models.Person, error)
+	// Returns models.ErrInvalidCursor if opts.Cursor is malformed.
+	// Returns models.ErrInvalidSortKey if people can't be ordered by opts.Sort.
+	GetWithFilter(ctx context.Context, filter models.FilterConfig, opts models.ListOptions) (models.PeoplePage, error)
+	// Search returns a page of people, whose FIO matches the given query, the best matches first.
+	// Only people, matching the filter, are searched. opts.Cursor and opts.Sort are not supported.
+	// Returns models.ErrInvalidSearchQuery if query is empty or malformed.
+	Search(ctx context.Context, query models.SearchQuery, filter models.FilterConfig, opts models.ListOptions) (models.SearchPage, error)
+	// Stats returns statistics over people, matching the filter, grouped the way query asks. The largest groups go first.
+	// Returns models.ErrInvalidStatsQuery if people can't be grouped the requested way.
+	Stats(ctx context.Context, filter models.FilterConfig, query models.StatsQuery) (models.Stats, error)
+	// CountPeople returns how many people tenant from ctx keeps.
+	// Inside of WithTx transactions of the same tenant count one after another, and each sees people, saved by the ones,
+	// which counted before it, so checks of quota can't all pass together. Lock is held till the transaction ends.
+	CountPeople(ctx context.Context) (int64, error)
+	// Export calls fn with every person, matching the filter, in order of IDs, and stops at the first error fn returns.
+	// People are read from storage in batches, so memory use doesn't depend on their number.
+	// Returns models.ErrInvalidFilter if filter can't be applied.
+	Export(ctx context.Context, filter models.FilterConfig, fn func(person models.Person) error) error
 	// GetByID returns one models.Person by given ID.
 	// Returns models.ErrPersonNotFound if no such people found in the storage.
 	GetByID(ctx context.Context, id uuid.UUID) (models.Person, error)
@@ -23,11 +47,73 @@ type Storage interface {
 	DeleteByID(ctx context.Context, id uuid.UUID) error
 	// ChangeByID applies given changes person from storage by given ID.
 	// Returns models.ErrPersonNotFound if no such people found in the storage.
+	// Returns models.ErrVersionConflict if person's version differs from changes.ExpectedVersion.
 	ChangeByID(ctx context.Context, id uuid.UUID, changes models.ChangeConfig) error
+	// History returns all recorded revisions of person with given ID, oldest first.
+	History(ctx context.Context, id uuid.UUID) ([]models.Revision, error)
+	// GetRevision returns given revision of person with given ID.
+	// Returns models.ErrRevisionNotFound if no such revision recorded.
+	GetRevision(ctx context.Context, id uuid.UUID, revision int) (models.Revision, error)
+	// GetAsOf returns person with given ID as it was at given moment.
+	// Returns models.ErrPersonNotFound if person didn't exist at that moment.
+	GetAsOf(ctx context.Context, id uuid.UUID, at time.Time) (models.Person, error)
+	// Anonymize replaces person with given anonymized one, and forgets its history and events, as they keep personal data.
+	// Anonymized person is recorded in history and outbox as the only revision.
+	// Returns models.ErrPersonNotFound if no such people found in the storage.
+	Anonymize(ctx context.Context, anonymized models.Person) error
+	// Erase removes person with given ID with all its history and events, and leaves a tombstone.
+	// Erasing already erased person returns its tombstone.
+	// Returns models.ErrPersonNotFound if nothing is known about the person.
+	Erase(ctx context.Context, id uuid.UUID) (models.Tombstone, error)
+	// ExpiredPeople returns up to query.Limit IDs of people, matching the query, in order of IDs.
+	// Anonymized people are skipped by anonymize rules only.
+	// Returns models.ErrInvalidFilter if query.Filter can't be applied.
+	ExpiredPeople(ctx context.Context, query models.ExpiredQuery) ([]uuid.UUID, error)
+	// WithTx calls fn with storage, which operations all succeed or fail together.
+	// Transaction is committed if fn returns nil, and rolled back otherwise.
+	// Nested WithTx rolls back only operations made inside of it.
+	WithTx(ctx context.Context, fn func(tx Storage) error) error
 	// MigrateUp performs a database migration to the last available version.
 	MigrateUp(ctx context.Context) error
 }
 
+// Outbox is interface to events about changes of people, kept in storage till delivered.
+type Outbox interface {
+	// PendingEvents returns up to limit events, which are not delivered yet, in the order changes were made.
+	PendingEvents(ctx context.Context, limit int) ([]models.Event, error)
+	// MarkDelivered marks events with given IDs as delivered, so they are not pending anymore.
+	MarkDelivered(ctx context.Context, ids []int64) error
+	// DeleteDelivered deletes events, delivered before given moment, and returns how many were deleted.
+	DeleteDelivered(ctx context.Context, before time.Time) (int64, error)
+	// LockOutbox calls fn with outbox, which no other relay publishes from till fn returns, so every event is
+	// published once, and events about the same person stay in order.
+	// Returns models.ErrOutboxLocked without calling fn, if another relay holds the outbox.
+	LockOutbox(ctx context.Context, fn func(outbox Outbox) error) error
+}
+
+// Imports is interface to import jobs and rows of imported files, kept in storage so jobs can be resumed.
+type Imports interface {
+	// SaveImport saves given import job, overwriting the stored one. Counts of rows are not saved, they are computed from rows.
+	SaveImport(ctx context.Context, job models.ImportJob) error
+	// GetImport returns import job by given ID with counts of its rows.
+	// Returns models.ErrImportNotFound if no such job found in the storage.
+	GetImport(ctx context.Context, id uuid.UUID) (models.ImportJob, error)
+	// AddImportRows adds given rows to import job with given ID.
+	// Returns models.ErrImportNotFound if no such job found in the storage.
+	AddImportRows(ctx context.Context, id uuid.UUID, rows []models.ImportRow) error
+	// ImportRows returns rows of import job with given ID, matching the query, in order of their numbers.
+	// Returns models.ErrImportNotFound if no such job found in the storage.
+	ImportRows(ctx context.Context, id uuid.UUID, query models.ImportRowsQuery) ([]models.ImportRow, error)
+	// SaveImportResults updates statuses, person IDs and errors of given rows of import job with given ID.
+	SaveImportResults(ctx context.Context, id uuid.UUID, rows []models.ImportRow) error
+	// ClaimImport claims import job with given ID for the run and sets its status to running with no error.
+	// Job is claimed anew if it's neither done nor running, or if claim of the run, running it, has expired.
+	// Claim is renewed only if it's held by the same run, and the job is still running.
+	// Returns models.ErrImportClaimed if job can't be claimed.
+	// Returns models.ErrImportNotFound if no such job found in the storage.
+	ClaimImport(ctx context.Context, id uuid.UUID, claim models.ImportClaim) error
+}
+
 // ProbableGender is interface to get the most likely gender for a given person.
 type ProbableGender interface {
 	// Get returns the most likely gender for a given person.
@@ -40,8 +126,8 @@ type ProbableAge interface {
 	Get(ctx context.Context, name string, surname string, patronymic string) (int, error)
 }
 
-// ProbableNationality is interface to get the most likely nationality for a given person.
+// ProbableNationality is interface to get probable nationalities for a given person.
 type ProbableNationality interface {
-	// Get returns the most likely nationality for a given person
-	Get(ctx context.Context, name string, surname string, patronymic string) (string, error)
+	// Get returns probable nationalities for a given person, the most likely first.
+	Get(ctx context.Context, name string, surname string, patronymic string) ([]models.Nationality, error)
 }
@@ -15,6 +15,10 @@ type Service struct {
 	ProbableAge         ProbableAge
 	ProbableGender      ProbableGender
 	ProbableNationality ProbableNationality
+	// RetentionRules tell what to do with people, kept too long. They are applied by ApplyRetention.
+	RetentionRules []models.RetentionRule
+	// Tenancy tells tenants of requests apart. Everything belongs to models.DefaultTenant if it's nil.
+	Tenancy *Tenancy
 }
 
 // New returns Service service.
@@ -27,33 +31,100 @@ func New(storage Storage, probableAge ProbableAge, probableGender ProbableGender
 	}
 }
 
-func (s *Service) AddPerson(ctx context.Context, name string, surname string, patronymic string) error {
+// AddPerson saves a new person with given FIO, attributes and tags, enriched with age, gender and nationality.
+// Returns models.ErrInvalidChange if attributes or tags are invalid.
+func (s *Service) AddPerson(ctx context.Context, name string, surname string, patronymic string, attributes map[string]string, tags []string) error {
+	person, err := s.NewPerson(ctx, name, surname, patronymic, attributes, tags)
+	if err != nil {
+		return err
+	}
+
+	// Person is saved in transaction, so it's rolled back if the tenant keeps too many people.
+	return s.Storage.WithTx(ctx, func(tx Storage) error {
+		err := tx.Save(ctx, person)
+		if err != nil {
+			return errors.Wrap(err, "save person in storage")
+		}
+		return s.checkPeopleQuota(ctx, tx)
+	})
+}
+
+// NewPerson returns new person with given FIO, attributes and tags, enriched with age, gender and nationality.
+// Person is not saved.
+// Returns models.ErrInvalidChange if attributes or tags are invalid.
+func (s *Service) NewPerson(ctx context.Context, name string, surname string, patronymic string, attributes map[string]string, tags []string) (models.Person, error) {
+	err := models.ValidateLabels(attributes, tags)
+	if err != nil {
+		return models.Person{}, err
+	}
 	person, err := s.enrich(ctx, name, surname, patronymic)
 	if err != nil {
-		return errors.Wrap(err, "enrich")
+		return models.Person{}, errors.Wrap(err, "enrich")
 	}
+	person.Attributes, person.Tags = attributes, tags
+	return person, nil
+}
+
+// AddPeople saves already enriched people at once. Use it for bulk ingestion instead of AddPerson.
+// Returns models.ErrQuotaExceeded, and saves none of the people, if the tenant would keep more people than it may.
+func (s *Service) AddPeople(ctx context.Context, people []models.Person) error {
+	return s.Storage.WithTx(ctx, func(tx Storage) error {
+		err := tx.SaveBatch(ctx, people)
+		if err != nil {
+			return errors.Wrap(err, "save people batch in storage")
+		}
+		return s.checkPeopleQuota(ctx, tx)
+	})
+}
 
-	err = s.Storage.Save(ctx, person)
+// EnrichPerson enriches already stored person with fresh age, gender and nationality.
+// Returns the person as stored after the change, with its new version.
+func (s *Service) EnrichPerson(ctx context.Context, id uuid.UUID) (models.Person, error) {
+	person, err := s.Storage.GetByID(ctx, id)
 	if err != nil {
-		return errors.Wrap(err, "save person in storage")
+		return models.Person{}, errors.Wrap(err, "get person by id")
 	}
-	return nil
+	enriched, err := s.enrich(ctx, person.Name, person.Surname, person.Patronymic)
+	if err != nil {
+		return models.Person{}, errors.Wrap(err, "enrich")
+	}
+	changes := models.ChangeConfig{
+		Age:           models.Some(enriched.Age),
+		Gender:        models.Some(enriched.Gender),
+		Nationalities: models.Some(enriched.Nationalities),
+	}
+	err = s.Storage.ChangeByID(models.WithOperation(ctx, models.OperationEnrich), id, changes)
+	if err != nil {
+		return models.Person{}, errors.Wrap(err, "change person by id")
+	}
+	person, err = s.Storage.GetByID(ctx, id)
+	if err != nil {
+		return models.Person{}, errors.Wrap(err, "get enriched person")
+	}
+	return person, nil
 }
 
+// enrich returns new person with given FIO, enriched by providers of tenant from ctx.
+// Returns models.ErrQuotaExceeded if the tenant enriched too many people in the last minute.
 func (s *Service) enrich(ctx context.Context, name string, surname string, patronymic string) (models.Person, error) {
-	gender, err := s.ProbableGender.Get(ctx, name, surname, patronymic)
+	err := s.allowEnrichment(ctx)
+	if err != nil {
+		return models.Person{}, err
+	}
+	providers := s.providers(ctx)
+	gender, err := providers.Gender.Get(ctx, name, surname, patronymic)
 	if err != nil {
 		return models.Person{}, errors.Wrap(err, "get probable gender")
 	}
 
-	age, err := s.ProbableAge.Get(ctx, name, surname, patronymic)
+	age, err := providers.Age.Get(ctx, name, surname, patronymic)
 	if err != nil {
-		return models.Person{}, errors.Wrap(err, "get probable gender")
+		return models.Person{}, errors.Wrap(err, "get probable age")
 	}
 
-	nationality, err := s.ProbableNationality.Get(ctx, name, surname, patronymic)
+	nationalities, err := providers.Nationality.Get(ctx, name, surname, patronymic)
 	if err != nil {
-		return models.Person{}, errors.Wrap(err, "get probable nationality")
+		return models.Person{}, errors.Wrap(err, "get probable nationalities")
 	}
 
 	id, err := uuid.NewRandom()
@@ -62,13 +133,14 @@ func (s *Service) enrich(ctx context.Context, name string, surname string, patro
 	}
 
 	person := models.Person{
-		ID:          id,
-		Name:        name,
-		Surname:     surname,
-		Patronymic:  patronymic,
-		Gender:      gender,
-		Age:         age,
-		Nationality: nationality,
+		ID:            id,
+		Name:          name,
+		Surname:       surname,
+		Patronymic:    patronymic,
+		Gender:        gender,
+		Age:           age,
+		Nationality:   models.PrimaryNationality(nationalities),
+		Nationalities: nationalities,
 	}
 
 	return person, nil
@@ -0,0 +1,63 @@
+package enrichfio_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"enrich-fio/internal/config"
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/enrich-fio/storage/memory"
+	"enrich-fio/internal/models"
+)
+
+// provider enriches every person the same way.
+type provider struct {
+	age           int
+	gender        models.Gender
+	nationalities []models.Nationality
+}
+
+func (p provider) Get(ctx context.Context, name string, surname string, patronymic string) (int, error) {
+	return p.age, nil
+}
+
+// genderProvider enriches every person with gender of provider.
+type genderProvider provider
+
+func (p genderProvider) Get(ctx context.Context, name string, surname string, patronymic string) (models.Gender, error) {
+	return p.gender, nil
+}
+
+// nationalityProvider enriches every person with nationalities of provider.
+type nationalityProvider provider
+
+func (p nationalityProvider) Get(ctx context.Context, name string, surname string, patronymic string) ([]models.Nationality, error) {
+	return p.nationalities, nil
+}
+
+func TestEnrichPerson(t *testing.T) {
+	ctx := context.Background()
+	p := provider{age: 40, gender: models.GenderFemale, nationalities: []models.Nationality{{Country: "KZ", Probability: 0.5}}}
+	service := enrichfio.New(memory.New(&config.DBConfig{DefaultPageSize: 5, MaxPageSize: 100}), p, genderProvider(p),
+		nationalityProvider(p))
+	person := models.Person{ID: uuid.New(), Name: "Anna", Surname: "Petrova", Age: 30, Gender: models.GenderMale}
+	err := service.Storage.Save(ctx, person)
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	enriched, err := service.EnrichPerson(ctx, person.ID)
+	if err != nil {
+		t.Fatalf("enrich: %v", err)
+	}
+	stored, err := service.Storage.GetByID(ctx, person.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if enriched.Age != 40 || enriched.Gender != models.GenderFemale || enriched.Nationality != "KZ" ||
+		!enriched.Equal(stored) || enriched.Version != stored.Version {
+		t.Fatalf("got enriched %+v, want stored %+v", enriched, stored)
+	}
+}
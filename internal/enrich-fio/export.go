@@ -0,0 +1,34 @@
+package enrichfio
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/enrich-fio/export"
+	"enrich-fio/internal/models"
+)
+
+// ExportPeople writes all people, matching the filter, to w in given format, and returns how many were written.
+// People are streamed from storage, so memory use doesn't depend on their number.
+// Nothing is written to w, if format or filter is invalid.
+func (s *Service) ExportPeople(ctx context.Context, filter models.FilterConfig, format models.ExportFormat, w io.Writer) (int64, error) {
+	writer, err := export.NewWriter(w, format)
+	if err != nil {
+		return 0, err
+	}
+	var exported int64
+	err = s.Storage.Export(ctx, filter, func(person models.Person) error {
+		exported++
+		return writer.Write(person)
+	})
+	if err != nil {
+		return exported, errors.Wrap(err, "export people from storage")
+	}
+	err = writer.Close()
+	if err != nil {
+		return exported, err
+	}
+	return exported, nil
+}
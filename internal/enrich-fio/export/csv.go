@@ -0,0 +1,79 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// _csvHeader are columns of people, written as CSV.
+var _csvHeader = []string{"id", "name", "surname", "patronymic", "age", "gender", "nationality",
+	"nationalities", "attributes", "tags", "version"}
+
+// csvWriter writes people as CSV with a header. Nationalities, attributes and tags are written as JSON.
+type csvWriter struct {
+	w *csv.Writer
+	// headerWritten tells if the header is written already, so empty export still has one.
+	headerWritten bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (w *csvWriter) Write(person models.Person) error {
+	err := w.writeHeader()
+	if err != nil {
+		return err
+	}
+	nationalities, err := jsonColumn(person.Nationalities, "[]")
+	if err != nil {
+		return errors.Wrap(err, "marshal nationalities")
+	}
+	attributes, err := jsonColumn(person.Attributes, "{}")
+	if err != nil {
+		return errors.Wrap(err, "marshal attributes")
+	}
+	tags, err := jsonColumn(person.Tags, "[]")
+	if err != nil {
+		return errors.Wrap(err, "marshal tags")
+	}
+	err = w.w.Write([]string{person.ID.String(), person.Name, person.Surname, person.Patronymic,
+		strconv.Itoa(person.Age), string(person.Gender), person.Nationality,
+		nationalities, attributes, tags, strconv.FormatInt(person.Version, 10)})
+	return errors.Wrap(err, "write csv record")
+}
+
+func (w *csvWriter) Close() error {
+	err := w.writeHeader()
+	if err != nil {
+		return err
+	}
+	w.w.Flush()
+	return errors.Wrap(w.w.Error(), "flush csv")
+}
+
+func (w *csvWriter) writeHeader() error {
+	if w.headerWritten {
+		return nil
+	}
+	w.headerWritten = true
+	return errors.Wrap(w.w.Write(_csvHeader), "write csv header")
+}
+
+// jsonColumn returns value as JSON, or empty one, if value is empty.
+func jsonColumn[T any](value T, empty string) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	if string(data) == "null" {
+		return empty, nil
+	}
+	return string(data), nil
+}
@@ -0,0 +1,46 @@
+// Package export writes people in formats, analytics can read.
+// People are written one by one as they are read from storage, so memory use doesn't depend on their number.
+package export
+
+import (
+	"io"
+
+	"enrich-fio/internal/models"
+)
+
+// Writer writes people to the underlying writer in some format.
+type Writer interface {
+	// Write writes person. It may be buffered until Close.
+	Write(person models.Person) error
+	// Close writes buffered people and ends the format. The underlying writer is not closed.
+	Close() error
+}
+
+// NewWriter returns writer of people to w in given format.
+// Returns models.ErrInvalidExportFormat if people can't be written in the format.
+func NewWriter(w io.Writer, format models.ExportFormat) (Writer, error) {
+	err := format.Validate()
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case models.ExportNDJSON:
+		return newNDJSONWriter(w), nil
+	case models.ExportParquet:
+		return newParquetWriter(w), nil
+	default:
+		return newCSVWriter(w), nil
+	}
+}
+
+// ContentType returns MIME type of people, written in given format.
+func ContentType(format models.ExportFormat) string {
+	switch format {
+	case models.ExportNDJSON:
+		return "application/x-ndjson"
+	case models.ExportParquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
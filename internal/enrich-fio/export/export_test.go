@@ -0,0 +1,211 @@
+package export_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/parquet-go/parquet-go"
+
+	"enrich-fio/internal/enrich-fio/export"
+	"enrich-fio/internal/models"
+)
+
+// _people are exported people, with values, which need quoting, and with nothing but FIO.
+var _people = []models.Person{
+	{
+		ID:          uuid.MustParse("7d3f8e5a-1c2b-4a6d-9e0f-1a2b3c4d5e6f"),
+		Name:        `Ivan, "the Great"`,
+		Surname:     "Ivanov\nSecond line",
+		Patronymic:  "Иванович",
+		Age:         42,
+		Gender:      models.GenderMale,
+		Nationality: "RU",
+		Nationalities: []models.Nationality{
+			{Country: "RU", Probability: 0.75},
+			{Country: "KZ", Probability: 0.125},
+		},
+		Attributes: map[string]string{"team": "A, B", "note": `say "hi"`, "json": `{"nested": [1, 2]}`, "html": "<b>&</b>"},
+		Tags:       []string{"vip", "with,comma"},
+		Version:    3,
+	},
+	{
+		ID:      uuid.MustParse("0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"),
+		Name:    "Anna",
+		Surname: "Petrova",
+		Version: 1,
+	},
+}
+
+// write returns people, written in given format.
+func write(t *testing.T, format models.ExportFormat, people []models.Person) []byte {
+	t.Helper()
+	buffer := &bytes.Buffer{}
+	writer, err := export.NewWriter(buffer, format)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	for _, person := range people {
+		err = writer.Write(person)
+		if err != nil {
+			t.Fatalf("write %+v: %v", person, err)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// assertPeople fails test if people, read back, differ from the written ones.
+func assertPeople(t *testing.T, got []models.Person, want []models.Person) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d people %+v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Fatalf("got person %+v, want %+v", got[i], want[i])
+		}
+	}
+}
+
+func TestCSV(t *testing.T) {
+	records, err := csv.NewReader(bytes.NewReader(write(t, models.ExportCSV, _people))).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	header := []string{"id", "name", "surname", "patronymic", "age", "gender", "nationality",
+		"nationalities", "attributes", "tags", "version"}
+	if len(records) == 0 || !slices.Equal(records[0], header) {
+		t.Fatalf("got records %q, want header %q first", records, header)
+	}
+	people := []models.Person{}
+	for _, record := range records[1:] {
+		var person models.Person
+		person.ID, err = uuid.Parse(record[0])
+		if err != nil {
+			t.Fatalf("parse id: %v", err)
+		}
+		person.Name, person.Surname, person.Patronymic = record[1], record[2], record[3]
+		person.Age, err = strconv.Atoi(record[4])
+		if err != nil {
+			t.Fatalf("parse age: %v", err)
+		}
+		person.Gender, person.Nationality = models.Gender(record[5]), record[6]
+		for i, value := range []any{&person.Nationalities, &person.Attributes, &person.Tags} {
+			err = json.Unmarshal([]byte(record[7+i]), value)
+			if err != nil {
+				t.Fatalf("unmarshal %s %q: %v", header[7+i], record[7+i], err)
+			}
+		}
+		person.Version, err = strconv.ParseInt(record[10], 10, 64)
+		if err != nil {
+			t.Fatalf("parse version: %v", err)
+		}
+		people = append(people, person)
+	}
+	assertPeople(t, people, _people)
+
+	// Missing nationalities, attributes and tags are written as empty JSON, not null.
+	if records[2][7] != "[]" || records[2][8] != "{}" || records[2][9] != "[]" {
+		t.Fatalf("got record %q, want empty JSON columns", records[2])
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	data := write(t, models.ExportNDJSON, _people)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	people := []models.Person{}
+	for scanner.Scan() {
+		var person models.Person
+		err := json.Unmarshal(scanner.Bytes(), &person)
+		if err != nil {
+			t.Fatalf("unmarshal %s: %v", scanner.Bytes(), err)
+		}
+		people = append(people, person)
+	}
+	assertPeople(t, people, _people)
+	// HTML isn't escaped, so values are read as they are by any tool.
+	if !bytes.Contains(data, []byte("<b>&</b>")) {
+		t.Fatalf("got %s, want HTML unescaped", data)
+	}
+}
+
+// parquetPerson is a row of person, read from parquet file.
+type parquetPerson struct {
+	ID            string `parquet:"id"`
+	Name          string `parquet:"name"`
+	Surname       string `parquet:"surname"`
+	Patronymic    string `parquet:"patronymic"`
+	Age           int64  `parquet:"age"`
+	Gender        string `parquet:"gender"`
+	Nationality   string `parquet:"nationality"`
+	Nationalities []struct {
+		Country     string  `parquet:"country"`
+		Probability float64 `parquet:"probability"`
+	} `parquet:"nationalities,list"`
+	Attributes map[string]string `parquet:"attributes"`
+	Tags       []string          `parquet:"tags,list"`
+	Version    int64             `parquet:"version"`
+}
+
+func TestParquet(t *testing.T) {
+	data := write(t, models.ExportParquet, _people)
+	rows, err := parquet.Read[parquetPerson](bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("read parquet: %v", err)
+	}
+	people := []models.Person{}
+	for _, row := range rows {
+		person := models.Person{
+			Name:        row.Name,
+			Surname:     row.Surname,
+			Patronymic:  row.Patronymic,
+			Age:         int(row.Age),
+			Gender:      models.Gender(row.Gender),
+			Nationality: row.Nationality,
+			Attributes:  row.Attributes,
+			Tags:        row.Tags,
+			Version:     row.Version,
+		}
+		person.ID, err = uuid.Parse(row.ID)
+		if err != nil {
+			t.Fatalf("parse id: %v", err)
+		}
+		for _, n := range row.Nationalities {
+			person.Nationalities = append(person.Nationalities, models.Nationality{Country: n.Country, Probability: n.Probability})
+		}
+		people = append(people, person)
+	}
+	assertPeople(t, people, _people)
+}
+
+func TestEmpty(t *testing.T) {
+	records, err := csv.NewReader(bytes.NewReader(write(t, models.ExportCSV, nil))).ReadAll()
+	if err != nil || len(records) != 1 || records[0][0] != "id" {
+		t.Fatalf("got csv records %q and error %v, want header only", records, err)
+	}
+	if data := write(t, models.ExportNDJSON, nil); len(data) != 0 {
+		t.Fatalf("got ndjson %q, want nothing", data)
+	}
+	data := write(t, models.ExportParquet, nil)
+	rows, err := parquet.Read[parquetPerson](bytes.NewReader(data), int64(len(data)))
+	if err != nil || len(rows) != 0 {
+		t.Fatalf("got parquet rows %+v and error %v, want valid file without rows", rows, err)
+	}
+}
+
+func TestNewWriterInvalidFormat(t *testing.T) {
+	_, err := export.NewWriter(&bytes.Buffer{}, models.ExportFormat("xml"))
+	if !errors.Is(err, models.ErrInvalidExportFormat) {
+		t.Fatalf("got error %v, want %v", err, models.ErrInvalidExportFormat)
+	}
+}
@@ -0,0 +1,32 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// ndjsonWriter writes people as JSON objects, one per line, the same as API returns them.
+type ndjsonWriter struct {
+	buffer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	buffer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	return &ndjsonWriter{buffer: buffer, encoder: encoder}
+}
+
+func (w *ndjsonWriter) Write(person models.Person) error {
+	return errors.Wrap(w.encoder.Encode(person), "encode person")
+}
+
+func (w *ndjsonWriter) Close() error {
+	return errors.Wrap(w.buffer.Flush(), "flush ndjson")
+}
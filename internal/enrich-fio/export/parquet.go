@@ -0,0 +1,74 @@
+package export
+
+import (
+	"io"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// _parquetRowGroupSize is a number of people in a row group. Row group is kept in memory until it's written.
+const _parquetRowGroupSize = 10000
+
+// parquetPerson is a row of person in parquet file.
+type parquetPerson struct {
+	ID            string               `parquet:"id"`
+	Name          string               `parquet:"name"`
+	Surname       string               `parquet:"surname"`
+	Patronymic    string               `parquet:"patronymic"`
+	Age           int64                `parquet:"age"`
+	Gender        string               `parquet:"gender"`
+	Nationality   string               `parquet:"nationality"`
+	Nationalities []parquetNationality `parquet:"nationalities,list"`
+	Attributes    map[string]string    `parquet:"attributes"`
+	Tags          []string             `parquet:"tags,list"`
+	Version       int64                `parquet:"version"`
+}
+
+// parquetNationality is a probable nationality of person in parquet file.
+type parquetNationality struct {
+	Country     string  `parquet:"country"`
+	Probability float64 `parquet:"probability"`
+}
+
+// parquetWriter writes people as parquet file, compressed with snappy.
+type parquetWriter struct {
+	w    *parquet.GenericWriter[parquetPerson]
+	rows []parquetPerson
+}
+
+func newParquetWriter(w io.Writer) *parquetWriter {
+	return &parquetWriter{
+		w: parquet.NewGenericWriter[parquetPerson](w,
+			parquet.Compression(&parquet.Snappy), parquet.MaxRowsPerRowGroup(_parquetRowGroupSize)),
+		rows: make([]parquetPerson, 1),
+	}
+}
+
+func (w *parquetWriter) Write(person models.Person) error {
+	row := parquetPerson{
+		ID:          person.ID.String(),
+		Name:        person.Name,
+		Surname:     person.Surname,
+		Patronymic:  person.Patronymic,
+		Age:         int64(person.Age),
+		Gender:      string(person.Gender),
+		Nationality: person.Nationality,
+		Attributes:  person.Attributes,
+		Tags:        person.Tags,
+		Version:     person.Version,
+	}
+	for _, n := range person.Nationalities {
+		row.Nationalities = append(row.Nationalities, parquetNationality{Country: n.Country, Probability: n.Probability})
+	}
+	// The same single row slice is written for every person.
+	w.rows[0] = row
+	_, err := w.w.Write(w.rows)
+	return errors.Wrap(err, "write parquet row")
+}
+
+func (w *parquetWriter) Close() error {
+	return errors.Wrap(w.w.Close(), "close parquet")
+}
@@ -0,0 +1,82 @@
+package enrichfio
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// History returns all recorded revisions of person with given ID, oldest first.
+func (s *Service) History(ctx context.Context, id uuid.UUID) ([]models.Revision, error) {
+	revisions, err := s.Storage.History(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "get history from storage")
+	}
+	return revisions, nil
+}
+
+// PersonAsOf returns person with given ID as it was at given moment.
+func (s *Service) PersonAsOf(ctx context.Context, id uuid.UUID, at time.Time) (models.Person, error) {
+	person, err := s.Storage.GetAsOf(ctx, id, at)
+	if err != nil {
+		return models.Person{}, errors.Wrap(err, "get person as of")
+	}
+	return person, nil
+}
+
+// RevertPerson brings person with given ID back to the state after given revision.
+// Deleted person is restored, if the tenant's quota allows. The revert itself is recorded in history as a new revision.
+// Returns the person as stored after the revert, with its current version.
+func (s *Service) RevertPerson(ctx context.Context, id uuid.UUID, revision int) (models.Person, error) {
+	ctx = models.WithOperation(ctx, models.OperationRevert)
+	var reverted models.Person
+	// Reading the revision and restoring the person succeed or fail together.
+	err := s.Storage.WithTx(ctx, func(tx Storage) error {
+		r, err := tx.GetRevision(ctx, id, revision)
+		if err != nil {
+			return errors.Wrap(err, "get revision")
+		}
+		if r.NewValue == nil {
+			return errors.Wrapf(models.ErrRevisionNotRestorable, "revision %d deleted the person", revision)
+		}
+		target := *r.NewValue
+		target.ID = id
+		current, err := tx.GetByID(ctx, id)
+		if errors.Is(err, models.ErrPersonNotFound) {
+			err = tx.Save(ctx, target)
+			if err == nil {
+				err = s.checkPeopleQuota(ctx, tx)
+			}
+		} else if err == nil {
+			err = tx.ChangeByID(ctx, id, models.ChangeConfig{
+				Name:          models.Some(target.Name),
+				Surname:       models.Some(target.Surname),
+				Patronymic:    models.Some(target.Patronymic),
+				Age:           models.Some(target.Age),
+				Gender:        models.Some(target.Gender),
+				Nationality:   models.Some(target.Nationality),
+				Nationalities: models.Some(target.Nationalities),
+				// Attributes are merged, so the ones added since the revision are removed explicitly.
+				Attributes: models.ReplaceAttributes(current.Attributes, target.Attributes),
+				Tags:       models.Some(target.Tags),
+			})
+		}
+		if err != nil {
+			return errors.Wrap(err, "restore person")
+		}
+		// Revision keeps the version person had back then, and the stored one is newer.
+		reverted, err = tx.GetByID(ctx, id)
+		if err != nil {
+			return errors.Wrap(err, "get reverted person")
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Person{}, err
+	}
+	return reverted, nil
+}
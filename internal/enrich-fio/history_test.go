@@ -0,0 +1,73 @@
+package enrichfio_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"enrich-fio/internal/config"
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/enrich-fio/storage/memory"
+	"enrich-fio/internal/models"
+)
+
+func TestRevertPerson(t *testing.T) {
+	ctx := context.Background()
+	service := enrichfio.New(memory.New(&config.DBConfig{DefaultPageSize: 5, MaxPageSize: 100}), nil, nil, nil)
+	person := models.Person{ID: uuid.New(), Name: "Ivan", Surname: "Ivanov", Age: 30}
+	err := service.Storage.Save(ctx, person)
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	err = service.Storage.ChangeByID(ctx, person.ID, models.ChangeConfig{Age: models.Some(31)})
+	if err != nil {
+		t.Fatalf("change: %v", err)
+	}
+
+	reverted, err := service.RevertPerson(ctx, person.ID, 1)
+	if err != nil {
+		t.Fatalf("revert: %v", err)
+	}
+	stored, err := service.Storage.GetByID(ctx, person.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if reverted.Age != 30 || !reverted.Equal(stored) || reverted.Version != stored.Version {
+		t.Fatalf("got reverted %+v, want stored %+v", reverted, stored)
+	}
+	// Version of the reverted person is the one to change it with.
+	err = service.Storage.ChangeByID(ctx, person.ID, models.ChangeConfig{Age: models.Some(32), ExpectedVersion: reverted.Version})
+	if err != nil {
+		t.Fatalf("change with version %d of reverted person: %v", reverted.Version, err)
+	}
+}
+
+func TestRevertPersonQuota(t *testing.T) {
+	ctx := models.WithTenant(context.Background(), "acme")
+	service := enrichfio.New(memory.New(&config.DBConfig{DefaultPageSize: 5, MaxPageSize: 100}), nil, nil, nil)
+	service.Tenancy = enrichfio.NewTenancy([]models.Tenant{{ID: "acme", Quota: models.Quota{MaxPeople: 1}}}, "", "tenant", nil)
+	deleted := models.Person{ID: uuid.New(), Name: "Ivan", Surname: "Ivanov"}
+	err := service.Storage.Save(ctx, deleted)
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	err = service.Storage.DeleteByID(ctx, deleted.ID)
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	err = service.Storage.Save(ctx, models.Person{ID: uuid.New(), Name: "Anna", Surname: "Petrova"})
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	_, err = service.RevertPerson(ctx, deleted.ID, 1)
+	if !errors.Is(err, models.ErrQuotaExceeded) {
+		t.Fatalf("got error %v restoring person over quota, want %v", err, models.ErrQuotaExceeded)
+	}
+	_, err = service.Storage.GetByID(ctx, deleted.ID)
+	if !errors.Is(err, models.ErrPersonNotFound) {
+		t.Fatalf("got error %v, want person left deleted", err)
+	}
+}
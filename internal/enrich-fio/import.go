@@ -0,0 +1,293 @@
+package enrichfio
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/enrich-fio/importfile"
+	"enrich-fio/internal/models"
+)
+
+const (
+	// _importReadBatchSize is a number of rows of imported file, added to storage at once.
+	_importReadBatchSize = 1000
+	// _importBatchSize is a number of rows, imported in a single transaction, so stopped job loses little work.
+	_importBatchSize = 100
+	// _importClaimTTL is how long claim of import job lasts, unless it's renewed. Run renews it with every batch of rows.
+	_importClaimTTL = 5 * time.Minute
+)
+
+// CreateImport reads rows of file from r, and saves them as a pending import job, which RunImport imports.
+// Rows without name or surname are failed right away.
+// Returns models.ErrInvalidImport, and saves nothing, if options are invalid or file can't be read with them.
+func (s *Service) CreateImport(ctx context.Context, r io.Reader, options models.ImportOptions) (models.ImportJob, error) {
+	options, err := options.WithDefaults()
+	if err != nil {
+		return models.ImportJob{}, err
+	}
+	reader, err := importfile.NewReader(r, options)
+	if err != nil {
+		return models.ImportJob{}, err
+	}
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return models.ImportJob{}, errors.Wrap(err, "generate id random")
+	}
+	now := time.Now()
+	job := models.ImportJob{ID: id, Status: models.ImportPending, Options: options, CreatedAt: now, UpdatedAt: now}
+
+	// Job is created in transaction, so file, which fails to be read, leaves no job behind.
+	err = s.Storage.WithTx(ctx, func(tx Storage) error {
+		err := tx.SaveImport(ctx, job)
+		if err != nil {
+			return errors.Wrap(err, "save import in storage")
+		}
+		rows := make([]models.ImportRow, 0, _importReadBatchSize)
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return errors.Wrapf(models.ErrInvalidImport, "%v", err)
+			}
+			row, err = newImportRow(row)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, row)
+			if len(rows) == _importReadBatchSize {
+				err = tx.AddImportRows(ctx, id, rows)
+				if err != nil {
+					return errors.Wrap(err, "add import rows to storage")
+				}
+				rows = rows[:0]
+			}
+		}
+		err = tx.AddImportRows(ctx, id, rows)
+		return errors.Wrap(err, "add import rows to storage")
+	})
+	if err != nil {
+		return models.ImportJob{}, err
+	}
+	return s.GetImport(ctx, id)
+}
+
+// newImportRow returns read row, validated and with ID of person, it's imported as.
+func newImportRow(row models.ImportRow) (models.ImportRow, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return models.ImportRow{}, errors.Wrap(err, "generate id random")
+	}
+	row.PersonID = id
+	if row.Status != models.ImportRowPending {
+		return row, nil
+	}
+	if row.Name == "" {
+		row.Status, row.Error = models.ImportRowFailed, "name required"
+	} else if row.Surname == "" {
+		row.Status, row.Error = models.ImportRowFailed, "surname required"
+	}
+	return row, nil
+}
+
+// GetImport returns import job by given ID with counts of its rows.
+// Returns models.ErrImportNotFound if no such job found.
+func (s *Service) GetImport(ctx context.Context, id uuid.UUID) (models.ImportJob, error) {
+	job, err := s.Storage.GetImport(ctx, id)
+	if err != nil {
+		return models.ImportJob{}, errors.Wrap(err, "get import from storage")
+	}
+	return job, nil
+}
+
+// ClaimImport claims import job with given ID for a new run, so no other run imports its rows at the same time,
+// and returns the running job, which is passed to RunImport. Claim of a run, which crashed, expires,
+// so its job can be claimed again. Job, which is done already, is returned as it is, without claiming it.
+// Returns models.ErrImportClaimed if job is run by another run.
+// Returns models.ErrImportNotFound if no such job found.
+func (s *Service) ClaimImport(ctx context.Context, id uuid.UUID) (models.ImportJob, error) {
+	job, err := s.GetImport(ctx, id)
+	if err != nil {
+		return models.ImportJob{}, err
+	}
+	if job.Status == models.ImportDone {
+		return job, nil
+	}
+	runner, err := uuid.NewRandom()
+	if err != nil {
+		return models.ImportJob{}, errors.Wrap(err, "generate runner random")
+	}
+	err = s.Storage.ClaimImport(ctx, id, models.ImportClaim{Runner: runner, Until: time.Now().Add(_importClaimTTL)})
+	if err != nil {
+		return models.ImportJob{}, errors.Wrap(err, "claim import in storage")
+	}
+	job, err = s.GetImport(ctx, id)
+	if err != nil {
+		return models.ImportJob{}, err
+	}
+	job.Runner = runner
+	return job, nil
+}
+
+// RunImport imports pending rows of import job, claimed by ClaimImport, in batches,
+// and returns the job, when it's done or paused.
+// Running or paused job is resumed: every row is imported as the same person, so rows, imported by a crashed run,
+// are overwritten rather than duplicated. Rows, failed to be enriched or saved, are failed with the reason.
+// Job is paused, and returned along with the error, if enrichment API is unavailable or the tenant exceeds its quota,
+// or on any error of storage.
+// Returns models.ErrImportClaimed, leaving the job as it is, if claim of the run has expired, and the job is claimed
+// by another run, or if the job isn't claimed at all.
+func (s *Service) RunImport(ctx context.Context, job models.ImportJob) (models.ImportJob, error) {
+	if job.Status == models.ImportDone {
+		return job, nil
+	}
+	ctx = models.WithAudit(ctx, models.Audit{Actor: models.AuditFromContext(ctx).Actor, Source: models.SourceImport})
+
+	after := 0
+	for {
+		rows, err := s.Storage.ImportRows(ctx, job.ID, models.ImportRowsQuery{After: after, Limit: _importBatchSize, Pending: true})
+		if err != nil {
+			return s.pauseImport(ctx, job, errors.Wrap(err, "get import rows from storage"))
+		}
+		if len(rows) == 0 {
+			break
+		}
+		after = rows[len(rows)-1].Row
+		err = s.importRows(ctx, job, rows)
+		if errors.Is(err, models.ErrImportClaimed) {
+			return job, err
+		}
+		if err != nil {
+			return s.pauseImport(ctx, job, err)
+		}
+	}
+
+	err := s.setImportStatus(ctx, &job, models.ImportDone, "")
+	if err != nil {
+		return models.ImportJob{}, err
+	}
+	return s.GetImport(ctx, job.ID)
+}
+
+// importRows imports given pending rows of job along with their results.
+// Rows up to the one, enrichment of which fails for a reason, which may go away, are imported, and the error is returned.
+func (s *Service) importRows(ctx context.Context, job models.ImportJob, rows []models.ImportRow) error {
+	people := make([]models.Person, 0, len(rows))
+	results := make([]models.ImportRow, 0, len(rows))
+	var stopErr error
+	for _, row := range rows {
+		person := models.Person{Name: row.Name, Surname: row.Surname, Patronymic: row.Patronymic}
+		if job.Options.Enrich {
+			var err error
+			person, err = s.NewPerson(ctx, row.Name, row.Surname, row.Patronymic, nil, nil)
+			if code := models.CodeOf(err); code == models.CodeUpstreamUnavailable || code == models.CodeQuotaExceeded {
+				stopErr = errors.Wrapf(err, "enrich row %d", row.Row)
+				break
+			}
+			if err != nil {
+				row.Status, row.Error = models.ImportRowFailed, err.Error()
+				results = append(results, row)
+				continue
+			}
+		}
+		person.ID = row.PersonID
+		people = append(people, person)
+		row.Status = models.ImportRowImported
+		results = append(results, row)
+	}
+
+	// Rows are marked in the same transaction, people are saved in, so no row is imported twice.
+	// The transaction renews the claim first, so run, which lost it, saves nothing.
+	err := s.Storage.WithTx(ctx, func(tx Storage) error {
+		err := renewImport(ctx, tx, job)
+		if err != nil {
+			return err
+		}
+		err = tx.SaveBatch(ctx, people)
+		if err != nil {
+			return errors.Wrap(err, "save people batch in storage")
+		}
+		err = s.checkPeopleQuota(ctx, tx)
+		if err != nil {
+			return err
+		}
+		return errors.Wrap(tx.SaveImportResults(ctx, job.ID, results), "save import results in storage")
+	})
+	if err != nil {
+		return err
+	}
+	return stopErr
+}
+
+// pauseImport pauses job, stopped by err, and returns it along with err.
+func (s *Service) pauseImport(ctx context.Context, job models.ImportJob, err error) (models.ImportJob, error) {
+	// Job is paused even if ctx is canceled, so it's not left running.
+	ctx = context.WithoutCancel(ctx)
+	pauseErr := s.setImportStatus(ctx, &job, models.ImportPaused, err.Error())
+	if pauseErr != nil {
+		return models.ImportJob{}, errors.Wrapf(err, "pause import failed: %v", pauseErr)
+	}
+	paused, getErr := s.GetImport(ctx, job.ID)
+	if getErr != nil {
+		return job, err
+	}
+	return paused, err
+}
+
+// setImportStatus saves job with given status and error, which releases the claim of the run.
+// Returns models.ErrImportClaimed, and saves nothing, if the run has lost the claim.
+func (s *Service) setImportStatus(ctx context.Context, job *models.ImportJob, status models.ImportStatus, reason string) error {
+	job.Status, job.Error, job.UpdatedAt = status, reason, time.Now()
+	return s.Storage.WithTx(ctx, func(tx Storage) error {
+		err := renewImport(ctx, tx, *job)
+		if err != nil {
+			return err
+		}
+		return errors.Wrap(tx.SaveImport(ctx, *job), "save import in storage")
+	})
+}
+
+// renewImport renews claim of job by its run in tx.
+// Returns models.ErrImportClaimed if the run has lost the claim.
+func renewImport(ctx context.Context, tx Storage, job models.ImportJob) error {
+	claim := models.ImportClaim{Runner: job.Runner, Until: time.Now().Add(_importClaimTTL), Renew: true}
+	return errors.Wrap(tx.ClaimImport(ctx, job.ID, claim), "renew import claim in storage")
+}
+
+// ImportReport writes results of all rows of import job with given ID to w in given format.
+// Nothing is written to w, if format is invalid or no such job found.
+// Returns models.ErrInvalidImport if format is unknown.
+// Returns models.ErrImportNotFound if no such job found.
+func (s *Service) ImportReport(ctx context.Context, id uuid.UUID, format models.ImportFormat, w io.Writer) error {
+	writer, err := importfile.NewReportWriter(w, format)
+	if err != nil {
+		return err
+	}
+	_, err = s.GetImport(ctx, id)
+	if err != nil {
+		return err
+	}
+	after := 0
+	for {
+		rows, err := s.Storage.ImportRows(ctx, id, models.ImportRowsQuery{After: after, Limit: _importReadBatchSize})
+		if err != nil {
+			return errors.Wrap(err, "get import rows from storage")
+		}
+		for _, row := range rows {
+			err = writer.Write(row)
+			if err != nil {
+				return err
+			}
+		}
+		if len(rows) < _importReadBatchSize {
+			break
+		}
+		after = rows[len(rows)-1].Row
+	}
+	return writer.Close()
+}
@@ -0,0 +1,128 @@
+package importfile
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// csvReader reads rows of CSV file with a header, naming the columns.
+type csvReader struct {
+	r *csv.Reader
+	// name, surname and patronymic are indexes of columns, FIO is read from. Patronymic is -1, if there is no such column.
+	name, surname, patronymic int
+	row                       int
+}
+
+func newCSVReader(r io.Reader, columns models.ImportColumns) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	// Short rows miss trailing columns, which are read as empty.
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.Wrap(models.ErrInvalidImport, "csv file has no header")
+	}
+	if err != nil {
+		return nil, errors.Wrapf(models.ErrInvalidImport, "read csv header: %v", err)
+	}
+	if len(header) != 0 {
+		// Spreadsheets often start CSV files with byte order mark.
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	indexes := make(map[string]int, len(header))
+	for i, column := range header {
+		if _, ok := indexes[strings.TrimSpace(column)]; !ok {
+			indexes[strings.TrimSpace(column)] = i
+		}
+	}
+	reader := &csvReader{r: cr, patronymic: -1}
+	var ok bool
+	reader.name, ok = indexes[columns.Name]
+	if !ok {
+		return nil, errors.Wrapf(models.ErrInvalidImport, "csv header has no name column %q", columns.Name)
+	}
+	reader.surname, ok = indexes[columns.Surname]
+	if !ok {
+		return nil, errors.Wrapf(models.ErrInvalidImport, "csv header has no surname column %q", columns.Surname)
+	}
+	if i, ok := indexes[columns.Patronymic]; ok {
+		reader.patronymic = i
+	}
+	return reader, nil
+}
+
+func (r *csvReader) Read() (models.ImportRow, error) {
+	record, err := r.r.Read()
+	if err == io.EOF {
+		return models.ImportRow{}, io.EOF
+	}
+	r.row++
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return models.ImportRow{Row: r.row, Status: models.ImportRowFailed, Error: parseErr.Error()}, nil
+	}
+	if err != nil {
+		return models.ImportRow{}, errors.Wrapf(err, "read row %d", r.row)
+	}
+	return models.ImportRow{
+		Row:        r.row,
+		Status:     models.ImportRowPending,
+		Name:       field(record, r.name),
+		Surname:    field(record, r.surname),
+		Patronymic: field(record, r.patronymic),
+	}, nil
+}
+
+// field returns trimmed value of i-th field of record, or empty one, if record is too short.
+func field(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// _reportHeader are columns of report, written as CSV.
+var _reportHeader = []string{"row", "status", "personId", "name", "surname", "patronymic", "error"}
+
+// csvReportWriter writes results of rows as CSV with a header.
+type csvReportWriter struct {
+	w *csv.Writer
+	// headerWritten tells if the header is written already, so empty report still has one.
+	headerWritten bool
+}
+
+func newCSVReportWriter(w io.Writer) *csvReportWriter {
+	return &csvReportWriter{w: csv.NewWriter(w)}
+}
+
+func (w *csvReportWriter) Write(row models.ImportRow) error {
+	err := w.writeHeader()
+	if err != nil {
+		return err
+	}
+	err = w.w.Write([]string{strconv.Itoa(row.Row), string(row.Status), row.PersonID.String(),
+		row.Name, row.Surname, row.Patronymic, row.Error})
+	return errors.Wrap(err, "write csv record")
+}
+
+func (w *csvReportWriter) Close() error {
+	err := w.writeHeader()
+	if err != nil {
+		return err
+	}
+	w.w.Flush()
+	return errors.Wrap(w.w.Error(), "flush csv")
+}
+
+func (w *csvReportWriter) writeHeader() error {
+	if w.headerWritten {
+		return nil
+	}
+	w.headerWritten = true
+	return errors.Wrap(w.w.Write(_reportHeader), "write csv header")
+}
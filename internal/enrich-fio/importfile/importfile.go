@@ -0,0 +1,60 @@
+// Package importfile reads rows of files, people are imported from, and writes reports about results of their import.
+// Rows are read one by one, so memory use doesn't depend on size of the file.
+package importfile
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// Reader reads rows of imported file.
+type Reader interface {
+	// Read returns the next row of file, numbered from 1, or io.EOF, if there are no more rows.
+	// Malformed row is returned failed with the reason, and the rows after it are still read.
+	Read() (models.ImportRow, error)
+}
+
+// NewReader returns reader of rows of r, in format and with columns, given by options.
+// Returns models.ErrInvalidImport if format is unknown or CSV header lacks name or surname column.
+func NewReader(r io.Reader, options models.ImportOptions) (Reader, error) {
+	switch options.Format {
+	case models.ImportCSV:
+		return newCSVReader(r, options.Columns)
+	case models.ImportNDJSON:
+		return newNDJSONReader(r, options.Columns), nil
+	default:
+		return nil, errors.Wrapf(models.ErrInvalidImport, "unknown format %q", options.Format)
+	}
+}
+
+// ReportWriter writes results of imported rows to the underlying writer in some format.
+type ReportWriter interface {
+	// Write writes row. It may be buffered until Close.
+	Write(row models.ImportRow) error
+	// Close writes buffered rows. The underlying writer is not closed.
+	Close() error
+}
+
+// NewReportWriter returns writer of results of rows to w in given format.
+// Returns models.ErrInvalidImport if format is unknown.
+func NewReportWriter(w io.Writer, format models.ImportFormat) (ReportWriter, error) {
+	switch format {
+	case models.ImportCSV:
+		return newCSVReportWriter(w), nil
+	case models.ImportNDJSON:
+		return newNDJSONReportWriter(w), nil
+	default:
+		return nil, errors.Wrapf(models.ErrInvalidImport, "unknown report format %q", format)
+	}
+}
+
+// ContentType returns MIME type of report, written in given format.
+func ContentType(format models.ImportFormat) string {
+	if format == models.ImportNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
@@ -0,0 +1,236 @@
+package importfile_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"enrich-fio/internal/enrich-fio/importfile"
+	"enrich-fio/internal/models"
+)
+
+// readAll returns all rows of file, read with given options.
+func readAll(t *testing.T, file string, options models.ImportOptions) []models.ImportRow {
+	t.Helper()
+	options, err := options.WithDefaults()
+	if err != nil {
+		t.Fatalf("options: %v", err)
+	}
+	reader, err := importfile.NewReader(strings.NewReader(file), options)
+	if err != nil {
+		t.Fatalf("new reader: %v", err)
+	}
+	rows := []models.ImportRow{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows
+		}
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// assertRows fails test if rows differ from the wanted ones. Errors of failed rows are only checked to be present.
+func assertRows(t *testing.T, got []models.ImportRow, want []models.ImportRow) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows %+v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if want[i].Status == models.ImportRowFailed {
+			if got[i].Row != want[i].Row || got[i].Status != models.ImportRowFailed || got[i].Error == "" {
+				t.Fatalf("got row %+v, want row %d failed with the reason", got[i], want[i].Row)
+			}
+			continue
+		}
+		if got[i] != want[i] {
+			t.Fatalf("got row %+v, want %+v", got[i], want[i])
+		}
+	}
+}
+
+func pending(row int, name string, surname string, patronymic string) models.ImportRow {
+	return models.ImportRow{Row: row, Status: models.ImportRowPending, Name: name, Surname: surname, Patronymic: patronymic}
+}
+
+func failed(row int) models.ImportRow {
+	return models.ImportRow{Row: row, Status: models.ImportRowFailed}
+}
+
+func TestCSV(t *testing.T) {
+	file := "\ufeffsurname, name ,patronymic,age\n" +
+		"Ivanov,Ivan,Ivanovich,30\n" +
+		`"Smith, Jr.","John ""Johnny""",,` + "\n" +
+		`"O'Brien","Mary` + "\n" + `Ann",Patrick` + "\n" +
+		"Petrova\n" +
+		"  Sidorov  ,  Petr  \n"
+	assertRows(t, readAll(t, file, models.ImportOptions{}), []models.ImportRow{
+		pending(1, "Ivan", "Ivanov", "Ivanovich"),
+		pending(2, `John "Johnny"`, "Smith, Jr.", ""),
+		pending(3, "Mary\nAnn", "O'Brien", "Patrick"),
+		// Short rows miss trailing columns.
+		pending(4, "", "Petrova", ""),
+		pending(5, "Petr", "Sidorov", ""),
+	})
+}
+
+func TestCSVColumns(t *testing.T) {
+	file := "id,first,last,email\n" +
+		"1,Ivan,Ivanov,ivan@example.com\n" +
+		"2,Anna,Petrova,\n"
+	options := models.ImportOptions{Columns: models.ImportColumns{Name: "first", Surname: "last", Patronymic: "middle"}}
+	// Missing patronymic column is read as empty.
+	assertRows(t, readAll(t, file, options), []models.ImportRow{
+		pending(1, "Ivan", "Ivanov", ""),
+		pending(2, "Anna", "Petrova", ""),
+	})
+
+	for _, columns := range []models.ImportColumns{{Name: "name", Surname: "last"}, {Name: "first", Surname: "surname"}} {
+		options, _ := models.ImportOptions{Columns: columns}.WithDefaults()
+		_, err := importfile.NewReader(strings.NewReader(file), options)
+		if !errors.Is(err, models.ErrInvalidImport) {
+			t.Fatalf("got error %v for columns %+v, want %v", err, columns, models.ErrInvalidImport)
+		}
+	}
+}
+
+func TestCSVMalformed(t *testing.T) {
+	file := "name,surname\n" +
+		"Ivan,Ivanov\n" +
+		`Anna,Pet"rova` + "\n" +
+		"Petr,Sidorov\n"
+	// Malformed row fails, and rows after it are still read.
+	assertRows(t, readAll(t, file, models.ImportOptions{}), []models.ImportRow{
+		pending(1, "Ivan", "Ivanov", ""),
+		failed(2),
+		pending(3, "Petr", "Sidorov", ""),
+	})
+
+	options, _ := models.ImportOptions{}.WithDefaults()
+	_, err := importfile.NewReader(strings.NewReader(""), options)
+	if !errors.Is(err, models.ErrInvalidImport) {
+		t.Fatalf("got error %v for empty file, want %v", err, models.ErrInvalidImport)
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	file := `{"first":"Ivan","last":"Ivanov","middle":"Ivanovich","age":30}` + "\n" +
+		"\n" +
+		`  {"last":"Smith, \"Jr.\"","first":"  John  ","middle":null}  ` + "\n" +
+		`{"first":"Anna"}` + "\n" +
+		`{"first":1,"last":"Petrova"}` + "\n" +
+		`not json` + "\n" +
+		`["Ivan","Ivanov"]` + "\n" +
+		`{"first":"Petr","last":"Sidorov","nested":{"last":"other"}}`
+	options := models.ImportOptions{
+		Format:  models.ImportNDJSON,
+		Columns: models.ImportColumns{Name: "first", Surname: "last", Patronymic: "middle"},
+	}
+	// Blank lines aren't counted as rows.
+	assertRows(t, readAll(t, file, options), []models.ImportRow{
+		pending(1, "Ivan", "Ivanov", "Ivanovich"),
+		pending(2, "John", `Smith, "Jr."`, ""),
+		pending(3, "Anna", "", ""),
+		failed(4),
+		failed(5),
+		failed(6),
+		pending(7, "Petr", "Sidorov", ""),
+	})
+}
+
+func TestNewReaderInvalidFormat(t *testing.T) {
+	_, err := importfile.NewReader(strings.NewReader(""), models.ImportOptions{Format: "xml"})
+	if !errors.Is(err, models.ErrInvalidImport) {
+		t.Fatalf("got error %v, want %v", err, models.ErrInvalidImport)
+	}
+	_, err = importfile.NewReportWriter(&bytes.Buffer{}, "xml")
+	if !errors.Is(err, models.ErrInvalidImport) {
+		t.Fatalf("got error %v, want %v", err, models.ErrInvalidImport)
+	}
+}
+
+// _results are results of imported rows, with values, which need quoting.
+var _results = []models.ImportRow{
+	{Row: 1, Status: models.ImportRowImported, PersonID: uuid.MustParse("7d3f8e5a-1c2b-4a6d-9e0f-1a2b3c4d5e6f"),
+		Name: `John "Johnny"`, Surname: "Smith, Jr.", Patronymic: "Line\nbreak"},
+	{Row: 2, Status: models.ImportRowFailed, PersonID: uuid.MustParse("0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"),
+		Name: "Anna", Error: "surname required"},
+}
+
+// writeReport returns results, written in given format.
+func writeReport(t *testing.T, format models.ImportFormat, rows []models.ImportRow) []byte {
+	t.Helper()
+	buffer := &bytes.Buffer{}
+	writer, err := importfile.NewReportWriter(buffer, format)
+	if err != nil {
+		t.Fatalf("new report writer: %v", err)
+	}
+	for _, row := range rows {
+		err = writer.Write(row)
+		if err != nil {
+			t.Fatalf("write %+v: %v", row, err)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestCSVReport(t *testing.T) {
+	records, err := csv.NewReader(bytes.NewReader(writeReport(t, models.ImportCSV, _results))).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(records) != len(_results)+1 || strings.Join(records[0], ",") != "row,status,personId,name,surname,patronymic,error" {
+		t.Fatalf("got records %q, want header and %d rows", records, len(_results))
+	}
+	for i, record := range records[1:] {
+		row := models.ImportRow{Status: models.ImportRowStatus(record[1]), Name: record[3], Surname: record[4],
+			Patronymic: record[5], Error: record[6]}
+		row.Row, err = strconv.Atoi(record[0])
+		if err != nil {
+			t.Fatalf("parse row: %v", err)
+		}
+		row.PersonID, err = uuid.Parse(record[2])
+		if err != nil {
+			t.Fatalf("parse person id: %v", err)
+		}
+		if row != _results[i] {
+			t.Fatalf("got row %+v, want %+v", row, _results[i])
+		}
+	}
+
+	records, err = csv.NewReader(bytes.NewReader(writeReport(t, models.ImportCSV, nil))).ReadAll()
+	if err != nil || len(records) != 1 {
+		t.Fatalf("got records %q and error %v of empty report, want header only", records, err)
+	}
+}
+
+func TestNDJSONReport(t *testing.T) {
+	scanner := bufio.NewScanner(bytes.NewReader(writeReport(t, models.ImportNDJSON, _results)))
+	rows := []models.ImportRow{}
+	for scanner.Scan() {
+		var row models.ImportRow
+		err := json.Unmarshal(scanner.Bytes(), &row)
+		if err != nil {
+			t.Fatalf("unmarshal %s: %v", scanner.Bytes(), err)
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) != len(_results) || rows[0] != _results[0] || rows[1] != _results[1] {
+		t.Fatalf("got rows %+v, want %+v", rows, _results)
+	}
+}
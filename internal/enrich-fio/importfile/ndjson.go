@@ -0,0 +1,95 @@
+package importfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// _maxLineSize is the longest line of NDJSON file, which can be read.
+const _maxLineSize = 1 << 20
+
+// ndjsonReader reads rows of NDJSON file, a JSON object per line. Blank lines are skipped.
+type ndjsonReader struct {
+	s       *bufio.Scanner
+	columns models.ImportColumns
+	row     int
+}
+
+func newNDJSONReader(r io.Reader, columns models.ImportColumns) *ndjsonReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), _maxLineSize)
+	return &ndjsonReader{s: s, columns: columns}
+}
+
+func (r *ndjsonReader) Read() (models.ImportRow, error) {
+	var line []byte
+	for len(line) == 0 {
+		if !r.s.Scan() {
+			if r.s.Err() != nil {
+				return models.ImportRow{}, errors.Wrapf(r.s.Err(), "read row %d", r.row+1)
+			}
+			return models.ImportRow{}, io.EOF
+		}
+		line = bytes.TrimSpace(r.s.Bytes())
+	}
+	r.row++
+	var object map[string]any
+	err := json.Unmarshal(line, &object)
+	if err != nil {
+		return r.failed(fmt.Sprintf("invalid JSON object: %v", err)), nil
+	}
+	row := models.ImportRow{Row: r.row, Status: models.ImportRowPending}
+	for _, f := range []struct {
+		column string
+		value  *string
+	}{
+		{r.columns.Name, &row.Name},
+		{r.columns.Surname, &row.Surname},
+		{r.columns.Patronymic, &row.Patronymic},
+	} {
+		value, ok := object[f.column]
+		if !ok || value == nil {
+			continue
+		}
+		s, ok := value.(string)
+		if !ok {
+			return r.failed(fmt.Sprintf("%q is not a string", f.column)), nil
+		}
+		*f.value = strings.TrimSpace(s)
+	}
+	return row, nil
+}
+
+// failed returns the current row, failed for given reason.
+func (r *ndjsonReader) failed(reason string) models.ImportRow {
+	return models.ImportRow{Row: r.row, Status: models.ImportRowFailed, Error: reason}
+}
+
+// ndjsonReportWriter writes results of rows as JSON objects, one per line.
+type ndjsonReportWriter struct {
+	buffer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+func newNDJSONReportWriter(w io.Writer) *ndjsonReportWriter {
+	buffer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	return &ndjsonReportWriter{buffer: buffer, encoder: encoder}
+}
+
+func (w *ndjsonReportWriter) Write(row models.ImportRow) error {
+	return errors.Wrap(w.encoder.Encode(row), "encode row")
+}
+
+func (w *ndjsonReportWriter) Close() error {
+	return errors.Wrap(w.buffer.Flush(), "flush ndjson")
+}
@@ -0,0 +1,182 @@
+package enrichfio
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/filterexpr"
+	"enrich-fio/internal/models"
+)
+
+const (
+	// _anonymizedPrefix starts anonymized parts of FIO, so they aren't mistaken for real ones.
+	_anonymizedPrefix = "anon-"
+	// _retentionBatchSize is a number of people, retention rule is applied to at once.
+	_retentionBatchSize = 100
+)
+
+// AnonymizePerson replaces FIO of person with given ID with irreversible hashes.
+// Age, gender and nationality are kept for statistics. History of the person is forgotten.
+func (s *Service) AnonymizePerson(ctx context.Context, id uuid.UUID) (models.Person, error) {
+	var anonymized models.Person
+	err := s.Storage.WithTx(ctx, func(tx Storage) error {
+		person, err := tx.GetByID(ctx, id)
+		if err != nil {
+			return errors.Wrap(err, "get person by id")
+		}
+		anonymized, err = anonymize(person)
+		if err != nil {
+			return err
+		}
+		err = tx.Anonymize(ctx, anonymized)
+		if err != nil {
+			return errors.Wrap(err, "anonymize person in storage")
+		}
+		anonymized.Version = person.Version + 1
+		return nil
+	})
+	if err != nil {
+		return models.Person{}, err
+	}
+	return anonymized, nil
+}
+
+// anonymize returns person with FIO replaced with hashes.
+// Hashes are salted with random salt, which is forgotten, so even guessing the FIO doesn't reveal it.
+func anonymize(person models.Person) (models.Person, error) {
+	salt := make([]byte, sha256.Size)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return models.Person{}, errors.Wrap(err, "generate salt")
+	}
+	hash := func(value string) string {
+		if value == "" {
+			return ""
+		}
+		sum := sha256.Sum256(append(salt, value...))
+		return _anonymizedPrefix + hex.EncodeToString(sum[:8])
+	}
+	person.Name = hash(person.Name)
+	person.Surname = hash(person.Surname)
+	person.Patronymic = hash(person.Patronymic)
+	return person, nil
+}
+
+// ErasePerson removes person with given ID from storage with all its history, leaving a tombstone.
+// Erasing already erased person returns its tombstone.
+func (s *Service) ErasePerson(ctx context.Context, id uuid.UUID) (models.Tombstone, error) {
+	tombstone, err := s.Storage.Erase(ctx, id)
+	if err != nil {
+		return models.Tombstone{}, errors.Wrap(err, "erase person in storage")
+	}
+	return tombstone, nil
+}
+
+// ParseRetentionRules parses JSON array of retention rules, like
+//
+//	[{"action": "anonymize", "afterDays": 365, "filter": "nationality = \"RU\""}]
+//
+// Empty data means no rules.
+// Returns models.ErrInvalidRetentionRule if rules are malformed.
+func ParseRetentionRules(data string) ([]models.RetentionRule, error) {
+	if data == "" {
+		return nil, nil
+	}
+	var rules []models.RetentionRule
+	err := json.Unmarshal([]byte(data), &rules)
+	if err != nil {
+		return nil, errors.Wrapf(models.ErrInvalidRetentionRule, "%v", err)
+	}
+	for i, rule := range rules {
+		_, err := retentionFilter(rule)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule %d", i)
+		}
+	}
+	return rules, nil
+}
+
+// retentionFilter returns filter of people, given rule applies to, regardless of how long they are kept.
+// Returns models.ErrInvalidRetentionRule if rule is malformed.
+func retentionFilter(rule models.RetentionRule) (models.FilterConfig, error) {
+	switch rule.Action {
+	case models.RetentionAnonymize, models.RetentionErase:
+	default:
+		return models.FilterConfig{}, errors.Wrapf(models.ErrInvalidRetentionRule, "unknown action %q", rule.Action)
+	}
+	if rule.AfterDays < 0 {
+		return models.FilterConfig{}, errors.Wrapf(models.ErrInvalidRetentionRule, "negative afterDays %d", rule.AfterDays)
+	}
+	filter := models.FilterConfig{}
+	if rule.Filter != "" {
+		expr, err := filterexpr.Parse(rule.Filter)
+		if err != nil {
+			return models.FilterConfig{}, errors.Wrapf(models.ErrInvalidRetentionRule, "filter: %v", err)
+		}
+		filter.Expr = expr
+	}
+	return filter, nil
+}
+
+// ApplyRetention applies s.RetentionRules in order, and tells what each of them did.
+// Dry run only counts people, rules apply to. Failures to anonymize or erase a person don't stop the rest.
+func (s *Service) ApplyRetention(ctx context.Context, dryRun bool) ([]models.RetentionResult, error) {
+	now := time.Now()
+	results := make([]models.RetentionResult, 0, len(s.RetentionRules))
+	for i, rule := range s.RetentionRules {
+		filter, err := retentionFilter(rule)
+		if err != nil {
+			return results, errors.Wrapf(err, "rule %d", i)
+		}
+		result := models.RetentionResult{Rule: rule}
+		query := models.ExpiredQuery{
+			Action:      rule.Action,
+			Filter:      filter,
+			AddedBefore: now.AddDate(0, 0, -rule.AfterDays),
+			Limit:       _retentionBatchSize,
+		}
+		for {
+			ids, err := s.Storage.ExpiredPeople(ctx, query)
+			if err != nil {
+				return results, errors.Wrapf(err, "get people, expired by rule %d", i)
+			}
+			for _, id := range ids {
+				result.Matched++
+				if dryRun {
+					continue
+				}
+				err := s.applyRetentionAction(ctx, rule.Action, id)
+				if err != nil {
+					result.Failed++
+					result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", id, err))
+					continue
+				}
+				result.Applied++
+			}
+			if len(ids) < query.Limit {
+				break
+			}
+			query.After = ids[len(ids)-1]
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// applyRetentionAction anonymizes or erases person with given ID.
+func (s *Service) applyRetentionAction(ctx context.Context, action models.RetentionAction, id uuid.UUID) error {
+	if action == models.RetentionErase {
+		_, err := s.ErasePerson(ctx, id)
+		return err
+	}
+	_, err := s.AnonymizePerson(ctx, id)
+	return err
+}
@@ -0,0 +1,18 @@
+package enrichfio
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// Stats returns statistics over people, matching the filter, grouped the way query asks.
+func (s *Service) Stats(ctx context.Context, filter models.FilterConfig, query models.StatsQuery) (models.Stats, error) {
+	stats, err := s.Storage.Stats(ctx, filter, query)
+	if err != nil {
+		return models.Stats{}, errors.Wrap(err, "get stats from storage")
+	}
+	return stats, nil
+}
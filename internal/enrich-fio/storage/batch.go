@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// _copyColumns are columns, people are copied into person table with. Version is left default.
+var _copyColumns = []string{"tenant_id", "id", "name", "surname", "patronymic", "gender", "nationality", "age",
+	"attributes", "tags", "name_bidx", "surname_bidx", "patronymic_bidx", "key_id"}
+
+// _uniqueViolation is postgres error code for unique constraint violation.
+const _uniqueViolation = "23505"
+
+// isUniqueViolation tells if err is caused by a row, duplicating another one by unique key.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == _uniqueViolation
+}
+
+// SaveBatch saves all given people at once, recording them in history.
+// People, already stored, are overwritten. If the same ID is given several times, the last person wins.
+func (s *Storage) SaveBatch(ctx context.Context, people []models.Person) error {
+	people = uniquePeople(people)
+	if len(people) == 0 {
+		return nil
+	}
+	encrypted := make([]encryptedPerson, 0, len(people))
+	for _, person := range people {
+		e, err := s.encrypt(person)
+		if err != nil {
+			return err
+		}
+		encrypted = append(encrypted, e)
+	}
+	tenant := models.TenantFromContext(ctx)
+	return pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		// Most batches are new people, and copying them straight into the table is the fastest.
+		// Failed nested transaction only rolls back to its savepoint.
+		err := pgx.BeginFunc(ctx, tx, func(tx pgx.Tx) error {
+			err := copyPeople(ctx, tx, tenant, encrypted)
+			if err != nil {
+				return err
+			}
+			return copyNationalities(ctx, tx, "person_nationality", tenant, people)
+		})
+		if isUniqueViolation(err) {
+			err = upsertPeople(ctx, tx, tenant, people, encrypted)
+		} else if err == nil {
+			err = insertBatchRevisions(ctx, tx, people)
+		}
+		if err != nil {
+			return err
+		}
+		return notifyChanged(ctx, tx, peopleIDs(people)...)
+	})
+}
+
+// copyPeople copies given people of given tenant into person table.
+func copyPeople(ctx context.Context, tx pgx.Tx, tenant string, people []encryptedPerson) error {
+	_, err := tx.CopyFrom(ctx, pgx.Identifier{"person"}, _copyColumns, peopleSource(tenant, people))
+	if err != nil {
+		return errors.Wrap(err, "copy people")
+	}
+	return nil
+}
+
+// insertBatchRevisions records creation of given just copied people in their history, and writes events about it to outbox.
+func insertBatchRevisions(ctx context.Context, tx pgx.Tx, people []models.Person) error {
+	audit := models.AuditFromContext(ctx)
+	operation := models.OperationCreate
+	if audit.Operation != "" {
+		operation = audit.Operation
+	}
+	query := `
+	WITH revisions AS (
+		INSERT INTO person_history (tenant_id, person_id, revision, operation, old_value, new_value, actor, source)
+		SELECT @tenant::varchar, p.id,
+			COALESCE((SELECT MAX(revision) FROM person_history h WHERE h.tenant_id = @tenant AND h.person_id = p.id), 0) + 1,
+			@operation::varchar, NULL, to_jsonb(p), @actor::varchar, @source::varchar
+		FROM (SELECT ` + _personColumns + ` FROM person WHERE tenant_id = @tenant AND id = ANY(@ids)) p
+		RETURNING tenant_id, ` + _revisionColumns + `
+	)` + _insertEvents
+	args := pgx.NamedArgs{
+		"tenant":    models.TenantFromContext(ctx),
+		"ids":       peopleIDs(people),
+		"operation": operation,
+		"actor":     audit.Actor,
+		"source":    audit.Source,
+	}
+	_, err := tx.Exec(ctx, query, args)
+	if err != nil {
+		return errors.Wrap(err, "exec insert revisions query")
+	}
+	return nil
+}
+
+// upsertPeople saves given people of given tenant, overwriting already stored ones, and records changes in their history and outbox.
+// People are copied into a temporary table first, so the upsert is still a single statement.
+// Their nationalities are copied into another one, and replace the stored ones after the upsert.
+func upsertPeople(ctx context.Context, tx pgx.Tx, tenant string, people []models.Person, encrypted []encryptedPerson) error {
+	_, err := tx.Exec(ctx, `CREATE TEMPORARY TABLE person_batch (LIKE person INCLUDING DEFAULTS) ON COMMIT DROP`)
+	if err != nil {
+		return errors.Wrap(err, "create batch table")
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"person_batch"}, _copyColumns, peopleSource(tenant, encrypted))
+	if err != nil {
+		return errors.Wrap(err, "copy people into batch table")
+	}
+	_, err = tx.Exec(ctx, `CREATE TEMPORARY TABLE person_nationality_batch (LIKE person_nationality) ON COMMIT DROP`)
+	if err != nil {
+		return errors.Wrap(err, "create nationality batch table")
+	}
+	err = copyNationalities(ctx, tx, "person_nationality_batch", tenant, people)
+	if err != nil {
+		return err
+	}
+
+	audit := models.AuditFromContext(ctx)
+	// Both CTEs see the table as it was before the statement, so old holds values before the upsert.
+	query := `
+	WITH old AS (
+		SELECT ` + _personColumns + `
+		FROM person
+		WHERE tenant_id = @tenant AND id IN (SELECT id FROM person_batch)
+		FOR UPDATE
+	), saved AS (
+		INSERT INTO person (tenant_id, id, name, surname, patronymic, gender, nationality, age, attributes, tags,
+			name_bidx, surname_bidx, patronymic_bidx, key_id)
+		SELECT tenant_id, id, name, surname, patronymic, gender, nationality, age, attributes, tags,
+			name_bidx, surname_bidx, patronymic_bidx, key_id
+		FROM person_batch
+		ON CONFLICT (tenant_id, id) DO UPDATE SET
+			name = EXCLUDED.name,
+			surname = EXCLUDED.surname,
+			patronymic = EXCLUDED.patronymic,
+			gender = EXCLUDED.gender,
+			nationality = EXCLUDED.nationality,
+			age = EXCLUDED.age,
+			attributes = EXCLUDED.attributes,
+			tags = EXCLUDED.tags,
+			name_bidx = EXCLUDED.name_bidx,
+			surname_bidx = EXCLUDED.surname_bidx,
+			patronymic_bidx = EXCLUDED.patronymic_bidx,
+			key_id = EXCLUDED.key_id,
+			version = person.version + 1,
+			-- Overwritten person is not anonymized anymore.
+			anonymized = false
+		RETURNING id, name, surname, patronymic, age, gender, nationality, ` + nationalitiesColumn("person_nationality_batch") + `,
+			attributes, tags, version
+	), revisions AS (
+		INSERT INTO person_history (tenant_id, person_id, revision, operation, old_value, new_value, actor, source)
+		SELECT @tenant::varchar, saved.id,
+			COALESCE((SELECT MAX(revision) FROM person_history h WHERE h.tenant_id = @tenant AND h.person_id = saved.id), 0) + 1,
+			COALESCE(NULLIF(@operation::varchar, ''), CASE WHEN old.id IS NULL THEN @create::varchar ELSE @update::varchar END),
+			CASE WHEN old.id IS NULL THEN NULL ELSE to_jsonb(old) END, to_jsonb(saved), @actor::varchar, @source::varchar
+		FROM saved
+		LEFT JOIN old ON old.id = saved.id
+		RETURNING tenant_id, ` + _revisionColumns + `
+	)` + _insertEvents
+	args := pgx.NamedArgs{
+		"tenant":    tenant,
+		"operation": audit.Operation,
+		"create":    models.OperationCreate,
+		"update":    models.OperationUpdate,
+		"actor":     audit.Actor,
+		"source":    audit.Source,
+	}
+	_, err = tx.Exec(ctx, query, args)
+	if err != nil {
+		return errors.Wrap(err, "exec upsert query")
+	}
+	_, err = tx.Exec(ctx, `
+	DELETE FROM person_nationality
+	WHERE tenant_id = @tenant AND person_id IN (SELECT id FROM person_batch)
+	`, args)
+	if err != nil {
+		return errors.Wrap(err, "delete nationalities")
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO person_nationality SELECT * FROM person_nationality_batch`)
+	if err != nil {
+		return errors.Wrap(err, "insert nationalities")
+	}
+	// Batch tables live till the outermost transaction ends, and the next batch in it creates them again.
+	_, err = tx.Exec(ctx, `DROP TABLE person_batch, person_nationality_batch`)
+	if err != nil {
+		return errors.Wrap(err, "drop batch tables")
+	}
+	return nil
+}
+
+// peopleSource returns CopyFrom source of given people of given tenant, with values in _copyColumns order.
+func peopleSource(tenant string, people []encryptedPerson) pgx.CopyFromSource {
+	return pgx.CopyFromSlice(len(people), func(i int) ([]any, error) {
+		p := people[i]
+		attributes, tags := labelValues(p.Attributes, p.Tags)
+		return []any{tenant, p.ID, p.Name, p.Surname, p.Patronymic, string(p.Gender), p.Nationality, p.Age,
+			attributes, tags, p.NameIndex, p.SurnameIndex, p.PatronymicIndex, p.KeyID}, nil
+	})
+}
+
+// uniquePeople returns given people without repeated IDs, keeping the last person with each ID.
+func uniquePeople(people []models.Person) []models.Person {
+	last := make(map[uuid.UUID]int, len(people))
+	for i, person := range people {
+		last[person.ID] = i
+	}
+	unique := make([]models.Person, 0, len(last))
+	for i, person := range people {
+		if last[person.ID] == i {
+			unique = append(unique, person)
+		}
+	}
+	return unique
+}
+
+func peopleIDs(people []models.Person) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(people))
+	for _, person := range people {
+		ids = append(ids, person.ID)
+	}
+	return ids
+}
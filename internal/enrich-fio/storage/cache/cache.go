@@ -12,59 +12,187 @@ import (
 	"go.uber.org/zap"
 
 	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/fieldcrypt"
 	"enrich-fio/internal/models"
 )
 
+// _invalidationChannel is redis channel, where people, changed by any instance of the service, are published
+// as "<tenant>:<id>", so other caches of people can evict them too. "*" means any person may have changed.
+const _invalidationChannel = "person_invalidated"
+
+// _setPerson caches person in KEYS[1], only if eviction counter of the person in KEYS[2] is still ARGV[1], as it was
+// before the person was read from storage. Otherwise the person was changed since, and what was read may be stale.
+var _setPerson = redis.NewScript(`
+if (redis.call('GET', KEYS[2]) or '') ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// changeListener is a storage, which tells about people, changed by any instance of the service.
+type changeListener interface {
+	// ListenChanges calls onChange with tenant and ID of every changed person, until ctx is done.
+	// onReconnect is called if some changes might have been missed.
+	ListenChanges(ctx context.Context, onChange func(tenant string, id uuid.UUID), onReconnect func()) error
+}
+
 // CacheStorage is a wrapper for storage, that implements caching.
 type CacheStorage struct {
 	Storage enrichfio.Storage
 	client  *redis.Client
 	ttl     time.Duration
+	// statsTTL is short, as stats aren't invalidated on changes.
+	statsTTL time.Duration
+	// keyring encrypts FIO of cached people. Nil keyring caches it as it is.
+	keyring *fieldcrypt.Keyring
+	// pending are cache mutations, deferred till transaction commits. Nil outside of WithTx.
+	pending *[]func(ctx context.Context)
 }
 
-// NewCacheStorage returns CacheStorage, which implements caching.
-func NewCacheStorage(storage enrichfio.Storage, client *redis.Client, ttl time.Duration) *CacheStorage {
+// NewCacheStorage returns CacheStorage, which implements caching. FIO is cached encrypted with keyring, unless it's nil.
+func NewCacheStorage(storage enrichfio.Storage, client *redis.Client, ttl time.Duration, statsTTL time.Duration, keyring *fieldcrypt.Keyring) *CacheStorage {
 	return &CacheStorage{
-		Storage: storage,
-		client:  client,
-		ttl:     ttl,
+		Storage:  storage,
+		client:   client,
+		ttl:      ttl,
+		statsTTL: statsTTL,
+		keyring:  keyring,
 	}
 }
 
 // Save saves given person in storage.
+// Person is cached by GetByID as stored, with its version, so the key is only cleared of whatever was cached before.
 func (c *CacheStorage) Save(ctx context.Context, person models.Person) error {
-	c.setPerson(ctx, person)
-	return c.Storage.Save(ctx, person)
+	err := c.Storage.Save(ctx, person)
+	if err != nil {
+		return err
+	}
+	c.deleteKeys(ctx, idKey(ctx, person.ID))
+	return nil
+}
+
+// SaveBatch saves all given people at once, recording them in history.
+// People, already stored, are overwritten. If the same ID is given several times, the last person wins.
+func (c *CacheStorage) SaveBatch(ctx context.Context, people []models.Person) error {
+	err := c.Storage.SaveBatch(ctx, people)
+	if err != nil {
+		return err
+	}
+	if len(people) == 0 {
+		return nil
+	}
+	// Overwritten people may be cached with their old values.
+	keys := make([]string, 0, len(people))
+	for _, person := range people {
+		keys = append(keys, idKey(ctx, person.ID))
+	}
+	c.deleteKeys(ctx, keys...)
+	return nil
 }
 
-// GetWithFilter returns models.People that match the given filter.
+// GetWithFilter returns a page of people that match the given filter.
 // Returns models.ErrPersonNotFound if no such people found in the storage.
-func (c *CacheStorage) GetWithFilter(ctx context.Context, filter models.FilterConfig, page int) ([]models.Person, error) {
+// Returns models.ErrInvalidCursor if opts.Cursor is malformed.
+// Returns models.ErrInvalidSortKey if people can't be ordered by opts.Sort.
+func (c *CacheStorage) GetWithFilter(ctx context.Context, filter models.FilterConfig, opts models.ListOptions) (models.PeoplePage, error) {
 	// Not implemented.
-	return c.Storage.GetWithFilter(ctx, filter, page)
+	return c.Storage.GetWithFilter(ctx, filter, opts)
+}
+
+// Search returns a page of people, whose FIO matches the given query, the best matches first.
+// Only people, matching the filter, are searched. opts.Cursor and opts.Sort are not supported.
+// Returns models.ErrInvalidSearchQuery if query is empty or malformed.
+func (c *CacheStorage) Search(ctx context.Context, query models.SearchQuery, filter models.FilterConfig, opts models.ListOptions) (models.SearchPage, error) {
+	return c.Storage.Search(ctx, query, filter, opts)
+}
+
+// CountPeople returns how many people tenant from ctx keeps. Count isn't cached, as it's used to check quota.
+// Inside of WithTx transactions of the same tenant count one after another, and each sees people, saved by the ones,
+// which counted before it, so checks of quota can't all pass together. Lock is held till the transaction ends.
+func (c *CacheStorage) CountPeople(ctx context.Context) (int64, error) {
+	return c.Storage.CountPeople(ctx)
+}
+
+// Export calls fn with every person, matching the filter, in order of IDs, and stops at the first error fn returns.
+// People are exported from storage, bypassing the cache.
+// Returns models.ErrInvalidFilter if filter can't be applied.
+func (c *CacheStorage) Export(ctx context.Context, filter models.FilterConfig, fn func(person models.Person) error) error {
+	return c.Storage.Export(ctx, filter, fn)
+}
+
+// Stats returns statistics over people, matching the filter, grouped the way query asks. The largest groups go first.
+// Stats are cached for a short time and may not reflect the latest changes.
+// Returns models.ErrInvalidStatsQuery if people can't be grouped the requested way.
+func (c *CacheStorage) Stats(ctx context.Context, filter models.FilterConfig, query models.StatsQuery) (models.Stats, error) {
+	if c.inTx() {
+		return c.Storage.Stats(ctx, filter, query)
+	}
+	logger := zap.L()
+	key, err := statsKey(models.TenantFromContext(ctx), filter, query)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("could not make stats cache key. Err: %v", err))
+		return c.Storage.Stats(ctx, filter, query)
+	}
+	data, err := c.client.Get(ctx, key).Bytes()
+	if err == nil {
+		stats := models.Stats{}
+		err = json.Unmarshal(data, &stats)
+		if err == nil {
+			return stats, nil
+		}
+		logger.Warn("can't unmarshal cached stats")
+	} else if !errors.Is(err, redis.Nil) {
+		logger.Warn(fmt.Sprintf("could not get stats from cache. Err: %v", err))
+	}
+
+	stats, err := c.Storage.Stats(ctx, filter, query)
+	if err != nil {
+		return models.Stats{}, err
+	}
+	data, err = json.Marshal(stats)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("could marshal stats to save in cache. Err: %v", err))
+		return stats, nil
+	}
+	err = c.client.Set(ctx, key, data, c.statsTTL).Err()
+	if err != nil {
+		logger.Warn(fmt.Sprintf("could not save to cache. Err: %v", err))
+	}
+	return stats, nil
 }
 
 // GetByID returns one models.Person by given ID.
 // Returns models.ErrPersonNotFound if no such people found in the storage.
 func (c *CacheStorage) GetByID(ctx context.Context, id uuid.UUID) (models.Person, error) {
-	logger := zap.L()
-	result := c.client.Get(ctx, idKey(id))
-	if result.Err() != nil {
-		if errors.Is(result.Err(), redis.Nil) {
-			logger.Info("no cache found")
-		}
+	if c.inTx() {
+		// Cache doesn't see changes, made in transaction, till it commits.
+		return c.Storage.GetByID(ctx, id)
 	}
-	if result.Err() == nil {
-		data, err := result.Bytes()
-		if err != nil {
-			logger.Warn("can't get cache data")
-		}
-		person := models.Person{}
-		err = json.Unmarshal(data, &person)
-		if err != nil {
-			logger.Warn("can't unmarshal cached person")
+	logger := zap.L()
+	key := idKey(ctx, id)
+	// Eviction counter is read along with the person, so person, read from storage, isn't cached,
+	// if it's changed and evicted by any instance in between.
+	values, err := c.client.MGet(ctx, key, evictionKey(key)).Result()
+	cacheable := err == nil
+	var evicted string
+	if err != nil {
+		logger.Warn(fmt.Sprintf("could not get person from cache. Err: %v", err))
+	} else {
+		evicted, _ = values[1].(string)
+		if data, ok := values[0].(string); ok {
+			person := models.Person{}
+			err = json.Unmarshal([]byte(data), &person)
+			if err != nil {
+				logger.Warn("can't unmarshal cached person")
+			}
+			person, err = c.keyring.DecryptPerson(person)
+			if err == nil {
+				return person, nil
+			}
+			// Master key of cached person may be gone after rotation, so it's taken from storage.
+			logger.Warn(fmt.Sprintf("can't decrypt cached person. Err: %v", err))
 		}
-		return person, nil
 	}
 	logger.Info("no record matched in cache")
 	person, err := c.Storage.GetByID(ctx, id)
@@ -72,37 +200,169 @@ func (c *CacheStorage) GetByID(ctx context.Context, id uuid.UUID) (models.Person
 		logger.Info("no record matched in storage")
 		return models.Person{}, errors.Wrap(err, "get by id")
 	}
-	if person != (models.Person{}) {
-		c.setPerson(ctx, person)
+	if cacheable && person.ID != uuid.Nil {
+		c.setPerson(ctx, person, evicted)
 	}
 	return person, nil
 }
 
 // DeleteByID deletes person from storage by given ID.
+// Person is evicted from cache both before and after it's deleted, as storages, which don't tell about changes,
+// leave nobody else to evict it, if it's cached in between.
 // Returns models.ErrPersonNotFound if no such people found in the storage.
 func (c *CacheStorage) DeleteByID(ctx context.Context, id uuid.UUID) error {
-	logger := zap.L()
-	result := c.client.Del(ctx, idKey(id))
-	if result.Err() != nil {
-		if errors.Is(result.Err(), redis.Nil) {
-			logger.Info("can't get cache")
-		}
+	c.deleteKeys(ctx, idKey(ctx, id))
+	err := c.Storage.DeleteByID(ctx, id)
+	if err != nil {
+		return err
 	}
-	return c.Storage.DeleteByID(ctx, id)
+	c.deleteKeys(ctx, idKey(ctx, id))
+	return nil
 }
 
 // ChangeByID applies given changes person from storage by given ID.
+// Person is evicted from cache both before and after it's changed, the same way as by DeleteByID.
 // Returns models.ErrPersonNotFound if no such people found in the storage.
+// Returns models.ErrVersionConflict if person's version differs from changes.ExpectedVersion.
 func (c *CacheStorage) ChangeByID(ctx context.Context, id uuid.UUID, changes models.ChangeConfig) error {
-	// Not implemented. (Deletes from cache, not changes)
-	logger := zap.L()
-	result := c.client.Del(ctx, idKey(id))
-	if result.Err() != nil {
-		if errors.Is(result.Err(), redis.Nil) {
-			logger.Info("can't get cache")
-		}
+	c.deleteKeys(ctx, idKey(ctx, id))
+	err := c.Storage.ChangeByID(ctx, id, changes)
+	if err != nil {
+		return err
 	}
-	return c.Storage.ChangeByID(ctx, id, changes)
+	c.deleteKeys(ctx, idKey(ctx, id))
+	return nil
+}
+
+// Anonymize replaces person with given anonymized one, and forgets its history and events, as they keep personal data.
+// Person is evicted from cache both before and after it's anonymized, the same way as by DeleteByID.
+// Returns models.ErrPersonNotFound if no such people found in the storage.
+func (c *CacheStorage) Anonymize(ctx context.Context, anonymized models.Person) error {
+	c.deleteKeys(ctx, idKey(ctx, anonymized.ID))
+	err := c.Storage.Anonymize(ctx, anonymized)
+	if err != nil {
+		return err
+	}
+	c.deleteKeys(ctx, idKey(ctx, anonymized.ID))
+	return nil
+}
+
+// Erase removes person with given ID with all its history and events, and leaves a tombstone.
+// Person is evicted from cache both before and after it's erased, the same way as by DeleteByID.
+// Returns models.ErrPersonNotFound if nothing is known about the person.
+func (c *CacheStorage) Erase(ctx context.Context, id uuid.UUID) (models.Tombstone, error) {
+	c.deleteKeys(ctx, idKey(ctx, id))
+	tombstone, err := c.Storage.Erase(ctx, id)
+	if err != nil {
+		return models.Tombstone{}, err
+	}
+	c.deleteKeys(ctx, idKey(ctx, id))
+	return tombstone, nil
+}
+
+// ExpiredPeople returns up to query.Limit IDs of people, matching the query, in order of IDs.
+// Anonymized people are skipped by anonymize rules only.
+func (c *CacheStorage) ExpiredPeople(ctx context.Context, query models.ExpiredQuery) ([]uuid.UUID, error) {
+	return c.Storage.ExpiredPeople(ctx, query)
+}
+
+// History returns all recorded revisions of person with given ID, oldest first.
+func (c *CacheStorage) History(ctx context.Context, id uuid.UUID) ([]models.Revision, error) {
+	return c.Storage.History(ctx, id)
+}
+
+// GetRevision returns given revision of person with given ID.
+// Returns models.ErrRevisionNotFound if no such revision recorded.
+func (c *CacheStorage) GetRevision(ctx context.Context, id uuid.UUID, revision int) (models.Revision, error) {
+	return c.Storage.GetRevision(ctx, id, revision)
+}
+
+// GetAsOf returns person with given ID as it was at given moment.
+// Returns models.ErrPersonNotFound if person didn't exist at that moment.
+func (c *CacheStorage) GetAsOf(ctx context.Context, id uuid.UUID, at time.Time) (models.Person, error) {
+	return c.Storage.GetAsOf(ctx, id, at)
+}
+
+// PendingEvents returns up to limit events, which are not delivered yet, in the order changes were made.
+func (c *CacheStorage) PendingEvents(ctx context.Context, limit int) ([]models.Event, error) {
+	return c.Storage.PendingEvents(ctx, limit)
+}
+
+// MarkDelivered marks events with given IDs as delivered, so they are not pending anymore.
+func (c *CacheStorage) MarkDelivered(ctx context.Context, ids []int64) error {
+	return c.Storage.MarkDelivered(ctx, ids)
+}
+
+// DeleteDelivered deletes events, delivered before given moment, and returns how many were deleted.
+func (c *CacheStorage) DeleteDelivered(ctx context.Context, before time.Time) (int64, error) {
+	return c.Storage.DeleteDelivered(ctx, before)
+}
+
+// LockOutbox calls fn with outbox, which no other relay publishes from till fn returns. Events are not cached.
+// Returns models.ErrOutboxLocked without calling fn, if another relay holds the outbox.
+func (c *CacheStorage) LockOutbox(ctx context.Context, fn func(outbox enrichfio.Outbox) error) error {
+	return c.Storage.LockOutbox(ctx, fn)
+}
+
+// SaveImport saves given import job, overwriting the stored one. Import jobs are not cached.
+func (c *CacheStorage) SaveImport(ctx context.Context, job models.ImportJob) error {
+	return c.Storage.SaveImport(ctx, job)
+}
+
+// GetImport returns import job by given ID with counts of its rows.
+// Returns models.ErrImportNotFound if no such job found in the storage.
+func (c *CacheStorage) GetImport(ctx context.Context, id uuid.UUID) (models.ImportJob, error) {
+	return c.Storage.GetImport(ctx, id)
+}
+
+// AddImportRows adds given rows to import job with given ID.
+// Returns models.ErrImportNotFound if no such job found in the storage.
+func (c *CacheStorage) AddImportRows(ctx context.Context, id uuid.UUID, rows []models.ImportRow) error {
+	return c.Storage.AddImportRows(ctx, id, rows)
+}
+
+// ImportRows returns rows of import job with given ID, matching the query, in order of their numbers.
+// Returns models.ErrImportNotFound if no such job found in the storage.
+func (c *CacheStorage) ImportRows(ctx context.Context, id uuid.UUID, query models.ImportRowsQuery) ([]models.ImportRow, error) {
+	return c.Storage.ImportRows(ctx, id, query)
+}
+
+// SaveImportResults updates statuses, person IDs and errors of given rows of import job with given ID.
+func (c *CacheStorage) SaveImportResults(ctx context.Context, id uuid.UUID, rows []models.ImportRow) error {
+	return c.Storage.SaveImportResults(ctx, id, rows)
+}
+
+// ClaimImport claims import job with given ID for the run and sets its status to running with no error.
+// Returns models.ErrImportClaimed if job can't be claimed.
+// Returns models.ErrImportNotFound if no such job found in the storage.
+func (c *CacheStorage) ClaimImport(ctx context.Context, id uuid.UUID, claim models.ImportClaim) error {
+	return c.Storage.ClaimImport(ctx, id, claim)
+}
+
+// WithTx calls fn with storage, which operations all succeed or fail together.
+// Transaction is committed if fn returns nil, and rolled back otherwise.
+// Nested WithTx rolls back only operations made inside of it.
+// Cache is changed only after the outermost transaction commits.
+func (c *CacheStorage) WithTx(ctx context.Context, fn func(tx enrichfio.Storage) error) error {
+	pending := []func(ctx context.Context){}
+	err := c.Storage.WithTx(ctx, func(tx enrichfio.Storage) error {
+		return fn(&CacheStorage{
+			Storage:  tx,
+			client:   c.client,
+			ttl:      c.ttl,
+			statsTTL: c.statsTTL,
+			keyring:  c.keyring,
+			pending:  &pending,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	// Nested transaction passes its mutations to the outer one.
+	for _, mutation := range pending {
+		c.mutate(ctx, mutation)
+	}
+	return nil
 }
 
 // MigrateUp performs a database migration to the last available version.
@@ -110,18 +370,141 @@ func (c *CacheStorage) MigrateUp(ctx context.Context) error {
 	return c.Storage.MigrateUp(ctx)
 }
 
-func (c *CacheStorage) setPerson(ctx context.Context, person models.Person) {
+// inTx tells if storage is used inside of WithTx.
+func (c *CacheStorage) inTx() bool {
+	return c.pending != nil
+}
+
+// mutate changes cache with given mutation, or defers it till commit inside of WithTx.
+func (c *CacheStorage) mutate(ctx context.Context, mutation func(ctx context.Context)) {
+	if c.inTx() {
+		*c.pending = append(*c.pending, mutation)
+		return
+	}
+	mutation(ctx)
+}
+
+// setPerson caches person, read from storage, unless it has been evicted since eviction counter was read as evicted.
+func (c *CacheStorage) setPerson(ctx context.Context, person models.Person, evicted string) {
 	logger := zap.L()
-	personData, err := json.Marshal(person)
+	encrypted, err := c.keyring.EncryptPerson(person)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("could not encrypt person to save in cache. Err: %v", err))
+		return
+	}
+	personData, err := json.Marshal(encrypted)
 	if err != nil {
 		logger.Warn(fmt.Sprintf("could marshal person to save in cache. Err: %v", err))
+		return
 	}
-	err = c.client.Set(ctx, idKey(person.ID), personData, c.ttl).Err()
+	key := idKey(ctx, person.ID)
+	err = _setPerson.Run(ctx, c.client, []string{key, evictionKey(key)}, evicted, personData, c.ttl.Milliseconds()).Err()
 	if err != nil {
 		logger.Warn(fmt.Sprintf("could not save to cache. Err: %v", err))
 	}
 }
 
-func idKey(id uuid.UUID) string {
-	return id.String()
+// deleteKeys evicts cached people with given keys, or defers it till commit inside of WithTx.
+func (c *CacheStorage) deleteKeys(ctx context.Context, keys ...string) {
+	c.mutate(ctx, func(ctx context.Context) {
+		c.evict(ctx, keys...)
+	})
+}
+
+// evict deletes cached people with given keys and bumps their eviction counters, so people, read from storage before,
+// aren't cached by reads, which are still in flight. Counters outlive any read, as they live as long as cached people.
+func (c *CacheStorage) evict(ctx context.Context, keys ...string) {
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, keys...)
+		for _, key := range keys {
+			pipe.Incr(ctx, evictionKey(key))
+			pipe.Expire(ctx, evictionKey(key), c.ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		zap.L().Warn(fmt.Sprintf("could not delete from cache. Err: %v", err))
+	}
+}
+
+// Listen evicts people, changed by any instance of the service, from cache and publishes their tenants and IDs
+// to _invalidationChannel, until ctx is done. Does nothing, if storage doesn't tell about changes.
+func (c *CacheStorage) Listen(ctx context.Context) error {
+	listener, ok := c.Storage.(changeListener)
+	if !ok {
+		zap.L().Info("storage doesn't tell about changes, cache is invalidated by changes of this instance only")
+		return nil
+	}
+	return listener.ListenChanges(ctx, func(tenant string, id uuid.UUID) {
+		c.invalidate(ctx, []string{personKey(tenant, id)}, models.PersonKey(tenant, id))
+	}, func() {
+		c.invalidateAll(ctx)
+	})
+}
+
+// invalidate deletes given keys and publishes message to _invalidationChannel.
+func (c *CacheStorage) invalidate(ctx context.Context, keys []string, message string) {
+	logger := zap.L()
+	if len(keys) != 0 {
+		c.evict(ctx, keys...)
+	}
+	err := c.client.Publish(ctx, _invalidationChannel, message).Err()
+	if err != nil {
+		logger.Warn(fmt.Sprintf("could not publish invalidation. Err: %v", err))
+	}
+}
+
+// invalidateAll deletes all cached people, as changes of any of them might have been missed.
+func (c *CacheStorage) invalidateAll(ctx context.Context) {
+	const batchSize = 1000
+	keys := []string{}
+	iter := c.client.Scan(ctx, 0, _idKeyPattern, batchSize).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == batchSize {
+			c.deleteKeys(ctx, keys...)
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		zap.L().Warn(fmt.Sprintf("could not scan cached people. Err: %v", err))
+	}
+	c.invalidate(ctx, keys, "*")
+}
+
+// _idKeyPattern matches keys of cached people of all tenants.
+const _idKeyPattern = "person:*:????????-????-????-????-????????????"
+
+// idKey returns cache key of person with given ID of tenant from ctx.
+func idKey(ctx context.Context, id uuid.UUID) string {
+	return personKey(models.TenantFromContext(ctx), id)
+}
+
+// personKey returns cache key of person with given ID of given tenant.
+func personKey(tenant string, id uuid.UUID) string {
+	return "person:" + models.PersonKey(tenant, id)
+}
+
+// evictionKey returns key of eviction counter of cached person with given key.
+func evictionKey(key string) string {
+	return "evicted:" + key
+}
+
+// statsKey returns cache key for stats of given tenant with given filter and query.
+func statsKey(tenant string, filter models.FilterConfig, query models.StatsQuery) (string, error) {
+	// Expression trees of different kinds may look the same in JSON, but not as strings.
+	expr := ""
+	if filter.Expr != nil {
+		expr = fmt.Sprint(filter.Expr)
+	}
+	filter.Expr = nil
+	data, err := json.Marshal(struct {
+		Filter models.FilterConfig
+		Expr   string
+		Query  models.StatsQuery
+	}{filter, expr, query})
+	if err != nil {
+		return "", errors.Wrap(err, "marshal stats key")
+	}
+	return "stats:" + tenant + ":" + string(data), nil
 }
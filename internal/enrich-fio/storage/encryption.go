@@ -0,0 +1,269 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/enrich-fio/storage/listing"
+	"enrich-fio/internal/models"
+)
+
+// _rotateBatchSize is a number of rows, reencrypted in a single transaction by RotateKeys.
+const _rotateBatchSize = 500
+
+// encryptedPerson is a person with encrypted FIO, along with columns, derived from plaintext FIO.
+type encryptedPerson struct {
+	models.Person
+	NameIndex       string
+	SurnameIndex    string
+	PatronymicIndex string
+	// KeyID is ID of master key, FIO is encrypted with, or empty for plaintext FIO.
+	KeyID string
+}
+
+// encrypt returns person with encrypted FIO, ready to be stored.
+func (s *Storage) encrypt(person models.Person) (encryptedPerson, error) {
+	encrypted, err := s.keyring.EncryptPerson(person)
+	if err != nil {
+		return encryptedPerson{}, errors.Wrap(err, "encrypt person")
+	}
+	return encryptedPerson{
+		Person:          encrypted,
+		NameIndex:       s.keyring.BlindIndex("name", person.Name),
+		SurnameIndex:    s.keyring.BlindIndex("surname", person.Surname),
+		PatronymicIndex: s.keyring.BlindIndex("patronymic", person.Patronymic),
+		KeyID:           s.keyring.CurrentKeyID(),
+	}, nil
+}
+
+// encryptedArgs adds values of FIO columns of encrypted person to args.
+func encryptedArgs(person encryptedPerson, args pgx.NamedArgs) pgx.NamedArgs {
+	args["name"] = person.Name
+	args["surname"] = person.Surname
+	args["patronymic"] = person.Patronymic
+	args["nameIndex"] = person.NameIndex
+	args["surnameIndex"] = person.SurnameIndex
+	args["patronymicIndex"] = person.PatronymicIndex
+	args["keyID"] = person.KeyID
+	return args
+}
+
+// _encryptedSet sets FIO columns to values, added by encryptedArgs.
+const _encryptedSet = `name = @name, surname = @surname, patronymic = @patronymic,
+	name_bidx = @nameIndex, surname_bidx = @surnameIndex, patronymic_bidx = @patronymicIndex, key_id = @keyID`
+
+// decrypt returns stored person with decrypted FIO.
+func (s *Storage) decrypt(person models.Person) (models.Person, error) {
+	decrypted, err := s.keyring.DecryptPerson(person)
+	if err != nil {
+		return models.Person{}, errors.Wrapf(err, "decrypt person %s", person.ID)
+	}
+	return decrypted, nil
+}
+
+// decryptPeople decrypts FIO of stored people in place.
+func (s *Storage) decryptPeople(people []models.Person) error {
+	for i := range people {
+		var err error
+		people[i], err = s.decrypt(people[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decryptRevisions decrypts FIO of values of recorded revisions in place.
+func (s *Storage) decryptRevisions(revisions []models.Revision) error {
+	for i := range revisions {
+		var err error
+		revisions[i], err = s.keyring.DecryptRevision(revisions[i])
+		if err != nil {
+			return errors.Wrapf(err, "decrypt revision %d of %s", revisions[i].Revision, revisions[i].PersonID)
+		}
+	}
+	return nil
+}
+
+// order returns order of people listing, described by given sort keys.
+// Encrypted FIO can't be ordered by, so people are ordered by ID only then, unless client chose an order.
+// Returns models.ErrInvalidSortKey if people can't be ordered by some of the keys.
+func (s *Storage) order(keys []models.SortKey) ([]listing.Column, error) {
+	if s.keyring == nil {
+		return listing.Order(keys)
+	}
+	if len(keys) == 0 {
+		return []listing.Column{}, nil
+	}
+	for _, key := range keys {
+		if _encryptedFields[key.Field] {
+			return nil, errors.Wrapf(models.ErrInvalidSortKey, "field %q is encrypted", key.Field)
+		}
+	}
+	return listing.Order(keys)
+}
+
+// RotateKeys reencrypts FIO, encrypted with other master keys than the current one, and encrypts plaintext FIO.
+// People are reencrypted, so their blind indexes are computed too, while data keys of their recorded revisions,
+// events and import rows are only rewrapped. Returns the number of rotated rows.
+func (s *Storage) RotateKeys(ctx context.Context) (int64, error) {
+	if s.keyring == nil {
+		return 0, errors.New("encryption is disabled, there are no keys to rotate")
+	}
+	rotated, err := s.rotatePeople(ctx, false)
+	if err != nil {
+		return rotated, err
+	}
+	for _, table := range []string{"person_history", "outbox"} {
+		n, err := s.rotateRevisions(ctx, table)
+		rotated += n
+		if err != nil {
+			return rotated, errors.Wrapf(err, "rotate %s", table)
+		}
+	}
+	n, err := s.rotateImportRows(ctx)
+	rotated += n
+	if err != nil {
+		return rotated, errors.Wrap(err, "rotate import_row")
+	}
+	return rotated, nil
+}
+
+// EncryptPlaintext encrypts FIO of people, kept in plaintext, like ones saved before encryption was enabled.
+// Such people have no blind indexes, so filters by FIO don't match them, until they are encrypted.
+// Returns the number of encrypted people. Nothing is done, if encryption is disabled.
+func (s *Storage) EncryptPlaintext(ctx context.Context) (int64, error) {
+	if s.keyring == nil {
+		return 0, nil
+	}
+	return s.rotatePeople(ctx, true)
+}
+
+// rotatePeople reencrypts FIO of people, encrypted with other master keys than the current one, in batches,
+// or only encrypts plaintext FIO, if plaintext is true.
+// Version of people doesn't change, as people themselves don't.
+func (s *Storage) rotatePeople(ctx context.Context, plaintext bool) (int64, error) {
+	condition, keyID := "key_id <> $1", s.keyring.CurrentKeyID()
+	if plaintext {
+		condition, keyID = "key_id = $1", ""
+	}
+	var rotated int64
+	for {
+		var ids []uuid.UUID
+		err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+			rows, err := tx.Query(ctx, `
+			SELECT tenant_id, `+_personColumns+`
+			FROM person
+			WHERE `+condition+`
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE
+			`, keyID, _rotateBatchSize)
+			if err != nil {
+				return errors.Wrap(err, "query people")
+			}
+			type tenantPerson struct {
+				TenantID string `db:"tenant_id"`
+				models.Person
+			}
+			people, err := pgx.CollectRows(rows, pgx.RowToStructByName[tenantPerson])
+			if err != nil {
+				return errors.Wrap(err, "collect rows")
+			}
+			for _, p := range people {
+				person := p.Person
+				// Blind indexes of plaintext FIO are computed too, so decrypting is needed anyway.
+				decrypted, err := s.decrypt(person)
+				if err != nil {
+					return err
+				}
+				encrypted, err := s.encrypt(decrypted)
+				if err != nil {
+					return err
+				}
+				args := encryptedArgs(encrypted, pgx.NamedArgs{"tenant": p.TenantID, "id": person.ID})
+				_, err = tx.Exec(ctx, `UPDATE person SET `+_encryptedSet+` WHERE tenant_id = @tenant AND id = @id`, args)
+				if err != nil {
+					return errors.Wrap(err, "exec update query")
+				}
+				// Cached copies are encrypted with the old key.
+				err = notifyChanged(models.WithTenant(ctx, p.TenantID), tx, person.ID)
+				if err != nil {
+					return err
+				}
+				ids = append(ids, person.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			return rotated, err
+		}
+		rotated += int64(len(ids))
+		if len(ids) < _rotateBatchSize {
+			return rotated, nil
+		}
+	}
+}
+
+// rotateRevisions rewraps data keys of FIO in old and new values of every row of given table, in batches.
+func (s *Storage) rotateRevisions(ctx context.Context, table string) (int64, error) {
+	var rotated int64
+	var after int64
+	for {
+		var scanned int
+		err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+			rows, err := tx.Query(ctx, `
+			SELECT id, old_value, new_value
+			FROM `+table+`
+			WHERE id > $1
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE
+			`, after, _rotateBatchSize)
+			if err != nil {
+				return errors.Wrap(err, "query rows")
+			}
+			type valuesRow struct {
+				ID       int64
+				OldValue *models.Person
+				NewValue *models.Person
+			}
+			found, err := pgx.CollectRows(rows, pgx.RowToStructByPos[valuesRow])
+			if err != nil {
+				return errors.Wrap(err, "collect rows")
+			}
+			scanned = len(found)
+			for _, row := range found {
+				after = row.ID
+				changed := false
+				for _, value := range []*models.Person{row.OldValue, row.NewValue} {
+					if value == nil {
+						continue
+					}
+					rewrapped, err := s.keyring.RewrapPerson(*value)
+					if err != nil {
+						return errors.Wrapf(err, "row %d", row.ID)
+					}
+					changed = changed || !rewrapped.Equal(*value)
+					*value = rewrapped
+				}
+				if !changed {
+					continue
+				}
+				_, err = tx.Exec(ctx, `UPDATE `+table+` SET old_value = $1, new_value = $2 WHERE id = $3`,
+					row.OldValue, row.NewValue, row.ID)
+				if err != nil {
+					return errors.Wrap(err, "exec update query")
+				}
+				rotated++
+			}
+			return nil
+		})
+		if err != nil || scanned < _rotateBatchSize {
+			return rotated, err
+		}
+	}
+}
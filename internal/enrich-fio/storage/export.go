@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// _exportBatchSize is a number of people, fetched from export cursor at once.
+const _exportBatchSize = 1000
+
+// Export calls fn with every person, matching the filter, in order of IDs, and stops at the first error fn returns.
+// People are fetched in batches from a server-side cursor, so memory use doesn't depend on their number.
+// Returns models.ErrInvalidFilter if filter can't be applied.
+func (s *Storage) Export(ctx context.Context, filter models.FilterConfig, fn func(person models.Person) error) error {
+	filters, args, err := s.filterConditions(ctx, filter)
+	if err != nil {
+		return err
+	}
+	query := `
+	DECLARE person_export NO SCROLL CURSOR FOR
+	SELECT ` + _personColumns + `
+	FROM person
+	WHERE ` + strings.Join(filters, ` AND `) + `
+	ORDER BY id
+	`
+	fetch := `FETCH FORWARD ` + strconv.Itoa(_exportBatchSize) + ` FROM person_export`
+	// Cursor lives till the end of transaction, and sees people as they were when it was declared.
+	return pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, query, args)
+		if err != nil {
+			return errors.Wrap(err, "declare cursor")
+		}
+		for {
+			rows, err := tx.Query(ctx, fetch)
+			if err != nil {
+				return errors.Wrap(err, "fetch people")
+			}
+			people, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.Person])
+			if err != nil {
+				return errors.Wrap(err, "collect rows")
+			}
+			if len(people) == 0 {
+				break
+			}
+			err = s.decryptPeople(people)
+			if err != nil {
+				return err
+			}
+			for _, person := range people {
+				err = fn(person)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		// Export may be a part of an outer transaction, which would keep the cursor open otherwise.
+		_, err = tx.Exec(ctx, `CLOSE person_export`)
+		return errors.Wrap(err, "close cursor")
+	})
+}
@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// _filterColumns are SQL expressions for person fields, people can be filtered by.
+var _filterColumns = map[string]string{
+	"id":          "id",
+	"name":        "name",
+	"surname":     "surname",
+	"patronymic":  "patronymic",
+	"age":         "age",
+	"gender":      "gender",
+	"nationality": "nationality",
+	"version":     "version",
+}
+
+// filterConditions returns SQL conditions, matching the given filter and people of tenant from ctx, and their arguments.
+// The tenant condition always goes first.
+// Returns models.ErrInvalidFilter if filter can't be applied.
+func (s *Storage) filterConditions(ctx context.Context, filter models.FilterConfig) ([]string, pgx.NamedArgs, error) {
+	filters := []string{"tenant_id = @tenant"}
+	if filter.ID != uuid.Nil {
+		filters = append(filters, "ID = @ID")
+	}
+	if filter.Name != "" {
+		filters = append(filters, s.filterColumn("name")+" = @name")
+	}
+	if filter.Surname != "" {
+		filters = append(filters, s.filterColumn("surname")+" = @surname")
+	}
+	if filter.Patronymic != "" {
+		filters = append(filters, s.filterColumn("patronymic")+" = @patronymic")
+	}
+	if filter.Age.Min != nil {
+		filters = append(filters, "age >= @ageMin")
+	}
+	if filter.Age.Max != nil {
+		filters = append(filters, "age <= @ageMax")
+	}
+	if filter.Gender != "" {
+		filters = append(filters, "gender = @gender")
+	}
+	err := filter.NationalityMatch.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+	if filter.Nationality != "" && filter.NationalityMatch == models.NationalityAny {
+		// Nationality, set without probabilities, is not among nationalities.
+		filters = append(filters, `(nationality = @nationality OR EXISTS (
+			SELECT 1 FROM person_nationality n
+			WHERE n.tenant_id = person.tenant_id AND n.person_id = person.id AND n.country = @nationality
+		))`)
+	} else if filter.Nationality != "" {
+		filters = append(filters, "nationality = @nationality")
+	}
+	// Containment is what GIN indexes of attributes and tags support.
+	if len(filter.Tags) != 0 {
+		filters = append(filters, "tags @> @tags")
+	}
+	if len(filter.Attributes) != 0 {
+		filters = append(filters, "attributes @> @attributes")
+	}
+
+	args := pgx.NamedArgs{
+		"tenant":      models.TenantFromContext(ctx),
+		"ID":          filter.ID,
+		"name":        s.filterValue("name", filter.Name),
+		"surname":     s.filterValue("surname", filter.Surname),
+		"patronymic":  s.filterValue("patronymic", filter.Patronymic),
+		"ageMin":      filter.Age.Min,
+		"ageMax":      filter.Age.Max,
+		"gender":      filter.Gender,
+		"nationality": filter.Nationality,
+		"tags":        filter.Tags,
+		"attributes":  filter.Attributes,
+	}
+
+	for _, c := range filter.Conditions {
+		condition, err := s.conditionSQL(c, args)
+		if err != nil {
+			return nil, nil, err
+		}
+		filters = append(filters, condition)
+	}
+	for _, group := range filter.AnyOf {
+		if len(group) == 0 {
+			continue
+		}
+		alternatives := make([]string, 0, len(group))
+		for _, c := range group {
+			condition, err := s.conditionSQL(c, args)
+			if err != nil {
+				return nil, nil, err
+			}
+			alternatives = append(alternatives, condition)
+		}
+		filters = append(filters, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	if filter.Expr != nil {
+		condition, err := s.exprSQL(filter.Expr, args)
+		if err != nil {
+			return nil, nil, err
+		}
+		filters = append(filters, condition)
+	}
+	return filters, args, nil
+}
+
+// exprSQL returns SQL condition, matching the given filter expression. Its values are added to args.
+// Returns models.ErrInvalidFilter if expression can't be applied.
+func (s *Storage) exprSQL(expr models.Expr, args pgx.NamedArgs) (string, error) {
+	switch expr := expr.(type) {
+	case models.Condition:
+		return s.conditionSQL(expr, args)
+	case models.AndExpr:
+		return s.binaryExprSQL(expr.Left, "AND", expr.Right, args)
+	case models.OrExpr:
+		return s.binaryExprSQL(expr.Left, "OR", expr.Right, args)
+	case models.NotExpr:
+		operand, err := s.exprSQL(expr.Operand, args)
+		if err != nil {
+			return "", err
+		}
+		// Same as negated conditions, negated expressions match unknown values.
+		return "(" + operand + ") IS NOT TRUE", nil
+	}
+	return "", errors.Wrapf(models.ErrInvalidFilter, "unsupported expression %T", expr)
+}
+
+// binaryExprSQL returns SQL condition, joining both operands with the given SQL operator.
+func (s *Storage) binaryExprSQL(left models.Expr, operator string, right models.Expr, args pgx.NamedArgs) (string, error) {
+	leftSQL, err := s.exprSQL(left, args)
+	if err != nil {
+		return "", err
+	}
+	rightSQL, err := s.exprSQL(right, args)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("(%s %s %s)", leftSQL, operator, rightSQL), nil
+}
+
+// _comparisonOperators are SQL operators for single value conditions.
+var _comparisonOperators = map[models.Operator]string{
+	models.OperatorEq:  "=",
+	models.OperatorGt:  ">",
+	models.OperatorGte: ">=",
+	models.OperatorLt:  "<",
+	models.OperatorLte: "<=",
+}
+
+// conditionSQL returns SQL condition, matching the given one. Its values are added to args.
+// Returns models.ErrInvalidFilter if condition can't be applied, e.g. encrypted field is compared by order.
+func (s *Storage) conditionSQL(c models.Condition, args pgx.NamedArgs) (string, error) {
+	err := c.Validate()
+	if err != nil {
+		return "", err
+	}
+	column := s.filterColumn(c.Field)
+	kind := models.FilterFields[c.Field]
+	if _encryptedFields[c.Field] && s.keyring != nil {
+		if _, ok := _comparisonOperators[c.Op]; ok && c.Op != models.OperatorEq {
+			return "", errors.Wrapf(models.ErrInvalidFilter, "field %q is encrypted and can only be matched exactly", c.Field)
+		}
+		values := make([]string, 0, len(c.Values))
+		for _, value := range c.Values {
+			values = append(values, s.filterValue(c.Field, value))
+		}
+		c.Values = values
+	}
+	// Argument names only have to be unique, and args only grow.
+	arg := fmt.Sprintf("arg%d", len(args))
+
+	var condition string
+	switch c.Op {
+	case models.OperatorIn:
+		condition = fmt.Sprintf("%s = ANY(@%s)", column, arg)
+		args[arg] = typedValues(kind, c.Values)
+	case models.OperatorUnknown:
+		switch kind {
+		case models.FieldString:
+			condition = fmt.Sprintf("(%s IS NULL OR %s = '')", column, column)
+		case models.FieldInt:
+			condition = fmt.Sprintf("(%s IS NULL OR %s = 0)", column, column)
+		default:
+			condition = fmt.Sprintf("%s IS NULL", column)
+		}
+	default:
+		condition = fmt.Sprintf("%s %s @%s", column, _comparisonOperators[c.Op], arg)
+		args[arg] = typedValue(kind, c.Values[0])
+	}
+	if c.Not {
+		// Unlike NOT, IS NOT TRUE holds for NULL, so negated conditions match unknown values.
+		condition = "(" + condition + ") IS NOT TRUE"
+	}
+	return condition, nil
+}
+
+// _encryptedFields are person fields, kept encrypted if storage has keyring.
+var _encryptedFields = map[string]bool{"name": true, "surname": true, "patronymic": true}
+
+// filterColumn returns SQL expression for person field, people can be filtered by.
+// Encrypted fields are filtered by their blind indexes, which people, kept in plaintext, have only after EncryptPlaintext.
+func (s *Storage) filterColumn(field string) string {
+	if _encryptedFields[field] && s.keyring != nil {
+		return field + "_bidx"
+	}
+	return _filterColumns[field]
+}
+
+// filterValue returns value of person field to compare filterColumn with.
+func (s *Storage) filterValue(field string, value string) string {
+	if _encryptedFields[field] && s.keyring != nil {
+		return s.keyring.BlindIndex(field, value)
+	}
+	return value
+}
+
+// typedValue converts validated textual value of a field of given kind to the field's type.
+func typedValue(kind models.FieldKind, value string) any {
+	switch kind {
+	case models.FieldInt:
+		number, _ := strconv.Atoi(value)
+		return number
+	case models.FieldUUID:
+		id, _ := uuid.Parse(value)
+		return id
+	}
+	return value
+}
+
+// typedValues converts validated textual values of a field of given kind to a slice of the field's type.
+func typedValues(kind models.FieldKind, values []string) any {
+	switch kind {
+	case models.FieldInt:
+		numbers := make([]int, 0, len(values))
+		for _, value := range values {
+			numbers = append(numbers, typedValue(kind, value).(int))
+		}
+		return numbers
+	case models.FieldUUID:
+		ids := make([]uuid.UUID, 0, len(values))
+		for _, value := range values {
+			ids = append(ids, typedValue(kind, value).(uuid.UUID))
+		}
+		return ids
+	}
+	return values
+}
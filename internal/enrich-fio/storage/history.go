@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// _revisionColumns are columns of person_history table, in the order of models.Revision fields.
+const _revisionColumns = "person_id, revision, operation, old_value, new_value, actor, source, changed_at"
+
+// insertRevision records a change of person with given ID in its history, and writes event about it to outbox.
+// Actor and source are taken from ctx, operation is overriden if ctx says so.
+func insertRevision(ctx context.Context, tx pgx.Tx, operation models.Operation, personID uuid.UUID, old *models.Person, new *models.Person) error {
+	audit := models.AuditFromContext(ctx)
+	if audit.Operation != "" {
+		operation = audit.Operation
+	}
+	query := `
+	WITH revisions AS (
+		INSERT INTO person_history (tenant_id, person_id, revision, operation, old_value, new_value, actor, source)
+		SELECT @tenant::varchar, @personID::uuid, COALESCE(MAX(revision), 0) + 1, @operation::varchar, @oldValue::jsonb, @newValue::jsonb, @actor::varchar, @source::varchar
+		FROM person_history
+		WHERE tenant_id = @tenant AND person_id = @personID
+		RETURNING tenant_id, ` + _revisionColumns + `
+	)` + _insertEvents
+	args := pgx.NamedArgs{
+		"tenant":    models.TenantFromContext(ctx),
+		"personID":  personID,
+		"operation": operation,
+		"oldValue":  old,
+		"newValue":  new,
+		"actor":     audit.Actor,
+		"source":    audit.Source,
+	}
+	_, err := tx.Exec(ctx, query, args)
+	if err != nil {
+		return errors.Wrap(err, "exec insert query")
+	}
+	return nil
+}
+
+// History returns all recorded revisions of person with given ID, oldest first.
+func (s *Storage) History(ctx context.Context, id uuid.UUID) ([]models.Revision, error) {
+	query := `
+	SELECT ` + _revisionColumns + `
+	FROM person_history
+	WHERE tenant_id = $1 AND person_id = $2
+	ORDER BY revision
+	`
+	rows, err := s.db.Query(ctx, query, models.TenantFromContext(ctx), id)
+	if err != nil {
+		return nil, errors.Wrap(err, "query history")
+	}
+	revisions, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.Revision])
+	if err != nil {
+		return nil, errors.Wrap(err, "collect rows")
+	}
+	err = s.decryptRevisions(revisions)
+	if err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// GetRevision returns given revision of person with given ID.
+// Returns models.ErrRevisionNotFound if no such revision recorded.
+func (s *Storage) GetRevision(ctx context.Context, id uuid.UUID, revision int) (models.Revision, error) {
+	query := `
+	SELECT ` + _revisionColumns + `
+	FROM person_history
+	WHERE tenant_id = $1 AND person_id = $2 AND revision = $3
+	`
+	rows, err := s.db.Query(ctx, query, models.TenantFromContext(ctx), id, revision)
+	if err != nil {
+		return models.Revision{}, errors.Wrap(err, "query revision")
+	}
+	r, err := pgx.CollectOneRow(rows, pgx.RowToStructByPos[models.Revision])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Revision{}, models.ErrRevisionNotFound
+		}
+		return models.Revision{}, errors.Wrap(err, "collect row")
+	}
+	r, err = s.keyring.DecryptRevision(r)
+	if err != nil {
+		return models.Revision{}, errors.Wrapf(err, "decrypt revision %d of %s", revision, id)
+	}
+	return r, nil
+}
+
+// GetAsOf returns person with given ID as it was at given moment.
+// Returns models.ErrPersonNotFound if person didn't exist at that moment.
+func (s *Storage) GetAsOf(ctx context.Context, id uuid.UUID, at time.Time) (models.Person, error) {
+	query := `
+	SELECT new_value
+	FROM person_history
+	WHERE tenant_id = $1 AND person_id = $2 AND changed_at <= $3
+	ORDER BY revision DESC
+	LIMIT 1
+	`
+	var person *models.Person
+	err := s.db.QueryRow(ctx, query, models.TenantFromContext(ctx), id, at).Scan(&person)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Person{}, models.ErrPersonNotFound
+		}
+		return models.Person{}, errors.Wrap(err, "query person as of")
+	}
+	if person == nil {
+		return models.Person{}, models.ErrPersonNotFound
+	}
+	return s.decrypt(*person)
+}
@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// SaveImport saves given import job, overwriting the stored one. Counts of rows are not saved, they are computed from rows.
+func (s *Storage) SaveImport(ctx context.Context, job models.ImportJob) error {
+	_, err := s.db.Exec(ctx, `
+	INSERT INTO import_job (tenant_id, id, status, options, error, created_at, updated_at)
+	VALUES (@tenant, @id, @status, @options, @error, @createdAt, @updatedAt)
+	ON CONFLICT (tenant_id, id) DO UPDATE
+	SET status = excluded.status, options = excluded.options, error = excluded.error, updated_at = excluded.updated_at
+	`, pgx.NamedArgs{
+		"tenant":    models.TenantFromContext(ctx),
+		"id":        job.ID,
+		"status":    job.Status,
+		"options":   job.Options,
+		"error":     job.Error,
+		"createdAt": job.CreatedAt,
+		"updatedAt": job.UpdatedAt,
+	})
+	return errors.Wrap(err, "exec upsert query")
+}
+
+// GetImport returns import job by given ID with counts of its rows.
+// Returns models.ErrImportNotFound if no such job found in the storage.
+func (s *Storage) GetImport(ctx context.Context, id uuid.UUID) (models.ImportJob, error) {
+	query := `
+	SELECT j.id, j.status, j.options, j.error, j.created_at, j.updated_at,
+		count(r.number), count(r.number) FILTER (WHERE r.status = 'imported'), count(r.number) FILTER (WHERE r.status = 'failed')
+	FROM import_job j
+	LEFT JOIN import_row r ON r.tenant_id = j.tenant_id AND r.job_id = j.id
+	WHERE j.tenant_id = $1 AND j.id = $2
+	GROUP BY j.tenant_id, j.id
+	`
+	var job models.ImportJob
+	err := s.db.QueryRow(ctx, query, models.TenantFromContext(ctx), id).Scan(&job.ID, &job.Status, &job.Options, &job.Error,
+		&job.CreatedAt, &job.UpdatedAt, &job.Rows, &job.Imported, &job.Failed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ImportJob{}, models.ErrImportNotFound
+	}
+	if err != nil {
+		return models.ImportJob{}, errors.Wrap(err, "query import")
+	}
+	return job, nil
+}
+
+// checkImport returns models.ErrImportNotFound if tenant from ctx has no import job with given ID.
+func (s *Storage) checkImport(ctx context.Context, id uuid.UUID) error {
+	var exists bool
+	err := s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM import_job WHERE tenant_id = $1 AND id = $2)`,
+		models.TenantFromContext(ctx), id).Scan(&exists)
+	if err != nil {
+		return errors.Wrap(err, "query import")
+	}
+	if !exists {
+		return models.ErrImportNotFound
+	}
+	return nil
+}
+
+// _importRowColumns are columns, rows are copied into import_row table with.
+var _importRowColumns = []string{"tenant_id", "job_id", "number", "status", "person_id", "name", "surname", "patronymic",
+	"error", "key_id"}
+
+// AddImportRows adds given rows to import job with given ID.
+// Returns models.ErrImportNotFound if no such job found in the storage.
+func (s *Storage) AddImportRows(ctx context.Context, id uuid.UUID, rows []models.ImportRow) error {
+	err := s.checkImport(ctx, id)
+	if err != nil {
+		return err
+	}
+	tenant := models.TenantFromContext(ctx)
+	values := make([][]any, 0, len(rows))
+	for _, row := range rows {
+		encrypted, err := s.encrypt(models.Person{Name: row.Name, Surname: row.Surname, Patronymic: row.Patronymic})
+		if err != nil {
+			return errors.Wrapf(err, "row %d", row.Row)
+		}
+		values = append(values, []any{tenant, id, row.Row, row.Status, row.PersonID,
+			encrypted.Name, encrypted.Surname, encrypted.Patronymic, row.Error, encrypted.KeyID})
+	}
+	_, err = s.db.CopyFrom(ctx, pgx.Identifier{"import_row"}, _importRowColumns, pgx.CopyFromRows(values))
+	return errors.Wrap(err, "copy rows")
+}
+
+// ImportRows returns rows of import job with given ID, matching the query, in order of their numbers.
+// Returns models.ErrImportNotFound if no such job found in the storage.
+func (s *Storage) ImportRows(ctx context.Context, id uuid.UUID, query models.ImportRowsQuery) ([]models.ImportRow, error) {
+	err := s.checkImport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx, `
+	SELECT number, status, person_id, name, surname, patronymic, error
+	FROM import_row
+	WHERE tenant_id = @tenant AND job_id = @job AND number > @after AND (NOT @pending OR status = 'pending')
+	ORDER BY number
+	LIMIT @limit
+	`, pgx.NamedArgs{
+		"tenant":  models.TenantFromContext(ctx),
+		"job":     id,
+		"after":   query.After,
+		"pending": query.Pending,
+		"limit":   query.Limit,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "query rows")
+	}
+	result := []models.ImportRow{}
+	var r models.ImportRow
+	_, err = pgx.ForEachRow(rows, []any{&r.Row, &r.Status, &r.PersonID, &r.Name, &r.Surname, &r.Patronymic, &r.Error}, func() error {
+		decrypted, err := s.decrypt(models.Person{Name: r.Name, Surname: r.Surname, Patronymic: r.Patronymic})
+		if err != nil {
+			return errors.Wrapf(err, "row %d", r.Row)
+		}
+		r.Name, r.Surname, r.Patronymic = decrypted.Name, decrypted.Surname, decrypted.Patronymic
+		result = append(result, r)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "scan rows")
+	}
+	return result, nil
+}
+
+// SaveImportResults updates statuses, person IDs and errors of given rows of import job with given ID.
+func (s *Storage) SaveImportResults(ctx context.Context, id uuid.UUID, rows []models.ImportRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	numbers := make([]int, 0, len(rows))
+	statuses := make([]string, 0, len(rows))
+	people := make([]uuid.UUID, 0, len(rows))
+	errs := make([]string, 0, len(rows))
+	for _, row := range rows {
+		numbers = append(numbers, row.Row)
+		statuses = append(statuses, string(row.Status))
+		people = append(people, row.PersonID)
+		errs = append(errs, row.Error)
+	}
+	_, err := s.db.Exec(ctx, `
+	UPDATE import_row r
+	SET status = u.status, person_id = u.person_id, error = u.error
+	FROM unnest(@numbers::integer[], @statuses::text[], @people::uuid[], @errors::text[]) AS u (number, status, person_id, error)
+	WHERE r.tenant_id = @tenant AND r.job_id = @job AND r.number = u.number
+	`, pgx.NamedArgs{
+		"tenant":   models.TenantFromContext(ctx),
+		"job":      id,
+		"numbers":  numbers,
+		"statuses": statuses,
+		"people":   people,
+		"errors":   errs,
+	})
+	return errors.Wrap(err, "exec update query")
+}
+
+// ClaimImport claims import job with given ID for the run and sets its status to running with no error.
+// Job is claimed anew if it's neither done nor running, or if claim of the run, running it, has expired.
+// Claim is renewed only if it's held by the same run, and the job is still running.
+// Returns models.ErrImportClaimed if job can't be claimed.
+// Returns models.ErrImportNotFound if no such job found in the storage.
+func (s *Storage) ClaimImport(ctx context.Context, id uuid.UUID, claim models.ImportClaim) error {
+	// Update locks the job, so of concurrent claims only the first one succeeds.
+	tag, err := s.db.Exec(ctx, `
+	UPDATE import_job
+	SET status = 'running', error = '', runner = @runner, lease_until = @until, updated_at = @now
+	WHERE tenant_id = @tenant AND id = @id AND CASE
+		WHEN @renew THEN status = 'running' AND runner = @runner
+		ELSE status <> 'done' AND (status <> 'running' OR lease_until IS NULL OR lease_until < @now)
+	END
+	`, pgx.NamedArgs{
+		"tenant": models.TenantFromContext(ctx),
+		"id":     id,
+		"runner": claim.Runner,
+		"until":  claim.Until,
+		"renew":  claim.Renew,
+		"now":    time.Now(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "exec update query")
+	}
+	if tag.RowsAffected() == 0 {
+		err = s.checkImport(ctx, id)
+		if err != nil {
+			return err
+		}
+		return models.ErrImportClaimed
+	}
+	return nil
+}
+
+// rotateImportRows rewraps data keys of FIO of import rows, encrypted with other master keys than the current one, in batches.
+func (s *Storage) rotateImportRows(ctx context.Context) (int64, error) {
+	var rotated int64
+	for {
+		var scanned int
+		err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+			rows, err := tx.Query(ctx, `
+			SELECT tenant_id, job_id, number, name, surname, patronymic
+			FROM import_row
+			WHERE key_id <> $1
+			LIMIT $2
+			FOR UPDATE
+			`, s.keyring.CurrentKeyID(), _rotateBatchSize)
+			if err != nil {
+				return errors.Wrap(err, "query rows")
+			}
+			type fioRow struct {
+				TenantID   string
+				JobID      uuid.UUID
+				Number     int
+				Name       string
+				Surname    string
+				Patronymic string
+			}
+			found, err := pgx.CollectRows(rows, pgx.RowToStructByPos[fioRow])
+			if err != nil {
+				return errors.Wrap(err, "collect rows")
+			}
+			scanned = len(found)
+			for _, row := range found {
+				rewrapped, err := s.keyring.RewrapPerson(models.Person{Name: row.Name, Surname: row.Surname, Patronymic: row.Patronymic})
+				if err != nil {
+					return errors.Wrapf(err, "row %d of import %s", row.Number, row.JobID)
+				}
+				_, err = tx.Exec(ctx, `
+				UPDATE import_row SET name = $1, surname = $2, patronymic = $3, key_id = $4
+				WHERE tenant_id = $5 AND job_id = $6 AND number = $7
+				`, rewrapped.Name, rewrapped.Surname, rewrapped.Patronymic, s.keyring.CurrentKeyID(), row.TenantID, row.JobID, row.Number)
+				if err != nil {
+					return errors.Wrap(err, "exec update query")
+				}
+			}
+			rotated += int64(scanned)
+			return nil
+		})
+		if err != nil || scanned < _rotateBatchSize {
+			return rotated, err
+		}
+	}
+}
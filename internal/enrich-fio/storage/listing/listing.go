@@ -0,0 +1,210 @@
+// Package listing implements ordering and pagination of people listing, common for all storage implementations.
+package listing
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// Column is a person field, people listing is ordered by.
+type Column struct {
+	Key  string
+	Desc bool
+}
+
+// SortableFields are person fields, people can be ordered by.
+var SortableFields = []string{"name", "surname", "patronymic", "age", "gender", "nationality", "version"}
+
+// DefaultOrder is an order of people listing, if client didn't choose one. Ties are always broken by id.
+var DefaultOrder = []Column{{Key: "name"}}
+
+// Order returns order of people listing, described by given sort keys.
+// Returns models.ErrInvalidSortKey if people can't be ordered by some of the keys.
+func Order(keys []models.SortKey) ([]Column, error) {
+	if len(keys) == 0 {
+		return DefaultOrder, nil
+	}
+	order := make([]Column, 0, len(keys))
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if !sortable(key.Field) {
+			return nil, errors.Wrapf(models.ErrInvalidSortKey, "unknown field %q", key.Field)
+		}
+		if seen[key.Field] {
+			return nil, errors.Wrapf(models.ErrInvalidSortKey, "field %q repeated", key.Field)
+		}
+		seen[key.Field] = true
+		order = append(order, Column{Key: key.Field, Desc: key.Desc})
+	}
+	return order, nil
+}
+
+func sortable(field string) bool {
+	for _, sortableField := range SortableFields {
+		if field == sortableField {
+			return true
+		}
+	}
+	return false
+}
+
+// Cursor is a position in people listing: the boundary row of a page and a direction to go from it.
+type Cursor struct {
+	// Order is a signature of the order cursor was made for.
+	Order string `json:"o"`
+	// Values are values of order columns in the boundary row, see SortValue.
+	Values []any     `json:"v"`
+	ID     uuid.UUID `json:"id"`
+	// Backward is set if cursor points to the rows before the boundary row.
+	Backward bool `json:"b"`
+}
+
+// EncodeCursor returns opaque cursor, pointing to the rows after (or before, if backward) given person.
+func EncodeCursor(order []Column, person models.Person, backward bool) string {
+	c := Cursor{
+		Order:    orderSignature(order),
+		Values:   make([]any, 0, len(order)),
+		ID:       person.ID,
+		Backward: backward,
+	}
+	for _, column := range order {
+		c.Values = append(c.Values, SortValue(person, column.Key))
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor decodes opaque cursor, made for listing with given order.
+// Returns models.ErrInvalidCursor if cursor is malformed, was made for another order, or has values of wrong types.
+func DecodeCursor(encoded string, order []Column) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Cursor{}, models.ErrInvalidCursor
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	c := Cursor{}
+	err = decoder.Decode(&c)
+	if err != nil {
+		return Cursor{}, models.ErrInvalidCursor
+	}
+	if c.Order != orderSignature(order) || len(c.Values) != len(order) {
+		return Cursor{}, models.ErrInvalidCursor
+	}
+	// Values are compared with their columns by storage, so a value of another type fails the query.
+	for i, value := range c.Values {
+		switch SortValue(models.Person{}, order[i].Key).(type) {
+		case int64:
+			number, ok := value.(json.Number)
+			if !ok {
+				return Cursor{}, models.ErrInvalidCursor
+			}
+			c.Values[i], err = number.Int64()
+			if err != nil {
+				return Cursor{}, models.ErrInvalidCursor
+			}
+		case string:
+			if _, ok := value.(string); !ok {
+				return Cursor{}, models.ErrInvalidCursor
+			}
+		}
+	}
+	return c, nil
+}
+
+// orderSignature returns short textual representation of given order.
+func orderSignature(order []Column) string {
+	keys := make([]string, 0, len(order))
+	for _, column := range order {
+		if column.Desc {
+			keys = append(keys, "-"+column.Key)
+			continue
+		}
+		keys = append(keys, column.Key)
+	}
+	return strings.Join(keys, ",")
+}
+
+// SortValue returns value of person's field, people can be ordered by.
+// Values are strings or int64.
+func SortValue(person models.Person, key string) any {
+	switch key {
+	case "name":
+		return person.Name
+	case "surname":
+		return person.Surname
+	case "patronymic":
+		return person.Patronymic
+	case "age":
+		return int64(person.Age)
+	case "gender":
+		return string(person.Gender)
+	case "nationality":
+		return person.Nationality
+	case "version":
+		return person.Version
+	}
+	return nil
+}
+
+// PageSize returns page size to use, when client asked for the given one.
+func PageSize(requested int, defaultSize int, maxSize int) int {
+	if requested <= 0 {
+		return defaultSize
+	}
+	if requested > maxSize {
+		return maxSize
+	}
+	return requested
+}
+
+// Paginate trims people fetched for a page of given size and makes cursors to neighbouring pages.
+// People are expected to be fetched with one extra row, to know whether there are more.
+// Going backward, they are expected in reversed order.
+func Paginate(order []Column, people []models.Person, pageSize int, opts models.ListOptions, c Cursor) models.PeoplePage {
+	hasMore := len(people) > pageSize
+	if hasMore {
+		people = people[:pageSize]
+	}
+	if c.Backward {
+		for i, j := 0, len(people)-1; i < j; i, j = i+1, j-1 {
+			people[i], people[j] = people[j], people[i]
+		}
+	}
+	page := models.PeoplePage{
+		People:   people,
+		PageSize: pageSize,
+		// Going backward, there are always people after the page: the ones cursor came from.
+		HasMore: hasMore || c.Backward,
+	}
+	if opts.Cursor == "" {
+		number := opts.Page
+		page.Page = &number
+	}
+	if len(people) == 0 {
+		return page
+	}
+	first, last := people[0], people[len(people)-1]
+	switch {
+	case c.Backward:
+		page.NextCursor = EncodeCursor(order, last, false)
+		if hasMore {
+			page.PrevCursor = EncodeCursor(order, first, true)
+		}
+	default:
+		if hasMore {
+			page.NextCursor = EncodeCursor(order, last, false)
+		}
+		if opts.Cursor != "" || opts.Page > 0 {
+			page.PrevCursor = EncodeCursor(order, first, true)
+		}
+	}
+	return page
+}
@@ -0,0 +1,30 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"sort"
+
+	"enrich-fio/internal/models"
+)
+
+// Export calls fn with every person, matching the filter, in order of IDs, and stops at the first error fn returns.
+// People are in memory anyway, so they are exported from a copy, taken at once.
+// Returns models.ErrInvalidFilter if filter can't be applied.
+func (s *Storage) Export(ctx context.Context, filter models.FilterConfig, fn func(person models.Person) error) error {
+	matches, err := filterPredicate(filter)
+	if err != nil {
+		return err
+	}
+	people := s.matching(ctx, matches)
+	sort.Slice(people, func(i, j int) bool {
+		return bytes.Compare(people[i].ID[:], people[j].ID[:]) < 0
+	})
+	for _, person := range people {
+		err = fn(person)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
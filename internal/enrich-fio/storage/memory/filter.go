@@ -0,0 +1,253 @@
+package memory
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// predicate tells whether person matches some filter.
+type predicate func(person models.Person) bool
+
+// filterPredicate returns predicate, matching the given filter.
+// Returns models.ErrInvalidFilter if filter can't be applied.
+func filterPredicate(filter models.FilterConfig) (predicate, error) {
+	predicates := []predicate{}
+	if filter.ID != uuid.Nil {
+		predicates = append(predicates, func(p models.Person) bool { return p.ID == filter.ID })
+	}
+	if filter.Name != "" {
+		predicates = append(predicates, func(p models.Person) bool { return p.Name == filter.Name })
+	}
+	if filter.Surname != "" {
+		predicates = append(predicates, func(p models.Person) bool { return p.Surname == filter.Surname })
+	}
+	if filter.Patronymic != "" {
+		predicates = append(predicates, func(p models.Person) bool { return p.Patronymic == filter.Patronymic })
+	}
+	if filter.Age.Min != nil {
+		ageMin := *filter.Age.Min
+		predicates = append(predicates, func(p models.Person) bool { return p.Age >= ageMin })
+	}
+	if filter.Age.Max != nil {
+		ageMax := *filter.Age.Max
+		predicates = append(predicates, func(p models.Person) bool { return p.Age <= ageMax })
+	}
+	if filter.Gender != "" {
+		predicates = append(predicates, func(p models.Person) bool { return p.Gender == filter.Gender })
+	}
+	err := filter.NationalityMatch.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if filter.Nationality != "" && filter.NationalityMatch == models.NationalityAny {
+		predicates = append(predicates, func(p models.Person) bool {
+			if p.Nationality == filter.Nationality {
+				return true
+			}
+			for _, n := range p.Nationalities {
+				if n.Country == filter.Nationality {
+					return true
+				}
+			}
+			return false
+		})
+	} else if filter.Nationality != "" {
+		predicates = append(predicates, func(p models.Person) bool { return p.Nationality == filter.Nationality })
+	}
+	for _, tag := range filter.Tags {
+		tag := tag
+		predicates = append(predicates, func(p models.Person) bool { return slices.Contains(p.Tags, tag) })
+	}
+	for key, value := range filter.Attributes {
+		key, value := key, value
+		predicates = append(predicates, func(p models.Person) bool {
+			got, ok := p.Attributes[key]
+			return ok && got == value
+		})
+	}
+
+	for _, c := range filter.Conditions {
+		condition, err := conditionPredicate(c)
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, condition)
+	}
+	for _, group := range filter.AnyOf {
+		if len(group) == 0 {
+			continue
+		}
+		alternatives := make([]predicate, 0, len(group))
+		for _, c := range group {
+			condition, err := conditionPredicate(c)
+			if err != nil {
+				return nil, err
+			}
+			alternatives = append(alternatives, condition)
+		}
+		predicates = append(predicates, anyOf(alternatives))
+	}
+	if filter.Expr != nil {
+		expr, err := exprPredicate(filter.Expr)
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, expr)
+	}
+	return allOf(predicates), nil
+}
+
+// exprPredicate returns predicate, matching the given filter expression.
+// Returns models.ErrInvalidFilter if expression can't be applied.
+func exprPredicate(expr models.Expr) (predicate, error) {
+	switch expr := expr.(type) {
+	case models.Condition:
+		return conditionPredicate(expr)
+	case models.AndExpr:
+		left, right, err := operandPredicates(expr.Left, expr.Right)
+		if err != nil {
+			return nil, err
+		}
+		return allOf([]predicate{left, right}), nil
+	case models.OrExpr:
+		left, right, err := operandPredicates(expr.Left, expr.Right)
+		if err != nil {
+			return nil, err
+		}
+		return anyOf([]predicate{left, right}), nil
+	case models.NotExpr:
+		operand, err := exprPredicate(expr.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return func(p models.Person) bool { return !operand(p) }, nil
+	}
+	return nil, errors.Wrapf(models.ErrInvalidFilter, "unsupported expression %T", expr)
+}
+
+func operandPredicates(left models.Expr, right models.Expr) (predicate, predicate, error) {
+	leftPredicate, err := exprPredicate(left)
+	if err != nil {
+		return nil, nil, err
+	}
+	rightPredicate, err := exprPredicate(right)
+	if err != nil {
+		return nil, nil, err
+	}
+	return leftPredicate, rightPredicate, nil
+}
+
+// conditionPredicate returns predicate, matching the given condition.
+// Returns models.ErrInvalidFilter if condition can't be applied.
+func conditionPredicate(c models.Condition) (predicate, error) {
+	err := c.Validate()
+	if err != nil {
+		return nil, err
+	}
+	kind := models.FilterFields[c.Field]
+	values := make([]any, 0, len(c.Values))
+	for _, value := range c.Values {
+		values = append(values, typedValue(kind, value))
+	}
+
+	var condition predicate
+	switch c.Op {
+	case models.OperatorEq, models.OperatorIn:
+		condition = func(p models.Person) bool {
+			field := fieldValue(p, c.Field)
+			for _, value := range values {
+				if field == value {
+					return true
+				}
+			}
+			return false
+		}
+	case models.OperatorUnknown:
+		// Unknown values are stored as zero values.
+		zero := typedValue(kind, "")
+		condition = func(p models.Person) bool { return fieldValue(p, c.Field) == zero }
+	default:
+		// Only integer fields can be compared, see models.Condition.Validate.
+		value := values[0].(int64)
+		condition = func(p models.Person) bool {
+			field := fieldValue(p, c.Field).(int64)
+			switch c.Op {
+			case models.OperatorGt:
+				return field > value
+			case models.OperatorGte:
+				return field >= value
+			case models.OperatorLt:
+				return field < value
+			}
+			return field <= value
+		}
+	}
+	if c.Not {
+		return func(p models.Person) bool { return !condition(p) }, nil
+	}
+	return condition, nil
+}
+
+// fieldValue returns value of person's field, people can be filtered by, of the type typedValue returns.
+func fieldValue(person models.Person, field string) any {
+	switch field {
+	case "id":
+		return person.ID
+	case "name":
+		return person.Name
+	case "surname":
+		return person.Surname
+	case "patronymic":
+		return person.Patronymic
+	case "age":
+		return int64(person.Age)
+	case "gender":
+		return string(person.Gender)
+	case "nationality":
+		return person.Nationality
+	case "version":
+		return person.Version
+	}
+	return nil
+}
+
+// typedValue converts validated textual value of a field of given kind to the field's type.
+// Empty value is converted to zero value.
+func typedValue(kind models.FieldKind, value string) any {
+	switch kind {
+	case models.FieldInt:
+		number, _ := strconv.ParseInt(value, 10, 64)
+		return number
+	case models.FieldUUID:
+		id, _ := uuid.Parse(value)
+		return id
+	}
+	return value
+}
+
+func allOf(predicates []predicate) predicate {
+	return func(p models.Person) bool {
+		for _, matches := range predicates {
+			if !matches(p) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func anyOf(predicates []predicate) predicate {
+	return func(p models.Person) bool {
+		for _, matches := range predicates {
+			if matches(p) {
+				return true
+			}
+		}
+		return false
+	}
+}
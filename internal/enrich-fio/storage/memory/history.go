@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"enrich-fio/internal/models"
+)
+
+// record records a change of person with given ID in its history, and writes event about it to outbox.
+// Actor and source are taken from ctx, operation is overriden if ctx says so.
+func (st *state) record(ctx context.Context, operation models.Operation, personID uuid.UUID, old *models.Person, new *models.Person) {
+	audit := models.AuditFromContext(ctx)
+	if audit.Operation != "" {
+		operation = audit.Operation
+	}
+	revisions := st.history[personID]
+	revision := 1
+	if len(revisions) != 0 {
+		revision = revisions[len(revisions)-1].Revision + 1
+	}
+	recorded := models.Revision{
+		PersonID:  personID,
+		Revision:  revision,
+		Operation: operation,
+		OldValue:  copyPerson(old),
+		NewValue:  copyPerson(new),
+		Actor:     audit.Actor,
+		Source:    audit.Source,
+		ChangedAt: time.Now(),
+	}
+	st.history[personID] = append(revisions, recorded)
+	st.outbox.add(st.tenant, recorded)
+}
+
+// copyPerson returns a pointer to a copy of given person, so recorded values don't change with the original.
+func copyPerson(person *models.Person) *models.Person {
+	if person == nil {
+		return nil
+	}
+	copied := *person
+	return &copied
+}
+
+// History returns all recorded revisions of person with given ID, oldest first.
+func (s *Storage) History(ctx context.Context, id uuid.UUID) ([]models.Revision, error) {
+	var revisions []models.Revision
+	err := s.read(ctx, func(st *state) error {
+		revisions = append([]models.Revision{}, st.history[id]...)
+		return nil
+	})
+	return revisions, err
+}
+
+// GetRevision returns given revision of person with given ID.
+// Returns models.ErrRevisionNotFound if no such revision recorded.
+func (s *Storage) GetRevision(ctx context.Context, id uuid.UUID, revision int) (models.Revision, error) {
+	var found models.Revision
+	err := s.read(ctx, func(st *state) error {
+		for _, r := range st.history[id] {
+			if r.Revision == revision {
+				found = r
+				return nil
+			}
+		}
+		return models.ErrRevisionNotFound
+	})
+	return found, err
+}
+
+// GetAsOf returns person with given ID as it was at given moment.
+// Returns models.ErrPersonNotFound if person didn't exist at that moment.
+func (s *Storage) GetAsOf(ctx context.Context, id uuid.UUID, at time.Time) (models.Person, error) {
+	var person models.Person
+	err := s.read(ctx, func(st *state) error {
+		revisions := st.history[id]
+		for i := len(revisions) - 1; i >= 0; i-- {
+			if revisions[i].ChangedAt.After(at) {
+				continue
+			}
+			if revisions[i].NewValue == nil {
+				return models.ErrPersonNotFound
+			}
+			person = *revisions[i].NewValue
+			return nil
+		}
+		return models.ErrPersonNotFound
+	})
+	return person, err
+}
@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// importJob is an import job with rows of imported file.
+type importJob struct {
+	job models.ImportJob
+	// rows are in order of their numbers.
+	rows []models.ImportRow
+	// claim is the last claim of the job.
+	claim models.ImportClaim
+}
+
+// SaveImport saves given import job, overwriting the stored one. Counts of rows are not saved, they are computed from rows.
+func (s *Storage) SaveImport(ctx context.Context, job models.ImportJob) error {
+	job.Rows, job.Imported, job.Failed, job.Runner = 0, 0, 0, uuid.Nil
+	return s.write(ctx, func(st *state) error {
+		stored, ok := st.imports[job.ID]
+		if !ok {
+			st.imports[job.ID] = &importJob{job: job}
+			return nil
+		}
+		stored.job = job
+		return nil
+	})
+}
+
+// GetImport returns import job by given ID with counts of its rows.
+// Returns models.ErrImportNotFound if no such job found in the storage.
+func (s *Storage) GetImport(ctx context.Context, id uuid.UUID) (models.ImportJob, error) {
+	var job models.ImportJob
+	err := s.read(ctx, func(st *state) error {
+		stored, ok := st.imports[id]
+		if !ok {
+			return models.ErrImportNotFound
+		}
+		job = stored.job
+		job.Rows = len(stored.rows)
+		for _, row := range stored.rows {
+			switch row.Status {
+			case models.ImportRowImported:
+				job.Imported++
+			case models.ImportRowFailed:
+				job.Failed++
+			}
+		}
+		return nil
+	})
+	return job, err
+}
+
+// AddImportRows adds given rows to import job with given ID.
+// Returns models.ErrImportNotFound if no such job found in the storage.
+func (s *Storage) AddImportRows(ctx context.Context, id uuid.UUID, rows []models.ImportRow) error {
+	return s.write(ctx, func(st *state) error {
+		stored, ok := st.imports[id]
+		if !ok {
+			return models.ErrImportNotFound
+		}
+		for _, row := range rows {
+			i := sort.Search(len(stored.rows), func(i int) bool { return stored.rows[i].Row >= row.Row })
+			if i < len(stored.rows) && stored.rows[i].Row == row.Row {
+				return errors.Errorf("row %d of import %s already added", row.Row, id)
+			}
+		}
+		stored.rows = append(stored.rows, rows...)
+		sort.SliceStable(stored.rows, func(i, j int) bool { return stored.rows[i].Row < stored.rows[j].Row })
+		return nil
+	})
+}
+
+// ImportRows returns rows of import job with given ID, matching the query, in order of their numbers.
+// Returns models.ErrImportNotFound if no such job found in the storage.
+func (s *Storage) ImportRows(ctx context.Context, id uuid.UUID, query models.ImportRowsQuery) ([]models.ImportRow, error) {
+	rows := []models.ImportRow{}
+	err := s.read(ctx, func(st *state) error {
+		stored, ok := st.imports[id]
+		if !ok {
+			return models.ErrImportNotFound
+		}
+		for _, row := range stored.rows {
+			if len(rows) == query.Limit {
+				break
+			}
+			if row.Row <= query.After || query.Pending && row.Status != models.ImportRowPending {
+				continue
+			}
+			rows = append(rows, row)
+		}
+		return nil
+	})
+	return rows, err
+}
+
+// ClaimImport claims import job with given ID for the run and sets its status to running with no error.
+// Job is claimed anew if it's neither done nor running, or if claim of the run, running it, has expired.
+// Claim is renewed only if it's held by the same run, and the job is still running.
+// Returns models.ErrImportClaimed if job can't be claimed.
+// Returns models.ErrImportNotFound if no such job found in the storage.
+func (s *Storage) ClaimImport(ctx context.Context, id uuid.UUID, claim models.ImportClaim) error {
+	now := time.Now()
+	return s.write(ctx, func(st *state) error {
+		stored, ok := st.imports[id]
+		if !ok {
+			return models.ErrImportNotFound
+		}
+		running := stored.job.Status == models.ImportRunning
+		if claim.Renew && (!running || stored.claim.Runner != claim.Runner) ||
+			!claim.Renew && (stored.job.Status == models.ImportDone || running && !stored.claim.Until.Before(now)) {
+			return models.ErrImportClaimed
+		}
+		stored.job.Status, stored.job.Error, stored.job.UpdatedAt = models.ImportRunning, "", now
+		stored.claim = claim
+		return nil
+	})
+}
+
+// SaveImportResults updates statuses, person IDs and errors of given rows of import job with given ID.
+func (s *Storage) SaveImportResults(ctx context.Context, id uuid.UUID, rows []models.ImportRow) error {
+	return s.write(ctx, func(st *state) error {
+		stored, ok := st.imports[id]
+		if !ok {
+			return models.ErrImportNotFound
+		}
+		for _, row := range rows {
+			i := sort.Search(len(stored.rows), func(i int) bool { return stored.rows[i].Row >= row.Row })
+			if i == len(stored.rows) || stored.rows[i].Row != row.Row {
+				continue
+			}
+			stored.rows[i].Status = row.Status
+			stored.rows[i].PersonID = row.PersonID
+			stored.rows[i].Error = row.Error
+		}
+		return nil
+	})
+}
@@ -0,0 +1,147 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/enrich-fio/storage/listing"
+	"enrich-fio/internal/models"
+)
+
+// GetWithFilter returns a page of people that match the given filter.
+// Returns models.ErrInvalidCursor if opts.Cursor is malformed.
+// Returns models.ErrInvalidSortKey if people can't be ordered by opts.Sort.
+func (s *Storage) GetWithFilter(ctx context.Context, filter models.FilterConfig, opts models.ListOptions) (models.PeoplePage, error) {
+	pageSize := listing.PageSize(opts.PageSize, s.config.DefaultPageSize, s.config.MaxPageSize)
+	order, err := listing.Order(opts.Sort)
+	if err != nil {
+		return models.PeoplePage{}, err
+	}
+	matches, err := filterPredicate(filter)
+	if err != nil {
+		return models.PeoplePage{}, err
+	}
+	switch opts.Total {
+	case models.TotalNone, models.TotalExact, models.TotalEstimated:
+	default:
+		return models.PeoplePage{}, errors.Wrapf(models.ErrInvalidTotalMode, "%q", opts.Total)
+	}
+	c := listing.Cursor{}
+	if opts.Cursor != "" {
+		c, err = listing.DecodeCursor(opts.Cursor, order)
+		if err != nil {
+			return models.PeoplePage{}, err
+		}
+		if !cursorMatches(order, c) {
+			return models.PeoplePage{}, models.ErrInvalidCursor
+		}
+	}
+
+	people := s.matching(ctx, matches)
+	// Counting is cheap in memory, so total is never estimated.
+	total := int64(len(people))
+	sort.Slice(people, func(i, j int) bool {
+		less := compare(order, people[i], people[j]) < 0
+		return less != c.Backward
+	})
+
+	start := 0
+	if opts.Cursor != "" {
+		start = sort.Search(len(people), func(i int) bool {
+			cmp := compareToCursor(order, people[i], c)
+			if c.Backward {
+				return cmp < 0
+			}
+			return cmp > 0
+		})
+	} else {
+		start = min(opts.Page*pageSize, len(people))
+	}
+	// One extra person tells whether there is a next page.
+	end := min(start+pageSize+1, len(people))
+	page := listing.Paginate(order, append([]models.Person{}, people[start:end]...), pageSize, opts, c)
+	if opts.Total != models.TotalNone {
+		page.Total = &total
+	}
+	return page, nil
+}
+
+// matching returns all people of tenant from ctx, matching the predicate, in no particular order.
+func (s *Storage) matching(ctx context.Context, matches predicate) []models.Person {
+	people := []models.Person{}
+	s.read(ctx, func(st *state) error {
+		for _, person := range st.people {
+			if matches(person) {
+				people = append(people, person)
+			}
+		}
+		return nil
+	})
+	return people
+}
+
+// compare compares people in given order, breaking ties by id.
+func compare(order []listing.Column, a models.Person, b models.Person) int {
+	for _, column := range order {
+		cmp := compareValues(listing.SortValue(a, column.Key), listing.SortValue(b, column.Key))
+		if column.Desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return bytes.Compare(a.ID[:], b.ID[:])
+}
+
+// compareToCursor compares person with cursor's boundary row in given order.
+func compareToCursor(order []listing.Column, person models.Person, c listing.Cursor) int {
+	for i, column := range order {
+		cmp := compareValues(listing.SortValue(person, column.Key), c.Values[i])
+		if column.Desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return bytes.Compare(person.ID[:], c.ID[:])
+}
+
+// cursorMatches tells if cursor values have the types of order columns.
+func cursorMatches(order []listing.Column, c listing.Cursor) bool {
+	for i, column := range order {
+		switch listing.SortValue(models.Person{}, column.Key).(type) {
+		case string:
+			if _, ok := c.Values[i].(string); !ok {
+				return false
+			}
+		case int64:
+			if _, ok := c.Values[i].(int64); !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compareValues compares sort values of the same type, see listing.SortValue.
+func compareValues(a any, b any) int {
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case int64:
+		b := b.(int64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,328 @@
+// Package memory implements storage, that keeps people in process memory.
+// It is meant for local development and tests, and behaves the same way as the postgres storage,
+// except that strings are compared byte-wise rather than with database collation.
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/config"
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/models"
+)
+
+// Storage is storage implementation via process memory. It is safe for concurrent use.
+type Storage struct {
+	mu   *sync.RWMutex
+	data *data
+	// inTx is set for storage, passed to WithTx callback. Its lock is already held.
+	inTx   bool
+	config *config.DBConfig
+}
+
+// data is all the data storage keeps.
+type data struct {
+	// tenants are states of tenants by their IDs.
+	tenants map[string]*state
+	outbox  *outbox
+}
+
+// state is all the data storage keeps about people of a tenant.
+type state struct {
+	tenant string
+	people map[uuid.UUID]models.Person
+	// history are revisions of people, oldest first.
+	history map[uuid.UUID][]models.Revision
+	// anonymized are IDs of people, whose FIO is replaced with hashes.
+	anonymized map[uuid.UUID]bool
+	// addedAt are moments people were added at. Unlike history, they are kept when people are anonymized.
+	addedAt map[uuid.UUID]time.Time
+	// tombstones are traces of erased people.
+	tombstones map[uuid.UUID]models.Tombstone
+	// imports are import jobs by their IDs.
+	imports map[uuid.UUID]*importJob
+	// outbox is shared by all tenants.
+	outbox *outbox
+}
+
+// outbox keeps events about changes of people of all tenants.
+type outbox struct {
+	// events are oldest first.
+	events []outboxEvent
+	// lastEventID is ID of the last event ever written to outbox, even if it's deleted since.
+	lastEventID int64
+}
+
+// New returns storage implemented with process memory.
+func New(config *config.DBConfig) *Storage {
+	return &Storage{
+		mu: &sync.RWMutex{},
+		data: &data{
+			tenants: map[string]*state{},
+			outbox:  &outbox{},
+		},
+		config: config,
+	}
+}
+
+// newState returns empty state of given tenant.
+func newState(tenant string, outbox *outbox) *state {
+	return &state{
+		tenant:     tenant,
+		people:     map[uuid.UUID]models.Person{},
+		history:    map[uuid.UUID][]models.Revision{},
+		anonymized: map[uuid.UUID]bool{},
+		addedAt:    map[uuid.UUID]time.Time{},
+		tombstones: map[uuid.UUID]models.Tombstone{},
+		imports:    map[uuid.UUID]*importJob{},
+		outbox:     outbox,
+	}
+}
+
+// clone returns a copy of data, which can be changed without affecting the original.
+func (d *data) clone() *data {
+	clone := &data{
+		tenants: make(map[string]*state, len(d.tenants)),
+		outbox: &outbox{
+			events:      append([]outboxEvent(nil), d.outbox.events...),
+			lastEventID: d.outbox.lastEventID,
+		},
+	}
+	for tenant, st := range d.tenants {
+		clone.tenants[tenant] = st.clone(clone.outbox)
+	}
+	return clone
+}
+
+// clone returns a copy of state, which can be changed without affecting the original. The copy shares given outbox.
+func (st *state) clone(outbox *outbox) *state {
+	clone := &state{
+		tenant:     st.tenant,
+		people:     make(map[uuid.UUID]models.Person, len(st.people)),
+		history:    make(map[uuid.UUID][]models.Revision, len(st.history)),
+		anonymized: make(map[uuid.UUID]bool, len(st.anonymized)),
+		addedAt:    make(map[uuid.UUID]time.Time, len(st.addedAt)),
+		tombstones: make(map[uuid.UUID]models.Tombstone, len(st.tombstones)),
+		imports:    make(map[uuid.UUID]*importJob, len(st.imports)),
+		outbox:     outbox,
+	}
+	for id, person := range st.people {
+		clone.people[id] = person
+	}
+	for id, revisions := range st.history {
+		clone.history[id] = append([]models.Revision(nil), revisions...)
+	}
+	for id := range st.anonymized {
+		clone.anonymized[id] = true
+	}
+	for id, at := range st.addedAt {
+		clone.addedAt[id] = at
+	}
+	for id, tombstone := range st.tombstones {
+		clone.tombstones[id] = tombstone
+	}
+	for id, job := range st.imports {
+		clone.imports[id] = &importJob{
+			job:   job.job,
+			rows:  append([]models.ImportRow(nil), job.rows...),
+			claim: job.claim,
+		}
+	}
+	return clone
+}
+
+// readData calls fn with data, locked for reading.
+func (s *Storage) readData(fn func(d *data) error) error {
+	if !s.inTx {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+	}
+	return fn(s.data)
+}
+
+// writeData calls fn with data, locked for writing. fn must not change data, if it returns error.
+func (s *Storage) writeData(fn func(d *data) error) error {
+	if !s.inTx {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	return fn(s.data)
+}
+
+// read calls fn with state of tenant from ctx, locked for reading.
+func (s *Storage) read(ctx context.Context, fn func(st *state) error) error {
+	tenant := models.TenantFromContext(ctx)
+	return s.readData(func(d *data) error {
+		st, ok := d.tenants[tenant]
+		if !ok {
+			// Tenant without people is not stored till it changes something.
+			st = newState(tenant, d.outbox)
+		}
+		return fn(st)
+	})
+}
+
+// write calls fn with state of tenant from ctx, locked for writing. fn must not change state, if it returns error.
+func (s *Storage) write(ctx context.Context, fn func(st *state) error) error {
+	tenant := models.TenantFromContext(ctx)
+	return s.writeData(func(d *data) error {
+		st, ok := d.tenants[tenant]
+		if !ok {
+			st = newState(tenant, d.outbox)
+			d.tenants[tenant] = st
+		}
+		return fn(st)
+	})
+}
+
+// WithTx calls fn with storage, which operations all succeed or fail together.
+// Transaction is committed if fn returns nil, and rolled back otherwise.
+// Nested WithTx rolls back only operations made inside of it.
+// Storage is locked till fn returns, so fn must use only the given tx, and not concurrently.
+func (s *Storage) WithTx(ctx context.Context, fn func(tx enrichfio.Storage) error) error {
+	return s.writeData(func(d *data) error {
+		snapshot := d.clone()
+		err := fn(&Storage{
+			mu:     s.mu,
+			data:   d,
+			inTx:   true,
+			config: s.config,
+		})
+		if err != nil {
+			*d = *snapshot
+			return err
+		}
+		return nil
+	})
+}
+
+// MigrateUp does nothing, as memory has no schema.
+func (s *Storage) MigrateUp(ctx context.Context) error {
+	return nil
+}
+
+// Save saves given person in storage.
+func (s *Storage) Save(ctx context.Context, person models.Person) error {
+	return s.write(ctx, func(st *state) error {
+		if _, ok := st.people[person.ID]; ok {
+			return errors.Wrapf(models.ErrPersonExists, "%s", person.ID)
+		}
+		person.Version = 1
+		st.people[person.ID] = person
+		st.addedAt[person.ID] = time.Now()
+		st.record(ctx, models.OperationCreate, person.ID, nil, &person)
+		return nil
+	})
+}
+
+// SaveBatch saves all given people at once, recording them in history.
+// People, already stored, are overwritten. If the same ID is given several times, the last person wins.
+func (s *Storage) SaveBatch(ctx context.Context, people []models.Person) error {
+	last := make(map[uuid.UUID]int, len(people))
+	for i, person := range people {
+		last[person.ID] = i
+	}
+	return s.write(ctx, func(st *state) error {
+		for i, person := range people {
+			if last[person.ID] != i {
+				continue
+			}
+			old, ok := st.people[person.ID]
+			if !ok {
+				person.Version = 1
+				st.people[person.ID] = person
+				st.addedAt[person.ID] = time.Now()
+				st.record(ctx, models.OperationCreate, person.ID, nil, &person)
+				continue
+			}
+			person.Version = old.Version + 1
+			st.people[person.ID] = person
+			// Overwritten person is not anonymized anymore.
+			delete(st.anonymized, person.ID)
+			st.record(ctx, models.OperationUpdate, person.ID, &old, &person)
+		}
+		return nil
+	})
+}
+
+// GetByID returns one models.Person by given ID.
+// Returns models.ErrPersonNotFound if no such people found in the storage.
+func (s *Storage) GetByID(ctx context.Context, id uuid.UUID) (models.Person, error) {
+	var person models.Person
+	err := s.read(ctx, func(st *state) error {
+		var ok bool
+		person, ok = st.people[id]
+		if !ok {
+			return models.ErrPersonNotFound
+		}
+		return nil
+	})
+	return person, err
+}
+
+// DeleteByID deletes person from storage by given ID.
+// Returns models.ErrPersonNotFound if no such people found in the storage.
+func (s *Storage) DeleteByID(ctx context.Context, id uuid.UUID) error {
+	return s.write(ctx, func(st *state) error {
+		old, ok := st.people[id]
+		if !ok {
+			return models.ErrPersonNotFound
+		}
+		delete(st.people, id)
+		delete(st.anonymized, id)
+		delete(st.addedAt, id)
+		st.record(ctx, models.OperationDelete, id, &old, nil)
+		return nil
+	})
+}
+
+// ChangeByID applies given changes person from storage by given ID.
+// Returns models.ErrPersonNotFound if no such people found in the storage.
+// Returns models.ErrVersionConflict if person's version differs from changes.ExpectedVersion.
+func (s *Storage) ChangeByID(ctx context.Context, id uuid.UUID, change models.ChangeConfig) error {
+	err := change.Validate()
+	if err != nil {
+		return err
+	}
+	return s.write(ctx, func(st *state) error {
+		old, ok := st.people[id]
+		if !ok {
+			return models.ErrPersonNotFound
+		}
+		if change.ExpectedVersion != 0 && change.ExpectedVersion != old.Version {
+			return models.ErrVersionConflict
+		}
+		updated := change.Apply(old)
+		if updated.ID != id {
+			if _, ok := st.people[updated.ID]; ok {
+				return errors.Wrapf(models.ErrPersonExists, "%s", updated.ID)
+			}
+		}
+		updated.Version++
+
+		if updated.ID != id {
+			delete(st.people, id)
+			st.history[updated.ID] = st.history[id]
+			delete(st.history, id)
+			for i := range st.history[updated.ID] {
+				st.history[updated.ID][i].PersonID = updated.ID
+			}
+			if st.anonymized[id] {
+				delete(st.anonymized, id)
+				st.anonymized[updated.ID] = true
+			}
+			if at, ok := st.addedAt[id]; ok {
+				delete(st.addedAt, id)
+				st.addedAt[updated.ID] = at
+			}
+		}
+		st.people[updated.ID] = updated
+		st.record(ctx, models.OperationUpdate, updated.ID, &old, &updated)
+		return nil
+	})
+}
@@ -0,0 +1,16 @@
+package memory_test
+
+import (
+	"testing"
+
+	"enrich-fio/internal/config"
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/enrich-fio/storage/memory"
+	"enrich-fio/internal/enrich-fio/storage/storagetest"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) enrichfio.Storage {
+		return memory.New(&config.DBConfig{DefaultPageSize: 5, MaxPageSize: 100})
+	})
+}
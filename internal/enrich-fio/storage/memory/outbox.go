@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/models"
+)
+
+// outboxEvent is an event, kept in outbox.
+type outboxEvent struct {
+	id int64
+	// tenant is ID of tenant, the person belongs to.
+	tenant   string
+	revision models.Revision
+	// deliveredAt is zero till event is delivered.
+	deliveredAt time.Time
+}
+
+// add writes event about a change of person of given tenant, recorded as given revision, to outbox.
+func (o *outbox) add(tenant string, revision models.Revision) {
+	o.lastEventID++
+	o.events = append(o.events, outboxEvent{id: o.lastEventID, tenant: tenant, revision: revision})
+}
+
+// PendingEvents returns up to limit events, which are not delivered yet, in the order changes were made.
+func (s *Storage) PendingEvents(ctx context.Context, limit int) ([]models.Event, error) {
+	events := []models.Event{}
+	// Events of all tenants are relayed together.
+	err := s.readData(func(d *data) error {
+		for _, e := range d.outbox.events {
+			if len(events) == limit {
+				break
+			}
+			if e.deliveredAt.IsZero() {
+				events = append(events, models.NewEvent(e.id, e.tenant, e.revision))
+			}
+		}
+		return nil
+	})
+	return events, err
+}
+
+// MarkDelivered marks events with given IDs as delivered, so they are not pending anymore.
+func (s *Storage) MarkDelivered(ctx context.Context, ids []int64) error {
+	delivered := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		delivered[id] = true
+	}
+	now := time.Now()
+	return s.writeData(func(d *data) error {
+		for i, e := range d.outbox.events {
+			if delivered[e.id] && e.deliveredAt.IsZero() {
+				d.outbox.events[i].deliveredAt = now
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteDelivered deletes events, delivered before given moment, and returns how many were deleted.
+func (s *Storage) DeleteDelivered(ctx context.Context, before time.Time) (int64, error) {
+	var deleted int64
+	err := s.writeData(func(d *data) error {
+		kept := d.outbox.events[:0]
+		for _, e := range d.outbox.events {
+			if !e.deliveredAt.IsZero() && e.deliveredAt.Before(before) {
+				deleted++
+				continue
+			}
+			kept = append(kept, e)
+		}
+		d.outbox.events = kept
+		return nil
+	})
+	return deleted, err
+}
+
+// LockOutbox calls fn with storage itself, as storage belongs to a single process, which runs a single relay.
+func (s *Storage) LockOutbox(ctx context.Context, fn func(outbox enrichfio.Outbox) error) error {
+	return fn(s)
+}
@@ -0,0 +1,122 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"enrich-fio/internal/models"
+)
+
+// Anonymize replaces person with given anonymized one, and forgets its history and events, as they keep personal data.
+// Anonymized person is recorded in history and outbox as the only revision.
+// Returns models.ErrPersonNotFound if no such people found in the storage.
+func (s *Storage) Anonymize(ctx context.Context, anonymized models.Person) error {
+	return s.write(ctx, func(st *state) error {
+		old, ok := st.people[anonymized.ID]
+		if !ok {
+			return models.ErrPersonNotFound
+		}
+		anonymized.Version = old.Version + 1
+		st.people[anonymized.ID] = anonymized
+		st.anonymized[anonymized.ID] = true
+		st.forget(anonymized.ID)
+		st.record(ctx, models.OperationAnonymize, anonymized.ID, nil, &anonymized)
+		return nil
+	})
+}
+
+// Erase removes person with given ID with all its history and events, and leaves a tombstone.
+// Erasing already erased person returns its tombstone.
+// Returns models.ErrPersonNotFound if nothing is known about the person.
+func (s *Storage) Erase(ctx context.Context, id uuid.UUID) (models.Tombstone, error) {
+	var tombstone models.Tombstone
+	err := s.write(ctx, func(st *state) error {
+		_, stored := st.people[id]
+		if !stored && len(st.history[id]) == 0 {
+			var ok bool
+			tombstone, ok = st.tombstones[id]
+			if !ok {
+				return models.ErrPersonNotFound
+			}
+			return nil
+		}
+		delete(st.people, id)
+		delete(st.anonymized, id)
+		delete(st.addedAt, id)
+		st.forget(id)
+
+		audit := models.AuditFromContext(ctx)
+		tombstone = models.Tombstone{
+			PersonID: id,
+			ErasedAt: time.Now(),
+			Actor:    audit.Actor,
+			Source:   audit.Source,
+		}
+		st.tombstones[id] = tombstone
+		st.outbox.add(st.tenant, models.Revision{
+			PersonID:  id,
+			Operation: models.OperationErase,
+			Actor:     tombstone.Actor,
+			Source:    tombstone.Source,
+			ChangedAt: tombstone.ErasedAt,
+		})
+		return nil
+	})
+	return tombstone, err
+}
+
+// forget deletes history of person with given ID and all events about it, delivered or not,
+// and FIO of rows, the person is imported from.
+func (st *state) forget(id uuid.UUID) {
+	delete(st.history, id)
+	for _, job := range st.imports {
+		for i, row := range job.rows {
+			if row.PersonID == id {
+				job.rows[i].Name, job.rows[i].Surname, job.rows[i].Patronymic = "", "", ""
+			}
+		}
+	}
+	kept := make([]outboxEvent, 0, len(st.outbox.events))
+	for _, e := range st.outbox.events {
+		if e.tenant != st.tenant || e.revision.PersonID != id {
+			kept = append(kept, e)
+		}
+	}
+	st.outbox.events = kept
+}
+
+// ExpiredPeople returns up to query.Limit IDs of people, matching the query, in order of IDs.
+// Anonymized people are skipped by anonymize rules only.
+// Returns models.ErrInvalidFilter if query.Filter can't be applied.
+func (s *Storage) ExpiredPeople(ctx context.Context, query models.ExpiredQuery) ([]uuid.UUID, error) {
+	matches, err := filterPredicate(query.Filter)
+	if err != nil {
+		return nil, err
+	}
+	ids := []uuid.UUID{}
+	err = s.read(ctx, func(st *state) error {
+		for id, person := range st.people {
+			if st.anonymized[id] && query.Action != models.RetentionErase {
+				continue
+			}
+			if bytes.Compare(id[:], query.After[:]) <= 0 || !matches(person) {
+				continue
+			}
+			// People, added before history was kept, have no moment they were added at and are always old enough.
+			if at, ok := st.addedAt[id]; ok && !at.Before(query.AddedBefore) {
+				continue
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	sort.Slice(ids, func(i, j int) bool { return bytes.Compare(ids[i][:], ids[j][:]) < 0 })
+	if len(ids) > query.Limit {
+		ids = ids[:query.Limit]
+	}
+	return ids, err
+}
@@ -0,0 +1,26 @@
+package memory
+
+import (
+	"context"
+
+	"enrich-fio/internal/enrich-fio/storage/listing"
+	"enrich-fio/internal/enrich-fio/storage/textsearch"
+	"enrich-fio/internal/models"
+)
+
+// Search returns a page of people, whose FIO matches the given query, the best matches first.
+// Only people, matching the filter, are searched. opts.Cursor and opts.Sort are not supported.
+// Similarity is computed the way pg_trgm does.
+// Returns models.ErrInvalidSearchQuery if query is empty or malformed.
+func (s *Storage) Search(ctx context.Context, query models.SearchQuery, filter models.FilterConfig, opts models.ListOptions) (models.SearchPage, error) {
+	query, err := query.WithDefaults()
+	if err != nil {
+		return models.SearchPage{}, err
+	}
+	pageSize := listing.PageSize(opts.PageSize, s.config.DefaultPageSize, s.config.MaxPageSize)
+	matches, err := filterPredicate(filter)
+	if err != nil {
+		return models.SearchPage{}, err
+	}
+	return textsearch.Search(s.matching(ctx, matches), query, opts.Page, pageSize), nil
+}
@@ -0,0 +1,136 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"enrich-fio/internal/models"
+)
+
+// statsKey is a group of people in statistics. Characteristics, people aren't grouped by, and unknown values are empty.
+type statsKey struct {
+	gender      string
+	nationality string
+	ageKnown    bool
+	ageFrom     int
+}
+
+// statsGroup is an accumulated statistics over a group of people.
+type statsGroup struct {
+	count    int64
+	ageSum   int64
+	ageCount int64
+}
+
+// Stats returns statistics over people, matching the filter, grouped the way query asks. The largest groups go first.
+// Empty gender and nationality and zero age are treated as unknown.
+// Returns models.ErrInvalidStatsQuery if people can't be grouped the requested way.
+func (s *Storage) Stats(ctx context.Context, filter models.FilterConfig, query models.StatsQuery) (models.Stats, error) {
+	query, err := query.WithDefaults()
+	if err != nil {
+		return models.Stats{}, err
+	}
+	matches, err := filterPredicate(filter)
+	if err != nil {
+		return models.Stats{}, err
+	}
+
+	groups := map[statsKey]*statsGroup{}
+	if len(query.GroupBy) == 0 {
+		// Like SQL aggregate without grouping, the only group exists even if nobody matches.
+		groups[statsKey{}] = &statsGroup{}
+	}
+	for _, person := range s.matching(ctx, matches) {
+		key := statsKey{}
+		if query.Groups(models.StatsByGender) {
+			key.gender = string(person.Gender)
+		}
+		if query.Groups(models.StatsByNationality) {
+			key.nationality = person.Nationality
+		}
+		if query.Groups(models.StatsByAge) && person.Age != 0 {
+			key.ageKnown = true
+			key.ageFrom = person.Age / query.AgeBucketSize * query.AgeBucketSize
+		}
+		group, ok := groups[key]
+		if !ok {
+			group = &statsGroup{}
+			groups[key] = group
+		}
+		group.count++
+		if person.Age != 0 {
+			group.ageSum += int64(person.Age)
+			group.ageCount++
+		}
+	}
+
+	stats := models.Stats{
+		GroupBy: query.GroupBy,
+		Rows:    make([]models.StatsRow, 0, len(groups)),
+	}
+	if query.Groups(models.StatsByAge) {
+		stats.AgeBucketSize = query.AgeBucketSize
+	}
+	for key, group := range groups {
+		row := models.StatsRow{Count: group.count}
+		if key.gender != "" {
+			gender := models.Gender(key.gender)
+			row.Gender = &gender
+		}
+		if key.nationality != "" {
+			nationality := key.nationality
+			row.Nationality = &nationality
+		}
+		if key.ageKnown {
+			ageFrom, ageTo := key.ageFrom, key.ageFrom+query.AgeBucketSize-1
+			row.AgeFrom, row.AgeTo = &ageFrom, &ageTo
+		}
+		if group.ageCount != 0 {
+			average := float64(group.ageSum) / float64(group.ageCount)
+			row.AverageAge = &average
+		}
+		stats.Rows = append(stats.Rows, row)
+	}
+	sort.Slice(stats.Rows, func(i, j int) bool {
+		a, b := stats.Rows[i], stats.Rows[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if cmp := compareNullable(a.Gender, b.Gender); cmp != 0 {
+			return cmp < 0
+		}
+		if cmp := compareNullable(a.Nationality, b.Nationality); cmp != 0 {
+			return cmp < 0
+		}
+		return compareNullable(a.AgeFrom, b.AgeFrom) < 0
+	})
+	return stats, nil
+}
+
+// compareNullable compares values the way SQL orders them ascending: nil goes last.
+func compareNullable[T models.Gender | string | int](a *T, b *T) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	case *a < *b:
+		return -1
+	case *a > *b:
+		return 1
+	}
+	return 0
+}
+
+// CountPeople returns how many people tenant from ctx keeps.
+// WithTx holds the storage locked, so transactions count one after another.
+func (s *Storage) CountPeople(ctx context.Context) (int64, error) {
+	var count int64
+	err := s.read(ctx, func(st *state) error {
+		count = int64(len(st.people))
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"embed"
+	"fmt"
+
+	"github.com/golang-migrate/migrate/v4"
+	migratePgx "github.com/golang-migrate/migrate/v4/database/pgx"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/enrich-fio/storage/migration"
+)
+
+// _migrations are migrations of storage schema, embedded into binary.
+//
+//go:embed migrations/*.sql
+var _migrations embed.FS
+
+// Migrate returns migrate instance for storage schema, which must be closed after use.
+// Migrations are embedded into binary, unless config.MigrationURL overrides them.
+func (s *Storage) Migrate() (*migrate.Migrate, error) {
+	p := &migratePgx.Postgres{}
+	driver, err := p.Open(fmt.Sprintf("postgresql://%s:%s@%s/%s", s.config.User, s.config.Password, s.config.Host, s.config.DBName))
+	if err != nil {
+		return nil, errors.Wrap(err, "opening connection")
+	}
+	return migration.New(_migrations, s.config.MigrationURL, "pgx", driver)
+}
+
+// MigrateUp performs a database migration to the last available version.
+func (s *Storage) MigrateUp(ctx context.Context) error {
+	m, err := s.Migrate()
+	if err != nil {
+		return err
+	}
+	return migration.Up(m)
+}
@@ -0,0 +1,44 @@
+// Package migration manages schema of sql storages with golang-migrate.
+package migration
+
+import (
+	"io/fs"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// New returns migrate instance for database, opened with driver.
+// Migrations are read from url, or from embedded directory "migrations" if url is empty.
+func New(embedded fs.FS, url string, databaseName string, driver database.Driver) (*migrate.Migrate, error) {
+	if url != "" {
+		m, err := migrate.NewWithDatabaseInstance(url, databaseName, driver)
+		return m, errors.Wrap(err, "get migrate instance")
+	}
+	source, err := iofs.New(embedded, "migrations")
+	if err != nil {
+		return nil, errors.Wrap(err, "open embedded migrations")
+	}
+	m, err := migrate.NewWithInstance("iofs", source, databaseName, driver)
+	return m, errors.Wrap(err, "get migrate instance")
+}
+
+// Up migrates database to the last available version and closes m.
+func Up(m *migrate.Migrate) error {
+	logger := zap.L()
+	defer m.Close()
+	err := m.Up()
+	if err != nil {
+		if !errors.Is(err, migrate.ErrNoChange) {
+			return errors.Wrap(err, "migrate up")
+		}
+		logger.Info("no change during migration")
+		return nil
+	}
+	logger.Info("database migrated successfully")
+	return nil
+}
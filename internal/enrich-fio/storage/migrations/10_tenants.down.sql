@@ -0,0 +1,24 @@
+-- People of other tenants than the default one can't be kept without tenants.
+DELETE FROM person WHERE tenant_id <> 'default';
+DELETE FROM person_history WHERE tenant_id <> 'default';
+DELETE FROM person_tombstone WHERE tenant_id <> 'default';
+DELETE FROM outbox WHERE tenant_id <> 'default';
+
+DROP INDEX IF EXISTS person_tenant_id_name_id_idx;
+CREATE INDEX IF NOT EXISTS person_name_id_idx ON person (name, id);
+
+ALTER TABLE person_tombstone DROP CONSTRAINT IF EXISTS person_tombstone_pkey;
+ALTER TABLE person_tombstone ADD CONSTRAINT person_tombstone_pkey PRIMARY KEY (person_id);
+
+DROP INDEX IF EXISTS person_history_tenant_id_person_id_changed_at_idx;
+CREATE INDEX IF NOT EXISTS person_history_person_id_changed_at_idx ON person_history (person_id, changed_at);
+ALTER TABLE person_history DROP CONSTRAINT IF EXISTS person_history_tenant_id_person_id_revision_key;
+ALTER TABLE person_history ADD CONSTRAINT person_history_person_id_revision_key UNIQUE (person_id, revision);
+
+ALTER TABLE person DROP CONSTRAINT IF EXISTS person_pkey;
+ALTER TABLE person ADD CONSTRAINT person_pkey PRIMARY KEY (id);
+
+ALTER TABLE outbox DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE person_tombstone DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE person_history DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE person DROP COLUMN IF EXISTS tenant_id;
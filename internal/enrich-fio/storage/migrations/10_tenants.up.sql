@@ -0,0 +1,21 @@
+-- People belong to tenants. People, added before tenants existed, belong to the default one.
+ALTER TABLE person ADD COLUMN IF NOT EXISTS tenant_id varchar(100) NOT NULL DEFAULT 'default';
+ALTER TABLE person_history ADD COLUMN IF NOT EXISTS tenant_id varchar(100) NOT NULL DEFAULT 'default';
+ALTER TABLE person_tombstone ADD COLUMN IF NOT EXISTS tenant_id varchar(100) NOT NULL DEFAULT 'default';
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS tenant_id varchar(100) NOT NULL DEFAULT 'default';
+
+-- The same ID may be used by different tenants.
+ALTER TABLE person DROP CONSTRAINT IF EXISTS person_pkey;
+ALTER TABLE person ADD CONSTRAINT person_pkey PRIMARY KEY (tenant_id, id);
+
+ALTER TABLE person_history DROP CONSTRAINT IF EXISTS person_history_person_id_revision_key;
+ALTER TABLE person_history ADD CONSTRAINT person_history_tenant_id_person_id_revision_key UNIQUE (tenant_id, person_id, revision);
+DROP INDEX IF EXISTS person_history_person_id_changed_at_idx;
+CREATE INDEX IF NOT EXISTS person_history_tenant_id_person_id_changed_at_idx ON person_history (tenant_id, person_id, changed_at);
+
+ALTER TABLE person_tombstone DROP CONSTRAINT IF EXISTS person_tombstone_pkey;
+ALTER TABLE person_tombstone ADD CONSTRAINT person_tombstone_pkey PRIMARY KEY (tenant_id, person_id);
+
+-- Listing is ordered by name within a tenant.
+DROP INDEX IF EXISTS person_name_id_idx;
+CREATE INDEX IF NOT EXISTS person_tenant_id_name_id_idx ON person (tenant_id, name, id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS person_tags_idx;
+DROP INDEX IF EXISTS person_attributes_idx;
+
+ALTER TABLE person DROP COLUMN IF EXISTS tags;
+ALTER TABLE person DROP COLUMN IF EXISTS attributes;
@@ -0,0 +1,7 @@
+-- Custom attributes and tags of people, set by clients.
+ALTER TABLE person ADD COLUMN IF NOT EXISTS attributes jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE person ADD COLUMN IF NOT EXISTS tags text[] NOT NULL DEFAULT '{}';
+
+-- People are filtered by containment of attributes and tags.
+CREATE INDEX IF NOT EXISTS person_attributes_idx ON person USING gin (attributes jsonb_path_ops);
+CREATE INDEX IF NOT EXISTS person_tags_idx ON person USING gin (tags);
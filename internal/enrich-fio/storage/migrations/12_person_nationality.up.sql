@@ -0,0 +1,14 @@
+-- Probable nationalities of people, the most likely first. Nationality of person is the first of them.
+-- People, whose nationality was set without probabilities, have none.
+CREATE TABLE IF NOT EXISTS person_nationality (
+    tenant_id varchar(100) NOT NULL,
+    person_id uuid NOT NULL,
+    rank integer NOT NULL,
+    country varchar(10) NOT NULL,
+    probability double precision NOT NULL,
+    PRIMARY KEY (tenant_id, person_id, rank),
+    FOREIGN KEY (tenant_id, person_id) REFERENCES person (tenant_id, id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+-- People are filtered by any of their nationalities.
+CREATE INDEX IF NOT EXISTS person_nationality_tenant_id_country_idx ON person_nationality (tenant_id, country);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS import_row;
+DROP TABLE IF EXISTS import_job;
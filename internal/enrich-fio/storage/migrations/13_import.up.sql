@@ -0,0 +1,31 @@
+-- Import jobs keep rows of imported files, so jobs can be resumed, and results of rows can be reported.
+CREATE TABLE IF NOT EXISTS import_job (
+    tenant_id varchar(100) NOT NULL,
+    id uuid NOT NULL,
+    status varchar(10) NOT NULL,
+    options jsonb NOT NULL,
+    error text NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL,
+    PRIMARY KEY (tenant_id, id)
+);
+
+-- FIO of rows is encrypted the same way as FIO of people.
+CREATE TABLE IF NOT EXISTS import_row (
+    tenant_id varchar(100) NOT NULL,
+    job_id uuid NOT NULL,
+    number integer NOT NULL,
+    status varchar(10) NOT NULL,
+    person_id uuid NOT NULL,
+    name text NOT NULL,
+    surname text NOT NULL,
+    patronymic text NOT NULL,
+    error text NOT NULL DEFAULT '',
+    key_id varchar(100) NOT NULL DEFAULT '',
+    PRIMARY KEY (tenant_id, job_id, number),
+    FOREIGN KEY (tenant_id, job_id) REFERENCES import_job (tenant_id, id) ON DELETE CASCADE
+);
+
+-- FIO of rows is forgotten along with people, imported from them.
+CREATE INDEX IF NOT EXISTS import_row_tenant_id_person_id_idx ON import_row (tenant_id, person_id);
+CREATE INDEX IF NOT EXISTS import_row_key_id_idx ON import_row (key_id);
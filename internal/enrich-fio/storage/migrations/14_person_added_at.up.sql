@@ -0,0 +1,10 @@
+-- Moment person was added at, which retention rules count from. Anonymizing or erasing forgets history,
+-- so it can't be told from the oldest revision. NULL is person, added before history was kept.
+ALTER TABLE person ADD COLUMN IF NOT EXISTS added_at timestamptz;
+
+UPDATE person SET added_at = (
+    SELECT MIN(changed_at) FROM person_history h
+    WHERE h.tenant_id = person.tenant_id AND h.person_id = person.id
+);
+
+ALTER TABLE person ALTER COLUMN added_at SET DEFAULT now();
@@ -0,0 +1,4 @@
+-- Import job is claimed by a single run, so its rows aren't imported twice.
+-- Claim expires at lease_until unless the run renews it, so job of a crashed run can be resumed.
+ALTER TABLE import_job ADD COLUMN IF NOT EXISTS runner uuid;
+ALTER TABLE import_job ADD COLUMN IF NOT EXISTS lease_until timestamptz;
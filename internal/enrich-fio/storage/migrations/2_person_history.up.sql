@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS person_history (
+    id bigserial PRIMARY KEY,
+    person_id uuid NOT NULL,
+    revision integer NOT NULL,
+    operation varchar(10) NOT NULL,
+    old_value jsonb,
+    new_value jsonb,
+    actor varchar(100) NOT NULL,
+    source varchar(10) NOT NULL,
+    changed_at timestamptz NOT NULL DEFAULT now(),
+    UNIQUE (person_id, revision)
+);
+
+CREATE INDEX IF NOT EXISTS person_history_person_id_changed_at_idx ON person_history (person_id, changed_at);
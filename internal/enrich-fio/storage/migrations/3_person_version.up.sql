@@ -0,0 +1 @@
+ALTER TABLE person ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
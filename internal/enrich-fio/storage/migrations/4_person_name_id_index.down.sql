@@ -0,0 +1 @@
+DROP INDEX IF EXISTS person_name_id_idx;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS person_name_id_idx ON person (name, id);
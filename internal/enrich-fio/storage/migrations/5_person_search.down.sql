@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS person_patronymic_trgm_idx;
+DROP INDEX IF EXISTS person_surname_trgm_idx;
+DROP INDEX IF EXISTS person_name_trgm_idx;
+DROP FUNCTION IF EXISTS immutable_unaccent(text);
+DROP EXTENSION IF EXISTS unaccent;
+DROP EXTENSION IF EXISTS pg_trgm;
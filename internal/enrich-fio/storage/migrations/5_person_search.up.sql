@@ -0,0 +1,11 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+-- unaccent is only stable, so it can't be used in index expressions directly.
+CREATE OR REPLACE FUNCTION immutable_unaccent(text) RETURNS text
+    LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT
+    AS $$ SELECT public.unaccent('public.unaccent'::regdictionary, $1) $$;
+
+CREATE INDEX IF NOT EXISTS person_name_trgm_idx ON person USING gin (lower(immutable_unaccent(name)) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS person_surname_trgm_idx ON person USING gin (lower(immutable_unaccent(surname)) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS person_patronymic_trgm_idx ON person USING gin (lower(immutable_unaccent(patronymic)) gin_trgm_ops);
@@ -0,0 +1 @@
+ALTER TABLE person DROP CONSTRAINT IF EXISTS person_pkey;
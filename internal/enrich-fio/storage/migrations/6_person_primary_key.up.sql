@@ -0,0 +1,2 @@
+-- Upserts need a unique key to detect conflicts on.
+ALTER TABLE person ADD CONSTRAINT person_pkey PRIMARY KEY (id);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS outbox (
+    id bigserial PRIMARY KEY,
+    person_id uuid NOT NULL,
+    revision integer NOT NULL,
+    operation varchar(10) NOT NULL,
+    old_value jsonb,
+    new_value jsonb,
+    actor varchar(100) NOT NULL,
+    source varchar(10) NOT NULL,
+    changed_at timestamptz NOT NULL,
+    delivered_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (id) WHERE delivered_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_delivered_at_idx ON outbox (delivered_at) WHERE delivered_at IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS person_tombstone;
+
+ALTER TABLE person DROP COLUMN IF EXISTS anonymized;
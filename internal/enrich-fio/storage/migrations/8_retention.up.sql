@@ -0,0 +1,10 @@
+-- Anonymized people are kept for statistics, but retention rules skip them.
+ALTER TABLE person ADD COLUMN IF NOT EXISTS anonymized boolean NOT NULL DEFAULT false;
+
+-- Tombstones prove erasure of people without keeping any personal data.
+CREATE TABLE IF NOT EXISTS person_tombstone (
+    person_id uuid PRIMARY KEY,
+    erased_at timestamptz NOT NULL DEFAULT now(),
+    actor varchar(100) NOT NULL,
+    source varchar(10) NOT NULL
+);
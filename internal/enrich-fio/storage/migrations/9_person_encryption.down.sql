@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS person_key_id_idx;
+DROP INDEX IF EXISTS person_patronymic_bidx_idx;
+DROP INDEX IF EXISTS person_surname_bidx_idx;
+DROP INDEX IF EXISTS person_name_bidx_idx;
+
+ALTER TABLE person DROP COLUMN IF EXISTS key_id;
+ALTER TABLE person DROP COLUMN IF EXISTS patronymic_bidx;
+ALTER TABLE person DROP COLUMN IF EXISTS surname_bidx;
+ALTER TABLE person DROP COLUMN IF EXISTS name_bidx;
+
+-- Encrypted FIO doesn't fit into the old columns, so rolling back fails while there are encrypted people.
+ALTER TABLE person ALTER COLUMN patronymic TYPE varchar(50);
+ALTER TABLE person ALTER COLUMN surname TYPE varchar(50);
+ALTER TABLE person ALTER COLUMN name TYPE varchar(50);
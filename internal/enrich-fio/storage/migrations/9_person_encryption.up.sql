@@ -0,0 +1,16 @@
+-- Encrypted FIO is much longer than plaintext one.
+ALTER TABLE person ALTER COLUMN name TYPE text;
+ALTER TABLE person ALTER COLUMN surname TYPE text;
+ALTER TABLE person ALTER COLUMN patronymic TYPE text;
+
+-- Blind indexes of FIO for exact-match filtering, empty while FIO is kept in plaintext.
+ALTER TABLE person ADD COLUMN IF NOT EXISTS name_bidx varchar(32) NOT NULL DEFAULT '';
+ALTER TABLE person ADD COLUMN IF NOT EXISTS surname_bidx varchar(32) NOT NULL DEFAULT '';
+ALTER TABLE person ADD COLUMN IF NOT EXISTS patronymic_bidx varchar(32) NOT NULL DEFAULT '';
+-- key_id is ID of master key, FIO of the row is encrypted with, or empty for plaintext.
+ALTER TABLE person ADD COLUMN IF NOT EXISTS key_id varchar(100) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS person_name_bidx_idx ON person (name_bidx);
+CREATE INDEX IF NOT EXISTS person_surname_bidx_idx ON person (surname_bidx);
+CREATE INDEX IF NOT EXISTS person_patronymic_bidx_idx ON person (patronymic_bidx);
+CREATE INDEX IF NOT EXISTS person_key_id_idx ON person (key_id);
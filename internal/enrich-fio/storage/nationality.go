@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// _nationalityColumns are columns, nationalities are copied into person_nationality table with.
+var _nationalityColumns = []string{"tenant_id", "person_id", "rank", "country", "probability"}
+
+// nationalitiesColumn returns column of JSON array of nationalities of person, ordered by rank, taken from the given table.
+// It's selected along with person table, so nationalities, written by the same statement, are not seen.
+func nationalitiesColumn(table string) string {
+	return `(
+		SELECT COALESCE(jsonb_agg(jsonb_build_object('country', n.country, 'probability', n.probability) ORDER BY n.rank), '[]')
+		FROM ` + table + ` n
+		WHERE n.tenant_id = person.tenant_id AND n.person_id = person.id
+	) AS nationalities`
+}
+
+// saveNationalities replaces nationalities of person of tenant from ctx with given ones.
+func saveNationalities(ctx context.Context, tx pgx.Tx, id uuid.UUID, nationalities []models.Nationality) error {
+	tenant := models.TenantFromContext(ctx)
+	_, err := tx.Exec(ctx, `DELETE FROM person_nationality WHERE tenant_id = $1 AND person_id = $2`, tenant, id)
+	if err != nil {
+		return errors.Wrap(err, "delete nationalities")
+	}
+	return copyNationalities(ctx, tx, "person_nationality", tenant, []models.Person{{ID: id, Nationalities: nationalities}})
+}
+
+// copyNationalities copies nationalities of given people of given tenant into the given table.
+func copyNationalities(ctx context.Context, tx pgx.Tx, table, tenant string, people []models.Person) error {
+	_, err := tx.CopyFrom(ctx, pgx.Identifier{table}, _nationalityColumns, nationalitiesSource(tenant, people))
+	if err != nil {
+		return errors.Wrap(err, "copy nationalities")
+	}
+	return nil
+}
+
+// nationalitiesSource returns CopyFrom source of nationalities of given people of given tenant,
+// with values in _nationalityColumns order.
+func nationalitiesSource(tenant string, people []models.Person) pgx.CopyFromSource {
+	var rows [][]any
+	for _, person := range people {
+		for i, n := range person.Nationalities {
+			rows = append(rows, []any{tenant, person.ID, i + 1, n.Country, n.Probability})
+		}
+	}
+	return pgx.CopyFromRows(rows)
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"enrich-fio/internal/models"
+)
+
+const (
+	// _changesChannel is a channel, where changed people are notified about as "<tenant>:<id>".
+	_changesChannel = "person_changed"
+	// _listenRetryMin is the pause before the first attempt to listen again, after listening connection dropped.
+	_listenRetryMin = time.Second
+	// _listenRetryMax is the longest pause between attempts to listen again.
+	_listenRetryMax = 30 * time.Second
+)
+
+// notifyChanged notifies listeners of _changesChannel, that people of tenant from ctx with given IDs are changed.
+// Notifications are sent when transaction commits, and aren't sent if it rolls back.
+func notifyChanged(ctx context.Context, tx pgx.Tx, ids ...uuid.UUID) error {
+	_, err := tx.Exec(ctx, `SELECT pg_notify($1, $2 || ':' || id::text) FROM unnest($3::uuid[]) AS id`,
+		_changesChannel, models.TenantFromContext(ctx), ids)
+	if err != nil {
+		return errors.Wrap(err, "exec notify query")
+	}
+	return nil
+}
+
+// ListenChanges calls onChange with tenant and ID of every person, changed by any instance of the service, until ctx is done.
+// Listening connection is opened again if it drops. Changes, made meanwhile, are missed, so onReconnect is called then.
+func (s *Storage) ListenChanges(ctx context.Context, onChange func(tenant string, id uuid.UUID), onReconnect func()) error {
+	logger := zap.L()
+	retry := _listenRetryMin
+	connected := false
+	for {
+		err := s.listen(ctx, onChange, func() {
+			if connected {
+				onReconnect()
+			}
+			connected = true
+			retry = _listenRetryMin
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		logger.Warn(fmt.Sprintf("listening to changes of people failed, retrying in %s. Err: %v", retry, err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retry):
+		}
+		retry = min(retry*2, _listenRetryMax)
+	}
+}
+
+// listen listens to _changesChannel on a dedicated connection, until it fails. onListen is called once listening starts.
+func (s *Storage) listen(ctx context.Context, onChange func(tenant string, id uuid.UUID), onListen func()) error {
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return errors.Wrap(err, "acquire connection")
+	}
+	// Listening connection is taken from pool for good, so no other query gets it.
+	listener := conn.Hijack()
+	defer listener.Close(context.Background())
+
+	_, err = listener.Exec(ctx, "LISTEN "+_changesChannel)
+	if err != nil {
+		return errors.Wrap(err, "listen")
+	}
+	onListen()
+	for {
+		notification, err := listener.WaitForNotification(ctx)
+		if err != nil {
+			return errors.Wrap(err, "wait for notification")
+		}
+		tenant, id, err := models.ParsePersonKey(notification.Payload)
+		if err != nil {
+			zap.L().Warn(fmt.Sprintf("unexpected payload %q of change notification", notification.Payload))
+			continue
+		}
+		onChange(tenant, id)
+	}
+}
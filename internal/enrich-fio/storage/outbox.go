@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/models"
+)
+
+// _outboxLockClass is the first key of advisory lock, taken by LockOutbox. See _quotaLockClass.
+const _outboxLockClass = 2
+
+// _insertEvents writes events about revisions, returned by revisions CTE along with their tenants, to outbox.
+const _insertEvents = `
+	INSERT INTO outbox (tenant_id, ` + _revisionColumns + `)
+	SELECT tenant_id, ` + _revisionColumns + `
+	FROM revisions
+	`
+
+// PendingEvents returns up to limit events, which are not delivered yet, in the order changes were made.
+func (s *Storage) PendingEvents(ctx context.Context, limit int) ([]models.Event, error) {
+	query := `
+	SELECT id, tenant_id, ` + _revisionColumns + `
+	FROM outbox
+	WHERE delivered_at IS NULL
+	ORDER BY id
+	LIMIT $1
+	`
+	rows, err := s.db.Query(ctx, query, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "query pending events")
+	}
+	events := []models.Event{}
+	var id int64
+	var tenant string
+	var r models.Revision
+	_, err = pgx.ForEachRow(rows, []any{&id, &tenant, &r.PersonID, &r.Revision, &r.Operation, &r.OldValue, &r.NewValue,
+		&r.Actor, &r.Source, &r.ChangedAt}, func() error {
+		// Events carry plaintext FIO, and changed fields are told by comparing it.
+		decrypted, err := s.keyring.DecryptRevision(r)
+		if err != nil {
+			return errors.Wrapf(err, "decrypt event %d", id)
+		}
+		events = append(events, models.NewEvent(id, tenant, decrypted))
+		// Values are scanned into pointers, so the next row must not overwrite this one's.
+		r = models.Revision{}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "scan events")
+	}
+	return events, nil
+}
+
+// MarkDelivered marks events with given IDs as delivered, so they are not pending anymore.
+func (s *Storage) MarkDelivered(ctx context.Context, ids []int64) error {
+	_, err := s.db.Exec(ctx, `UPDATE outbox SET delivered_at = now() WHERE id = ANY($1) AND delivered_at IS NULL`, ids)
+	if err != nil {
+		return errors.Wrap(err, "exec update query")
+	}
+	return nil
+}
+
+// DeleteDelivered deletes events, delivered before given moment, and returns how many were deleted.
+func (s *Storage) DeleteDelivered(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.db.Exec(ctx, `DELETE FROM outbox WHERE delivered_at < $1`, before)
+	if err != nil {
+		return 0, errors.Wrap(err, "exec delete query")
+	}
+	return tag.RowsAffected(), nil
+}
+
+// LockOutbox calls fn with outbox inside of a transaction, holding advisory lock of the outbox, so replicas relay
+// one at a time. Replicas could claim distinct rows instead, but then events about the same person could be
+// published by two of them at once, and get out of order. Lock is released once transaction ends.
+// Events, marked delivered by fn, stay pending, if fn returns error.
+// Returns models.ErrOutboxLocked without calling fn, if another relay holds the outbox.
+func (s *Storage) LockOutbox(ctx context.Context, fn func(outbox enrichfio.Outbox) error) error {
+	return pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		var locked bool
+		err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1, 0)`, _outboxLockClass).Scan(&locked)
+		if err != nil {
+			return errors.Wrap(err, "lock outbox")
+		}
+		if !locked {
+			return models.ErrOutboxLocked
+		}
+		return fn(&Storage{
+			pool:    s.pool,
+			db:      tx,
+			config:  s.config,
+			keyring: s.keyring,
+		})
+	})
+}
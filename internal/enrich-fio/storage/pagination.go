@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"enrich-fio/internal/enrich-fio/storage/listing"
+)
+
+// _sortExpressions are SQL expressions for person fields, people can be ordered by, see listing.SortableFields.
+// Nullable columns are coalesced, so keyset comparisons never meet NULL.
+var _sortExpressions = map[string]string{
+	"name":        "name",
+	"surname":     "surname",
+	"patronymic":  "COALESCE(patronymic, '')",
+	"age":         "COALESCE(age, 0)",
+	"gender":      "COALESCE(gender, '')",
+	"nationality": "COALESCE(nationality, '')",
+	"version":     "version",
+}
+
+// keysetCondition returns SQL condition, matching rows after (or before) cursor's boundary row.
+// Cursor values are added to args.
+func keysetCondition(order []listing.Column, c listing.Cursor, args pgx.NamedArgs) string {
+	alternatives := make([]string, 0, len(order)+1)
+	equal := make([]string, 0, len(order))
+	for i, column := range order {
+		arg := fmt.Sprintf("cursor%d", i)
+		args[arg] = c.Values[i]
+		operator := ">"
+		if column.Desc != c.Backward {
+			operator = "<"
+		}
+		expr := _sortExpressions[column.Key]
+		condition := fmt.Sprintf("%s %s @%s", expr, operator, arg)
+		alternatives = append(alternatives, strings.Join(append(equal, condition), " AND "))
+		equal = append(equal, fmt.Sprintf("%s = @%s", expr, arg))
+	}
+	args["cursorID"] = c.ID
+	operator := ">"
+	if c.Backward {
+		operator = "<"
+	}
+	alternatives = append(alternatives, strings.Join(append(equal, "id "+operator+" @cursorID"), " AND "))
+	return "((" + strings.Join(alternatives, ") OR (") + "))"
+}
+
+// orderByClause returns SQL ORDER BY expressions for given order, reversed if backward.
+func orderByClause(order []listing.Column, backward bool) string {
+	expressions := make([]string, 0, len(order)+1)
+	for _, column := range order {
+		expressions = append(expressions, _sortExpressions[column.Key]+" "+direction(column.Desc != backward))
+	}
+	expressions = append(expressions, "id "+direction(backward))
+	return strings.Join(expressions, ", ")
+}
+
+func direction(desc bool) string {
+	if desc {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// pageSize returns page size to use, when client asked for the given one.
+func (s *Storage) pageSize(requested int) int {
+	return listing.PageSize(requested, s.config.DefaultPageSize, s.config.MaxPageSize)
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// _quotaLockClass is the first key of advisory locks, taken by CountPeople, and the second one is hash of tenant.
+const _quotaLockClass = 1
+
+// CountPeople returns how many people tenant from ctx keeps.
+// Inside of WithTx transactions of the same tenant count one after another, and each sees people, saved by the ones,
+// which counted before it, so checks of quota can't all pass together. Lock is held till the transaction ends.
+func (s *Storage) CountPeople(ctx context.Context) (int64, error) {
+	tenant := models.TenantFromContext(ctx)
+	// Count is taken by a separate statement, so under read committed its snapshot is taken after the lock is.
+	_, err := s.db.Exec(ctx, `SELECT pg_advisory_xact_lock($1, hashtext($2))`, _quotaLockClass, tenant)
+	if err != nil {
+		return 0, errors.Wrap(err, "lock tenant quota")
+	}
+	var count int64
+	err = s.db.QueryRow(ctx, `SELECT count(*) FROM person WHERE tenant_id = $1`, tenant).Scan(&count)
+	if err != nil {
+		return 0, errors.Wrap(err, "count people")
+	}
+	return count, nil
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// Anonymize replaces person with given anonymized one, and forgets its history and events, as they keep personal data.
+// Anonymized person is recorded in history and outbox as the only revision.
+// Returns models.ErrPersonNotFound if no such people found in the storage.
+func (s *Storage) Anonymize(ctx context.Context, anonymized models.Person) error {
+	encrypted, err := s.encrypt(anonymized)
+	if err != nil {
+		return err
+	}
+	query := `
+	UPDATE person
+	SET ` + _encryptedSet + `, age = @age, gender = @gender,
+		nationality = @nationality, version = version + 1, anonymized = true
+	WHERE tenant_id = @tenant AND id = @id
+	RETURNING ` + _personColumns
+	args := encryptedArgs(encrypted, pgx.NamedArgs{
+		"tenant":      models.TenantFromContext(ctx),
+		"id":          anonymized.ID,
+		"age":         anonymized.Age,
+		"gender":      anonymized.Gender,
+		"nationality": anonymized.Nationality,
+	})
+	return pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, query, args)
+		if err != nil {
+			return errors.Wrap(err, "query update")
+		}
+		updated, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.Person])
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return models.ErrPersonNotFound
+			}
+			return errors.Wrap(err, "collect updated row")
+		}
+		_, err = forget(ctx, tx, anonymized.ID)
+		if err != nil {
+			return err
+		}
+		err = insertRevision(ctx, tx, models.OperationAnonymize, anonymized.ID, nil, &updated)
+		if err != nil {
+			return errors.Wrap(err, "insert revision")
+		}
+		return notifyChanged(ctx, tx, anonymized.ID)
+	})
+}
+
+// Erase removes person with given ID with all its history and events, and leaves a tombstone.
+// Erasing already erased person returns its tombstone.
+// Returns models.ErrPersonNotFound if nothing is known about the person.
+func (s *Storage) Erase(ctx context.Context, id uuid.UUID) (models.Tombstone, error) {
+	var tombstone models.Tombstone
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		tenant := models.TenantFromContext(ctx)
+		deleted, err := tx.Exec(ctx, `DELETE FROM person WHERE tenant_id = $1 AND id = $2`, tenant, id)
+		if err != nil {
+			return errors.Wrap(err, "exec delete query")
+		}
+		forgotten, err := forget(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if deleted.RowsAffected() == 0 && forgotten == 0 {
+			err = tx.QueryRow(ctx, `SELECT `+_tombstoneColumns+` FROM person_tombstone WHERE tenant_id = $1 AND person_id = $2`, tenant, id).
+				Scan(&tombstone.PersonID, &tombstone.ErasedAt, &tombstone.Actor, &tombstone.Source)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return models.ErrPersonNotFound
+			}
+			return errors.Wrap(err, "query tombstone")
+		}
+
+		audit := models.AuditFromContext(ctx)
+		query := `
+		WITH tombstones AS (
+			INSERT INTO person_tombstone (tenant_id, person_id, actor, source)
+			VALUES (@tenant, @id, @actor, @source)
+			ON CONFLICT (tenant_id, person_id) DO UPDATE SET
+				erased_at = EXCLUDED.erased_at,
+				actor = EXCLUDED.actor,
+				source = EXCLUDED.source
+			RETURNING tenant_id, ` + _tombstoneColumns + `
+		), events AS (
+			INSERT INTO outbox (tenant_id, ` + _revisionColumns + `)
+			SELECT tenant_id, person_id, 0, @operation::varchar, NULL::jsonb, NULL::jsonb, actor, source, erased_at
+			FROM tombstones
+		)
+		SELECT ` + _tombstoneColumns + ` FROM tombstones
+		`
+		args := pgx.NamedArgs{
+			"tenant":    tenant,
+			"id":        id,
+			"actor":     audit.Actor,
+			"source":    audit.Source,
+			"operation": models.OperationErase,
+		}
+		err = tx.QueryRow(ctx, query, args).Scan(&tombstone.PersonID, &tombstone.ErasedAt, &tombstone.Actor, &tombstone.Source)
+		if err != nil {
+			return errors.Wrap(err, "query insert tombstone")
+		}
+		return notifyChanged(ctx, tx, id)
+	})
+	return tombstone, err
+}
+
+// _tombstoneColumns are columns of person_tombstone table, in the order of models.Tombstone fields.
+const _tombstoneColumns = "person_id, erased_at, actor, source"
+
+// forget deletes history of person of tenant from ctx with given ID and all events about it, delivered or not,
+// and FIO of rows, the person is imported from. Returns how many revisions were deleted.
+func forget(ctx context.Context, tx pgx.Tx, id uuid.UUID) (int64, error) {
+	tenant := models.TenantFromContext(ctx)
+	deleted, err := tx.Exec(ctx, `DELETE FROM person_history WHERE tenant_id = $1 AND person_id = $2`, tenant, id)
+	if err != nil {
+		return 0, errors.Wrap(err, "exec delete history query")
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM outbox WHERE tenant_id = $1 AND person_id = $2`, tenant, id)
+	if err != nil {
+		return 0, errors.Wrap(err, "exec delete events query")
+	}
+	_, err = tx.Exec(ctx, `
+	UPDATE import_row SET name = '', surname = '', patronymic = '', key_id = ''
+	WHERE tenant_id = $1 AND person_id = $2
+	`, tenant, id)
+	if err != nil {
+		return 0, errors.Wrap(err, "exec update import rows query")
+	}
+	return deleted.RowsAffected(), nil
+}
+
+// ExpiredPeople returns up to query.Limit IDs of people, matching the query, in order of IDs.
+// Anonymized people are skipped by anonymize rules only.
+// Returns models.ErrInvalidFilter if query.Filter can't be applied.
+func (s *Storage) ExpiredPeople(ctx context.Context, query models.ExpiredQuery) ([]uuid.UUID, error) {
+	filters, args, err := s.filterConditions(ctx, query.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if query.Action != models.RetentionErase {
+		filters = append(filters, "NOT anonymized")
+	}
+	// People, added before history was kept, have no added_at and are always old enough.
+	filters = append(filters, "id > @after", "COALESCE(added_at, '-infinity') < @addedBefore")
+	args["after"] = query.After
+	args["addedBefore"] = query.AddedBefore
+	args["limit"] = query.Limit
+
+	selectQuery := `
+	SELECT id
+	FROM person
+	WHERE ` + strings.Join(filters, ` AND `) + `
+	ORDER BY id
+	LIMIT @limit
+	`
+	rows, err := s.db.Query(ctx, selectQuery, args)
+	if err != nil {
+		return nil, errors.Wrap(err, "query expired people")
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, errors.Wrap(err, "collect rows")
+	}
+	return ids, nil
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// scoredPerson is a person row along with its search score.
+type scoredPerson struct {
+	models.Person
+	Score float64
+}
+
+// Search returns a page of people, whose FIO matches the given query, the best matches first.
+// Only people, matching the filter, are searched. opts.Cursor and opts.Sort are not supported.
+// Returns models.ErrInvalidSearchQuery if query is empty or malformed, or if FIO is encrypted.
+func (s *Storage) Search(ctx context.Context, query models.SearchQuery, filter models.FilterConfig, opts models.ListOptions) (models.SearchPage, error) {
+	query, err := query.WithDefaults()
+	if err != nil {
+		return models.SearchPage{}, err
+	}
+	if s.keyring != nil {
+		// Encrypted FIO can only be matched exactly, by blind indexes.
+		return models.SearchPage{}, errors.Wrap(models.ErrInvalidSearchQuery, "FIO is encrypted, search is unavailable")
+	}
+	pageSize := s.pageSize(opts.PageSize)
+	filters, args, err := s.filterConditions(ctx, filter)
+	if err != nil {
+		return models.SearchPage{}, err
+	}
+	args["text"] = query.Text
+	args["pattern"] = escapeLike(query.Text) + "%"
+
+	text := normalized("@text")
+	pattern := normalized("@pattern")
+	scores := make([]string, 0, len(query.Fields))
+	matches := make([]string, 0, len(query.Fields))
+	for _, field := range query.Fields {
+		column := normalized(field)
+		scores = append(scores, fmt.Sprintf("similarity(%s, %s)", column, text))
+		match := fmt.Sprintf("%s LIKE %s", column, pattern)
+		if query.Mode == models.SearchSimilar {
+			match = fmt.Sprintf("%s %% %s OR %s", column, text, match)
+		}
+		matches = append(matches, match)
+	}
+	filters = append(filters, "("+strings.Join(matches, " OR ")+")")
+
+	sql := `
+	SELECT ` + _personColumns + `, GREATEST(` + strings.Join(scores, ", ") + `) AS score
+	FROM person
+	WHERE ` + strings.Join(filters, ` AND `) + `
+	ORDER BY score DESC, id
+	LIMIT @limit
+	OFFSET @offset
+	`
+	// One extra row tells whether there is a next page.
+	args["limit"] = pageSize + 1
+	args["offset"] = opts.Page * pageSize
+
+	var found []scoredPerson
+	err = pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		// Similarity operator uses trigram indexes, but takes the threshold from settings only.
+		threshold := strconv.FormatFloat(query.MinSimilarity, 'f', -1, 64)
+		_, err := tx.Exec(ctx, `SELECT set_config('pg_trgm.similarity_threshold', $1, true)`, threshold)
+		if err != nil {
+			return errors.Wrap(err, "set similarity threshold")
+		}
+		rows, err := tx.Query(ctx, sql, args)
+		if err != nil {
+			return errors.Wrap(err, "query people")
+		}
+		found, err = pgx.CollectRows(rows, pgx.RowToStructByName[scoredPerson])
+		if err != nil {
+			return errors.Wrap(err, "collect rows")
+		}
+		return nil
+	})
+	if err != nil {
+		return models.SearchPage{}, err
+	}
+
+	page := models.SearchPage{
+		Results:  make([]models.SearchResult, 0, len(found)),
+		Page:     opts.Page,
+		PageSize: pageSize,
+		HasMore:  len(found) > pageSize,
+	}
+	if page.HasMore {
+		found = found[:pageSize]
+	}
+	for _, person := range found {
+		page.Results = append(page.Results, models.SearchResult{Person: person.Person, Score: person.Score})
+	}
+	return page, nil
+}
+
+// normalized returns SQL expression, that lowercases and unaccents given one, the way search indexes do.
+func normalized(expr string) string {
+	return "lower(immutable_unaccent(" + expr + "))"
+}
+
+// escapeLike escapes LIKE wildcards in given text.
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+}
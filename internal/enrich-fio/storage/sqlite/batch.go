@@ -0,0 +1,83 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// SaveBatch saves all given people at once, recording them in history.
+// People, already stored, are overwritten. If the same ID is given several times, the last person wins.
+func (s *Storage) SaveBatch(ctx context.Context, people []models.Person) error {
+	people = uniquePeople(people)
+	if len(people) == 0 {
+		return nil
+	}
+	query := `
+	INSERT INTO person (tenant_id, id, name, surname, patronymic, gender, nationality, age, attributes, tags, added_at)
+	VALUES (@tenant, @id, @name, @surname, @patronymic, @gender, @nationality, @age, @attributes, @tags, @addedAt)
+	ON CONFLICT (tenant_id, id) DO UPDATE SET
+		name = excluded.name,
+		surname = excluded.surname,
+		patronymic = excluded.patronymic,
+		gender = excluded.gender,
+		nationality = excluded.nationality,
+		age = excluded.age,
+		attributes = excluded.attributes,
+		tags = excluded.tags,
+		version = person.version + 1,
+		-- Overwritten person is not anonymized anymore.
+		anonymized = 0
+	RETURNING ` + _personColumns
+	// Overwritten people keep the moment they were added at.
+	addedAt := time.Now().UnixNano()
+	// Inside of a single transaction row by row upserts are fast enough for sqlite.
+	return s.transaction(ctx, func(tx *Storage) error {
+		for _, person := range people {
+			old, err := tx.GetByID(ctx, person.ID)
+			stored := err == nil
+			if err != nil && !errors.Is(err, models.ErrPersonNotFound) {
+				return errors.Wrap(err, "get stored person")
+			}
+			args := personArgs(ctx, person)
+			args["addedAt"] = addedAt
+			saved, err := tx.queryPerson(ctx, query, args)
+			if err != nil {
+				return errors.Wrap(err, "upsert person")
+			}
+			err = tx.saveNationalities(ctx, person.ID, person.Nationalities)
+			if err != nil {
+				return err
+			}
+			saved.Nationalities = person.Nationalities
+			if stored {
+				err = tx.insertRevision(ctx, models.OperationUpdate, person.ID, &old, &saved)
+			} else {
+				err = tx.insertRevision(ctx, models.OperationCreate, person.ID, nil, &saved)
+			}
+			if err != nil {
+				return errors.Wrap(err, "insert revision")
+			}
+		}
+		return nil
+	})
+}
+
+// uniquePeople returns given people without repeated IDs, keeping the last person with each ID.
+func uniquePeople(people []models.Person) []models.Person {
+	last := make(map[uuid.UUID]int, len(people))
+	for i, person := range people {
+		last[person.ID] = i
+	}
+	unique := make([]models.Person, 0, len(last))
+	for i, person := range people {
+		if last[person.ID] == i {
+			unique = append(unique, person)
+		}
+	}
+	return unique
+}
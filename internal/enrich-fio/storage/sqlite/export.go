@@ -0,0 +1,48 @@
+package sqlite
+
+import (
+	"context"
+
+	"enrich-fio/internal/models"
+)
+
+// _exportBatchSize is a number of people, read at once by export.
+const _exportBatchSize = 1000
+
+// Export calls fn with every person, matching the filter, in order of IDs, and stops at the first error fn returns.
+// Sqlite has a single connection, so people are read in batches after the last read ID rather than with a cursor,
+// which would keep the connection busy while fn is called.
+// Returns models.ErrInvalidFilter if filter can't be applied.
+func (s *Storage) Export(ctx context.Context, filter models.FilterConfig, fn func(person models.Person) error) error {
+	filters, args, err := filterConditions(ctx, filter)
+	if err != nil {
+		return err
+	}
+	query := `
+	SELECT ` + _personColumns + `
+	FROM person
+	` + whereClause(append(filters, "id > @after")) + `
+	ORDER BY id
+	LIMIT @limit
+	`
+	args["limit"] = _exportBatchSize
+	// IDs are stored as text, which is greater than empty one.
+	after := ""
+	for {
+		args["after"] = after
+		people, err := s.queryPeople(ctx, query, args)
+		if err != nil {
+			return err
+		}
+		for _, person := range people {
+			err = fn(person)
+			if err != nil {
+				return err
+			}
+		}
+		if len(people) < _exportBatchSize {
+			return nil
+		}
+		after = people[len(people)-1].ID.String()
+	}
+}
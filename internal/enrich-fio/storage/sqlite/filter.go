@@ -0,0 +1,231 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// _filterColumns are SQL expressions for person fields, people can be filtered by.
+var _filterColumns = map[string]string{
+	"id":          "id",
+	"name":        "name",
+	"surname":     "surname",
+	"patronymic":  "patronymic",
+	"age":         "age",
+	"gender":      "gender",
+	"nationality": "nationality",
+	"version":     "version",
+}
+
+// filterConditions returns SQL conditions, matching the given filter and people of tenant from ctx, and their arguments.
+// Returns models.ErrInvalidFilter if filter can't be applied.
+func filterConditions(ctx context.Context, filter models.FilterConfig) ([]string, namedArgs, error) {
+	filters := []string{"tenant_id = @tenant"}
+	if filter.ID != uuid.Nil {
+		filters = append(filters, "id = @id")
+	}
+	if filter.Name != "" {
+		filters = append(filters, "name = @name")
+	}
+	if filter.Surname != "" {
+		filters = append(filters, "surname = @surname")
+	}
+	if filter.Patronymic != "" {
+		filters = append(filters, "patronymic = @patronymic")
+	}
+	if filter.Age.Min != nil {
+		filters = append(filters, "age >= @ageMin")
+	}
+	if filter.Age.Max != nil {
+		filters = append(filters, "age <= @ageMax")
+	}
+	if filter.Gender != "" {
+		filters = append(filters, "gender = @gender")
+	}
+	err := filter.NationalityMatch.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+	if filter.Nationality != "" && filter.NationalityMatch == models.NationalityAny {
+		// Nationality, set without probabilities, is not among nationalities.
+		filters = append(filters, `(nationality = @nationality OR EXISTS (
+			SELECT 1 FROM person_nationality n
+			WHERE n.tenant_id = person.tenant_id AND n.person_id = person.id AND n.country = @nationality
+		))`)
+	} else if filter.Nationality != "" {
+		filters = append(filters, "nationality = @nationality")
+	}
+	for i := range filter.Tags {
+		filters = append(filters, fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(tags) WHERE value = @tag%d)", i))
+	}
+	attributeKeys := make([]string, 0, len(filter.Attributes))
+	for key := range filter.Attributes {
+		attributeKeys = append(attributeKeys, key)
+	}
+	// Stable order keeps generated SQL the same for the same filter.
+	sort.Strings(attributeKeys)
+	for i := range attributeKeys {
+		filters = append(filters, fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM json_each(attributes) WHERE key = @attributeKey%d AND value = @attributeValue%d)", i, i))
+	}
+
+	args := namedArgs{
+		"tenant":      models.TenantFromContext(ctx),
+		"id":          filter.ID,
+		"name":        filter.Name,
+		"surname":     filter.Surname,
+		"patronymic":  filter.Patronymic,
+		"ageMin":      filter.Age.Min,
+		"ageMax":      filter.Age.Max,
+		"gender":      string(filter.Gender),
+		"nationality": filter.Nationality,
+	}
+	for i, tag := range filter.Tags {
+		args[fmt.Sprintf("tag%d", i)] = tag
+	}
+	for i, key := range attributeKeys {
+		args[fmt.Sprintf("attributeKey%d", i)] = key
+		args[fmt.Sprintf("attributeValue%d", i)] = filter.Attributes[key]
+	}
+
+	for _, c := range filter.Conditions {
+		condition, err := conditionSQL(c, args)
+		if err != nil {
+			return nil, nil, err
+		}
+		filters = append(filters, condition)
+	}
+	for _, group := range filter.AnyOf {
+		if len(group) == 0 {
+			continue
+		}
+		alternatives := make([]string, 0, len(group))
+		for _, c := range group {
+			condition, err := conditionSQL(c, args)
+			if err != nil {
+				return nil, nil, err
+			}
+			alternatives = append(alternatives, condition)
+		}
+		filters = append(filters, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	if filter.Expr != nil {
+		condition, err := exprSQL(filter.Expr, args)
+		if err != nil {
+			return nil, nil, err
+		}
+		filters = append(filters, condition)
+	}
+	return filters, args, nil
+}
+
+// exprSQL returns SQL condition, matching the given filter expression. Its values are added to args.
+// Returns models.ErrInvalidFilter if expression can't be applied.
+func exprSQL(expr models.Expr, args namedArgs) (string, error) {
+	switch expr := expr.(type) {
+	case models.Condition:
+		return conditionSQL(expr, args)
+	case models.AndExpr:
+		return binaryExprSQL(expr.Left, "AND", expr.Right, args)
+	case models.OrExpr:
+		return binaryExprSQL(expr.Left, "OR", expr.Right, args)
+	case models.NotExpr:
+		operand, err := exprSQL(expr.Operand, args)
+		if err != nil {
+			return "", err
+		}
+		// Same as negated conditions, negated expressions match unknown values.
+		return "(" + operand + ") IS NOT TRUE", nil
+	}
+	return "", errors.Wrapf(models.ErrInvalidFilter, "unsupported expression %T", expr)
+}
+
+// binaryExprSQL returns SQL condition, joining both operands with the given SQL operator.
+func binaryExprSQL(left models.Expr, operator string, right models.Expr, args namedArgs) (string, error) {
+	leftSQL, err := exprSQL(left, args)
+	if err != nil {
+		return "", err
+	}
+	rightSQL, err := exprSQL(right, args)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("(%s %s %s)", leftSQL, operator, rightSQL), nil
+}
+
+// _comparisonOperators are SQL operators for single value conditions.
+var _comparisonOperators = map[models.Operator]string{
+	models.OperatorEq:  "=",
+	models.OperatorGt:  ">",
+	models.OperatorGte: ">=",
+	models.OperatorLt:  "<",
+	models.OperatorLte: "<=",
+}
+
+// conditionSQL returns SQL condition, matching the given one. Its values are added to args.
+// Returns models.ErrInvalidFilter if condition can't be applied.
+func conditionSQL(c models.Condition, args namedArgs) (string, error) {
+	err := c.Validate()
+	if err != nil {
+		return "", err
+	}
+	column := _filterColumns[c.Field]
+	kind := models.FilterFields[c.Field]
+
+	var condition string
+	switch c.Op {
+	case models.OperatorIn:
+		// Sqlite has no arrays, so every value is a separate argument.
+		placeholders := make([]string, 0, len(c.Values))
+		for _, value := range c.Values {
+			placeholders = append(placeholders, "@"+addArg(args, typedValue(kind, value)))
+		}
+		condition = fmt.Sprintf("%s IN (%s)", column, strings.Join(placeholders, ", "))
+	case models.OperatorUnknown:
+		switch kind {
+		case models.FieldString:
+			condition = fmt.Sprintf("(%s IS NULL OR %s = '')", column, column)
+		case models.FieldInt:
+			condition = fmt.Sprintf("(%s IS NULL OR %s = 0)", column, column)
+		default:
+			condition = fmt.Sprintf("%s IS NULL", column)
+		}
+	default:
+		arg := addArg(args, typedValue(kind, c.Values[0]))
+		condition = fmt.Sprintf("%s %s @%s", column, _comparisonOperators[c.Op], arg)
+	}
+	if c.Not {
+		// Unlike NOT, IS NOT TRUE holds for NULL, so negated conditions match unknown values.
+		condition = "(" + condition + ") IS NOT TRUE"
+	}
+	return condition, nil
+}
+
+// addArg adds value to args under a new name and returns the name.
+func addArg(args namedArgs, value any) string {
+	// Argument names only have to be unique, and args only grow.
+	arg := fmt.Sprintf("arg%d", len(args))
+	args[arg] = value
+	return arg
+}
+
+// typedValue converts validated textual value of a field of given kind to the field's type.
+func typedValue(kind models.FieldKind, value string) any {
+	switch kind {
+	case models.FieldInt:
+		number, _ := strconv.Atoi(value)
+		return number
+	case models.FieldUUID:
+		id, _ := uuid.Parse(value)
+		return id
+	}
+	return value
+}
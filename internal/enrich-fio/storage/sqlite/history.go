@@ -0,0 +1,184 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// _revisionColumns are columns of person_history table, in the order of models.Revision fields.
+const _revisionColumns = "person_id, revision, operation, old_value, new_value, actor, source, changed_at"
+
+// insertRevision records a change of person with given ID in its history, and writes event about it to outbox.
+// Actor and source are taken from ctx, operation is overriden if ctx says so.
+func (s *Storage) insertRevision(ctx context.Context, operation models.Operation, personID uuid.UUID, old *models.Person, new *models.Person) error {
+	audit := models.AuditFromContext(ctx)
+	if audit.Operation != "" {
+		operation = audit.Operation
+	}
+	oldValue, err := personJSON(old)
+	if err != nil {
+		return errors.Wrap(err, "marshal old value")
+	}
+	newValue, err := personJSON(new)
+	if err != nil {
+		return errors.Wrap(err, "marshal new value")
+	}
+	query := `
+	INSERT INTO person_history (tenant_id, person_id, revision, operation, old_value, new_value, actor, source, changed_at)
+	SELECT @tenant, @personID, COALESCE(MAX(revision), 0) + 1, @operation, @oldValue, @newValue, @actor, @source, @changedAt
+	FROM person_history
+	WHERE tenant_id = @tenant AND person_id = @personID
+	`
+	args := namedArgs{
+		"tenant":    models.TenantFromContext(ctx),
+		"personID":  personID,
+		"operation": string(operation),
+		"oldValue":  oldValue,
+		"newValue":  newValue,
+		"actor":     audit.Actor,
+		"source":    string(audit.Source),
+		"changedAt": time.Now().UnixNano(),
+	}
+	_, err = s.q.ExecContext(ctx, query, args.list()...)
+	if err != nil {
+		return errors.Wrap(err, "exec insert query")
+	}
+	// The connection is the only one, so the last inserted row is the revision just recorded.
+	query = `
+	INSERT INTO outbox (tenant_id, ` + _revisionColumns + `)
+	SELECT tenant_id, ` + _revisionColumns + `
+	FROM person_history
+	WHERE id = last_insert_rowid()
+	`
+	_, err = s.q.ExecContext(ctx, query)
+	if err != nil {
+		return errors.Wrap(err, "exec insert event query")
+	}
+	return nil
+}
+
+// personJSON returns person as JSON text, the way history keeps it, or NULL for nil person.
+func personJSON(person *models.Person) (sql.NullString, error) {
+	if person == nil {
+		return sql.NullString{}, nil
+	}
+	value, err := json.Marshal(person)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(value), Valid: true}, nil
+}
+
+// personFromJSON returns person, kept in history as JSON text, or nil for NULL.
+func personFromJSON(value sql.NullString) (*models.Person, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+	var person models.Person
+	err := json.Unmarshal([]byte(value.String), &person)
+	if err != nil {
+		return nil, err
+	}
+	return &person, nil
+}
+
+// scanRevision scans revision from a row of _revisionColumns.
+func scanRevision(r row) (models.Revision, error) {
+	var revision models.Revision
+	var oldValue, newValue sql.NullString
+	var changedAt int64
+	err := r.Scan(&revision.PersonID, &revision.Revision, &revision.Operation, &oldValue, &newValue,
+		&revision.Actor, &revision.Source, &changedAt)
+	if err != nil {
+		return models.Revision{}, err
+	}
+	revision.OldValue, err = personFromJSON(oldValue)
+	if err != nil {
+		return models.Revision{}, errors.Wrap(err, "unmarshal old value")
+	}
+	revision.NewValue, err = personFromJSON(newValue)
+	if err != nil {
+		return models.Revision{}, errors.Wrap(err, "unmarshal new value")
+	}
+	revision.ChangedAt = time.Unix(0, changedAt)
+	return revision, nil
+}
+
+// History returns all recorded revisions of person with given ID, oldest first.
+func (s *Storage) History(ctx context.Context, id uuid.UUID) ([]models.Revision, error) {
+	query := `
+	SELECT ` + _revisionColumns + `
+	FROM person_history
+	WHERE tenant_id = @tenant AND person_id = @id
+	ORDER BY revision
+	`
+	rows, err := s.q.QueryContext(ctx, query, sql.Named("tenant", models.TenantFromContext(ctx)), sql.Named("id", id))
+	if err != nil {
+		return nil, errors.Wrap(err, "query history")
+	}
+	defer rows.Close()
+	revisions := []models.Revision{}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan revision")
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, errors.Wrap(rows.Err(), "read rows")
+}
+
+// GetRevision returns given revision of person with given ID.
+// Returns models.ErrRevisionNotFound if no such revision recorded.
+func (s *Storage) GetRevision(ctx context.Context, id uuid.UUID, revision int) (models.Revision, error) {
+	query := `
+	SELECT ` + _revisionColumns + `
+	FROM person_history
+	WHERE tenant_id = @tenant AND person_id = @id AND revision = @revision
+	`
+	r, err := scanRevision(s.q.QueryRowContext(ctx, query,
+		sql.Named("tenant", models.TenantFromContext(ctx)), sql.Named("id", id), sql.Named("revision", revision)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Revision{}, models.ErrRevisionNotFound
+		}
+		return models.Revision{}, errors.Wrap(err, "query revision")
+	}
+	return r, nil
+}
+
+// GetAsOf returns person with given ID as it was at given moment.
+// Returns models.ErrPersonNotFound if person didn't exist at that moment.
+func (s *Storage) GetAsOf(ctx context.Context, id uuid.UUID, at time.Time) (models.Person, error) {
+	query := `
+	SELECT new_value
+	FROM person_history
+	WHERE tenant_id = @tenant AND person_id = @id AND changed_at <= @at
+	ORDER BY revision DESC
+	LIMIT 1
+	`
+	var value sql.NullString
+	err := s.q.QueryRowContext(ctx, query,
+		sql.Named("tenant", models.TenantFromContext(ctx)), sql.Named("id", id), sql.Named("at", at.UnixNano())).Scan(&value)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Person{}, models.ErrPersonNotFound
+		}
+		return models.Person{}, errors.Wrap(err, "query person as of")
+	}
+	person, err := personFromJSON(value)
+	if err != nil {
+		return models.Person{}, errors.Wrap(err, "unmarshal person")
+	}
+	if person == nil {
+		return models.Person{}, models.ErrPersonNotFound
+	}
+	return *person, nil
+}
@@ -0,0 +1,215 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// SaveImport saves given import job, overwriting the stored one. Counts of rows are not saved, they are computed from rows.
+func (s *Storage) SaveImport(ctx context.Context, job models.ImportJob) error {
+	options, err := json.Marshal(job.Options)
+	if err != nil {
+		return errors.Wrap(err, "marshal options")
+	}
+	_, err = s.q.ExecContext(ctx, `
+	INSERT INTO import_job (tenant_id, id, status, options, error, created_at, updated_at)
+	VALUES (@tenant, @id, @status, @options, @error, @createdAt, @updatedAt)
+	ON CONFLICT (tenant_id, id) DO UPDATE
+	SET status = excluded.status, options = excluded.options, error = excluded.error, updated_at = excluded.updated_at
+	`, namedArgs{
+		"tenant":    models.TenantFromContext(ctx),
+		"id":        job.ID,
+		"status":    job.Status,
+		"options":   string(options),
+		"error":     job.Error,
+		"createdAt": job.CreatedAt.UnixNano(),
+		"updatedAt": job.UpdatedAt.UnixNano(),
+	}.list()...)
+	return errors.Wrap(err, "exec upsert query")
+}
+
+// GetImport returns import job by given ID with counts of its rows.
+// Returns models.ErrImportNotFound if no such job found in the storage.
+func (s *Storage) GetImport(ctx context.Context, id uuid.UUID) (models.ImportJob, error) {
+	query := `
+	SELECT id, status, options, error, created_at, updated_at,
+		(SELECT count(*) FROM import_row r WHERE r.tenant_id = j.tenant_id AND r.job_id = j.id),
+		(SELECT count(*) FROM import_row r WHERE r.tenant_id = j.tenant_id AND r.job_id = j.id AND r.status = 'imported'),
+		(SELECT count(*) FROM import_row r WHERE r.tenant_id = j.tenant_id AND r.job_id = j.id AND r.status = 'failed')
+	FROM import_job j
+	WHERE tenant_id = @tenant AND id = @id
+	`
+	var job models.ImportJob
+	var options string
+	var createdAt, updatedAt int64
+	err := s.q.QueryRowContext(ctx, query, sql.Named("tenant", models.TenantFromContext(ctx)), sql.Named("id", id)).
+		Scan(&job.ID, &job.Status, &options, &job.Error, &createdAt, &updatedAt, &job.Rows, &job.Imported, &job.Failed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ImportJob{}, models.ErrImportNotFound
+	}
+	if err != nil {
+		return models.ImportJob{}, errors.Wrap(err, "query import")
+	}
+	err = json.Unmarshal([]byte(options), &job.Options)
+	if err != nil {
+		return models.ImportJob{}, errors.Wrap(err, "unmarshal options")
+	}
+	job.CreatedAt = time.Unix(0, createdAt)
+	job.UpdatedAt = time.Unix(0, updatedAt)
+	return job, nil
+}
+
+// checkImport returns models.ErrImportNotFound if tenant from ctx has no import job with given ID.
+func (s *Storage) checkImport(ctx context.Context, id uuid.UUID) error {
+	var exists bool
+	err := s.q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM import_job WHERE tenant_id = @tenant AND id = @id)`,
+		sql.Named("tenant", models.TenantFromContext(ctx)), sql.Named("id", id)).Scan(&exists)
+	if err != nil {
+		return errors.Wrap(err, "query import")
+	}
+	if !exists {
+		return models.ErrImportNotFound
+	}
+	return nil
+}
+
+// AddImportRows adds given rows to import job with given ID.
+// Returns models.ErrImportNotFound if no such job found in the storage.
+func (s *Storage) AddImportRows(ctx context.Context, id uuid.UUID, rows []models.ImportRow) error {
+	return s.transaction(ctx, func(tx *Storage) error {
+		err := tx.checkImport(ctx, id)
+		if err != nil {
+			return err
+		}
+		tenant := models.TenantFromContext(ctx)
+		for _, row := range rows {
+			_, err = tx.q.ExecContext(ctx, `
+			INSERT INTO import_row (tenant_id, job_id, number, status, person_id, name, surname, patronymic, error)
+			VALUES (@tenant, @job, @row, @status, @person, @name, @surname, @patronymic, @error)
+			`, namedArgs{
+				"tenant":     tenant,
+				"job":        id,
+				"row":        row.Row,
+				"status":     row.Status,
+				"person":     row.PersonID,
+				"name":       row.Name,
+				"surname":    row.Surname,
+				"patronymic": row.Patronymic,
+				"error":      row.Error,
+			}.list()...)
+			if err != nil {
+				return errors.Wrapf(err, "insert row %d", row.Row)
+			}
+		}
+		return nil
+	})
+}
+
+// ImportRows returns rows of import job with given ID, matching the query, in order of their numbers.
+// Returns models.ErrImportNotFound if no such job found in the storage.
+func (s *Storage) ImportRows(ctx context.Context, id uuid.UUID, query models.ImportRowsQuery) ([]models.ImportRow, error) {
+	err := s.checkImport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	filters := []string{"tenant_id = @tenant", "job_id = @job", "number > @after"}
+	if query.Pending {
+		filters = append(filters, "status = 'pending'")
+	}
+	rows, err := s.q.QueryContext(ctx, `
+	SELECT number, status, person_id, name, surname, patronymic, error
+	FROM import_row
+	`+whereClause(filters)+`
+	ORDER BY number
+	LIMIT @limit
+	`, namedArgs{
+		"tenant": models.TenantFromContext(ctx),
+		"job":    id,
+		"after":  query.After,
+		"limit":  query.Limit,
+	}.list()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "query rows")
+	}
+	defer rows.Close()
+	result := []models.ImportRow{}
+	for rows.Next() {
+		var row models.ImportRow
+		err = rows.Scan(&row.Row, &row.Status, &row.PersonID, &row.Name, &row.Surname, &row.Patronymic, &row.Error)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan row")
+		}
+		result = append(result, row)
+	}
+	return result, errors.Wrap(rows.Err(), "read rows")
+}
+
+// ClaimImport claims import job with given ID for the run and sets its status to running with no error.
+// Job is claimed anew if it's neither done nor running, or if claim of the run, running it, has expired.
+// Claim is renewed only if it's held by the same run, and the job is still running.
+// Returns models.ErrImportClaimed if job can't be claimed.
+// Returns models.ErrImportNotFound if no such job found in the storage.
+func (s *Storage) ClaimImport(ctx context.Context, id uuid.UUID, claim models.ImportClaim) error {
+	result, err := s.q.ExecContext(ctx, `
+	UPDATE import_job
+	SET status = 'running', error = '', runner = @runner, lease_until = @until, updated_at = @now
+	WHERE tenant_id = @tenant AND id = @id AND CASE
+		WHEN @renew THEN status = 'running' AND runner = @runner
+		ELSE status <> 'done' AND (status <> 'running' OR lease_until IS NULL OR lease_until < @now)
+	END
+	`, namedArgs{
+		"tenant": models.TenantFromContext(ctx),
+		"id":     id,
+		"runner": claim.Runner,
+		"until":  claim.Until.UnixNano(),
+		"renew":  claim.Renew,
+		"now":    time.Now().UnixNano(),
+	}.list()...)
+	if err != nil {
+		return errors.Wrap(err, "exec update query")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get affected rows")
+	}
+	if affected == 0 {
+		err = s.checkImport(ctx, id)
+		if err != nil {
+			return err
+		}
+		return models.ErrImportClaimed
+	}
+	return nil
+}
+
+// SaveImportResults updates statuses, person IDs and errors of given rows of import job with given ID.
+func (s *Storage) SaveImportResults(ctx context.Context, id uuid.UUID, rows []models.ImportRow) error {
+	return s.transaction(ctx, func(tx *Storage) error {
+		tenant := models.TenantFromContext(ctx)
+		for _, row := range rows {
+			_, err := tx.q.ExecContext(ctx, `
+			UPDATE import_row
+			SET status = @status, person_id = @person, error = @error
+			WHERE tenant_id = @tenant AND job_id = @job AND number = @row
+			`, namedArgs{
+				"tenant": tenant,
+				"job":    id,
+				"row":    row.Row,
+				"status": row.Status,
+				"person": row.PersonID,
+				"error":  row.Error,
+			}.list()...)
+			if err != nil {
+				return errors.Wrapf(err, "update row %d", row.Row)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,37 @@
+package sqlite
+
+import (
+	"context"
+	"embed"
+
+	"github.com/golang-migrate/migrate/v4"
+	migrateSqlite "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/enrich-fio/storage/migration"
+)
+
+// _migrations are migrations of storage schema, embedded into binary.
+//
+//go:embed migrations/*.sql
+var _migrations embed.FS
+
+// Migrate returns migrate instance for storage schema, which must be closed after use.
+// Migrations are embedded into binary, unless config.MigrationURL overrides them.
+func (s *Storage) Migrate() (*migrate.Migrate, error) {
+	p := &migrateSqlite.Sqlite{}
+	driver, err := p.Open("sqlite://" + s.config.SQLitePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening connection")
+	}
+	return migration.New(_migrations, s.config.MigrationURL, "sqlite", driver)
+}
+
+// MigrateUp performs a database migration to the last available version.
+func (s *Storage) MigrateUp(ctx context.Context) error {
+	m, err := s.Migrate()
+	if err != nil {
+		return err
+	}
+	return migration.Up(m)
+}
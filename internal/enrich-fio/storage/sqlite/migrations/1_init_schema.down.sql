@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS person_history;
+DROP TABLE IF EXISTS person;
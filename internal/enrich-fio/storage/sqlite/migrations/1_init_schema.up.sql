@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS person (
+    id text PRIMARY KEY,
+    name text NOT NULL,
+    surname text NOT NULL,
+    patronymic text NOT NULL DEFAULT '',
+    gender text NOT NULL DEFAULT '',
+    nationality text NOT NULL DEFAULT '',
+    age integer NOT NULL DEFAULT 0,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS person_name_id_idx ON person (name, id);
+
+CREATE TABLE IF NOT EXISTS person_history (
+    id integer PRIMARY KEY,
+    person_id text NOT NULL,
+    revision integer NOT NULL,
+    operation text NOT NULL,
+    old_value text,
+    new_value text,
+    actor text NOT NULL,
+    source text NOT NULL,
+    -- Unix time in nanoseconds, so moments compare as numbers.
+    changed_at integer NOT NULL,
+    UNIQUE (person_id, revision)
+);
+
+CREATE INDEX IF NOT EXISTS person_history_person_id_changed_at_idx ON person_history (person_id, changed_at);
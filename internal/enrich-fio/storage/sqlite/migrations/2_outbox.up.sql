@@ -0,0 +1,17 @@
+-- AUTOINCREMENT never reuses ids of deleted events, so consumers can skip events they have already seen.
+CREATE TABLE IF NOT EXISTS outbox (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    person_id text NOT NULL,
+    revision integer NOT NULL,
+    operation text NOT NULL,
+    old_value text,
+    new_value text,
+    actor text NOT NULL,
+    source text NOT NULL,
+    changed_at integer NOT NULL,
+    -- Unix time in nanoseconds, NULL till event is delivered.
+    delivered_at integer
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (id) WHERE delivered_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_delivered_at_idx ON outbox (delivered_at) WHERE delivered_at IS NOT NULL;
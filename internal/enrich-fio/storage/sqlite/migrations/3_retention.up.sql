@@ -0,0 +1,11 @@
+-- Anonymized people are kept for statistics, but retention rules skip them.
+ALTER TABLE person ADD COLUMN anonymized integer NOT NULL DEFAULT 0;
+
+-- Tombstones prove erasure of people without keeping any personal data.
+CREATE TABLE IF NOT EXISTS person_tombstone (
+    person_id text PRIMARY KEY,
+    -- Unix time in nanoseconds.
+    erased_at integer NOT NULL,
+    actor text NOT NULL,
+    source text NOT NULL
+);
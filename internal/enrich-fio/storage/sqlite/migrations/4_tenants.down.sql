@@ -0,0 +1,50 @@
+-- People of tenants other than the default one are lost, as their IDs may repeat.
+ALTER TABLE outbox DROP COLUMN tenant_id;
+
+CREATE TABLE person_tombstone_single (
+    person_id text PRIMARY KEY,
+    -- Unix time in nanoseconds.
+    erased_at integer NOT NULL,
+    actor text NOT NULL,
+    source text NOT NULL
+);
+INSERT INTO person_tombstone_single (person_id, erased_at, actor, source)
+SELECT person_id, erased_at, actor, source FROM person_tombstone WHERE tenant_id = 'default';
+DROP TABLE person_tombstone;
+ALTER TABLE person_tombstone_single RENAME TO person_tombstone;
+
+CREATE TABLE person_history_single (
+    id integer PRIMARY KEY,
+    person_id text NOT NULL,
+    revision integer NOT NULL,
+    operation text NOT NULL,
+    old_value text,
+    new_value text,
+    actor text NOT NULL,
+    source text NOT NULL,
+    -- Unix time in nanoseconds, so moments compare as numbers.
+    changed_at integer NOT NULL,
+    UNIQUE (person_id, revision)
+);
+INSERT INTO person_history_single (id, person_id, revision, operation, old_value, new_value, actor, source, changed_at)
+SELECT id, person_id, revision, operation, old_value, new_value, actor, source, changed_at FROM person_history WHERE tenant_id = 'default';
+DROP TABLE person_history;
+ALTER TABLE person_history_single RENAME TO person_history;
+CREATE INDEX IF NOT EXISTS person_history_person_id_changed_at_idx ON person_history (person_id, changed_at);
+
+CREATE TABLE person_single (
+    id text PRIMARY KEY,
+    name text NOT NULL,
+    surname text NOT NULL,
+    patronymic text NOT NULL DEFAULT '',
+    gender text NOT NULL DEFAULT '',
+    nationality text NOT NULL DEFAULT '',
+    age integer NOT NULL DEFAULT 0,
+    version integer NOT NULL DEFAULT 1,
+    anonymized integer NOT NULL DEFAULT 0
+);
+INSERT INTO person_single (id, name, surname, patronymic, gender, nationality, age, version, anonymized)
+SELECT id, name, surname, patronymic, gender, nationality, age, version, anonymized FROM person WHERE tenant_id = 'default';
+DROP TABLE person;
+ALTER TABLE person_single RENAME TO person;
+CREATE INDEX IF NOT EXISTS person_name_id_idx ON person (name, id);
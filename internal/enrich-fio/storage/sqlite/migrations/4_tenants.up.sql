@@ -0,0 +1,57 @@
+-- People of different tenants may have the same IDs, so tenant becomes part of every key.
+-- Sqlite can't change keys of a table, so tables are rebuilt. People, added before tenants existed, are of the default one.
+CREATE TABLE person_tenant (
+    tenant_id text NOT NULL DEFAULT 'default',
+    id text NOT NULL,
+    name text NOT NULL,
+    surname text NOT NULL,
+    patronymic text NOT NULL DEFAULT '',
+    gender text NOT NULL DEFAULT '',
+    nationality text NOT NULL DEFAULT '',
+    age integer NOT NULL DEFAULT 0,
+    version integer NOT NULL DEFAULT 1,
+    anonymized integer NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, id)
+);
+INSERT INTO person_tenant (id, name, surname, patronymic, gender, nationality, age, version, anonymized)
+SELECT id, name, surname, patronymic, gender, nationality, age, version, anonymized FROM person;
+DROP TABLE person;
+ALTER TABLE person_tenant RENAME TO person;
+CREATE INDEX IF NOT EXISTS person_tenant_id_name_id_idx ON person (tenant_id, name, id);
+
+CREATE TABLE person_history_tenant (
+    id integer PRIMARY KEY,
+    tenant_id text NOT NULL DEFAULT 'default',
+    person_id text NOT NULL,
+    revision integer NOT NULL,
+    operation text NOT NULL,
+    old_value text,
+    new_value text,
+    actor text NOT NULL,
+    source text NOT NULL,
+    -- Unix time in nanoseconds, so moments compare as numbers.
+    changed_at integer NOT NULL,
+    UNIQUE (tenant_id, person_id, revision)
+);
+INSERT INTO person_history_tenant (id, person_id, revision, operation, old_value, new_value, actor, source, changed_at)
+SELECT id, person_id, revision, operation, old_value, new_value, actor, source, changed_at FROM person_history;
+DROP TABLE person_history;
+ALTER TABLE person_history_tenant RENAME TO person_history;
+CREATE INDEX IF NOT EXISTS person_history_tenant_id_person_id_changed_at_idx ON person_history (tenant_id, person_id, changed_at);
+
+CREATE TABLE person_tombstone_tenant (
+    tenant_id text NOT NULL DEFAULT 'default',
+    person_id text NOT NULL,
+    -- Unix time in nanoseconds.
+    erased_at integer NOT NULL,
+    actor text NOT NULL,
+    source text NOT NULL,
+    PRIMARY KEY (tenant_id, person_id)
+);
+INSERT INTO person_tombstone_tenant (person_id, erased_at, actor, source)
+SELECT person_id, erased_at, actor, source FROM person_tombstone;
+DROP TABLE person_tombstone;
+ALTER TABLE person_tombstone_tenant RENAME TO person_tombstone;
+
+-- Outbox is shared by all tenants, and events tell their tenant.
+ALTER TABLE outbox ADD COLUMN tenant_id text NOT NULL DEFAULT 'default';
@@ -0,0 +1,2 @@
+ALTER TABLE person DROP COLUMN tags;
+ALTER TABLE person DROP COLUMN attributes;
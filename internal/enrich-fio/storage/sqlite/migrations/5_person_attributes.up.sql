@@ -0,0 +1,3 @@
+-- Custom attributes and tags of people, set by clients, as JSON object and array.
+ALTER TABLE person ADD COLUMN attributes text NOT NULL DEFAULT '{}';
+ALTER TABLE person ADD COLUMN tags text NOT NULL DEFAULT '[]';
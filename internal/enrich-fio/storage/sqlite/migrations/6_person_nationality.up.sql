@@ -0,0 +1,12 @@
+-- Probable nationalities of people, the most likely first. Nationality of person is the first of them.
+-- People, whose nationality was set without probabilities, have none.
+CREATE TABLE IF NOT EXISTS person_nationality (
+    tenant_id text NOT NULL,
+    person_id text NOT NULL,
+    rank integer NOT NULL,
+    country text NOT NULL,
+    probability real NOT NULL,
+    PRIMARY KEY (tenant_id, person_id, rank)
+);
+
+CREATE INDEX IF NOT EXISTS person_nationality_tenant_id_country_idx ON person_nationality (tenant_id, country);
@@ -0,0 +1,28 @@
+-- Import jobs keep rows of imported files, so jobs can be resumed, and results of rows can be reported.
+CREATE TABLE IF NOT EXISTS import_job (
+    tenant_id text NOT NULL,
+    id text NOT NULL,
+    status text NOT NULL,
+    -- JSON of models.ImportOptions.
+    options text NOT NULL,
+    error text NOT NULL DEFAULT '',
+    -- Unix time in nanoseconds.
+    created_at integer NOT NULL,
+    updated_at integer NOT NULL,
+    PRIMARY KEY (tenant_id, id)
+);
+
+CREATE TABLE IF NOT EXISTS import_row (
+    tenant_id text NOT NULL,
+    job_id text NOT NULL,
+    number integer NOT NULL,
+    status text NOT NULL,
+    person_id text NOT NULL,
+    name text NOT NULL,
+    surname text NOT NULL,
+    patronymic text NOT NULL,
+    error text NOT NULL DEFAULT '',
+    PRIMARY KEY (tenant_id, job_id, number)
+);
+
+CREATE INDEX IF NOT EXISTS import_row_tenant_id_person_id_idx ON import_row (tenant_id, person_id);
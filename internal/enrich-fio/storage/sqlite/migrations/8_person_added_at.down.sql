@@ -0,0 +1 @@
+ALTER TABLE person DROP COLUMN added_at;
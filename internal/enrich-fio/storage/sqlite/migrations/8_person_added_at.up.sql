@@ -0,0 +1,9 @@
+-- Moment person was added at, which retention rules count from. Anonymizing or erasing forgets history,
+-- so it can't be told from the oldest revision. NULL is person, added before history was kept.
+-- Unix time in nanoseconds.
+ALTER TABLE person ADD COLUMN added_at integer;
+
+UPDATE person SET added_at = (
+    SELECT MIN(changed_at) FROM person_history h
+    WHERE h.tenant_id = person.tenant_id AND h.person_id = person.id
+);
@@ -0,0 +1,2 @@
+ALTER TABLE import_job DROP COLUMN lease_until;
+ALTER TABLE import_job DROP COLUMN runner;
@@ -0,0 +1,5 @@
+-- Import job is claimed by a single run, so its rows aren't imported twice.
+-- Claim expires at lease_until unless the run renews it, so job of a crashed run can be resumed.
+ALTER TABLE import_job ADD COLUMN runner text;
+-- Unix time in nanoseconds.
+ALTER TABLE import_job ADD COLUMN lease_until integer;
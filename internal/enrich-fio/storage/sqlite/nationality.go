@@ -0,0 +1,51 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// _nationalitiesColumn is JSON array of nationalities of person, ordered by rank.
+// It's selected from person table, so nationalities, written by the same statement, are not seen.
+const _nationalitiesColumn = `(
+		SELECT json_group_array(json_object('country', country, 'probability', probability))
+		FROM (
+			SELECT country, probability
+			FROM person_nationality n
+			WHERE n.tenant_id = person.tenant_id AND n.person_id = person.id
+			ORDER BY rank
+		)
+	) AS nationalities`
+
+// saveNationalities replaces nationalities of person of tenant from ctx with given ones.
+func (s *Storage) saveNationalities(ctx context.Context, id uuid.UUID, nationalities []models.Nationality) error {
+	err := s.deleteNationalities(ctx, id)
+	if err != nil {
+		return err
+	}
+	tenant := models.TenantFromContext(ctx)
+	for i, n := range nationalities {
+		_, err = s.q.ExecContext(ctx, `
+		INSERT INTO person_nationality (tenant_id, person_id, rank, country, probability)
+		VALUES (@tenant, @id, @rank, @country, @probability)
+		`, sql.Named("tenant", tenant), sql.Named("id", id), sql.Named("rank", i+1),
+			sql.Named("country", n.Country), sql.Named("probability", n.Probability))
+		if err != nil {
+			return errors.Wrapf(err, "insert nationality %q", n.Country)
+		}
+	}
+	return nil
+}
+
+// deleteNationalities deletes nationalities of person of tenant from ctx.
+// Sqlite doesn't enforce foreign keys, so they are deleted along with the person explicitly.
+func (s *Storage) deleteNationalities(ctx context.Context, id uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, `DELETE FROM person_nationality WHERE tenant_id = @tenant AND person_id = @id`,
+		sql.Named("tenant", models.TenantFromContext(ctx)), sql.Named("id", id))
+	return errors.Wrap(err, "delete nationalities")
+}
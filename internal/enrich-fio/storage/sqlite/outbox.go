@@ -0,0 +1,88 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/models"
+)
+
+// eventRow is a row of outbox, which has event ID and tenant before columns of the revision.
+type eventRow struct {
+	row
+	id     *int64
+	tenant *string
+}
+
+// Scan scans event ID and tenant, and then the rest of the row into dest.
+func (r eventRow) Scan(dest ...any) error {
+	return r.row.Scan(append([]any{r.id, r.tenant}, dest...)...)
+}
+
+// PendingEvents returns up to limit events, which are not delivered yet, in the order changes were made.
+func (s *Storage) PendingEvents(ctx context.Context, limit int) ([]models.Event, error) {
+	query := `
+	SELECT id, tenant_id, ` + _revisionColumns + `
+	FROM outbox
+	WHERE delivered_at IS NULL
+	ORDER BY id
+	LIMIT @limit
+	`
+	rows, err := s.q.QueryContext(ctx, query, sql.Named("limit", limit))
+	if err != nil {
+		return nil, errors.Wrap(err, "query pending events")
+	}
+	defer rows.Close()
+	events := []models.Event{}
+	for rows.Next() {
+		var id int64
+		var tenant string
+		revision, err := scanRevision(eventRow{row: rows, id: &id, tenant: &tenant})
+		if err != nil {
+			return nil, errors.Wrap(err, "scan event")
+		}
+		events = append(events, models.NewEvent(id, tenant, revision))
+	}
+	return events, errors.Wrap(rows.Err(), "read rows")
+}
+
+// MarkDelivered marks events with given IDs as delivered, so they are not pending anymore.
+func (s *Storage) MarkDelivered(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := namedArgs{"deliveredAt": time.Now().UnixNano()}
+	placeholders := make([]string, 0, len(ids))
+	for _, id := range ids {
+		placeholders = append(placeholders, "@"+addArg(args, id))
+	}
+	query := `UPDATE outbox SET delivered_at = @deliveredAt WHERE delivered_at IS NULL AND id IN (` + strings.Join(placeholders, ", ") + `)`
+	_, err := s.q.ExecContext(ctx, query, args.list()...)
+	if err != nil {
+		return errors.Wrap(err, "exec update query")
+	}
+	return nil
+}
+
+// DeleteDelivered deletes events, delivered before given moment, and returns how many were deleted.
+func (s *Storage) DeleteDelivered(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.q.ExecContext(ctx, `DELETE FROM outbox WHERE delivered_at < @before`, sql.Named("before", before.UnixNano()))
+	if err != nil {
+		return 0, errors.Wrap(err, "exec delete query")
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "get deleted rows")
+	}
+	return deleted, nil
+}
+
+// LockOutbox calls fn with storage itself, as storage belongs to a single process, which runs a single relay.
+func (s *Storage) LockOutbox(ctx context.Context, fn func(outbox enrichfio.Outbox) error) error {
+	return fn(s)
+}
@@ -0,0 +1,189 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// Anonymize replaces person with given anonymized one, and forgets its history and events, as they keep personal data.
+// Anonymized person is recorded in history and outbox as the only revision.
+// Returns models.ErrPersonNotFound if no such people found in the storage.
+func (s *Storage) Anonymize(ctx context.Context, anonymized models.Person) error {
+	query := `
+	UPDATE person
+	SET name = @name, surname = @surname, patronymic = @patronymic, age = @age, gender = @gender,
+		nationality = @nationality, version = version + 1, anonymized = 1
+	WHERE tenant_id = @tenant AND id = @id
+	RETURNING ` + _personColumns
+	return s.transaction(ctx, func(tx *Storage) error {
+		updated, err := tx.queryPerson(ctx, query, personArgs(ctx, anonymized))
+		if err != nil {
+			return err
+		}
+		_, err = tx.forget(ctx, anonymized.ID)
+		if err != nil {
+			return err
+		}
+		err = tx.insertRevision(ctx, models.OperationAnonymize, anonymized.ID, nil, &updated)
+		if err != nil {
+			return errors.Wrap(err, "insert revision")
+		}
+		return nil
+	})
+}
+
+// Erase removes person with given ID with all its history and events, and leaves a tombstone.
+// Erasing already erased person returns its tombstone.
+// Returns models.ErrPersonNotFound if nothing is known about the person.
+func (s *Storage) Erase(ctx context.Context, id uuid.UUID) (models.Tombstone, error) {
+	var tombstone models.Tombstone
+	err := s.transaction(ctx, func(tx *Storage) error {
+		tenant := models.TenantFromContext(ctx)
+		result, err := tx.q.ExecContext(ctx, `DELETE FROM person WHERE tenant_id = @tenant AND id = @id`,
+			sql.Named("tenant", tenant), sql.Named("id", id))
+		if err != nil {
+			return errors.Wrap(err, "exec delete query")
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return errors.Wrap(err, "get deleted rows")
+		}
+		err = tx.deleteNationalities(ctx, id)
+		if err != nil {
+			return err
+		}
+		forgotten, err := tx.forget(ctx, id)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 && forgotten == 0 {
+			tombstone, err = scanTombstone(tx.q.QueryRowContext(ctx,
+				`SELECT `+_tombstoneColumns+` FROM person_tombstone WHERE tenant_id = @tenant AND person_id = @id`,
+				sql.Named("tenant", tenant), sql.Named("id", id)))
+			if errors.Is(err, sql.ErrNoRows) {
+				return models.ErrPersonNotFound
+			}
+			return errors.Wrap(err, "query tombstone")
+		}
+
+		audit := models.AuditFromContext(ctx)
+		args := namedArgs{
+			"tenant":    tenant,
+			"id":        id,
+			"erasedAt":  time.Now().UnixNano(),
+			"actor":     audit.Actor,
+			"source":    string(audit.Source),
+			"operation": string(models.OperationErase),
+		}
+		query := `
+		INSERT INTO person_tombstone (tenant_id, person_id, erased_at, actor, source)
+		VALUES (@tenant, @id, @erasedAt, @actor, @source)
+		ON CONFLICT (tenant_id, person_id) DO UPDATE SET
+			erased_at = excluded.erased_at,
+			actor = excluded.actor,
+			source = excluded.source
+		RETURNING ` + _tombstoneColumns
+		tombstone, err = scanTombstone(tx.q.QueryRowContext(ctx, query, args.list()...))
+		if err != nil {
+			return errors.Wrap(err, "insert tombstone")
+		}
+		query = `
+		INSERT INTO outbox (tenant_id, ` + _revisionColumns + `)
+		VALUES (@tenant, @id, 0, @operation, NULL, NULL, @actor, @source, @erasedAt)
+		`
+		_, err = tx.q.ExecContext(ctx, query, args.list()...)
+		if err != nil {
+			return errors.Wrap(err, "exec insert event query")
+		}
+		return nil
+	})
+	return tombstone, err
+}
+
+// _tombstoneColumns are columns of person_tombstone table, in the order of models.Tombstone fields.
+const _tombstoneColumns = "person_id, erased_at, actor, source"
+
+// scanTombstone scans tombstone from a row of _tombstoneColumns.
+func scanTombstone(r row) (models.Tombstone, error) {
+	var tombstone models.Tombstone
+	var erasedAt int64
+	err := r.Scan(&tombstone.PersonID, &erasedAt, &tombstone.Actor, &tombstone.Source)
+	if err != nil {
+		return models.Tombstone{}, err
+	}
+	tombstone.ErasedAt = time.Unix(0, erasedAt)
+	return tombstone, nil
+}
+
+// forget deletes history of person of tenant from ctx with given ID and all events about it, delivered or not,
+// and FIO of rows, the person is imported from. Returns how many revisions were deleted.
+func (s *Storage) forget(ctx context.Context, id uuid.UUID) (int64, error) {
+	args := namedArgs{"tenant": models.TenantFromContext(ctx), "id": id}.list()
+	result, err := s.q.ExecContext(ctx, `DELETE FROM person_history WHERE tenant_id = @tenant AND person_id = @id`, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "exec delete history query")
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "get deleted rows")
+	}
+	_, err = s.q.ExecContext(ctx, `DELETE FROM outbox WHERE tenant_id = @tenant AND person_id = @id`, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "exec delete events query")
+	}
+	_, err = s.q.ExecContext(ctx, `
+	UPDATE import_row SET name = '', surname = '', patronymic = ''
+	WHERE tenant_id = @tenant AND person_id = @id
+	`, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "exec update import rows query")
+	}
+	return deleted, nil
+}
+
+// ExpiredPeople returns up to query.Limit IDs of people, matching the query, in order of IDs.
+// Anonymized people are skipped by anonymize rules only.
+// Returns models.ErrInvalidFilter if query.Filter can't be applied.
+func (s *Storage) ExpiredPeople(ctx context.Context, query models.ExpiredQuery) ([]uuid.UUID, error) {
+	filters, args, err := filterConditions(ctx, query.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if query.Action != models.RetentionErase {
+		filters = append(filters, "NOT anonymized")
+	}
+	// People, added before history was kept, have no added_at and are always old enough.
+	filters = append(filters, "id > @after", "COALESCE(added_at, 0) < @addedBefore")
+	args["after"] = query.After
+	args["addedBefore"] = query.AddedBefore.UnixNano()
+	args["limit"] = query.Limit
+
+	selectQuery := `
+	SELECT id
+	FROM person
+	` + whereClause(filters) + `
+	ORDER BY id
+	LIMIT @limit
+	`
+	rows, err := s.q.QueryContext(ctx, selectQuery, args.list()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "query expired people")
+	}
+	defer rows.Close()
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan id")
+		}
+		ids = append(ids, id)
+	}
+	return ids, errors.Wrap(rows.Err(), "read rows")
+}
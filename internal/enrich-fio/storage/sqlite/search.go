@@ -0,0 +1,30 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/enrich-fio/storage/textsearch"
+	"enrich-fio/internal/models"
+)
+
+// Search returns a page of people, whose FIO matches the given query, the best matches first.
+// Only people, matching the filter, are searched. opts.Cursor and opts.Sort are not supported.
+// Sqlite has no trigram indexes, so matching people are scored in process, the way pg_trgm does.
+// Returns models.ErrInvalidSearchQuery if query is empty or malformed.
+func (s *Storage) Search(ctx context.Context, query models.SearchQuery, filter models.FilterConfig, opts models.ListOptions) (models.SearchPage, error) {
+	query, err := query.WithDefaults()
+	if err != nil {
+		return models.SearchPage{}, err
+	}
+	filters, args, err := filterConditions(ctx, filter)
+	if err != nil {
+		return models.SearchPage{}, err
+	}
+	people, err := s.queryPeople(ctx, `SELECT `+_personColumns+` FROM person `+whereClause(filters), args)
+	if err != nil {
+		return models.SearchPage{}, errors.Wrap(err, "query filtered people")
+	}
+	return textsearch.Search(people, query, opts.Page, s.pageSize(opts.PageSize)), nil
+}
@@ -0,0 +1,446 @@
+// Package sqlite is storage implementation via sqlite, for single-node deployments without postgres.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"enrich-fio/internal/config"
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/enrich-fio/storage/listing"
+	"enrich-fio/internal/models"
+)
+
+// Storage is storage implementation via sqlite.
+type Storage struct {
+	db *sql.DB
+	// q is the db, or transaction, if storage is used inside of WithTx.
+	q querier
+	// tx is the transaction, if storage is used inside of WithTx.
+	tx *sql.Tx
+	// savepoints is a number of WithTx, storage is nested in, inside of the transaction.
+	savepoints int
+	config     *config.DBConfig
+}
+
+// querier is a way to run queries, common for db and transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// namedArgs are named arguments of a query, referenced in it as @name.
+type namedArgs map[string]any
+
+func (a namedArgs) list() []any {
+	args := make([]any, 0, len(a))
+	for name, value := range a {
+		args = append(args, sql.Named(name, value))
+	}
+	return args
+}
+
+// New returns storage implemented with sqlite, opened with "sqlite" driver.
+// Sqlite allows only one writer at a time, so db is limited to a single connection.
+func New(db *sql.DB, config *config.DBConfig) *Storage {
+	db.SetMaxOpenConns(1)
+	return &Storage{
+		db:     db,
+		q:      db,
+		config: config,
+	}
+}
+
+// WithTx calls fn with storage, which operations all succeed or fail together.
+// Transaction is committed if fn returns nil, and rolled back otherwise.
+// Nested WithTx rolls back only operations made inside of it.
+func (s *Storage) WithTx(ctx context.Context, fn func(tx enrichfio.Storage) error) error {
+	return s.transaction(ctx, func(tx *Storage) error {
+		return fn(tx)
+	})
+}
+
+// transaction calls fn with storage inside of a transaction, or of a savepoint, if storage is already in one.
+func (s *Storage) transaction(ctx context.Context, fn func(tx *Storage) error) error {
+	if s.tx == nil {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return errors.Wrap(err, "begin transaction")
+		}
+		err = fn(&Storage{db: s.db, q: tx, tx: tx, config: s.config})
+		if err != nil {
+			rollbackErr := tx.Rollback()
+			if rollbackErr != nil {
+				return errors.Wrapf(err, "rollback failed: %v", rollbackErr)
+			}
+			return err
+		}
+		return errors.Wrap(tx.Commit(), "commit transaction")
+	}
+
+	savepoint := fmt.Sprintf("savepoint_%d", s.savepoints+1)
+	_, err := s.tx.ExecContext(ctx, "SAVEPOINT "+savepoint)
+	if err != nil {
+		return errors.Wrap(err, "create savepoint")
+	}
+	err = fn(&Storage{db: s.db, q: s.tx, tx: s.tx, savepoints: s.savepoints + 1, config: s.config})
+	if err != nil {
+		// Rolling back to a savepoint keeps it, so it is released either way.
+		_, rollbackErr := s.tx.ExecContext(ctx, "ROLLBACK TO "+savepoint+"; RELEASE "+savepoint)
+		if rollbackErr != nil {
+			return errors.Wrapf(err, "rollback to savepoint failed: %v", rollbackErr)
+		}
+		return err
+	}
+	_, err = s.tx.ExecContext(ctx, "RELEASE "+savepoint)
+	return errors.Wrap(err, "release savepoint")
+}
+
+// _personColumns are columns of person table, in the order of models.Person fields.
+// Nationalities are aggregated from person_nationality table.
+const _personColumns = "id, name, surname, patronymic, age, gender, nationality, " + _nationalitiesColumn + ", attributes, tags, version"
+
+// row is a single row of query result, common for sql.Row and sql.Rows.
+type row interface {
+	Scan(dest ...any) error
+}
+
+// scanPerson scans person from a row of _personColumns.
+func scanPerson(r row) (models.Person, error) {
+	var person models.Person
+	var nationalities, attributes, tags string
+	err := r.Scan(&person.ID, &person.Name, &person.Surname, &person.Patronymic,
+		&person.Age, &person.Gender, &person.Nationality, &nationalities, &attributes, &tags, &person.Version)
+	if err != nil {
+		return models.Person{}, err
+	}
+	err = json.Unmarshal([]byte(nationalities), &person.Nationalities)
+	if err != nil {
+		return models.Person{}, errors.Wrap(err, "unmarshal nationalities")
+	}
+	err = json.Unmarshal([]byte(attributes), &person.Attributes)
+	if err != nil {
+		return models.Person{}, errors.Wrap(err, "unmarshal attributes")
+	}
+	err = json.Unmarshal([]byte(tags), &person.Tags)
+	if err != nil {
+		return models.Person{}, errors.Wrap(err, "unmarshal tags")
+	}
+	return person, nil
+}
+
+// labelColumns returns values of attributes and tags columns: JSON object and array, empty ones if they are nil.
+func labelColumns(attributes map[string]string, tags []string) (string, string) {
+	if attributes == nil {
+		attributes = map[string]string{}
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	// Maps of strings and slices of strings always marshal.
+	attributesJSON, _ := json.Marshal(attributes)
+	tagsJSON, _ := json.Marshal(tags)
+	return string(attributesJSON), string(tagsJSON)
+}
+
+// queryPeople returns all people, the query of _personColumns returns.
+func (s *Storage) queryPeople(ctx context.Context, query string, args namedArgs) ([]models.Person, error) {
+	rows, err := s.q.QueryContext(ctx, query, args.list()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "query people")
+	}
+	defer rows.Close()
+	people := []models.Person{}
+	for rows.Next() {
+		person, err := scanPerson(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan person")
+		}
+		people = append(people, person)
+	}
+	return people, errors.Wrap(rows.Err(), "read rows")
+}
+
+// queryPerson returns the person, the query of _personColumns returns.
+// Returns models.ErrPersonNotFound if query returns nothing.
+func (s *Storage) queryPerson(ctx context.Context, query string, args namedArgs) (models.Person, error) {
+	person, err := scanPerson(s.q.QueryRowContext(ctx, query, args.list()...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Person{}, models.ErrPersonNotFound
+		}
+		return models.Person{}, errors.Wrap(err, "query person")
+	}
+	return person, nil
+}
+
+func (s *Storage) Save(ctx context.Context, person models.Person) error {
+	query := `
+	INSERT INTO person (tenant_id, id, name, surname, patronymic, gender, nationality, age, attributes, tags, added_at)
+	VALUES (@tenant, @id, @name, @surname, @patronymic, @gender, @nationality, @age, @attributes, @tags, @addedAt)
+	RETURNING ` + _personColumns
+	args := personArgs(ctx, person)
+	args["addedAt"] = time.Now().UnixNano()
+	return s.transaction(ctx, func(tx *Storage) error {
+		saved, err := tx.queryPerson(ctx, query, args)
+		if err != nil {
+			if isPrimaryKeyViolation(err) {
+				return errors.Wrapf(models.ErrPersonExists, "%s", person.ID)
+			}
+			return errors.Wrap(err, "insert person")
+		}
+		err = tx.saveNationalities(ctx, person.ID, person.Nationalities)
+		if err != nil {
+			return err
+		}
+		saved.Nationalities = person.Nationalities
+		err = tx.insertRevision(ctx, models.OperationCreate, person.ID, nil, &saved)
+		if err != nil {
+			return errors.Wrap(err, "insert revision")
+		}
+		return nil
+	})
+}
+
+// isPrimaryKeyViolation tells if err is caused by a row, duplicating another one by primary key.
+func isPrimaryKeyViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+// personArgs returns arguments with values of person's columns, and tenant from ctx, the person belongs to.
+func personArgs(ctx context.Context, person models.Person) namedArgs {
+	attributes, tags := labelColumns(person.Attributes, person.Tags)
+	return namedArgs{
+		"tenant":      models.TenantFromContext(ctx),
+		"id":          person.ID,
+		"name":        person.Name,
+		"surname":     person.Surname,
+		"patronymic":  person.Patronymic,
+		"gender":      string(person.Gender),
+		"nationality": person.Nationality,
+		"age":         person.Age,
+		"attributes":  attributes,
+		"tags":        tags,
+	}
+}
+
+// GetWithFilter returns a page of people that match the given filter.
+// Sqlite keeps no table statistics, so total is never estimated.
+// Returns models.ErrInvalidCursor if opts.Cursor is malformed.
+// Returns models.ErrInvalidSortKey if people can't be ordered by opts.Sort.
+func (s *Storage) GetWithFilter(ctx context.Context, filter models.FilterConfig, opts models.ListOptions) (models.PeoplePage, error) {
+	pageSize := s.pageSize(opts.PageSize)
+	order, err := listing.Order(opts.Sort)
+	if err != nil {
+		return models.PeoplePage{}, err
+	}
+	filters, args, err := filterConditions(ctx, filter)
+	if err != nil {
+		return models.PeoplePage{}, err
+	}
+
+	var total *int64
+	switch opts.Total {
+	case models.TotalNone:
+	case models.TotalExact, models.TotalEstimated:
+		count, err := s.countPeople(ctx, filters, args)
+		if err != nil {
+			return models.PeoplePage{}, errors.Wrap(err, "count people")
+		}
+		total = &count
+	default:
+		return models.PeoplePage{}, errors.Wrapf(models.ErrInvalidTotalMode, "%q", opts.Total)
+	}
+
+	c := listing.Cursor{}
+	if opts.Cursor != "" {
+		c, err = listing.DecodeCursor(opts.Cursor, order)
+		if err != nil {
+			return models.PeoplePage{}, err
+		}
+		filters = append(filters, keysetCondition(order, c, args))
+	}
+
+	query := `
+	SELECT ` + _personColumns + `
+	FROM person
+	` + whereClause(filters) + `
+	ORDER BY ` + orderByClause(order, c.Backward) + `
+	LIMIT @limit
+	`
+	// One extra row tells whether there is a next page.
+	args["limit"] = pageSize + 1
+	if opts.Cursor == "" {
+		query += `OFFSET @offset`
+		args["offset"] = opts.Page * pageSize
+	}
+
+	people, err := s.queryPeople(ctx, query, args)
+	if err != nil {
+		return models.PeoplePage{}, err
+	}
+	page := listing.Paginate(order, people, pageSize, opts, c)
+	page.Total = total
+	return page, nil
+}
+
+// countPeople returns a number of people, matching given SQL conditions.
+func (s *Storage) countPeople(ctx context.Context, filters []string, args namedArgs) (int64, error) {
+	query := `
+	SELECT count(*)
+	FROM person
+	` + whereClause(filters)
+	var count int64
+	err := s.q.QueryRowContext(ctx, query, args.list()...).Scan(&count)
+	if err != nil {
+		return 0, errors.Wrap(err, "query count")
+	}
+	return count, nil
+}
+
+// whereClause returns SQL WHERE clause, joining given conditions, or nothing if there are none.
+func whereClause(filters []string) string {
+	if len(filters) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(filters, " AND ")
+}
+
+func (s *Storage) GetByID(ctx context.Context, id uuid.UUID) (models.Person, error) {
+	query := `
+	SELECT ` + _personColumns + `
+	FROM person
+	WHERE tenant_id = @tenant AND id = @id
+	`
+	return s.queryPerson(ctx, query, namedArgs{"tenant": models.TenantFromContext(ctx), "id": id})
+}
+
+func (s *Storage) DeleteByID(ctx context.Context, id uuid.UUID) error {
+	query := `
+	DELETE FROM person
+	WHERE tenant_id = @tenant AND id = @id
+	RETURNING ` + _personColumns
+	return s.transaction(ctx, func(tx *Storage) error {
+		old, err := tx.queryPerson(ctx, query, namedArgs{"tenant": models.TenantFromContext(ctx), "id": id})
+		if err != nil {
+			return err
+		}
+		err = tx.deleteNationalities(ctx, id)
+		if err != nil {
+			return err
+		}
+		err = tx.insertRevision(ctx, models.OperationDelete, id, &old, nil)
+		if err != nil {
+			return errors.Wrap(err, "insert revision")
+		}
+		return nil
+	})
+}
+
+func (s *Storage) ChangeByID(ctx context.Context, id uuid.UUID, change models.ChangeConfig) error {
+	query := `
+	UPDATE person
+	SET %s
+	WHERE tenant_id = @tenant AND id = @currentID
+	RETURNING ` + _personColumns
+	err := change.Validate()
+	if err != nil {
+		return err
+	}
+	changes := []string{}
+	if change.ID.Present() {
+		changes = append(changes, "id = @id")
+	}
+	if change.Name.Present() {
+		changes = append(changes, "name = @name")
+	}
+	if change.Surname.Present() {
+		changes = append(changes, "surname = @surname")
+	}
+	if change.Patronymic.Present() {
+		changes = append(changes, "patronymic = @patronymic")
+	}
+	if change.Age.Present() {
+		changes = append(changes, "age = @age")
+	}
+	if change.Gender.Present() {
+		changes = append(changes, "gender = @gender")
+	}
+	nationalityChanged := change.Nationality.Present() || change.Nationalities.Present()
+	if nationalityChanged {
+		changes = append(changes, "nationality = @nationality")
+	}
+	if change.Attributes.Present() {
+		changes = append(changes, "attributes = @attributes")
+	}
+	if change.Tags.Present() {
+		changes = append(changes, "tags = @tags")
+	}
+	changes = append(changes, "version = version + 1")
+	query = fmt.Sprintf(query, strings.Join(changes, ", "))
+	args := namedArgs{
+		"id":         change.ID.Get(),
+		"name":       change.Name.Get(),
+		"surname":    change.Surname.Get(),
+		"patronymic": change.Patronymic.Get(),
+		"age":        change.Age.Get(),
+		"gender":     string(change.Gender.Get()),
+		"currentID":  id,
+		"tenant":     models.TenantFromContext(ctx),
+	}
+	return s.transaction(ctx, func(tx *Storage) error {
+		// Sqlite transaction is the only writer, so the row needs no lock.
+		old, err := tx.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if change.ExpectedVersion != 0 && change.ExpectedVersion != old.Version {
+			return models.ErrVersionConflict
+		}
+		// Attributes are merged with the stored ones, and nationality depends on nationalities.
+		changed := change.Apply(old)
+		args["nationality"] = changed.Nationality
+		args["attributes"], args["tags"] = labelColumns(changed.Attributes, changed.Tags)
+		updated, err := tx.queryPerson(ctx, query, args)
+		if err != nil {
+			if isPrimaryKeyViolation(err) {
+				return errors.Wrapf(models.ErrPersonExists, "%s", change.ID.Get())
+			}
+			return errors.Wrap(err, "update person")
+		}
+		if updated.ID != id {
+			for _, table := range []string{"person_history", "person_nationality"} {
+				_, err = tx.q.ExecContext(ctx, `UPDATE `+table+` SET person_id = @newID WHERE tenant_id = @tenant AND person_id = @id`,
+					sql.Named("newID", updated.ID), sql.Named("tenant", models.TenantFromContext(ctx)), sql.Named("id", id))
+				if err != nil {
+					return errors.Wrapf(err, "move %s to new id", table)
+				}
+			}
+		}
+		// Nationalities, selected by update, are the old ones.
+		updated.Nationalities = old.Nationalities
+		if nationalityChanged {
+			err = tx.saveNationalities(ctx, updated.ID, changed.Nationalities)
+			if err != nil {
+				return err
+			}
+			updated.Nationalities = changed.Nationalities
+		}
+		err = tx.insertRevision(ctx, models.OperationUpdate, updated.ID, &old, &updated)
+		if err != nil {
+			return errors.Wrap(err, "insert revision")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,34 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"enrich-fio/internal/config"
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/enrich-fio/storage/sqlite"
+	"enrich-fio/internal/enrich-fio/storage/storagetest"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) enrichfio.Storage {
+		dbConfig := &config.DBConfig{
+			SQLitePath:      filepath.Join(t.TempDir(), "enrich-fio.db"),
+			DefaultPageSize: 5,
+			MaxPageSize:     100,
+		}
+		db, err := sql.Open("sqlite", dbConfig.SQLitePath)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		s := sqlite.New(db, dbConfig)
+		err = s.MigrateUp(context.Background())
+		if err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+		return s
+	})
+}
@@ -0,0 +1,94 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// Stats returns statistics over people, matching the filter, grouped the way query asks. The largest groups go first.
+// Empty gender and nationality and zero age are treated as unknown.
+// Returns models.ErrInvalidStatsQuery if people can't be grouped the requested way.
+func (s *Storage) Stats(ctx context.Context, filter models.FilterConfig, query models.StatsQuery) (models.Stats, error) {
+	query, err := query.WithDefaults()
+	if err != nil {
+		return models.Stats{}, err
+	}
+	filters, args, err := filterConditions(ctx, filter)
+	if err != nil {
+		return models.Stats{}, err
+	}
+	args["bucket"] = query.AgeBucketSize
+
+	// Columns go in models.StatsRow order, so grouping is by their positions.
+	columns := []string{"NULL", "NULL", "NULL"}
+	groupBy := []string{}
+	for _, group := range query.GroupBy {
+		switch group {
+		case models.StatsByGender:
+			columns[0] = "NULLIF(gender, '')"
+			groupBy = append(groupBy, "1")
+		case models.StatsByNationality:
+			columns[1] = "NULLIF(nationality, '')"
+			groupBy = append(groupBy, "2")
+		case models.StatsByAge:
+			// Both operands are integers, so division is integer too.
+			columns[2] = "NULLIF(age, 0) / @bucket * @bucket"
+			groupBy = append(groupBy, "3")
+		}
+	}
+	sql := `
+	SELECT ` + columns[0] + ` AS gender, ` + columns[1] + ` AS nationality, ` + columns[2] + ` AS age_from,
+		COUNT(*) AS count, AVG(NULLIF(age, 0)) AS average_age
+	FROM person
+	` + whereClause(filters)
+	if len(groupBy) != 0 {
+		sql += `
+	GROUP BY ` + strings.Join(groupBy, ", ")
+	}
+	// Unlike postgres, sqlite puts NULL first by default.
+	sql += `
+	ORDER BY count DESC, 1 NULLS LAST, 2 NULLS LAST, 3 NULLS LAST`
+
+	rows, err := s.q.QueryContext(ctx, sql, args.list()...)
+	if err != nil {
+		return models.Stats{}, errors.Wrap(err, "query stats")
+	}
+	defer rows.Close()
+	stats := models.Stats{
+		GroupBy: query.GroupBy,
+		Rows:    []models.StatsRow{},
+	}
+	if query.Groups(models.StatsByAge) {
+		stats.AgeBucketSize = query.AgeBucketSize
+	}
+	for rows.Next() {
+		var row models.StatsRow
+		err := rows.Scan(&row.Gender, &row.Nationality, &row.AgeFrom, &row.Count, &row.AverageAge)
+		if err != nil {
+			return models.Stats{}, errors.Wrap(err, "scan stats row")
+		}
+		if row.AgeFrom != nil {
+			ageTo := *row.AgeFrom + query.AgeBucketSize - 1
+			row.AgeTo = &ageTo
+		}
+		stats.Rows = append(stats.Rows, row)
+	}
+	return stats, errors.Wrap(rows.Err(), "read rows")
+}
+
+// CountPeople returns how many people tenant from ctx keeps.
+// Sqlite has a single writer, so transactions, counting inside of WithTx, see everything committed before them.
+func (s *Storage) CountPeople(ctx context.Context) (int64, error) {
+	var count int64
+	err := s.q.QueryRowContext(ctx, `SELECT count(*) FROM person WHERE tenant_id = @tenant`,
+		sql.Named("tenant", models.TenantFromContext(ctx))).Scan(&count)
+	if err != nil {
+		return 0, errors.Wrap(err, "count people")
+	}
+	return count, nil
+}
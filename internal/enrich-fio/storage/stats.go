@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/models"
+)
+
+// statsRow is a row of statistics query. Columns of characteristics, people weren't grouped by, are NULL.
+type statsRow struct {
+	Gender      *models.Gender
+	Nationality *string
+	AgeFrom     *int
+	Count       int64
+	AverageAge  *float64
+}
+
+// Stats returns statistics over people, matching the filter, grouped the way query asks. The largest groups go first.
+// Empty gender and nationality and zero age are treated as unknown.
+// Returns models.ErrInvalidStatsQuery if people can't be grouped the requested way.
+func (s *Storage) Stats(ctx context.Context, filter models.FilterConfig, query models.StatsQuery) (models.Stats, error) {
+	query, err := query.WithDefaults()
+	if err != nil {
+		return models.Stats{}, err
+	}
+	filters, args, err := s.filterConditions(ctx, filter)
+	if err != nil {
+		return models.Stats{}, err
+	}
+	args["bucket"] = query.AgeBucketSize
+
+	// Columns go in statsRow order, so grouping is by their positions.
+	columns := []string{"NULL::varchar", "NULL::varchar", "NULL::int"}
+	groupBy := []string{}
+	for _, group := range query.GroupBy {
+		switch group {
+		case models.StatsByGender:
+			columns[0] = "NULLIF(gender, '')"
+			groupBy = append(groupBy, "1")
+		case models.StatsByNationality:
+			columns[1] = "NULLIF(nationality, '')"
+			groupBy = append(groupBy, "2")
+		case models.StatsByAge:
+			columns[2] = "(NULLIF(age, 0) / @bucket * @bucket)::int"
+			groupBy = append(groupBy, "3")
+		}
+	}
+	sql := `
+	SELECT ` + columns[0] + ` AS gender, ` + columns[1] + ` AS nationality, ` + columns[2] + ` AS age_from,
+		COUNT(*) AS count, AVG(NULLIF(age, 0))::float8 AS average_age
+	FROM person
+	WHERE ` + strings.Join(filters, ` AND `)
+	if len(groupBy) != 0 {
+		sql += `
+	GROUP BY ` + strings.Join(groupBy, ", ")
+	}
+	sql += `
+	ORDER BY count DESC, 1, 2, 3`
+
+	rows, err := s.db.Query(ctx, sql, args)
+	if err != nil {
+		return models.Stats{}, errors.Wrap(err, "query stats")
+	}
+	found, err := pgx.CollectRows(rows, pgx.RowToStructByPos[statsRow])
+	if err != nil {
+		return models.Stats{}, errors.Wrap(err, "collect rows")
+	}
+
+	stats := models.Stats{
+		GroupBy: query.GroupBy,
+		Rows:    make([]models.StatsRow, 0, len(found)),
+	}
+	if query.Groups(models.StatsByAge) {
+		stats.AgeBucketSize = query.AgeBucketSize
+	}
+	for _, row := range found {
+		statsRow := models.StatsRow{
+			Gender:      row.Gender,
+			Nationality: row.Nationality,
+			AgeFrom:     row.AgeFrom,
+			Count:       row.Count,
+			AverageAge:  row.AverageAge,
+		}
+		if row.AgeFrom != nil {
+			ageTo := *row.AgeFrom + query.AgeBucketSize - 1
+			statsRow.AgeTo = &ageTo
+		}
+		stats.Rows = append(stats.Rows, statsRow)
+	}
+	return stats, nil
+}
@@ -5,30 +5,45 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/golang-migrate/migrate/v4"
-	migratePgx "github.com/golang-migrate/migrate/v4/database/pgx"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pkg/errors"
-	"go.uber.org/zap"
 
 	"enrich-fio/internal/config"
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/enrich-fio/storage/listing"
+	"enrich-fio/internal/fieldcrypt"
 	"enrich-fio/internal/models"
 )
 
 // Storage is storage implementation via postgresql.
 type Storage struct {
-	db     *pgxpool.Pool
+	pool *pgxpool.Pool
+	// db is the pool, or transaction, if storage is used inside of WithTx.
+	db     querier
 	config *config.DBConfig
+	// keyring encrypts FIO of people. FIO is kept in plaintext if it's nil.
+	keyring *fieldcrypt.Keyring
 }
 
-// New returns storage implemented with postgresql.
-func New(db *pgxpool.Pool, config *config.DBConfig) *Storage {
+// querier is a way to run queries, common for pool and transaction.
+type querier interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// New returns storage implemented with postgresql. FIO is encrypted with keyring, unless it's nil.
+func New(db *pgxpool.Pool, config *config.DBConfig, keyring *fieldcrypt.Keyring) *Storage {
 	return &Storage{
-		db:     db,
-		config: config,
+		pool:    db,
+		db:      db,
+		config:  config,
+		keyring: keyring,
 	}
 }
 
@@ -37,189 +52,367 @@ func (s *Storage) connect(ctx context.Context) error {
 }
 
 func (s *Storage) ping(ctx context.Context) error {
-	return s.db.Ping(ctx)
+	return s.pool.Ping(ctx)
 }
 
 func (s *Storage) close() {
-	s.db.Close()
+	s.pool.Close()
 }
 
-func (s *Storage) MigrateUp(ctx context.Context) error {
-	logger := zap.L()
-	p := &migratePgx.Postgres{}
-	driver, err := p.Open(fmt.Sprintf("postgresql://%s:%s@%s/%s", s.config.User, s.config.Password, s.config.Host, s.config.DBName))
-	if err != nil {
-		return errors.Wrap(err, "opening connection")
-	}
-	m, err := migrate.NewWithDatabaseInstance(
-		s.config.MigrationURL,
-		"pgx", driver)
-	if err != nil {
-		return errors.Wrap(err, "get migrate instance")
-	}
-	err = m.Up()
-	if err != nil {
-		if !errors.Is(err, migrate.ErrNoChange) {
-			return errors.Wrap(err, "migrate up")
-		}
-		logger.Info("no change during migration")
-		return nil
-	}
-	logger.Info("database migrated successfully")
-	return nil
+// WithTx calls fn with storage, which operations all succeed or fail together.
+// Transaction is committed if fn returns nil, and rolled back otherwise.
+// Nested WithTx rolls back only operations made inside of it.
+func (s *Storage) WithTx(ctx context.Context, fn func(tx enrichfio.Storage) error) error {
+	return pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		return fn(&Storage{
+			pool:    s.pool,
+			db:      tx,
+			config:  s.config,
+			keyring: s.keyring,
+		})
+	})
 }
 
 func (s *Storage) Save(ctx context.Context, person models.Person) error {
 	query := `
-	INSERT INTO person (id, name, surname, patronymic, gender, nationality, age)
-	VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`
-	_, err := s.db.Exec(ctx, query, person.ID, person.Name, person.Surname, person.Patronymic,
-		person.Gender, person.Nationality, person.Age)
+	INSERT INTO person (tenant_id, id, name, surname, patronymic, gender, nationality, age, attributes, tags,
+		name_bidx, surname_bidx, patronymic_bidx, key_id)
+	VALUES (@tenant, @id, @name, @surname, @patronymic, @gender, @nationality, @age, @attributes, @tags,
+		@nameIndex, @surnameIndex, @patronymicIndex, @keyID)
+	RETURNING ` + _personColumns
+	encrypted, err := s.encrypt(person)
 	if err != nil {
-		return errors.Wrap(err, "exec insert query")
+		return err
 	}
-	return nil
+	args := encryptedArgs(encrypted, pgx.NamedArgs{
+		"tenant":      models.TenantFromContext(ctx),
+		"id":          person.ID,
+		"gender":      person.Gender,
+		"nationality": person.Nationality,
+		"age":         person.Age,
+	})
+	args["attributes"], args["tags"] = labelValues(person.Attributes, person.Tags)
+	return pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, query, args)
+		if err != nil {
+			return errors.Wrap(err, "query insert")
+		}
+		saved, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.Person])
+		if err != nil {
+			if isUniqueViolation(err) {
+				return errors.Wrapf(models.ErrPersonExists, "%s", person.ID)
+			}
+			return errors.Wrap(err, "collect inserted row")
+		}
+		err = saveNationalities(ctx, tx, person.ID, person.Nationalities)
+		if err != nil {
+			return err
+		}
+		saved.Nationalities = person.Nationalities
+		err = insertRevision(ctx, tx, models.OperationCreate, person.ID, nil, &saved)
+		if err != nil {
+			return errors.Wrap(err, "insert revision")
+		}
+		return notifyChanged(ctx, tx, person.ID)
+	})
 }
 
-var _resultsPerPage = 5
+// _personColumns are columns of person table, in the order of models.Person fields.
+// Nationalities are aggregated from person_nationality table.
+var _personColumns = "id, name, surname, patronymic, age, gender, nationality, " +
+	nationalitiesColumn("person_nationality") + ", attributes, tags, version"
 
-func (s *Storage) GetWithFilter(ctx context.Context, filter models.FilterConfig, page int) ([]models.Person, error) {
-	query := `
-	SELECT *
-	FROM person
-
-	`
-	filters := []string{}
-	if filter.ID != uuid.Nil {
-		filters = append(filters, "ID = @ID")
-	}
-	if filter.Name != "" {
-		filters = append(filters, "name = @name")
+// labelValues returns values of attributes and tags columns, which are empty rather than null, if they are nil.
+func labelValues(attributes map[string]string, tags []string) (map[string]string, []string) {
+	if attributes == nil {
+		attributes = map[string]string{}
 	}
-	if filter.Surname != "" {
-		filters = append(filters, "surname = @surname")
+	if tags == nil {
+		tags = []string{}
 	}
-	if filter.Patronymic != "" {
-		filters = append(filters, "patronymic = @patronymic")
+	return attributes, tags
+}
+
+func (s *Storage) GetWithFilter(ctx context.Context, filter models.FilterConfig, opts models.ListOptions) (models.PeoplePage, error) {
+	pageSize := s.pageSize(opts.PageSize)
+	order, err := s.order(opts.Sort)
+	if err != nil {
+		return models.PeoplePage{}, err
 	}
-	if filter.Age != (models.FilterAge{}) {
-		filters = append(filters, "age BETWEEN @ageMin and @ageMax")
+	filters, args, err := s.filterConditions(ctx, filter)
+	if err != nil {
+		return models.PeoplePage{}, err
 	}
-	if filter.Gender != "" {
-		filters = append(filters, "gender = @gender")
+
+	var total *int64
+	var estimated bool
+	if opts.Total != models.TotalNone {
+		count, isEstimate, err := s.countPeople(ctx, filters, args, opts.Total)
+		if err != nil {
+			return models.PeoplePage{}, errors.Wrap(err, "count people")
+		}
+		total, estimated = &count, isEstimate
 	}
-	if filter.Nationality != "" {
-		filters = append(filters, "nationality = @nationality")
+
+	c := listing.Cursor{}
+	if opts.Cursor != "" {
+		c, err = listing.DecodeCursor(opts.Cursor, order)
+		if err != nil {
+			return models.PeoplePage{}, err
+		}
+		filters = append(filters, keysetCondition(order, c, args))
 	}
 
-	args := pgx.NamedArgs{
-		"ID":             filter.ID,
-		"name":           filter.Name,
-		"surname":        filter.Surname,
-		"patronymic":     filter.Patronymic,
-		"ageMin":         filter.Age.Min,
-		"ageMax":         filter.Age.Max,
-		"gender":         filter.Gender,
-		"nationality":    filter.Nationality,
-		"offset":         page * _resultsPerPage,
-		"resultsPerPage": _resultsPerPage,
-	}
-
-	if len(filters) != 0 {
-		query += `WHERE `
-		query += strings.Join(filters, ` AND `)
-	}
-
-	query += `
-	ORDER BY name
-	LIMIT @resultsPerPage
-	OFFSET @offset
+	query := `
+	SELECT ` + _personColumns + `
+	FROM person
+	WHERE ` + strings.Join(filters, ` AND `) + `
+	ORDER BY ` + orderByClause(order, c.Backward) + `
+	LIMIT @limit
 	`
+	// One extra row tells whether there is a next page.
+	args["limit"] = pageSize + 1
+	if opts.Cursor == "" {
+		query += `OFFSET @offset`
+		args["offset"] = opts.Page * pageSize
+	}
 
 	rows, err := s.db.Query(ctx, query, args)
 	if err != nil {
-		return nil, errors.Wrap(err, "query people")
+		return models.PeoplePage{}, errors.Wrap(err, "query people")
 	}
-	defer rows.Close()
 	people, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.Person])
 	if err != nil {
-		return []models.Person{}, errors.Wrap(err, "collect rows")
+		return models.PeoplePage{}, errors.Wrap(err, "collect rows")
+	}
+	err = s.decryptPeople(people)
+	if err != nil {
+		return models.PeoplePage{}, err
+	}
+	if people == nil {
+		people = []models.Person{}
+	}
+	page := listing.Paginate(order, people, pageSize, opts, c)
+	page.Total, page.TotalEstimated = total, estimated
+	return page, nil
+}
+
+// countPeople returns a number of people, matching given SQL conditions, and whether it is an estimate.
+func (s *Storage) countPeople(ctx context.Context, filters []string, args pgx.NamedArgs, mode models.TotalMode) (int64, bool, error) {
+	switch mode {
+	case models.TotalExact:
+	case models.TotalEstimated:
+		// People aren't filtered by anything but their tenant.
+		if len(filters) == 1 {
+			estimate, err := s.estimateTenantPeople(ctx, args)
+			if err != nil {
+				return 0, false, errors.Wrap(err, "estimate people of tenant")
+			}
+			if estimate >= int64(s.config.EstimateTotalAbove) {
+				return estimate, true, nil
+			}
+		}
+	default:
+		return 0, false, errors.Wrapf(models.ErrInvalidTotalMode, "%q", mode)
+	}
+
+	query := `
+	SELECT count(*)
+	FROM person
+	WHERE ` + strings.Join(filters, ` AND `)
+	var count int64
+	err := s.db.QueryRow(ctx, query, args).Scan(&count)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "query count")
 	}
-	return people, nil
+	return count, false, nil
+}
+
+// estimateTenantPeople returns a number of people of tenant from args, as estimated by query planner from table statistics.
+func (s *Storage) estimateTenantPeople(ctx context.Context, args pgx.NamedArgs) (int64, error) {
+	var plans []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	err := s.db.QueryRow(ctx, `EXPLAIN (FORMAT JSON) SELECT 1 FROM person WHERE tenant_id = @tenant`,
+		pgx.NamedArgs{"tenant": args["tenant"]}).Scan(&plans)
+	if err != nil {
+		return 0, errors.Wrap(err, "query plan")
+	}
+	if len(plans) == 0 {
+		return 0, errors.New("empty query plan")
+	}
+	return int64(plans[0].Plan.Rows), nil
 }
 
 func (s *Storage) GetByID(ctx context.Context, id uuid.UUID) (models.Person, error) {
 	query := `
-	SELECT * FROM person
-	WHERE ID = $1
+	SELECT ` + _personColumns + `
+	FROM person
+	WHERE tenant_id = $1 AND id = $2
 	`
-	rows, err := s.db.Query(ctx, query, id)
+	rows, err := s.db.Query(ctx, query, models.TenantFromContext(ctx), id)
 	if err != nil {
-		return models.Person{}, err
+		return models.Person{}, errors.Wrap(err, "query person")
 	}
 	person, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.Person])
-	return person, nil
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Person{}, models.ErrPersonNotFound
+		}
+		return models.Person{}, errors.Wrap(err, "collect row")
+	}
+	return s.decrypt(person)
 }
 
 func (s *Storage) DeleteByID(ctx context.Context, id uuid.UUID) error {
 	query := `
 	DELETE FROM person
-	WHERE ID = $1
-	`
-	_, err := s.db.Exec(ctx, query, id)
-	if err != nil {
-		return errors.Wrap(err, "exec delete query")
-	}
-	return nil
+	WHERE tenant_id = $1 AND id = $2
+	RETURNING ` + _personColumns
+	return pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, query, models.TenantFromContext(ctx), id)
+		if err != nil {
+			return errors.Wrap(err, "query delete")
+		}
+		old, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.Person])
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return models.ErrPersonNotFound
+			}
+			return errors.Wrap(err, "collect deleted row")
+		}
+		err = insertRevision(ctx, tx, models.OperationDelete, id, &old, nil)
+		if err != nil {
+			return errors.Wrap(err, "insert revision")
+		}
+		return notifyChanged(ctx, tx, id)
+	})
 }
 
 func (s *Storage) ChangeByID(ctx context.Context, id uuid.UUID, change models.ChangeConfig) error {
 	query := `
 	UPDATE person
 	SET %s
-	WHERE id = @currentID
-	`
+	WHERE tenant_id = @tenant AND id = @currentID
+	RETURNING ` + _personColumns
+	err := change.Validate()
+	if err != nil {
+		return err
+	}
 	changes := []string{}
-	if change.ID != uuid.Nil {
+	if change.ID.Present() {
 		changes = append(changes, "ID = @ID")
 	}
-	if change.Name != "" {
-		changes = append(changes, "name = @name")
-	}
-	if change.Surname != "" {
-		changes = append(changes, "surname = @surname")
-	}
-	if change.Patronymic != "" {
-		changes = append(changes, "patronymic = @patronymic")
+	// FIO is encrypted and indexed as a whole, so all of it is set, if any part changes.
+	fioChanged := change.Name.Present() || change.Surname.Present() || change.Patronymic.Present()
+	if fioChanged {
+		changes = append(changes, _encryptedSet)
 	}
-	if change.Age != 0 {
+	if change.Age.Present() {
 		changes = append(changes, "age = @age")
 	}
-	if change.Gender != "" {
+	if change.Gender.Present() {
 		changes = append(changes, "gender = @gender")
 	}
-	if change.Nationality != "" {
+	nationalityChanged := change.Nationality.Present() || change.Nationalities.Present()
+	if nationalityChanged {
 		changes = append(changes, "nationality = @nationality")
 	}
-
-	if len(changes) == 0 {
-		return models.ErrNoChangesMade
+	if change.Attributes.Present() {
+		changes = append(changes, "attributes = @attributes")
+	}
+	if change.Tags.Present() {
+		changes = append(changes, "tags = @tags")
 	}
+	changes = append(changes, "version = version + 1")
 	query = fmt.Sprintf(query, strings.Join(changes, ", "))
 	args := pgx.NamedArgs{
-		"ID":          change.ID,
-		"name":        change.Name,
-		"surname":     change.Surname,
-		"patronymic":  change.Patronymic,
-		"age":         change.Age,
-		"gender":      change.Gender,
-		"nationality": change.Nationality,
-		"currentID":   id,
-	}
-	_, err := s.db.Exec(ctx, query, args)
+		"ID":        change.ID.Get(),
+		"age":       change.Age.Get(),
+		"gender":    change.Gender.Get(),
+		"currentID": id,
+		"tenant":    models.TenantFromContext(ctx),
+	}
+	return pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		old, err := lockPerson(ctx, tx, id)
+		if err != nil {
+			return errors.Wrap(err, "lock person")
+		}
+		if change.ExpectedVersion != 0 && change.ExpectedVersion != old.Version {
+			return models.ErrVersionConflict
+		}
+		// Attributes are merged with the locked ones, and nationality depends on nationalities.
+		changed := change.Apply(old)
+		args["nationality"] = changed.Nationality
+		args["attributes"], args["tags"] = labelValues(changed.Attributes, changed.Tags)
+		if fioChanged {
+			decrypted, err := s.decrypt(old)
+			if err != nil {
+				return err
+			}
+			encrypted, err := s.encrypt(change.Apply(decrypted))
+			if err != nil {
+				return err
+			}
+			encryptedArgs(encrypted, args)
+		}
+		rows, err := tx.Query(ctx, query, args)
+		if err != nil {
+			return errors.Wrap(err, "query update")
+		}
+		updated, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.Person])
+		if err != nil {
+			if isUniqueViolation(err) {
+				return errors.Wrapf(models.ErrPersonExists, "%s", change.ID.Get())
+			}
+			return errors.Wrap(err, "collect updated row")
+		}
+		if updated.ID != id {
+			_, err = tx.Exec(ctx, `UPDATE person_history SET person_id = $1 WHERE tenant_id = $2 AND person_id = $3`,
+				updated.ID, models.TenantFromContext(ctx), id)
+			if err != nil {
+				return errors.Wrap(err, "move history to new id")
+			}
+		}
+		// Nationalities, selected by update, are the old ones. They follow the new ID by themselves.
+		updated.Nationalities = old.Nationalities
+		if nationalityChanged {
+			err = saveNationalities(ctx, tx, updated.ID, changed.Nationalities)
+			if err != nil {
+				return err
+			}
+			updated.Nationalities = changed.Nationalities
+		}
+		err = insertRevision(ctx, tx, models.OperationUpdate, updated.ID, &old, &updated)
+		if err != nil {
+			return errors.Wrap(err, "insert revision")
+		}
+		// Person, cached under the old ID, is stale as well.
+		return notifyChanged(ctx, tx, id, updated.ID)
+	})
+}
+
+// lockPerson returns person of tenant from ctx by given ID, locking its row until the end of transaction.
+// Returns models.ErrPersonNotFound if no such person found in the storage.
+func lockPerson(ctx context.Context, tx pgx.Tx, id uuid.UUID) (models.Person, error) {
+	query := `
+	SELECT ` + _personColumns + `
+	FROM person
+	WHERE tenant_id = $1 AND id = $2
+	FOR UPDATE
+	`
+	rows, err := tx.Query(ctx, query, models.TenantFromContext(ctx), id)
 	if err != nil {
-		return errors.Wrap(err, "exec update query")
+		return models.Person{}, errors.Wrap(err, "query person")
 	}
-	return nil
+	person, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.Person])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Person{}, models.ErrPersonNotFound
+		}
+		return models.Person{}, errors.Wrap(err, "collect row")
+	}
+	return person, nil
 }
@@ -0,0 +1,136 @@
+package storage_test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/config"
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/enrich-fio/storage"
+	"enrich-fio/internal/enrich-fio/storage/storagetest"
+	"enrich-fio/internal/fieldcrypt"
+	"enrich-fio/internal/models"
+)
+
+// TestStorage runs against database from POSTGRES_* environment variables, and empties it before every test.
+func TestStorage(t *testing.T) {
+	pool, dbConfig := connect(t)
+	storagetest.Run(t, func(t *testing.T) enrichfio.Storage {
+		truncate(t, pool)
+		return storage.New(pool, dbConfig, nil)
+	})
+}
+
+// TestEncryption checks that FIO is stored encrypted, is still matched exactly, and survives key rotation.
+func TestEncryption(t *testing.T) {
+	pool, dbConfig := connect(t)
+	truncate(t, pool)
+	ctx := context.Background()
+	old := storage.New(pool, dbConfig, keyring(t, "1", "1"))
+	person := models.Person{ID: uuid.New(), Name: "Ivan", Surname: "Ivanov", Age: 30}
+	err := old.Save(ctx, person)
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	var name, keyID string
+	err = pool.QueryRow(ctx, `SELECT name, key_id FROM person WHERE id = $1`, person.ID).Scan(&name, &keyID)
+	if err != nil {
+		t.Fatalf("query stored person: %v", err)
+	}
+	if !strings.HasPrefix(name, "enc:v1:1:") || keyID != "1" {
+		t.Fatalf("stored name %q with key %q, want encrypted with key 1", name, keyID)
+	}
+
+	// The current key changes, the old one is kept to decrypt people, that are not rotated yet.
+	s := storage.New(pool, dbConfig, keyring(t, "2", "1", "2"))
+	page, err := s.GetWithFilter(ctx, models.FilterConfig{Name: "Ivan"}, models.ListOptions{})
+	if err != nil {
+		t.Fatalf("get with filter: %v", err)
+	}
+	if len(page.People) != 1 || page.People[0].Name != "Ivan" || page.People[0].Surname != "Ivanov" {
+		t.Fatalf("filtered by name %+v, want decrypted %+v", page.People, person)
+	}
+	_, err = s.GetWithFilter(ctx, models.FilterConfig{Conditions: []models.Condition{
+		{Field: "name", Op: models.OperatorGt, Values: []string{"A"}},
+	}}, models.ListOptions{})
+	if !errors.Is(err, models.ErrInvalidFilter) {
+		t.Fatalf("ordered comparison of encrypted name: got %v, want %v", err, models.ErrInvalidFilter)
+	}
+
+	rotated, err := s.RotateKeys(ctx)
+	if err != nil {
+		t.Fatalf("rotate keys: %v", err)
+	}
+	// Person itself, its creation in history and the event about it.
+	if rotated != 3 {
+		t.Fatalf("rotated %d rows, want 3", rotated)
+	}
+	// The old key is not needed anymore.
+	s = storage.New(pool, dbConfig, keyring(t, "2", "2"))
+	got, err := s.GetByID(ctx, person.ID)
+	if err != nil {
+		t.Fatalf("get by id: %v", err)
+	}
+	if got.Name != person.Name || got.Surname != person.Surname {
+		t.Fatalf("got %+v after rotation, want %+v", got, person)
+	}
+	history, err := s.History(ctx, person.ID)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(history) != 1 || history[0].NewValue == nil || history[0].NewValue.Name != person.Name {
+		t.Fatalf("history %+v after rotation, want decrypted creation", history)
+	}
+}
+
+// connect returns pool of database from POSTGRES_* environment variables, migrated to the last version.
+func connect(t *testing.T) (*pgxpool.Pool, *config.DBConfig) {
+	dbConfig := config.NewDBConfig()
+	if dbConfig.Host == "" {
+		t.Skip("POSTGRES_HOST is not set")
+	}
+	dbConfig.DefaultPageSize, dbConfig.MaxPageSize = 5, 100
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, fmt.Sprintf("postgresql://%s:%s@%s/%s", dbConfig.User, dbConfig.Password, dbConfig.Host, dbConfig.DBName))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	err = storage.New(pool, dbConfig, nil).MigrateUp(ctx)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return pool, dbConfig
+}
+
+func truncate(t *testing.T, pool *pgxpool.Pool) {
+	_, err := pool.Exec(context.Background(), "TRUNCATE person, person_nationality, person_history, outbox, person_tombstone, import_job, import_row")
+	if err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+}
+
+// keyring returns keyring with given current key and keys with given IDs, derived from the IDs themselves.
+func keyring(t *testing.T, current string, ids ...string) *fieldcrypt.Keyring {
+	key := func(seed string) string {
+		return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(seed, 32)[:32]))
+	}
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, fmt.Sprintf("%q: %q", id, key(id)))
+	}
+	data := fmt.Sprintf(`{"current": %q, "keys": {%s}, "blindIndexKey": %q}`, current, strings.Join(keys, ", "), key("b"))
+	k, err := fieldcrypt.Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("parse keyring: %v", err)
+	}
+	return k
+}
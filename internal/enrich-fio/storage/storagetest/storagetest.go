@@ -0,0 +1,1410 @@
+// Package storagetest is a conformance test suite, every enrichfio.Storage implementation must pass.
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/filterexpr"
+	"enrich-fio/internal/models"
+)
+
+// Run runs the suite against storages, made by newStorage. Every test gets a new empty storage.
+// Storage must use default page size of 5 and max page size of at least 10.
+// Test people have capitalized ASCII names, so they are ordered the same byte-wise and by database collation.
+func Run(t *testing.T, newStorage func(t *testing.T) enrichfio.Storage) {
+	tests := map[string]func(t *testing.T, s enrichfio.Storage){
+		"SaveAndGetByID":       testSaveAndGetByID,
+		"DeleteByID":           testDeleteByID,
+		"ChangeByID":           testChangeByID,
+		"History":              testHistory,
+		"SaveBatch":            testSaveBatch,
+		"Filter":               testFilter,
+		"InvalidListing":       testInvalidListing,
+		"OffsetPagination":     testOffsetPagination,
+		"CursorPagination":     testCursorPagination,
+		"Search":               testSearch,
+		"Stats":                testStats,
+		"CountPeople":          testCountPeople,
+		"WithTx":               testWithTx,
+		"WithTxNestedRollback": testWithTxNestedRollback,
+		"Outbox":               testOutbox,
+		"LockOutbox":           testLockOutbox,
+		"Anonymize":            testAnonymize,
+		"Erase":                testErase,
+		"ExpiredPeople":        testExpiredPeople,
+		"Tenants":              testTenants,
+		"Attributes":           testAttributes,
+		"Nationalities":        testNationalities,
+		"Export":               testExport,
+		"Import":               testImport,
+		"ClaimImport":          testClaimImport,
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			test(t, newStorage(t))
+		})
+	}
+}
+
+// _people are people most tests start with, in order by name.
+var _people = []models.Person{
+	{Name: "Anna", Surname: "Ivanova", Patronymic: "Petrovna", Age: 31, Gender: models.GenderFemale, Nationality: "RU"},
+	{Name: "Boris", Surname: "Petrov", Age: 45, Gender: models.GenderMale, Nationality: "RU"},
+	{Name: "Dmitry", Surname: "Sidorov", Patronymic: "Ivanovich", Age: 62, Gender: models.GenderMale, Nationality: "KZ"},
+	{Name: "Elena", Surname: "Smirnova", Age: 28, Gender: models.GenderFemale, Nationality: "UA"},
+	{Name: "Ivan", Surname: "Kuznetsov", Patronymic: "Olegovich", Age: 37, Gender: models.GenderMale, Nationality: "RU"},
+	{Name: "Iwan", Surname: "Novak", Age: 0, Gender: "", Nationality: ""},
+	{Name: "Olga", Surname: "Popova", Age: 55, Gender: models.GenderFemale, Nationality: "KZ"},
+}
+
+// savePeople saves _people with fresh IDs and returns them as stored.
+func savePeople(t *testing.T, s enrichfio.Storage) []models.Person {
+	t.Helper()
+	saved := make([]models.Person, 0, len(_people))
+	for _, person := range _people {
+		person.ID = uuid.New()
+		err := s.Save(context.Background(), person)
+		if err != nil {
+			t.Fatalf("save %s: %v", person.Name, err)
+		}
+		person.Version = 1
+		saved = append(saved, person)
+	}
+	return saved
+}
+
+func names(people []models.Person) []string {
+	names := make([]string, 0, len(people))
+	for _, person := range people {
+		names = append(names, person.Name)
+	}
+	return names
+}
+
+func assertNames(t *testing.T, got []models.Person, want ...string) {
+	t.Helper()
+	gotNames := names(got)
+	if len(gotNames) != len(want) {
+		t.Fatalf("got people %v, want %v", gotNames, want)
+	}
+	for i := range want {
+		if gotNames[i] != want[i] {
+			t.Fatalf("got people %v, want %v", gotNames, want)
+		}
+	}
+}
+
+func assertError(t *testing.T, err error, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Fatalf("got error %v, want %v", err, want)
+	}
+}
+
+func testSaveAndGetByID(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	people := savePeople(t, s)
+	got, err := s.GetByID(ctx, people[0].ID)
+	if err != nil {
+		t.Fatalf("get by id: %v", err)
+	}
+	if !got.Equal(people[0]) {
+		t.Fatalf("got %+v, want %+v", got, people[0])
+	}
+	_, err = s.GetByID(ctx, uuid.New())
+	assertError(t, err, models.ErrPersonNotFound)
+	err = s.Save(ctx, people[0])
+	assertError(t, err, models.ErrPersonExists)
+}
+
+func testDeleteByID(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	people := savePeople(t, s)
+	err := s.DeleteByID(ctx, people[0].ID)
+	if err != nil {
+		t.Fatalf("delete by id: %v", err)
+	}
+	_, err = s.GetByID(ctx, people[0].ID)
+	assertError(t, err, models.ErrPersonNotFound)
+	err = s.DeleteByID(ctx, people[0].ID)
+	assertError(t, err, models.ErrPersonNotFound)
+}
+
+func testChangeByID(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	people := savePeople(t, s)
+	id := people[0].ID
+
+	err := s.ChangeByID(ctx, id, models.ChangeConfig{Age: models.Some(32), Nationality: models.Some("BY"), ExpectedVersion: 1})
+	if err != nil {
+		t.Fatalf("change by id: %v", err)
+	}
+	got, err := s.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("get by id: %v", err)
+	}
+	want := people[0]
+	want.Age, want.Nationality, want.Version = 32, "BY", 2
+	if !got.Equal(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	err = s.ChangeByID(ctx, id, models.ChangeConfig{Age: models.Some(33), ExpectedVersion: 1})
+	assertError(t, err, models.ErrVersionConflict)
+	err = s.ChangeByID(ctx, id, models.ChangeConfig{})
+	assertError(t, err, models.ErrNoChangesMade)
+	err = s.ChangeByID(ctx, uuid.New(), models.ChangeConfig{Age: models.Some(33)})
+	assertError(t, err, models.ErrPersonNotFound)
+	err = s.ChangeByID(ctx, id, models.ChangeConfig{ID: models.Some(people[1].ID)})
+	assertError(t, err, models.ErrPersonExists)
+
+	newID := uuid.New()
+	err = s.ChangeByID(ctx, id, models.ChangeConfig{ID: models.Some(newID)})
+	if err != nil {
+		t.Fatalf("change id: %v", err)
+	}
+	_, err = s.GetByID(ctx, id)
+	assertError(t, err, models.ErrPersonNotFound)
+	revisions, err := s.History(ctx, newID)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(revisions) != 3 {
+		t.Fatalf("got %d revisions under new id, want 3", len(revisions))
+	}
+
+	err = s.ChangeByID(ctx, newID, models.ChangeConfig{Patronymic: models.Null[string](), Age: models.Null[int]()})
+	if err != nil {
+		t.Fatalf("clear fields: %v", err)
+	}
+	got, err = s.GetByID(ctx, newID)
+	if err != nil {
+		t.Fatalf("get by id: %v", err)
+	}
+	want.ID, want.Patronymic, want.Age, want.Version = newID, "", 0, 4
+	if !got.Equal(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	err = s.ChangeByID(ctx, newID, models.ChangeConfig{Name: models.Null[string]()})
+	assertError(t, err, models.ErrInvalidChange)
+}
+
+func testHistory(t *testing.T, s enrichfio.Storage) {
+	ctx := models.WithAudit(context.Background(), models.Audit{Actor: "tester", Source: models.SourceREST})
+	person := models.Person{ID: uuid.New(), Name: "Anna", Surname: "Ivanova", Age: 31}
+	err := s.Save(ctx, person)
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	err = s.ChangeByID(ctx, person.ID, models.ChangeConfig{Age: models.Some(32)})
+	if err != nil {
+		t.Fatalf("change by id: %v", err)
+	}
+	err = s.DeleteByID(ctx, person.ID)
+	if err != nil {
+		t.Fatalf("delete by id: %v", err)
+	}
+
+	revisions, err := s.History(ctx, person.ID)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	wantOperations := []models.Operation{models.OperationCreate, models.OperationUpdate, models.OperationDelete}
+	if len(revisions) != len(wantOperations) {
+		t.Fatalf("got %d revisions, want %d", len(revisions), len(wantOperations))
+	}
+	for i, r := range revisions {
+		if r.Revision != i+1 || r.Operation != wantOperations[i] || r.Actor != "tester" || r.Source != models.SourceREST {
+			t.Fatalf("got revision %+v, want revision %d of %s by tester via rest", r, i+1, wantOperations[i])
+		}
+	}
+	if revisions[1].OldValue == nil || revisions[1].OldValue.Age != 31 || revisions[1].NewValue == nil || revisions[1].NewValue.Age != 32 {
+		t.Fatalf("got update revision %+v, want age changed from 31 to 32", revisions[1])
+	}
+	if revisions[2].NewValue != nil {
+		t.Fatalf("got delete revision with new value %+v", revisions[2].NewValue)
+	}
+
+	r, err := s.GetRevision(ctx, person.ID, 2)
+	if err != nil {
+		t.Fatalf("get revision: %v", err)
+	}
+	if r.Operation != models.OperationUpdate {
+		t.Fatalf("got revision 2 %+v, want update", r)
+	}
+	_, err = s.GetRevision(ctx, person.ID, 4)
+	assertError(t, err, models.ErrRevisionNotFound)
+
+	_, err = s.GetAsOf(ctx, person.ID, time.Now().Add(-time.Hour))
+	assertError(t, err, models.ErrPersonNotFound)
+	_, err = s.GetAsOf(ctx, person.ID, time.Now().Add(time.Hour))
+	assertError(t, err, models.ErrPersonNotFound)
+}
+
+func testSaveBatch(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	people := savePeople(t, s)
+	changed := people[0]
+	changed.Age = 99
+	first := models.Person{ID: uuid.New(), Name: "Zoe", Surname: "First"}
+	last := first
+	last.Surname = "Last"
+	err := s.SaveBatch(ctx, []models.Person{changed, first, last})
+	if err != nil {
+		t.Fatalf("save batch: %v", err)
+	}
+
+	got, err := s.GetByID(ctx, changed.ID)
+	if err != nil {
+		t.Fatalf("get overwritten: %v", err)
+	}
+	if got.Age != 99 || got.Version != 2 {
+		t.Fatalf("got overwritten %+v, want age 99 and version 2", got)
+	}
+	got, err = s.GetByID(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("get new: %v", err)
+	}
+	if got.Surname != "Last" || got.Version != 1 {
+		t.Fatalf("got new %+v, want the last of repeated people with version 1", got)
+	}
+	revisions, err := s.History(ctx, changed.ID)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(revisions) != 2 || revisions[1].Operation != models.OperationUpdate {
+		t.Fatalf("got revisions %+v, want create and update", revisions)
+	}
+	err = s.SaveBatch(ctx, nil)
+	if err != nil {
+		t.Fatalf("save empty batch: %v", err)
+	}
+}
+
+func testFilter(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	savePeople(t, s)
+	ageMin, ageMax := 30, 50
+	expr, err := filterexpr.Parse(`age > 30 and nationality in ("RU", "KZ") and not gender = "male"`)
+	if err != nil {
+		t.Fatalf("parse expression: %v", err)
+	}
+	tests := []struct {
+		name   string
+		filter models.FilterConfig
+		want   []string
+	}{
+		{"nationality", models.FilterConfig{Nationality: "RU"}, []string{"Anna", "Boris", "Ivan"}},
+		{"age range", models.FilterConfig{Age: models.FilterAge{Min: &ageMin, Max: &ageMax}}, []string{"Anna", "Boris", "Ivan"}},
+		{"open age range", models.FilterConfig{Age: models.FilterAge{Min: &ageMax}}, []string{"Dmitry", "Olga"}},
+		{"in", models.FilterConfig{Conditions: []models.Condition{
+			{Field: "nationality", Op: models.OperatorIn, Values: []string{"KZ", "UA"}},
+		}}, []string{"Dmitry", "Elena", "Olga"}},
+		{"negated", models.FilterConfig{Conditions: []models.Condition{
+			{Field: "gender", Op: models.OperatorEq, Values: []string{"male"}, Not: true},
+		}}, []string{"Anna", "Elena", "Iwan", "Olga"}},
+		{"unknown", models.FilterConfig{Conditions: []models.Condition{
+			{Field: "patronymic", Op: models.OperatorUnknown},
+			{Field: "age", Op: models.OperatorLt, Values: []string{"50"}},
+		}}, []string{"Boris", "Elena", "Iwan"}},
+		{"any of", models.FilterConfig{AnyOf: [][]models.Condition{{
+			{Field: "age", Op: models.OperatorGte, Values: []string{"60"}},
+			{Field: "nationality", Op: models.OperatorEq, Values: []string{"UA"}},
+		}}}, []string{"Dmitry", "Elena"}},
+		{"expression", models.FilterConfig{Expr: expr}, []string{"Anna", "Olga"}},
+	}
+	for _, test := range tests {
+		page, err := s.GetWithFilter(ctx, test.filter, models.ListOptions{PageSize: 10})
+		if err != nil {
+			t.Fatalf("%s: get with filter: %v", test.name, err)
+		}
+		assertNames(t, page.People, test.want...)
+	}
+
+	_, err = s.GetWithFilter(ctx, models.FilterConfig{Conditions: []models.Condition{
+		{Field: "name", Op: models.OperatorGt, Values: []string{"A"}},
+	}}, models.ListOptions{})
+	assertError(t, err, models.ErrInvalidFilter)
+}
+
+func testInvalidListing(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	savePeople(t, s)
+	_, err := s.GetWithFilter(ctx, models.FilterConfig{}, models.ListOptions{Sort: []models.SortKey{{Field: "password"}}})
+	assertError(t, err, models.ErrInvalidSortKey)
+	_, err = s.GetWithFilter(ctx, models.FilterConfig{}, models.ListOptions{Cursor: "not a cursor"})
+	assertError(t, err, models.ErrInvalidCursor)
+	_, err = s.GetWithFilter(ctx, models.FilterConfig{}, models.ListOptions{Total: "approximate"})
+	assertError(t, err, models.ErrInvalidTotalMode)
+
+	page, err := s.GetWithFilter(ctx, models.FilterConfig{}, models.ListOptions{PageSize: 2})
+	if err != nil {
+		t.Fatalf("get first page: %v", err)
+	}
+	_, err = s.GetWithFilter(ctx, models.FilterConfig{}, models.ListOptions{PageSize: 2, Cursor: page.NextCursor, Sort: models.ParseSort("-age")})
+	assertError(t, err, models.ErrInvalidCursor)
+
+	// Cursors, edited by hand, must have values of the types of their columns.
+	forged := map[string][]string{
+		"age":  {`{"o":"age","v":["old"]}`, `{"o":"age","v":[30.5]}`, `{"o":"age","v":[null]}`},
+		"name": {`{"o":"name","v":[1]}`, `{"o":"name","v":[["Anna"]]}`},
+	}
+	for sort, cursors := range forged {
+		for _, cursor := range cursors {
+			_, err = s.GetWithFilter(ctx, models.FilterConfig{}, models.ListOptions{
+				Cursor: base64.RawURLEncoding.EncodeToString([]byte(cursor)),
+				Sort:   models.ParseSort(sort),
+			})
+			assertError(t, err, models.ErrInvalidCursor)
+		}
+	}
+}
+
+func testOffsetPagination(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	savePeople(t, s)
+	page, err := s.GetWithFilter(ctx, models.FilterConfig{}, models.ListOptions{Total: models.TotalExact})
+	if err != nil {
+		t.Fatalf("get first page: %v", err)
+	}
+	assertNames(t, page.People, "Anna", "Boris", "Dmitry", "Elena", "Ivan")
+	if !page.HasMore || page.PageSize != 5 || page.Page == nil || *page.Page != 0 || page.Total == nil || *page.Total != 7 {
+		t.Fatalf("got first page %+v, want default page size 5, more people and total 7", page)
+	}
+
+	page, err = s.GetWithFilter(ctx, models.FilterConfig{}, models.ListOptions{Page: 1, PageSize: 3, Sort: models.ParseSort("-age")})
+	if err != nil {
+		t.Fatalf("get second page: %v", err)
+	}
+	assertNames(t, page.People, "Ivan", "Anna", "Elena")
+	if !page.HasMore || page.Total != nil {
+		t.Fatalf("got second page %+v, want more people and no total", page)
+	}
+}
+
+func testCursorPagination(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	savePeople(t, s)
+	opts := models.ListOptions{PageSize: 3, Sort: models.ParseSort("nationality,-age")}
+	want := [][]string{{"Iwan", "Dmitry", "Olga"}, {"Boris", "Ivan", "Anna"}, {"Elena"}}
+
+	pages := []models.PeoplePage{}
+	for i := range want {
+		page, err := s.GetWithFilter(ctx, models.FilterConfig{}, opts)
+		if err != nil {
+			t.Fatalf("get page %d: %v", i, err)
+		}
+		assertNames(t, page.People, want[i]...)
+		pages = append(pages, page)
+		opts.Cursor = page.NextCursor
+	}
+	if pages[2].HasMore || pages[2].NextCursor != "" {
+		t.Fatalf("got last page %+v, want no more people", pages[2])
+	}
+
+	opts.Cursor = pages[2].PrevCursor
+	page, err := s.GetWithFilter(ctx, models.FilterConfig{}, opts)
+	if err != nil {
+		t.Fatalf("get page backward: %v", err)
+	}
+	assertNames(t, page.People, want[1]...)
+	if !page.HasMore || page.PrevCursor == "" {
+		t.Fatalf("got page backward %+v, want people on both sides", page)
+	}
+}
+
+func testSearch(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	savePeople(t, s)
+	page, err := s.Search(ctx, models.SearchQuery{Text: "Ivan", Fields: []string{"name"}}, models.FilterConfig{}, models.ListOptions{})
+	if err != nil {
+		t.Fatalf("search similar: %v", err)
+	}
+	if len(page.Results) != 2 || page.Results[0].Person.Name != "Ivan" || page.Results[1].Person.Name != "Iwan" {
+		t.Fatalf("got results %+v, want Ivan and then Iwan", page.Results)
+	}
+	if page.Results[0].Score != 1 {
+		t.Fatalf("got exact match score %v, want 1", page.Results[0].Score)
+	}
+
+	page, err = s.Search(ctx, models.SearchQuery{Text: "iva", Mode: models.SearchPrefix}, models.FilterConfig{Gender: models.GenderMale}, models.ListOptions{})
+	if err != nil {
+		t.Fatalf("search prefix: %v", err)
+	}
+	got := []models.Person{}
+	for _, result := range page.Results {
+		got = append(got, result.Person)
+	}
+	// Dmitry's patronymic starts with "Ivan" too, but Ivan's name matches better.
+	assertNames(t, got, "Ivan", "Dmitry")
+
+	_, err = s.Search(ctx, models.SearchQuery{Text: " "}, models.FilterConfig{}, models.ListOptions{})
+	assertError(t, err, models.ErrInvalidSearchQuery)
+}
+
+func testStats(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	savePeople(t, s)
+	stats, err := s.Stats(ctx, models.FilterConfig{}, models.StatsQuery{GroupBy: []models.StatsGroup{models.StatsByNationality}})
+	if err != nil {
+		t.Fatalf("stats by nationality: %v", err)
+	}
+	wantNationalities := []string{"RU", "KZ", "UA", ""}
+	wantCounts := []int64{3, 2, 1, 1}
+	if len(stats.Rows) != len(wantCounts) {
+		t.Fatalf("got rows %+v, want %d rows", stats.Rows, len(wantCounts))
+	}
+	for i, row := range stats.Rows {
+		nationality := ""
+		if row.Nationality != nil {
+			nationality = *row.Nationality
+		}
+		if nationality != wantNationalities[i] || row.Count != wantCounts[i] || row.Gender != nil {
+			t.Fatalf("got row %d %+v, want %d people of %q", i, row, wantCounts[i], wantNationalities[i])
+		}
+	}
+	if stats.Rows[0].AverageAge == nil || *stats.Rows[0].AverageAge != 113.0/3 {
+		t.Fatalf("got average age %v of RU, want %v", stats.Rows[0].AverageAge, 113.0/3)
+	}
+	if stats.Rows[3].AverageAge != nil {
+		t.Fatalf("got average age %v of people with unknown age", *stats.Rows[3].AverageAge)
+	}
+
+	stats, err = s.Stats(ctx, models.FilterConfig{Gender: models.GenderFemale}, models.StatsQuery{
+		GroupBy:       []models.StatsGroup{models.StatsByAge},
+		AgeBucketSize: 20,
+	})
+	if err != nil {
+		t.Fatalf("stats by age: %v", err)
+	}
+	if len(stats.Rows) != 2 || stats.Rows[0].Count != 2 || *stats.Rows[0].AgeFrom != 20 || *stats.Rows[0].AgeTo != 39 || *stats.Rows[1].AgeFrom != 40 {
+		t.Fatalf("got rows %+v, want 2 women of 20-39 and 1 of 40-59", stats.Rows)
+	}
+
+	_, err = s.Stats(ctx, models.FilterConfig{}, models.StatsQuery{GroupBy: []models.StatsGroup{"height"}})
+	assertError(t, err, models.ErrInvalidStatsQuery)
+}
+
+func testCountPeople(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	savePeople(t, s)
+	count, err := s.CountPeople(ctx)
+	if err != nil || count != int64(len(_people)) {
+		t.Fatalf("got %d people and error %v, want %d", count, err, len(_people))
+	}
+	count, err = s.CountPeople(models.WithTenant(ctx, "acme"))
+	if err != nil || count != 0 {
+		t.Fatalf("got %d people of another tenant and error %v, want none", count, err)
+	}
+	// Inside of transaction people, saved by it, are counted too.
+	err = s.WithTx(ctx, func(tx enrichfio.Storage) error {
+		err := tx.Save(ctx, models.Person{ID: uuid.New(), Name: "Pavel", Surname: "Orlov"})
+		if err != nil {
+			return err
+		}
+		count, err = tx.CountPeople(ctx)
+		return err
+	})
+	if err != nil || count != int64(len(_people))+1 {
+		t.Fatalf("got %d people and error %v in transaction, want %d", count, err, len(_people)+1)
+	}
+}
+
+func testWithTx(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	people := savePeople(t, s)
+	rollback := errors.New("rollback")
+	err := s.WithTx(ctx, func(tx enrichfio.Storage) error {
+		err := tx.ChangeByID(ctx, people[0].ID, models.ChangeConfig{Age: models.Some(99)})
+		if err != nil {
+			return err
+		}
+		err = tx.DeleteByID(ctx, people[1].ID)
+		if err != nil {
+			return err
+		}
+		person, err := tx.GetByID(ctx, people[0].ID)
+		if err != nil {
+			return err
+		}
+		if person.Age != 99 {
+			t.Errorf("got age %d inside of transaction, want 99", person.Age)
+		}
+		return rollback
+	})
+	assertError(t, err, rollback)
+	person, err := s.GetByID(ctx, people[0].ID)
+	if err != nil {
+		t.Fatalf("get changed person: %v", err)
+	}
+	if person.Age != people[0].Age {
+		t.Fatalf("got age %d after rollback, want %d", person.Age, people[0].Age)
+	}
+	_, err = s.GetByID(ctx, people[1].ID)
+	if err != nil {
+		t.Fatalf("get deleted person after rollback: %v", err)
+	}
+
+	err = s.WithTx(ctx, func(tx enrichfio.Storage) error {
+		return tx.ChangeByID(ctx, people[0].ID, models.ChangeConfig{Age: models.Some(99)})
+	})
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	person, err = s.GetByID(ctx, people[0].ID)
+	if err != nil {
+		t.Fatalf("get changed person: %v", err)
+	}
+	if person.Age != 99 {
+		t.Fatalf("got age %d after commit, want 99", person.Age)
+	}
+}
+
+func testWithTxNestedRollback(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	people := savePeople(t, s)
+	rollback := errors.New("rollback")
+	err := s.WithTx(ctx, func(tx enrichfio.Storage) error {
+		err := tx.ChangeByID(ctx, people[0].ID, models.ChangeConfig{Age: models.Some(98)})
+		if err != nil {
+			return err
+		}
+		err = tx.WithTx(ctx, func(tx enrichfio.Storage) error {
+			err := tx.ChangeByID(ctx, people[1].ID, models.ChangeConfig{Age: models.Some(99)})
+			if err != nil {
+				return err
+			}
+			return rollback
+		})
+		if !errors.Is(err, rollback) {
+			t.Errorf("got nested error %v, want %v", err, rollback)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	committed, err := s.GetByID(ctx, people[0].ID)
+	if err != nil {
+		t.Fatalf("get person, changed by outer transaction: %v", err)
+	}
+	rolledBack, err := s.GetByID(ctx, people[1].ID)
+	if err != nil {
+		t.Fatalf("get person, changed by nested transaction: %v", err)
+	}
+	if committed.Age != 98 || rolledBack.Age != people[1].Age {
+		t.Fatalf("got ages %d and %d, want 98 and %d", committed.Age, rolledBack.Age, people[1].Age)
+	}
+}
+
+func testOutbox(t *testing.T, s enrichfio.Storage) {
+	ctx := models.WithAudit(context.Background(), models.Audit{Actor: "tester", Source: models.SourceKafka})
+	person := models.Person{ID: uuid.New(), Name: "Anna", Surname: "Ivanova", Patronymic: "Petrovna", Age: 31}
+	err := s.Save(ctx, person)
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	err = s.ChangeByID(ctx, person.ID, models.ChangeConfig{Age: models.Some(32), Patronymic: models.Null[string]()})
+	if err != nil {
+		t.Fatalf("change by id: %v", err)
+	}
+	rollback := errors.New("rollback")
+	err = s.WithTx(ctx, func(tx enrichfio.Storage) error {
+		err := tx.ChangeByID(ctx, person.ID, models.ChangeConfig{Age: models.Some(50)})
+		if err != nil {
+			return err
+		}
+		return rollback
+	})
+	assertError(t, err, rollback)
+	err = s.DeleteByID(ctx, person.ID)
+	if err != nil {
+		t.Fatalf("delete by id: %v", err)
+	}
+	other := models.Person{ID: uuid.New(), Name: "Boris", Surname: "Petrov"}
+	err = s.SaveBatch(ctx, []models.Person{other})
+	if err != nil {
+		t.Fatalf("save batch: %v", err)
+	}
+
+	events, err := s.PendingEvents(ctx, 10)
+	if err != nil {
+		t.Fatalf("pending events: %v", err)
+	}
+	wantTypes := []models.EventType{models.EventPersonCreated, models.EventPersonUpdated, models.EventPersonDeleted, models.EventPersonCreated}
+	if len(events) != len(wantTypes) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(wantTypes), events)
+	}
+	for i, event := range events {
+		if event.Type != wantTypes[i] {
+			t.Fatalf("got event %d of type %s, want %s", i, event.Type, wantTypes[i])
+		}
+		if i > 0 && event.ID <= events[i-1].ID {
+			t.Fatalf("got event IDs %d and %d, want them growing", events[i-1].ID, event.ID)
+		}
+		if event.Actor != "tester" || event.Source != models.SourceKafka {
+			t.Fatalf("got event %d by %q from %q, want tester from kafka", i, event.Actor, event.Source)
+		}
+	}
+	if events[2].PersonID != person.ID || events[2].Revision.Revision != 3 || events[3].PersonID != other.ID {
+		t.Fatalf("got events %+v, want 3 revisions of the first person and then the second one", events)
+	}
+	wantDiff := map[string]models.FieldChange{
+		"age":        {Old: 31, New: 32},
+		"patronymic": {Old: "Petrovna", New: ""},
+	}
+	diff := events[1].Diff
+	if len(diff) != len(wantDiff) || diff["age"] != wantDiff["age"] || diff["patronymic"] != wantDiff["patronymic"] {
+		t.Fatalf("got diff %+v, want %+v", diff, wantDiff)
+	}
+
+	first, err := s.PendingEvents(ctx, 2)
+	if err != nil {
+		t.Fatalf("pending events: %v", err)
+	}
+	if len(first) != 2 || first[0].ID != events[0].ID || first[1].ID != events[1].ID {
+		t.Fatalf("got %+v, want the first 2 events", first)
+	}
+	err = s.MarkDelivered(ctx, []int64{first[0].ID, first[1].ID})
+	if err != nil {
+		t.Fatalf("mark delivered: %v", err)
+	}
+	pending, err := s.PendingEvents(ctx, 10)
+	if err != nil {
+		t.Fatalf("pending events: %v", err)
+	}
+	if len(pending) != 2 || pending[0].ID != events[2].ID {
+		t.Fatalf("got pending %+v, want the last 2 events", pending)
+	}
+
+	deleted, err := s.DeleteDelivered(ctx, time.Now().Add(-time.Hour))
+	if err != nil || deleted != 0 {
+		t.Fatalf("got %d deleted events and error %v, recently delivered events must be kept", deleted, err)
+	}
+	deleted, err = s.DeleteDelivered(ctx, time.Now().Add(time.Minute))
+	if err != nil || deleted != 2 {
+		t.Fatalf("got %d deleted events and error %v, want 2 delivered events deleted", deleted, err)
+	}
+	pending, err = s.PendingEvents(ctx, 10)
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("got %d pending events and error %v, pending events must not be deleted", len(pending), err)
+	}
+}
+
+func testLockOutbox(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	people := savePeople(t, s)
+	var events []models.Event
+	err := s.LockOutbox(ctx, func(outbox enrichfio.Outbox) error {
+		var err error
+		events, err = outbox.PendingEvents(ctx, len(people))
+		if err != nil {
+			return err
+		}
+		return outbox.MarkDelivered(ctx, []int64{events[0].ID})
+	})
+	if err != nil {
+		t.Fatalf("lock outbox: %v", err)
+	}
+	if len(events) != len(people) {
+		t.Fatalf("got %d events, want %d", len(events), len(people))
+	}
+	pending, err := s.PendingEvents(ctx, len(people))
+	if err != nil {
+		t.Fatalf("pending events: %v", err)
+	}
+	if len(pending) != len(people)-1 || pending[0].ID != events[1].ID {
+		t.Fatalf("got pending %+v, want all events but the first one", pending)
+	}
+
+	failed := errors.New("failed")
+	err = s.LockOutbox(ctx, func(outbox enrichfio.Outbox) error {
+		return failed
+	})
+	assertError(t, err, failed)
+}
+
+func testAnonymize(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	people := savePeople(t, s)
+	person := people[0]
+	err := s.ChangeByID(ctx, person.ID, models.ChangeConfig{Age: models.Some(32)})
+	if err != nil {
+		t.Fatalf("change by id: %v", err)
+	}
+
+	anonymized := person
+	anonymized.Name, anonymized.Surname, anonymized.Patronymic = "anon-1", "anon-2", "anon-3"
+	anonymized.Age = 32
+	err = s.Anonymize(ctx, anonymized)
+	if err != nil {
+		t.Fatalf("anonymize: %v", err)
+	}
+	got, err := s.GetByID(ctx, person.ID)
+	if err != nil {
+		t.Fatalf("get by id: %v", err)
+	}
+	anonymized.Version = 3
+	if !got.Equal(anonymized) {
+		t.Fatalf("got %+v, want %+v", got, anonymized)
+	}
+	revisions, err := s.History(ctx, person.ID)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(revisions) != 1 || revisions[0].Operation != models.OperationAnonymize || revisions[0].OldValue != nil ||
+		revisions[0].NewValue == nil || !revisions[0].NewValue.Equal(anonymized) {
+		t.Fatalf("got history %+v, want the only anonymized revision", revisions)
+	}
+	events, err := s.PendingEvents(ctx, 100)
+	if err != nil {
+		t.Fatalf("pending events: %v", err)
+	}
+	for _, event := range events {
+		if event.PersonID == person.ID && event.Type != models.EventPersonAnonymized {
+			t.Fatalf("got event %+v, want events before anonymization forgotten", event)
+		}
+	}
+	if len(events) != len(people) {
+		t.Fatalf("got %d events, want %d", len(events), len(people))
+	}
+
+	err = s.Anonymize(ctx, models.Person{ID: uuid.New(), Name: "anon-1", Surname: "anon-2"})
+	assertError(t, err, models.ErrPersonNotFound)
+}
+
+func testErase(t *testing.T, s enrichfio.Storage) {
+	ctx := models.WithAudit(context.Background(), models.Audit{Actor: "dpo", Source: models.SourceCLI})
+	people := savePeople(t, s)
+	person := people[0]
+	err := s.ChangeByID(ctx, person.ID, models.ChangeConfig{Age: models.Some(32)})
+	if err != nil {
+		t.Fatalf("change by id: %v", err)
+	}
+
+	tombstone, err := s.Erase(ctx, person.ID)
+	if err != nil {
+		t.Fatalf("erase: %v", err)
+	}
+	if tombstone.PersonID != person.ID || tombstone.Actor != "dpo" || tombstone.Source != models.SourceCLI || tombstone.ErasedAt.IsZero() {
+		t.Fatalf("got tombstone %+v, want tombstone of %s by dpo from cli", tombstone, person.ID)
+	}
+	_, err = s.GetByID(ctx, person.ID)
+	assertError(t, err, models.ErrPersonNotFound)
+	revisions, err := s.History(ctx, person.ID)
+	if err != nil || len(revisions) != 0 {
+		t.Fatalf("got history %+v and error %v, want history erased", revisions, err)
+	}
+	events, err := s.PendingEvents(ctx, 100)
+	if err != nil {
+		t.Fatalf("pending events: %v", err)
+	}
+	last := events[len(events)-1]
+	if len(events) != len(people) || last.PersonID != person.ID || last.Type != models.EventPersonErased ||
+		last.OldValue != nil || last.NewValue != nil {
+		t.Fatalf("got events %+v, want events of the erased person replaced with the erase one", events)
+	}
+
+	again, err := s.Erase(context.Background(), person.ID)
+	if err != nil {
+		t.Fatalf("erase again: %v", err)
+	}
+	if again.PersonID != tombstone.PersonID || again.Actor != tombstone.Actor || !again.ErasedAt.Equal(tombstone.ErasedAt) {
+		t.Fatalf("got tombstone %+v, want the first one %+v", again, tombstone)
+	}
+
+	// Deleted person is still known by its history.
+	err = s.DeleteByID(ctx, people[1].ID)
+	if err != nil {
+		t.Fatalf("delete by id: %v", err)
+	}
+	_, err = s.Erase(ctx, people[1].ID)
+	if err != nil {
+		t.Fatalf("erase deleted: %v", err)
+	}
+	_, err = s.Erase(ctx, uuid.New())
+	assertError(t, err, models.ErrPersonNotFound)
+}
+
+func testExpiredPeople(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	people := savePeople(t, s)
+	expired := func(query models.ExpiredQuery) []uuid.UUID {
+		t.Helper()
+		ids, err := s.ExpiredPeople(ctx, query)
+		if err != nil {
+			t.Fatalf("expired people: %v", err)
+		}
+		return ids
+	}
+
+	ids := expired(models.ExpiredQuery{AddedBefore: time.Now().Add(-time.Hour), Limit: 100})
+	if len(ids) != 0 {
+		t.Fatalf("got %v, people added just now must not be expired", ids)
+	}
+
+	gender := models.FilterConfig{Gender: models.GenderFemale}
+	ids = expired(models.ExpiredQuery{Filter: gender, AddedBefore: time.Now().Add(time.Minute), Limit: 100})
+	if len(ids) != 3 {
+		t.Fatalf("got %v, want 3 women", ids)
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i].String() <= ids[i-1].String() {
+			t.Fatalf("got %v, want IDs in order", ids)
+		}
+	}
+	next := expired(models.ExpiredQuery{Filter: gender, AddedBefore: time.Now().Add(time.Minute), After: ids[0], Limit: 1})
+	if len(next) != 1 || next[0] != ids[1] {
+		t.Fatalf("got %v after %s, want %s", next, ids[0], ids[1])
+	}
+
+	var woman models.Person
+	for _, person := range people {
+		if person.ID == ids[0] {
+			woman = person
+		}
+	}
+	// Anonymizing forgets history, but not the moment person was added at.
+	addedBefore := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	woman.Name, woman.Surname, woman.Patronymic = "anon-1", "anon-2", ""
+	err := s.Anonymize(ctx, woman)
+	if err != nil {
+		t.Fatalf("anonymize: %v", err)
+	}
+	left := expired(models.ExpiredQuery{Action: models.RetentionAnonymize, Filter: gender, AddedBefore: addedBefore, Limit: 100})
+	if len(left) != 2 || left[0] != ids[1] {
+		t.Fatalf("got %v, anonymized people must be skipped by anonymize rules", left)
+	}
+	left = expired(models.ExpiredQuery{Action: models.RetentionErase, Filter: gender, AddedBefore: addedBefore, Limit: 100})
+	if len(left) != 3 || left[0] != ids[0] {
+		t.Fatalf("got %v, anonymized people must be expired by erase rules as added before anonymizing", left)
+	}
+}
+
+func testTenants(t *testing.T, s enrichfio.Storage) {
+	acme := models.WithTenant(context.Background(), "acme")
+	globex := models.WithTenant(context.Background(), "globex")
+	// People of the default tenant aren't seen by others either.
+	savePeople(t, s)
+
+	// Tenants may use the same ID for different people.
+	id := uuid.New()
+	anna := models.Person{ID: id, Name: "Anna", Surname: "Ivanova", Age: 31, Gender: models.GenderFemale}
+	boris := models.Person{ID: id, Name: "Boris", Surname: "Petrov", Age: 45, Gender: models.GenderMale}
+	err := s.Save(acme, anna)
+	if err != nil {
+		t.Fatalf("save to acme: %v", err)
+	}
+	err = s.Save(globex, boris)
+	if err != nil {
+		t.Fatalf("save to globex: %v", err)
+	}
+	got, err := s.GetByID(acme, id)
+	if err != nil || got.Name != "Anna" {
+		t.Fatalf("got %+v and error %v from acme, want Anna", got, err)
+	}
+	got, err = s.GetByID(globex, id)
+	if err != nil || got.Name != "Boris" {
+		t.Fatalf("got %+v and error %v from globex, want Boris", got, err)
+	}
+
+	page, err := s.GetWithFilter(acme, models.FilterConfig{}, models.ListOptions{Total: models.TotalExact})
+	if err != nil {
+		t.Fatalf("get with filter: %v", err)
+	}
+	assertNames(t, page.People, "Anna")
+	if page.Total == nil || *page.Total != 1 {
+		t.Fatalf("got total %v, want 1 person of acme", page.Total)
+	}
+	stats, err := s.Stats(globex, models.FilterConfig{}, models.StatsQuery{})
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if len(stats.Rows) != 1 || stats.Rows[0].Count != 1 {
+		t.Fatalf("got stats %+v, want 1 person of globex", stats)
+	}
+
+	// Batch overwrites people of its own tenant only.
+	err = s.SaveBatch(acme, []models.Person{{ID: id, Name: "Anna", Surname: "Petrova", Age: 32}})
+	if err != nil {
+		t.Fatalf("save batch: %v", err)
+	}
+	got, err = s.GetByID(globex, id)
+	if err != nil || !got.Equal(models.Person{ID: id, Name: "Boris", Surname: "Petrov", Age: 45, Gender: models.GenderMale, Version: 1}) {
+		t.Fatalf("got %+v and error %v from globex, batch of acme must not change it", got, err)
+	}
+	revisions, err := s.History(acme, id)
+	if err != nil || len(revisions) != 2 {
+		t.Fatalf("got history %+v and error %v of acme, want 2 revisions", revisions, err)
+	}
+	revisions, err = s.History(globex, id)
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("got history %+v and error %v of globex, want 1 revision", revisions, err)
+	}
+
+	err = s.ChangeByID(globex, uuid.New(), models.ChangeConfig{Age: models.Some(1)})
+	assertError(t, err, models.ErrPersonNotFound)
+	_, err = s.Erase(acme, id)
+	if err != nil {
+		t.Fatalf("erase from acme: %v", err)
+	}
+	_, err = s.GetByID(acme, id)
+	assertError(t, err, models.ErrPersonNotFound)
+	_, err = s.GetByID(globex, id)
+	if err != nil {
+		t.Fatalf("get from globex after erase from acme: %v", err)
+	}
+	err = s.DeleteByID(acme, id)
+	assertError(t, err, models.ErrPersonNotFound)
+
+	events, err := s.PendingEvents(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("pending events: %v", err)
+	}
+	tenants := map[string]int{}
+	for _, event := range events {
+		tenants[event.Tenant]++
+	}
+	// The default tenant created its people, globex created Boris, and acme erased Anna, which replaced her events.
+	if len(tenants) != 3 || tenants[models.DefaultTenant] != len(_people) || tenants["globex"] != 1 || tenants["acme"] != 1 {
+		t.Fatalf("got events by tenants %v, want events of every tenant", tenants)
+	}
+}
+
+func testAttributes(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	people := []models.Person{
+		{ID: uuid.New(), Name: "Anna", Surname: "Ivanova", Attributes: map[string]string{"source": "crm", "region": "north"}, Tags: []string{"vip", "new"}},
+		{ID: uuid.New(), Name: "Boris", Surname: "Petrov", Attributes: map[string]string{"source": "web"}, Tags: []string{"vip"}},
+		{ID: uuid.New(), Name: "Dmitry", Surname: "Sidorov"},
+	}
+	for i, person := range people {
+		err := s.Save(ctx, person)
+		if err != nil {
+			t.Fatalf("save %s: %v", person.Name, err)
+		}
+		people[i].Version = 1
+	}
+	got, err := s.GetByID(ctx, people[0].ID)
+	if err != nil || !got.Equal(people[0]) {
+		t.Fatalf("got %+v and error %v, want %+v", got, err, people[0])
+	}
+
+	tests := []struct {
+		name   string
+		filter models.FilterConfig
+		want   []string
+	}{
+		{"tag", models.FilterConfig{Tags: []string{"vip"}}, []string{"Anna", "Boris"}},
+		{"all tags", models.FilterConfig{Tags: []string{"vip", "new"}}, []string{"Anna"}},
+		{"attribute", models.FilterConfig{Attributes: map[string]string{"source": "crm"}}, []string{"Anna"}},
+		{"attributes and tag", models.FilterConfig{Attributes: map[string]string{"source": "web"}, Tags: []string{"vip"}}, []string{"Boris"}},
+		{"missing attribute", models.FilterConfig{Attributes: map[string]string{"region": "south"}}, []string{}},
+	}
+	for _, test := range tests {
+		page, err := s.GetWithFilter(ctx, test.filter, models.ListOptions{PageSize: 10})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		assertNames(t, page.People, test.want...)
+	}
+
+	// Attributes are merged, and tags are replaced.
+	erp := "erp"
+	err = s.ChangeByID(ctx, people[0].ID, models.ChangeConfig{
+		Attributes: models.Some(map[string]*string{"source": &erp, "region": nil}),
+		Tags:       models.Some([]string{"churned"}),
+	})
+	if err != nil {
+		t.Fatalf("change: %v", err)
+	}
+	got, err = s.GetByID(ctx, people[0].ID)
+	want := people[0]
+	want.Attributes, want.Tags, want.Version = map[string]string{"source": "erp"}, []string{"churned"}, 2
+	if err != nil || !got.Equal(want) {
+		t.Fatalf("got %+v and error %v after change, want %+v", got, err, want)
+	}
+	err = s.ChangeByID(ctx, people[1].ID, models.ChangeConfig{Attributes: models.Null[map[string]*string](), Tags: models.Null[[]string]()})
+	if err != nil {
+		t.Fatalf("clear: %v", err)
+	}
+	got, err = s.GetByID(ctx, people[1].ID)
+	if err != nil || len(got.Attributes) != 0 || len(got.Tags) != 0 {
+		t.Fatalf("got %+v and error %v after clearing, want no attributes and tags", got, err)
+	}
+	err = s.ChangeByID(ctx, people[2].ID, models.ChangeConfig{Tags: models.Some([]string{"vip", "vip"})})
+	assertError(t, err, models.ErrInvalidChange)
+
+	// Batch overwrites attributes and tags too.
+	err = s.SaveBatch(ctx, []models.Person{{ID: people[2].ID, Name: "Dmitry", Surname: "Sidorov", Tags: []string{"vip"}}})
+	if err != nil {
+		t.Fatalf("save batch: %v", err)
+	}
+	page, err := s.GetWithFilter(ctx, models.FilterConfig{Tags: []string{"vip"}}, models.ListOptions{PageSize: 10})
+	if err != nil {
+		t.Fatalf("filter after batch: %v", err)
+	}
+	assertNames(t, page.People, "Dmitry")
+}
+
+func testNationalities(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	people := []models.Person{
+		{ID: uuid.New(), Name: "Anna", Surname: "Ivanova", Nationality: "KZ", Nationalities: []models.Nationality{
+			{Country: "KZ", Probability: 0.5}, {Country: "RU", Probability: 0.25},
+		}},
+		{ID: uuid.New(), Name: "Boris", Surname: "Petrov", Nationality: "RU"},
+		{ID: uuid.New(), Name: "Dmitry", Surname: "Sidorov", Nationality: "UA", Nationalities: []models.Nationality{
+			{Country: "UA", Probability: 0.75},
+		}},
+	}
+	for i, person := range people {
+		err := s.Save(ctx, person)
+		if err != nil {
+			t.Fatalf("save %s: %v", person.Name, err)
+		}
+		people[i].Version = 1
+	}
+	got, err := s.GetByID(ctx, people[0].ID)
+	if err != nil || !got.Equal(people[0]) {
+		t.Fatalf("got %+v and error %v, want %+v", got, err, people[0])
+	}
+
+	tests := []struct {
+		name   string
+		filter models.FilterConfig
+		want   []string
+	}{
+		{"primary by default", models.FilterConfig{Nationality: "RU"}, []string{"Boris"}},
+		{"primary", models.FilterConfig{Nationality: "KZ", NationalityMatch: models.NationalityPrimary}, []string{"Anna"}},
+		// Nationality, set without probabilities, matches too.
+		{"any", models.FilterConfig{Nationality: "RU", NationalityMatch: models.NationalityAny}, []string{"Anna", "Boris"}},
+	}
+	for _, test := range tests {
+		page, err := s.GetWithFilter(ctx, test.filter, models.ListOptions{PageSize: 10})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		assertNames(t, page.People, test.want...)
+	}
+	_, err = s.GetWithFilter(ctx, models.FilterConfig{Nationality: "RU", NationalityMatch: "some"}, models.ListOptions{})
+	assertError(t, err, models.ErrInvalidFilter)
+
+	// The first of changed nationalities becomes nationality, and they follow the changed ID.
+	newID := uuid.New()
+	nationalities := []models.Nationality{{Country: "BY", Probability: 0.5}, {Country: "RU", Probability: 0.5}}
+	err = s.ChangeByID(ctx, people[1].ID, models.ChangeConfig{ID: models.Some(newID), Nationalities: models.Some(nationalities)})
+	if err != nil {
+		t.Fatalf("change nationalities: %v", err)
+	}
+	got, err = s.GetByID(ctx, newID)
+	want := people[1]
+	want.ID, want.Nationality, want.Nationalities, want.Version = newID, "BY", nationalities, 2
+	if err != nil || !got.Equal(want) {
+		t.Fatalf("got %+v and error %v after changing nationalities, want %+v", got, err, want)
+	}
+	err = s.ChangeByID(ctx, newID, models.ChangeConfig{Nationality: models.Some("RU"), Nationalities: models.Some(nationalities)})
+	assertError(t, err, models.ErrInvalidChange)
+
+	// Nationality, changed on its own, has no probabilities.
+	err = s.ChangeByID(ctx, people[0].ID, models.ChangeConfig{Nationality: models.Some("RU")})
+	if err != nil {
+		t.Fatalf("change nationality: %v", err)
+	}
+	got, err = s.GetByID(ctx, people[0].ID)
+	if err != nil || got.Nationality != "RU" || len(got.Nationalities) != 0 {
+		t.Fatalf("got %+v and error %v after changing nationality, want only nationality RU", got, err)
+	}
+
+	// Nationalities of deleted people don't match anymore, and batch overwrites them.
+	err = s.DeleteByID(ctx, people[2].ID)
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	err = s.SaveBatch(ctx, []models.Person{
+		{ID: people[0].ID, Name: "Anna", Surname: "Ivanova", Nationality: "KZ", Nationalities: []models.Nationality{{Country: "KZ", Probability: 0.5}}},
+		{ID: uuid.New(), Name: "Elena", Surname: "Smirnova", Nationality: "RU", Nationalities: []models.Nationality{
+			{Country: "RU", Probability: 0.5}, {Country: "UA", Probability: 0.25},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("save batch: %v", err)
+	}
+	page, err := s.GetWithFilter(ctx, models.FilterConfig{Nationality: "UA", NationalityMatch: models.NationalityAny}, models.ListOptions{PageSize: 10})
+	if err != nil {
+		t.Fatalf("filter after batch: %v", err)
+	}
+	assertNames(t, page.People, "Elena")
+	got, err = s.GetByID(ctx, people[0].ID)
+	if err != nil || len(got.Nationalities) != 1 || got.Nationalities[0].Country != "KZ" {
+		t.Fatalf("got %+v and error %v after batch, want the only nationality KZ", got, err)
+	}
+}
+
+func testExport(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	people := savePeople(t, s)
+	export := func(filter models.FilterConfig) ([]models.Person, error) {
+		exported := []models.Person{}
+		err := s.Export(ctx, filter, func(person models.Person) error {
+			exported = append(exported, person)
+			return nil
+		})
+		return exported, err
+	}
+	exported, err := export(models.FilterConfig{Nationality: "RU"})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	want := []models.Person{}
+	for _, person := range people {
+		if person.Nationality == "RU" {
+			want = append(want, person)
+		}
+	}
+	sort.Slice(want, func(i, j int) bool { return bytes.Compare(want[i].ID[:], want[j].ID[:]) < 0 })
+	if len(exported) != len(want) {
+		t.Fatalf("exported %v, want %v", names(exported), names(want))
+	}
+	for i := range want {
+		if !exported[i].Equal(want[i]) {
+			t.Fatalf("exported %+v, want %+v in order of IDs", exported, want)
+		}
+	}
+	_, err = export(models.FilterConfig{Conditions: []models.Condition{{Field: "height", Op: models.OperatorEq, Values: []string{"1"}}}})
+	assertError(t, err, models.ErrInvalidFilter)
+
+	// Export goes on past the first batch, and stops at the first error.
+	batch := make([]models.Person, 0, 1500)
+	for i := 0; i < cap(batch); i++ {
+		batch = append(batch, models.Person{ID: uuid.New(), Name: "Batch", Surname: "Person"})
+	}
+	err = s.SaveBatch(ctx, batch)
+	if err != nil {
+		t.Fatalf("save batch: %v", err)
+	}
+	exported, err = export(models.FilterConfig{Name: "Batch"})
+	if err != nil || len(exported) != len(batch) {
+		t.Fatalf("exported %d people and error %v, want %d people", len(exported), err, len(batch))
+	}
+	for i := 1; i < len(exported); i++ {
+		if bytes.Compare(exported[i-1].ID[:], exported[i].ID[:]) >= 0 {
+			t.Fatalf("exported %s after %s, want people in order of IDs", exported[i].ID, exported[i-1].ID)
+		}
+	}
+	stop := errors.New("stop")
+	calls := 0
+	err = s.Export(ctx, models.FilterConfig{}, func(person models.Person) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("got error %v after %d calls, want error %v after a single call", err, calls, stop)
+	}
+}
+
+func testImport(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	id := uuid.New()
+	_, err := s.GetImport(ctx, id)
+	assertError(t, err, models.ErrImportNotFound)
+	err = s.AddImportRows(ctx, id, []models.ImportRow{{Row: 1, Status: models.ImportRowPending, PersonID: uuid.New()}})
+	assertError(t, err, models.ErrImportNotFound)
+	_, err = s.ImportRows(ctx, id, models.ImportRowsQuery{Limit: 10})
+	assertError(t, err, models.ErrImportNotFound)
+
+	// Databases keep time with microseconds at best.
+	createdAt := time.Now().Truncate(time.Millisecond)
+	job := models.ImportJob{
+		ID:     id,
+		Status: models.ImportPending,
+		Options: models.ImportOptions{
+			Format:  models.ImportNDJSON,
+			Columns: models.ImportColumns{Name: "first", Surname: "last", Patronymic: "middle"},
+			Enrich:  true,
+		},
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}
+	err = s.SaveImport(ctx, job)
+	if err != nil {
+		t.Fatalf("save import: %v", err)
+	}
+	rows := []models.ImportRow{
+		{Row: 1, Status: models.ImportRowPending, PersonID: uuid.New(), Name: "Anna", Surname: "Ivanova", Patronymic: "Petrovna"},
+		{Row: 2, Status: models.ImportRowFailed, PersonID: uuid.New(), Name: "Boris", Error: "surname required"},
+		{Row: 3, Status: models.ImportRowPending, PersonID: uuid.New(), Name: "Dmitry", Surname: "Sidorov"},
+	}
+	err = s.AddImportRows(ctx, id, rows)
+	if err != nil {
+		t.Fatalf("add import rows: %v", err)
+	}
+	got, err := s.GetImport(ctx, id)
+	if err != nil {
+		t.Fatalf("get import: %v", err)
+	}
+	if got.Status != job.Status || got.Options != job.Options || !got.CreatedAt.Equal(createdAt) ||
+		got.Rows != 3 || got.Imported != 0 || got.Failed != 1 {
+		t.Fatalf("got import %+v, want %+v with 3 rows, 1 of them failed", got, job)
+	}
+
+	all, err := s.ImportRows(ctx, id, models.ImportRowsQuery{Limit: 10})
+	if err != nil || len(all) != len(rows) {
+		t.Fatalf("got rows %+v and error %v, want %+v", all, err, rows)
+	}
+	for i := range rows {
+		if all[i] != rows[i] {
+			t.Fatalf("got row %+v, want %+v", all[i], rows[i])
+		}
+	}
+	pending, err := s.ImportRows(ctx, id, models.ImportRowsQuery{Limit: 10, Pending: true})
+	if err != nil || len(pending) != 2 || pending[0].Row != 1 || pending[1].Row != 3 {
+		t.Fatalf("got pending rows %+v and error %v, want rows 1 and 3", pending, err)
+	}
+	page, err := s.ImportRows(ctx, id, models.ImportRowsQuery{After: 1, Limit: 1})
+	if err != nil || len(page) != 1 || page[0].Row != 2 {
+		t.Fatalf("got rows %+v and error %v after row 1, want row 2", page, err)
+	}
+
+	// Imported rows aren't pending anymore.
+	imported := rows[0]
+	imported.Status = models.ImportRowImported
+	failed := rows[2]
+	failed.Status, failed.Error = models.ImportRowFailed, "enrichment failed"
+	err = s.SaveImportResults(ctx, id, []models.ImportRow{imported, failed})
+	if err != nil {
+		t.Fatalf("save import results: %v", err)
+	}
+	pending, err = s.ImportRows(ctx, id, models.ImportRowsQuery{Limit: 10, Pending: true})
+	if err != nil || len(pending) != 0 {
+		t.Fatalf("got pending rows %+v and error %v, want none", pending, err)
+	}
+	all, err = s.ImportRows(ctx, id, models.ImportRowsQuery{Limit: 10})
+	if err != nil || all[0] != imported || all[2] != failed {
+		t.Fatalf("got rows %+v and error %v, want results saved", all, err)
+	}
+
+	// Saving job changes its status, but not its rows.
+	job.Status, job.Error, job.UpdatedAt = models.ImportPaused, "upstream unavailable", createdAt.Add(time.Minute)
+	err = s.SaveImport(ctx, job)
+	if err != nil {
+		t.Fatalf("save import: %v", err)
+	}
+	got, err = s.GetImport(ctx, id)
+	if err != nil || got.Status != models.ImportPaused || got.Error != job.Error || !got.UpdatedAt.Equal(job.UpdatedAt) ||
+		got.Rows != 3 || got.Imported != 1 || got.Failed != 2 {
+		t.Fatalf("got import %+v and error %v, want paused one with 1 row imported and 2 failed", got, err)
+	}
+
+	// Jobs are seen by their tenant only.
+	acme := models.WithTenant(ctx, "acme")
+	_, err = s.GetImport(acme, id)
+	assertError(t, err, models.ErrImportNotFound)
+	_, err = s.ImportRows(acme, id, models.ImportRowsQuery{Limit: 10})
+	assertError(t, err, models.ErrImportNotFound)
+
+	// Erased person's FIO is forgotten by rows, it was imported from.
+	err = s.Save(ctx, models.Person{ID: imported.PersonID, Name: imported.Name, Surname: imported.Surname, Patronymic: imported.Patronymic})
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	_, err = s.Erase(ctx, imported.PersonID)
+	if err != nil {
+		t.Fatalf("erase: %v", err)
+	}
+	all, err = s.ImportRows(ctx, id, models.ImportRowsQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("import rows: %v", err)
+	}
+	if all[0].Name != "" || all[0].Surname != "" || all[0].Patronymic != "" || all[0].Status != models.ImportRowImported {
+		t.Fatalf("got row %+v of erased person, want it imported without FIO", all[0])
+	}
+	if all[2] != failed {
+		t.Fatalf("got row %+v, want %+v kept", all[2], failed)
+	}
+}
+
+func testClaimImport(t *testing.T, s enrichfio.Storage) {
+	ctx := context.Background()
+	id := uuid.New()
+	until := time.Now().Add(time.Minute)
+	err := s.ClaimImport(ctx, id, models.ImportClaim{Runner: uuid.New(), Until: until})
+	assertError(t, err, models.ErrImportNotFound)
+
+	createdAt := time.Now().Truncate(time.Millisecond)
+	job := models.ImportJob{ID: id, Status: models.ImportPaused, Error: "upstream unavailable", CreatedAt: createdAt, UpdatedAt: createdAt}
+	err = s.SaveImport(ctx, job)
+	if err != nil {
+		t.Fatalf("save import: %v", err)
+	}
+	first := models.ImportClaim{Runner: uuid.New(), Until: until}
+	err = s.ClaimImport(ctx, id, first)
+	if err != nil {
+		t.Fatalf("claim import: %v", err)
+	}
+	got, err := s.GetImport(ctx, id)
+	if err != nil || got.Status != models.ImportRunning || got.Error != "" {
+		t.Fatalf("got import %+v and error %v, want running one without error", got, err)
+	}
+
+	// Running job is claimed by its run only.
+	second := models.ImportClaim{Runner: uuid.New(), Until: until}
+	err = s.ClaimImport(ctx, id, second)
+	assertError(t, err, models.ErrImportClaimed)
+	err = s.ClaimImport(ctx, id, models.ImportClaim{Runner: second.Runner, Until: until, Renew: true})
+	assertError(t, err, models.ErrImportClaimed)
+	first.Renew = true
+	err = s.ClaimImport(ctx, id, first)
+	if err != nil {
+		t.Fatalf("renew import claim: %v", err)
+	}
+
+	// Expired claim is taken over, and can't be renewed anymore.
+	first.Until = time.Now().Add(-time.Second)
+	err = s.ClaimImport(ctx, id, first)
+	if err != nil {
+		t.Fatalf("renew import claim: %v", err)
+	}
+	err = s.ClaimImport(ctx, id, second)
+	if err != nil {
+		t.Fatalf("claim import with expired claim: %v", err)
+	}
+	first.Until = until
+	err = s.ClaimImport(ctx, id, first)
+	assertError(t, err, models.ErrImportClaimed)
+
+	// Paused job is claimed anew, but claim of the run, which paused it, isn't renewed.
+	job.UpdatedAt = createdAt.Add(time.Minute)
+	err = s.SaveImport(ctx, job)
+	if err != nil {
+		t.Fatalf("save import: %v", err)
+	}
+	second.Renew = true
+	err = s.ClaimImport(ctx, id, second)
+	assertError(t, err, models.ErrImportClaimed)
+
+	// Done job isn't claimed at all.
+	job.Status, job.Error = models.ImportDone, ""
+	err = s.SaveImport(ctx, job)
+	if err != nil {
+		t.Fatalf("save import: %v", err)
+	}
+	err = s.ClaimImport(ctx, id, models.ImportClaim{Runner: uuid.New(), Until: until})
+	assertError(t, err, models.ErrImportClaimed)
+
+	// Jobs are claimed by their tenant only.
+	acme := models.WithTenant(ctx, "acme")
+	err = s.ClaimImport(acme, id, models.ImportClaim{Runner: uuid.New(), Until: until})
+	assertError(t, err, models.ErrImportNotFound)
+}
@@ -0,0 +1,105 @@
+// Package textsearch searches people by FIO in process, for storages without full text search of their own.
+// Similarity is computed the way pg_trgm does.
+package textsearch
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"enrich-fio/internal/models"
+)
+
+// Search returns a page of given people, whose FIO matches the query, the best matches first.
+// Query must be validated with models.SearchQuery.WithDefaults.
+func Search(people []models.Person, query models.SearchQuery, page int, pageSize int) models.SearchPage {
+	text := Normalized(query.Text)
+	textTrigrams := Trigrams(text)
+	results := []models.SearchResult{}
+	for _, person := range people {
+		score, found := 0.0, false
+		for _, field := range query.Fields {
+			value := Normalized(fieldValue(person, field))
+			similarity := Similarity(Trigrams(value), textTrigrams)
+			score = max(score, similarity)
+			if strings.HasPrefix(value, text) || (query.Mode == models.SearchSimilar && similarity >= query.MinSimilarity) {
+				found = true
+			}
+		}
+		if found {
+			results = append(results, models.SearchResult{Person: person, Score: score})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return bytes.Compare(results[i].Person.ID[:], results[j].Person.ID[:]) < 0
+	})
+
+	start := min(page*pageSize, len(results))
+	end := min(start+pageSize, len(results))
+	return models.SearchPage{
+		Results:  append([]models.SearchResult{}, results[start:end]...),
+		Page:     page,
+		PageSize: pageSize,
+		HasMore:  len(results) > end,
+	}
+}
+
+// fieldValue returns value of person's field, people can be searched by.
+func fieldValue(person models.Person, field string) string {
+	switch field {
+	case "name":
+		return person.Name
+	case "surname":
+		return person.Surname
+	case "patronymic":
+		return person.Patronymic
+	}
+	return ""
+}
+
+// Normalized returns lowercased text without accents, the way search indexes have it.
+func Normalized(text string) string {
+	unaccented := strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return r
+	}, norm.NFD.String(strings.ToLower(text)))
+	return norm.NFC.String(unaccented)
+}
+
+// Trigrams returns set of trigrams of text's words. Like in pg_trgm, words are padded with two spaces before and one after.
+func Trigrams(text string) map[string]bool {
+	set := map[string]bool{}
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// Similarity returns a share of trigrams, common for both sets, from 0 to 1.
+func Similarity(a map[string]bool, b map[string]bool) float64 {
+	common := 0
+	for trigram := range a {
+		if b[trigram] {
+			common++
+		}
+	}
+	all := len(a) + len(b) - common
+	if all == 0 {
+		return 0
+	}
+	return float64(common) / float64(all)
+}
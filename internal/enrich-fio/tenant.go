@@ -0,0 +1,250 @@
+package enrichfio
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/jwt"
+	"enrich-fio/internal/models"
+)
+
+// Providers are APIs, people are enriched with.
+type Providers struct {
+	Age         ProbableAge
+	Gender      ProbableGender
+	Nationality ProbableNationality
+}
+
+// Tenancy tells tenants of requests apart, and keeps their providers and quotas.
+type Tenancy struct {
+	tenants map[string]*tenant
+	// byAPIKey are IDs of tenants by their API keys.
+	byAPIKey  map[string]string
+	jwtSecret []byte
+	jwtClaim  string
+}
+
+// tenant is a configured tenant along with its providers and usage.
+type tenant struct {
+	models.Tenant
+	// providers are nil, if tenant doesn't override any of the default ones.
+	providers   *Providers
+	enrichments *rateLimiter
+}
+
+// NewTenancy returns tenancy of given tenants. Requests may be authenticated with JWTs, signed with jwtSecret,
+// which hold tenant ID in jwtClaim. JWTs are rejected if jwtSecret is empty.
+// newProviders returns providers for tenants, which override the default ones.
+func NewTenancy(tenants []models.Tenant, jwtSecret string, jwtClaim string, newProviders func(config models.ProviderConfig) Providers) *Tenancy {
+	t := &Tenancy{
+		tenants:   make(map[string]*tenant, len(tenants)),
+		byAPIKey:  map[string]string{},
+		jwtSecret: []byte(jwtSecret),
+		jwtClaim:  jwtClaim,
+	}
+	for _, config := range tenants {
+		tenant := &tenant{
+			Tenant:      config,
+			enrichments: newRateLimiter(config.Quota.EnrichmentsPerMinute, time.Minute),
+		}
+		if config.Providers != (models.ProviderConfig{}) {
+			providers := newProviders(config.Providers)
+			tenant.providers = &providers
+		}
+		t.tenants[config.ID] = tenant
+		for _, key := range config.APIKeys {
+			t.byAPIKey[key] = config.ID
+		}
+	}
+	return t
+}
+
+// ParseTenants parses JSON array of tenants, like
+//
+//	[{"id": "acme", "apiKeys": ["secret"], "providers": {"apiKey": "key"}, "quota": {"maxPeople": 1000}}]
+//
+// Empty data means no tenants.
+// Returns models.ErrInvalidTenant if tenants are malformed.
+func ParseTenants(data string) ([]models.Tenant, error) {
+	if data == "" {
+		return nil, nil
+	}
+	var tenants []models.Tenant
+	err := json.Unmarshal([]byte(data), &tenants)
+	if err != nil {
+		return nil, errors.Wrapf(models.ErrInvalidTenant, "%v", err)
+	}
+	ids := map[string]bool{}
+	apiKeys := map[string]bool{}
+	for i, tenant := range tenants {
+		// Tenant ID is a part of cache keys and notifications, separated by colons.
+		if tenant.ID == "" || strings.Contains(tenant.ID, ":") {
+			return nil, errors.Wrapf(models.ErrInvalidTenant, "tenant %d: ID %q must be non-empty and have no colons", i, tenant.ID)
+		}
+		if ids[tenant.ID] {
+			return nil, errors.Wrapf(models.ErrInvalidTenant, "tenant %d: duplicate ID %q", i, tenant.ID)
+		}
+		ids[tenant.ID] = true
+		for _, key := range tenant.APIKeys {
+			if key == "" || apiKeys[key] {
+				return nil, errors.Wrapf(models.ErrInvalidTenant, "tenant %q: API keys must be non-empty and unique", tenant.ID)
+			}
+			apiKeys[key] = true
+		}
+		if tenant.Quota.MaxPeople < 0 || tenant.Quota.EnrichmentsPerMinute < 0 {
+			return nil, errors.Wrapf(models.ErrInvalidTenant, "tenant %q: negative quota", tenant.ID)
+		}
+	}
+	return tenants, nil
+}
+
+// Authenticate returns who makes request with given API key or bearer JWT. API key is checked first.
+// Actor of API key is its fingerprint, so history tells keys apart without keeping them, and actor of JWT is its subject.
+// Without tenancy every request is made by models.DefaultTenant, and actor is unknown.
+// Returns models.ErrUnauthorized if neither credential identifies a known tenant.
+func (s *Service) Authenticate(apiKey string, token string) (models.Principal, error) {
+	if s.Tenancy == nil {
+		return models.Principal{Tenant: models.DefaultTenant}, nil
+	}
+	if apiKey != "" {
+		id, ok := s.Tenancy.byAPIKey[apiKey]
+		if !ok {
+			return models.Principal{}, errors.Wrap(models.ErrUnauthorized, "unknown API key")
+		}
+		return models.Principal{Tenant: id, Actor: apiKeyActor(apiKey)}, nil
+	}
+	if token != "" {
+		if len(s.Tenancy.jwtSecret) == 0 {
+			return models.Principal{}, errors.Wrap(models.ErrUnauthorized, "JWTs are not accepted")
+		}
+		claims, err := jwt.Verify(token, s.Tenancy.jwtSecret, time.Now())
+		if err != nil {
+			return models.Principal{}, errors.Wrapf(models.ErrUnauthorized, "%v", err)
+		}
+		id, _ := claims[s.Tenancy.jwtClaim].(string)
+		if id == "" {
+			return models.Principal{}, errors.Wrapf(models.ErrUnauthorized, "no %q claim in JWT", s.Tenancy.jwtClaim)
+		}
+		err = s.CheckTenant(id)
+		if err != nil {
+			return models.Principal{}, err
+		}
+		subject, _ := claims["sub"].(string)
+		return models.Principal{Tenant: id, Actor: subject}, nil
+	}
+	return models.Principal{}, errors.Wrap(models.ErrUnauthorized, "no API key or JWT")
+}
+
+// apiKeyActor returns actor of requests, made with given API key, like "api-key:1a2b3c4d5e6f".
+func apiKeyActor(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return "api-key:" + hex.EncodeToString(sum[:6])
+}
+
+// CheckTenant checks that tenant with given ID is known.
+// Without tenancy only models.DefaultTenant is known.
+// Returns models.ErrUnauthorized if the tenant is unknown.
+func (s *Service) CheckTenant(id string) error {
+	if s.Tenancy == nil {
+		if id == models.DefaultTenant {
+			return nil
+		}
+	} else if _, ok := s.Tenancy.tenants[id]; ok {
+		return nil
+	}
+	return errors.Wrapf(models.ErrUnauthorized, "unknown tenant %q", id)
+}
+
+// TenantIDs returns IDs of all known tenants.
+func (s *Service) TenantIDs() []string {
+	if s.Tenancy == nil {
+		return []string{models.DefaultTenant}
+	}
+	ids := make([]string, 0, len(s.Tenancy.tenants))
+	for id := range s.Tenancy.tenants {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// tenant returns configured tenant from ctx, or nil if it has no config.
+func (s *Service) tenant(ctx context.Context) *tenant {
+	if s.Tenancy == nil {
+		return nil
+	}
+	return s.Tenancy.tenants[models.TenantFromContext(ctx)]
+}
+
+// providers returns providers of tenant from ctx.
+func (s *Service) providers(ctx context.Context) Providers {
+	if t := s.tenant(ctx); t != nil && t.providers != nil {
+		return *t.providers
+	}
+	return Providers{Age: s.ProbableAge, Gender: s.ProbableGender, Nationality: s.ProbableNationality}
+}
+
+// allowEnrichment tells if tenant from ctx may enrich one more person.
+// Returns models.ErrQuotaExceeded if it may not.
+func (s *Service) allowEnrichment(ctx context.Context) error {
+	t := s.tenant(ctx)
+	if t == nil || t.enrichments.allow(time.Now()) {
+		return nil
+	}
+	return errors.Wrapf(models.ErrQuotaExceeded, "tenant %q may enrich %d people a minute", t.ID, t.Quota.EnrichmentsPerMinute)
+}
+
+// checkPeopleQuota checks that tenant from ctx keeps no more people, than its quota allows.
+// It's called after people are saved in transaction, so the transaction is rolled back if quota is exceeded.
+// Concurrent transactions of the tenant are counted one after another, so they can't exceed quota together.
+// Returns models.ErrQuotaExceeded if tenant keeps too many people.
+func (s *Service) checkPeopleQuota(ctx context.Context, tx Storage) error {
+	t := s.tenant(ctx)
+	if t == nil || t.Quota.MaxPeople == 0 {
+		return nil
+	}
+	count, err := tx.CountPeople(ctx)
+	if err != nil {
+		return errors.Wrap(err, "count people")
+	}
+	if count > t.Quota.MaxPeople {
+		return errors.Wrapf(models.ErrQuotaExceeded, "tenant %q may keep %d people", t.ID, t.Quota.MaxPeople)
+	}
+	return nil
+}
+
+// rateLimiter allows up to limit events in every fixed window. Zero limit allows everything.
+type rateLimiter struct {
+	mu          sync.Mutex
+	limit       int
+	window      time.Duration
+	windowStart time.Time
+	count       int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window}
+}
+
+// allow tells if one more event may happen at given moment, and counts it if so.
+func (l *rateLimiter) allow(now time.Time) bool {
+	if l.limit == 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.windowStart) >= l.window {
+		l.windowStart, l.count = now, 0
+	}
+	if l.count >= l.limit {
+		return false
+	}
+	l.count++
+	return true
+}
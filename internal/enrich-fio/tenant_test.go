@@ -0,0 +1,87 @@
+package enrichfio_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	enrichfio "enrich-fio/internal/enrich-fio"
+	"enrich-fio/internal/jwt"
+	"enrich-fio/internal/models"
+)
+
+func TestAuthenticate(t *testing.T) {
+	secret := "secret"
+	tenants := []models.Tenant{{ID: "acme", APIKeys: []string{"acme-key", "other-acme-key"}}, {ID: "globex"}}
+	service := enrichfio.New(nil, nil, nil, nil)
+	service.Tenancy = enrichfio.NewTenancy(tenants, secret, "tenant", nil)
+	sign := func(claims map[string]any) string {
+		token, err := jwt.Sign(claims, []byte(secret))
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return token
+	}
+	tests := []struct {
+		name   string
+		apiKey string
+		token  string
+		// want is ID of tenant, or empty if request is unauthorized.
+		want  string
+		actor string
+	}{
+		{name: "API key", apiKey: "acme-key", want: "acme", actor: "api-key:"},
+		{name: "API key goes first", apiKey: "acme-key", token: sign(map[string]any{"tenant": "globex", "sub": "alice"}),
+			want: "acme", actor: "api-key:"},
+		{name: "unknown API key", apiKey: "other-key", token: sign(map[string]any{"tenant": "globex"})},
+		{name: "JWT", token: sign(map[string]any{"tenant": "globex", "sub": "alice"}), want: "globex", actor: "alice"},
+		{name: "JWT without subject", token: sign(map[string]any{"tenant": "globex"}), want: "globex"},
+		{name: "JWT of unknown tenant", token: sign(map[string]any{"tenant": "initech"})},
+		{name: "JWT without tenant claim", token: sign(map[string]any{"sub": "alice"})},
+		{name: "JWT with empty tenant claim", token: sign(map[string]any{"tenant": ""})},
+		{name: "JWT with non-string tenant claim", token: sign(map[string]any{"tenant": 1})},
+		{name: "expired JWT", token: sign(map[string]any{"tenant": "globex", "exp": time.Now().Add(-time.Minute).Unix()})},
+		{name: "malformed JWT", token: "token"},
+		{name: "no credentials"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.Authenticate(tt.apiKey, tt.token)
+			if tt.want == "" {
+				if !errors.Is(err, models.ErrUnauthorized) {
+					t.Fatalf("got %+v and error %v, want %v", got, err, models.ErrUnauthorized)
+				}
+				return
+			}
+			// Actors of API keys are checked to start with the prefix, as the rest is a fingerprint.
+			if err != nil || got.Tenant != tt.want || !strings.HasPrefix(got.Actor, tt.actor) ||
+				(tt.actor == "") != (got.Actor == "") {
+				t.Fatalf("got %+v and error %v, want tenant %q and actor %q", got, err, tt.want, tt.actor)
+			}
+		})
+	}
+
+	// API keys are told apart by actor, which doesn't reveal them.
+	first, _ := service.Authenticate("acme-key", "")
+	again, _ := service.Authenticate("acme-key", "")
+	other, _ := service.Authenticate("other-acme-key", "")
+	if first.Actor != again.Actor || first.Actor == other.Actor || strings.Contains(first.Actor, "acme-key") {
+		t.Fatalf("got actors %q, %q and %q, want the same key to have the same actor, hiding the key", first.Actor,
+			again.Actor, other.Actor)
+	}
+
+	// JWTs are rejected without secret.
+	service.Tenancy = enrichfio.NewTenancy(tenants, "", "tenant", nil)
+	_, err := service.Authenticate("", sign(map[string]any{"tenant": "globex"}))
+	if !errors.Is(err, models.ErrUnauthorized) {
+		t.Fatalf("got error %v without JWT secret, want %v", err, models.ErrUnauthorized)
+	}
+
+	// Without tenancy everything belongs to the default tenant.
+	service.Tenancy = nil
+	got, err := service.Authenticate("", "")
+	if err != nil || got != (models.Principal{Tenant: models.DefaultTenant}) {
+		t.Fatalf("got %+v and error %v without tenancy, want %q without actor", got, err, models.DefaultTenant)
+	}
+}
@@ -0,0 +1,315 @@
+// Package fieldcrypt implements envelope encryption of FIO of people at rest.
+//
+// Every value is encrypted with its own random data key by AES-256-GCM, and the data key is encrypted (wrapped)
+// with a master key from keyring. Encrypted value keeps ID of the master key and the wrapped data key:
+//
+//	enc:v1:<key ID>:<wrapped data key>:<encrypted value>
+//
+// so rotating master keys only rewraps data keys, and values stay decryptable while their master key is in keyring.
+// Exact-match lookups use blind indexes, HMAC of the plaintext with a separate key, which is never rotated.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"enrich-fio/internal/config"
+	"enrich-fio/internal/models"
+)
+
+const (
+	// _prefix starts every encrypted value, so plaintext values, stored before encryption was enabled, are told apart.
+	_prefix = "enc:v1:"
+	// _keySize is the size of master, data and blind index keys, AES-256 needs 32 bytes.
+	_keySize = 32
+	// _blindIndexSize is the number of bytes of HMAC, kept in blind index. It's enough to make collisions unlikely.
+	_blindIndexSize = 16
+)
+
+// ErrUnknownKey is error occured if value is encrypted with master key, keyring doesn't have.
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// ErrMalformed is error occured if encrypted value is damaged or was encrypted for another field.
+var ErrMalformed = errors.New("malformed encrypted value")
+
+// Keyring is a set of master keys, the current of which encrypts new values, and a key of blind indexes.
+// Nil keyring doesn't encrypt anything.
+type Keyring struct {
+	keys          map[string][]byte
+	current       string
+	blindIndexKey []byte
+}
+
+// keyringJSON is a structure of keyring in a keyfile or in environment. Keys are base64 encoded.
+//
+//	{"current": "2024-01", "keys": {"2023-01": "...", "2024-01": "..."}, "blindIndexKey": "..."}
+type keyringJSON struct {
+	Current       string            `json:"current"`
+	Keys          map[string][]byte `json:"keys"`
+	BlindIndexKey []byte            `json:"blindIndexKey"`
+}
+
+// Parse returns keyring from its JSON, see keyringJSON.
+func Parse(data []byte) (*Keyring, error) {
+	var parsed keyringJSON
+	err := json.Unmarshal(data, &parsed)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal keyring")
+	}
+	for id, key := range parsed.Keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, errors.Errorf("key ID %q must be non-empty and have no colons", id)
+		}
+		if len(key) != _keySize {
+			return nil, errors.Errorf("key %q has %d bytes, want %d", id, len(key), _keySize)
+		}
+	}
+	if _, ok := parsed.Keys[parsed.Current]; !ok {
+		return nil, errors.Errorf("current key %q is not in keyring", parsed.Current)
+	}
+	if len(parsed.BlindIndexKey) < _keySize {
+		return nil, errors.Errorf("blind index key has %d bytes, want at least %d", len(parsed.BlindIndexKey), _keySize)
+	}
+	return &Keyring{
+		keys:          parsed.Keys,
+		current:       parsed.Current,
+		blindIndexKey: parsed.BlindIndexKey,
+	}, nil
+}
+
+// Load returns keyring from keyfile, or from environment, if there is no keyfile.
+// Returns nil keyring if neither is configured.
+func Load(config *config.EncryptionConfig) (*Keyring, error) {
+	data := []byte(config.Keys)
+	if config.KeyFile != "" {
+		var err error
+		data, err = os.ReadFile(config.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read keyfile")
+		}
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return Parse(data)
+}
+
+// CurrentKeyID returns ID of master key, new values are encrypted with.
+func (k *Keyring) CurrentKeyID() string {
+	if k == nil {
+		return ""
+	}
+	return k.current
+}
+
+// Encrypt returns value of given field, encrypted with a fresh data key, wrapped with the current master key.
+// Empty value stays empty, so unknown values are still told apart.
+func (k *Keyring) Encrypt(field string, value string) (string, error) {
+	if k == nil || value == "" {
+		return value, nil
+	}
+	dataKey := make([]byte, _keySize)
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return "", errors.Wrap(err, "generate data key")
+	}
+	wrapped, err := seal(k.keys[k.current], dataKey, []byte(k.current))
+	if err != nil {
+		return "", errors.Wrap(err, "wrap data key")
+	}
+	encrypted, err := seal(dataKey, []byte(value), []byte(field))
+	if err != nil {
+		return "", errors.Wrap(err, "encrypt value")
+	}
+	return format(k.current, wrapped, encrypted), nil
+}
+
+// Decrypt returns plaintext of given field's value. Values, which aren't encrypted, are returned as they are.
+// Returns ErrUnknownKey if value's master key is not in keyring.
+func (k *Keyring) Decrypt(field string, value string) (string, error) {
+	if !strings.HasPrefix(value, _prefix) {
+		return value, nil
+	}
+	keyID, wrapped, encrypted, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := k.unwrap(keyID, wrapped)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataKey, encrypted, []byte(field))
+	if err != nil {
+		return "", errors.Wrap(ErrMalformed, "decrypt value")
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap returns value of given field with its data key wrapped with the current master key.
+// Value itself is not reencrypted. Values, which aren't encrypted yet, are encrypted.
+func (k *Keyring) Rewrap(field string, value string) (string, error) {
+	if k == nil {
+		return value, nil
+	}
+	if !strings.HasPrefix(value, _prefix) {
+		return k.Encrypt(field, value)
+	}
+	keyID, wrapped, encrypted, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+	if keyID == k.current {
+		return value, nil
+	}
+	dataKey, err := k.unwrap(keyID, wrapped)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err = seal(k.keys[k.current], dataKey, []byte(k.current))
+	if err != nil {
+		return "", errors.Wrap(err, "wrap data key")
+	}
+	return format(k.current, wrapped, encrypted), nil
+}
+
+// BlindIndex returns blind index of given field's value, which matches blind indexes of equal values only.
+// Empty value and any value of nil keyring have empty blind index, so unknown values are still told apart.
+func (k *Keyring) BlindIndex(field string, value string) string {
+	if k == nil || value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, k.blindIndexKey)
+	mac.Write([]byte(field + ":" + value))
+	return hex.EncodeToString(mac.Sum(nil)[:_blindIndexSize])
+}
+
+// unwrap returns data key, wrapped with master key with given ID.
+func (k *Keyring) unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	if k == nil {
+		return nil, errors.Wrapf(ErrUnknownKey, "%q, encryption is disabled", keyID)
+	}
+	masterKey, ok := k.keys[keyID]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownKey, "%q", keyID)
+	}
+	dataKey, err := open(masterKey, wrapped, []byte(keyID))
+	if err != nil {
+		return nil, errors.Wrap(ErrMalformed, "unwrap data key")
+	}
+	return dataKey, nil
+}
+
+// format returns encrypted value, see package doc.
+func format(keyID string, wrapped []byte, encrypted []byte) string {
+	encoding := base64.RawStdEncoding
+	return _prefix + keyID + ":" + encoding.EncodeToString(wrapped) + ":" + encoding.EncodeToString(encrypted)
+}
+
+// parse returns parts of encrypted value, see package doc.
+func parse(value string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, _prefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, ErrMalformed
+	}
+	encoding := base64.RawStdEncoding
+	wrapped, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, errors.Wrap(ErrMalformed, "decode data key")
+	}
+	encrypted, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, errors.Wrap(ErrMalformed, "decode value")
+	}
+	return parts[0], wrapped, encrypted, nil
+}
+
+// seal encrypts plaintext with key by AES-GCM, authenticating additional data too. Nonce goes first.
+func seal(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate nonce")
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts ciphertext, sealed by seal.
+func open(key []byte, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "create cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "create GCM")
+	}
+	return aead, nil
+}
+
+// EncryptPerson returns person with FIO encrypted. Nil keyring returns person as it is.
+func (k *Keyring) EncryptPerson(person models.Person) (models.Person, error) {
+	return k.mapFIO(person, k.Encrypt)
+}
+
+// DecryptPerson returns person with FIO decrypted. Person, which isn't encrypted, is returned as it is.
+func (k *Keyring) DecryptPerson(person models.Person) (models.Person, error) {
+	return k.mapFIO(person, k.Decrypt)
+}
+
+// RewrapPerson returns person with data keys of FIO wrapped with the current master key, see Rewrap.
+func (k *Keyring) RewrapPerson(person models.Person) (models.Person, error) {
+	return k.mapFIO(person, k.Rewrap)
+}
+
+// DecryptRevision returns revision with FIO of its values decrypted.
+func (k *Keyring) DecryptRevision(revision models.Revision) (models.Revision, error) {
+	for _, value := range []**models.Person{&revision.OldValue, &revision.NewValue} {
+		if *value == nil {
+			continue
+		}
+		decrypted, err := k.DecryptPerson(**value)
+		if err != nil {
+			return models.Revision{}, err
+		}
+		*value = &decrypted
+	}
+	return revision, nil
+}
+
+// mapFIO returns person with fn applied to every part of FIO.
+func (k *Keyring) mapFIO(person models.Person, fn func(field string, value string) (string, error)) (models.Person, error) {
+	var err error
+	for field, value := range map[string]*string{"name": &person.Name, "surname": &person.Surname, "patronymic": &person.Patronymic} {
+		*value, err = fn(field, *value)
+		if err != nil {
+			return models.Person{}, errors.Wrap(err, field)
+		}
+	}
+	return person, nil
+}
@@ -0,0 +1,238 @@
+package fieldcrypt_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"enrich-fio/internal/fieldcrypt"
+	"enrich-fio/internal/models"
+)
+
+// newKeyring returns keyring with given current key and the other keys. Every key is made of its ID,
+// so keyrings, having the same key IDs, have the same keys.
+func newKeyring(t *testing.T, current string, others ...string) *fieldcrypt.Keyring {
+	t.Helper()
+	keys := map[string][]byte{current: key(current)}
+	for _, id := range others {
+		keys[id] = key(id)
+	}
+	data, err := json.Marshal(map[string]any{"current": current, "keys": keys, "blindIndexKey": key("blind index")})
+	if err != nil {
+		t.Fatalf("marshal keyring: %v", err)
+	}
+	keyring, err := fieldcrypt.Parse(data)
+	if err != nil {
+		t.Fatalf("parse keyring: %v", err)
+	}
+	return keyring
+}
+
+// key returns 32 bytes key, made of seed.
+func key(seed string) []byte {
+	return bytes.Repeat([]byte(seed), 32)[:32]
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	keyring := newKeyring(t, "k1")
+	for _, value := range []string{"Ivan", "Иван", "with:colons", strings.Repeat("long", 100)} {
+		encrypted, err := keyring.Encrypt("name", value)
+		if err != nil {
+			t.Fatalf("encrypt %q: %v", value, err)
+		}
+		if !strings.HasPrefix(encrypted, "enc:v1:k1:") || strings.Contains(encrypted, value) {
+			t.Fatalf("got %q, want %q encrypted with key k1", encrypted, value)
+		}
+		decrypted, err := keyring.Decrypt("name", encrypted)
+		if err != nil || decrypted != value {
+			t.Fatalf("got %q and error %v, want %q", decrypted, err, value)
+		}
+	}
+
+	// Every value has its own data key and nonce.
+	first, _ := keyring.Encrypt("name", "Ivan")
+	second, _ := keyring.Encrypt("name", "Ivan")
+	if first == second {
+		t.Fatalf("got the same ciphertext %q twice", first)
+	}
+
+	// Empty values stay empty, and plaintext values are decrypted as they are.
+	encrypted, err := keyring.Encrypt("name", "")
+	if err != nil || encrypted != "" {
+		t.Fatalf("got %q and error %v, want empty value", encrypted, err)
+	}
+	decrypted, err := keyring.Decrypt("name", "Ivan")
+	if err != nil || decrypted != "Ivan" {
+		t.Fatalf("got %q and error %v, want plaintext as it is", decrypted, err)
+	}
+
+	// Nil keyring doesn't encrypt.
+	var disabled *fieldcrypt.Keyring
+	encrypted, err = disabled.Encrypt("name", "Ivan")
+	if err != nil || encrypted != "Ivan" {
+		t.Fatalf("got %q and error %v from nil keyring, want plaintext", encrypted, err)
+	}
+}
+
+func TestDecryptUnknownKey(t *testing.T) {
+	encrypted, err := newKeyring(t, "k1").Encrypt("name", "Ivan")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	_, err = newKeyring(t, "k2").Decrypt("name", encrypted)
+	if !errors.Is(err, fieldcrypt.ErrUnknownKey) {
+		t.Fatalf("got error %v, want %v", err, fieldcrypt.ErrUnknownKey)
+	}
+	var disabled *fieldcrypt.Keyring
+	_, err = disabled.Decrypt("name", encrypted)
+	if !errors.Is(err, fieldcrypt.ErrUnknownKey) {
+		t.Fatalf("got error %v from nil keyring, want %v", err, fieldcrypt.ErrUnknownKey)
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	keyring := newKeyring(t, "k1", "k2")
+	encrypted, err := keyring.Encrypt("name", "Ivan")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	parts := strings.Split(encrypted, ":")
+	// parts are "enc", "v1", key ID, wrapped data key and encrypted value.
+	tampered := map[string]string{
+		"data key":                 strings.Join([]string{parts[0], parts[1], parts[2], flip(parts[3]), parts[4]}, ":"),
+		"value":                    strings.Join([]string{parts[0], parts[1], parts[2], parts[3], flip(parts[4])}, ":"),
+		"key ID":                   strings.Join([]string{parts[0], parts[1], "k2", parts[3], parts[4]}, ":"),
+		"truncated value":          strings.Join([]string{parts[0], parts[1], parts[2], parts[3], parts[4][:8]}, ":"),
+		"missing part":             strings.Join(parts[:4], ":"),
+		"extra part":               encrypted + ":AAAA",
+		"invalid base64 data key":  strings.Join([]string{parts[0], parts[1], parts[2], "!!!!", parts[4]}, ":"),
+		"invalid base64 value":     strings.Join([]string{parts[0], parts[1], parts[2], parts[3], "!!!!"}, ":"),
+		"value of the other field": encrypted,
+	}
+	for name, value := range tampered {
+		field := "name"
+		if name == "value of the other field" {
+			field = "surname"
+		}
+		decrypted, err := keyring.Decrypt(field, value)
+		if !errors.Is(err, fieldcrypt.ErrMalformed) {
+			t.Fatalf("%s: got %q and error %v, want %v", name, decrypted, err, fieldcrypt.ErrMalformed)
+		}
+	}
+}
+
+// flip returns base64 encoded bytes with the middle byte changed.
+func flip(encoded string) string {
+	data, _ := base64.RawStdEncoding.DecodeString(encoded)
+	data[len(data)/2] ^= 1
+	return base64.RawStdEncoding.EncodeToString(data)
+}
+
+func TestRewrap(t *testing.T) {
+	old := newKeyring(t, "k1")
+	encrypted, err := old.Encrypt("surname", "Ivanov")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	rotated := newKeyring(t, "k2", "k1")
+	rewrapped, err := rotated.Rewrap("surname", encrypted)
+	if err != nil {
+		t.Fatalf("rewrap: %v", err)
+	}
+	if !strings.HasPrefix(rewrapped, "enc:v1:k2:") {
+		t.Fatalf("got %q, want it wrapped with key k2", rewrapped)
+	}
+	// Value itself isn't reencrypted.
+	if encrypted[strings.LastIndex(encrypted, ":"):] != rewrapped[strings.LastIndex(rewrapped, ":"):] {
+		t.Fatalf("got value %q reencrypted as %q, want only data key rewrapped", encrypted, rewrapped)
+	}
+	decrypted, err := newKeyring(t, "k2").Decrypt("surname", rewrapped)
+	if err != nil || decrypted != "Ivanov" {
+		t.Fatalf("got %q and error %v without the old key, want Ivanov", decrypted, err)
+	}
+	again, err := rotated.Rewrap("surname", rewrapped)
+	if err != nil || again != rewrapped {
+		t.Fatalf("got %q and error %v, want value, wrapped with the current key, as it is", again, err)
+	}
+
+	// Plaintext is encrypted.
+	encrypted, err = rotated.Rewrap("surname", "Petrov")
+	if err != nil || !strings.HasPrefix(encrypted, "enc:v1:k2:") {
+		t.Fatalf("got %q and error %v, want plaintext encrypted with key k2", encrypted, err)
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	keyring := newKeyring(t, "k1")
+	index := keyring.BlindIndex("name", "Ivan")
+	if len(index) != 32 {
+		t.Fatalf("got blind index %q, want 16 hex encoded bytes", index)
+	}
+	// Blind indexes don't depend on master keys, so they stay the same after rotation.
+	if got := newKeyring(t, "k2", "k1").BlindIndex("name", "Ivan"); got != index {
+		t.Fatalf("got blind index %q after rotation, want %q", got, index)
+	}
+	if got := keyring.BlindIndex("name", "Ivan"); got != index {
+		t.Fatalf("got blind index %q, want %q", got, index)
+	}
+	if got := keyring.BlindIndex("surname", "Ivan"); got == index {
+		t.Fatalf("got the same blind index %q for other field", got)
+	}
+	if got := keyring.BlindIndex("name", "ivan"); got == index {
+		t.Fatalf("got the same blind index %q for other value", got)
+	}
+	if got := keyring.BlindIndex("name", ""); got != "" {
+		t.Fatalf("got blind index %q of empty value, want empty", got)
+	}
+	var disabled *fieldcrypt.Keyring
+	if got := disabled.BlindIndex("name", "Ivan"); got != "" {
+		t.Fatalf("got blind index %q from nil keyring, want empty", got)
+	}
+}
+
+func TestPerson(t *testing.T) {
+	keyring := newKeyring(t, "k1")
+	person := models.Person{Name: "Ivan", Surname: "Ivanov", Patronymic: "Ivanovich", Age: 30}
+	encrypted, err := keyring.EncryptPerson(person)
+	if err != nil {
+		t.Fatalf("encrypt person: %v", err)
+	}
+	if encrypted.Name == person.Name || encrypted.Surname == person.Surname || encrypted.Patronymic == person.Patronymic ||
+		encrypted.Age != person.Age {
+		t.Fatalf("got person %+v, want only FIO of %+v encrypted", encrypted, person)
+	}
+	decrypted, err := keyring.DecryptPerson(encrypted)
+	if err != nil || !decrypted.Equal(person) {
+		t.Fatalf("got person %+v and error %v, want %+v", decrypted, err, person)
+	}
+}
+
+func TestParse(t *testing.T) {
+	valid := func() map[string]any {
+		return map[string]any{"current": "k1", "keys": map[string][]byte{"k1": key("k1")}, "blindIndexKey": key("blind")}
+	}
+	tests := map[string]func(keyring map[string]any){
+		"unknown current key":     func(keyring map[string]any) { keyring["current"] = "k2" },
+		"short key":               func(keyring map[string]any) { keyring["keys"] = map[string][]byte{"k1": key("k1")[:16]} },
+		"key ID with colon":       func(keyring map[string]any) { keyring["keys"] = map[string][]byte{"k1": key("k1"), "k:2": key("k2")} },
+		"short blind index key":   func(keyring map[string]any) { keyring["blindIndexKey"] = key("blind")[:16] },
+		"missing blind index key": func(keyring map[string]any) { delete(keyring, "blindIndexKey") },
+	}
+	data, _ := json.Marshal(valid())
+	_, err := fieldcrypt.Parse(data)
+	if err != nil {
+		t.Fatalf("parse valid keyring: %v", err)
+	}
+	for name, change := range tests {
+		keyring := valid()
+		change(keyring)
+		data, _ := json.Marshal(keyring)
+		_, err := fieldcrypt.Parse(data)
+		if err == nil {
+			t.Fatalf("%s: parsed keyring, want error", name)
+		}
+	}
+}
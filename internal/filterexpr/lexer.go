@@ -0,0 +1,122 @@
+package filterexpr
+
+import (
+	"strings"
+	"unicode"
+)
+
+// tokenKind is a kind of lexical token of filter expression.
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+// token is a lexical token of filter expression.
+type token struct {
+	kind tokenKind
+	text string
+	// pos is a 1-based position of token's first character in expression.
+	pos int
+}
+
+// keyword returns lowercased token text, if token is an identifier, so keywords are case insensitive.
+func (t token) keyword() string {
+	if t.kind != tokenIdent {
+		return ""
+	}
+	return strings.ToLower(t.text)
+}
+
+// lex splits expression into tokens, ending with tokenEOF.
+// Returns *SyntaxError on unexpected characters and unterminated strings.
+func lex(expression string) ([]token, error) {
+	runes := []rune(expression)
+	tokens := []token{}
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: pos})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: pos})
+			i++
+		case r == '=':
+			tokens = append(tokens, token{kind: tokenOperator, text: "=", pos: pos})
+			i++
+		case r == '!' || r == '<' || r == '>':
+			text := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				text += "="
+			}
+			if text == "!" {
+				return nil, &SyntaxError{Pos: pos, Msg: `expected "!="`}
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: text, pos: pos})
+			i += len(text)
+		case r == '"' || r == '\'':
+			text, end, ok := lexString(runes, i)
+			if !ok {
+				return nil, &SyntaxError{Pos: pos, Msg: "unterminated string"}
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: pos})
+			i = end
+		case unicode.IsDigit(r) || r == '-':
+			end := i + 1
+			for end < len(runes) && unicode.IsDigit(runes[end]) {
+				end++
+			}
+			if r == '-' && end == i+1 {
+				return nil, &SyntaxError{Pos: pos, Msg: "expected a number after minus"}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[i:end]), pos: pos})
+			i = end
+		case unicode.IsLetter(r) || r == '_':
+			end := i + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[i:end]), pos: pos})
+			i = end
+		default:
+			return nil, &SyntaxError{Pos: pos, Msg: "unexpected character " + string(r)}
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(runes) + 1})
+	return tokens, nil
+}
+
+// lexString reads quoted string, starting at runes[start], and returns its unquoted text and the index after it.
+// Quote is escaped by backslash. Returns false if string is not terminated.
+func lexString(runes []rune, start int) (string, int, bool) {
+	quote := runes[start]
+	text := strings.Builder{}
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				text.WriteRune(runes[i])
+			}
+		case quote:
+			return text.String(), i + 1, true
+		default:
+			text.WriteRune(runes[i])
+		}
+	}
+	return "", 0, false
+}
@@ -0,0 +1,255 @@
+// Package filterexpr parses filter expressions over person fields, like
+//
+//	age>30 and nationality in ("RU","KZ") and not gender="male"
+//
+// into models.Expr tree.
+//
+// Grammar, keywords are case insensitive:
+//
+//	expr       = and { "or" and }
+//	and        = unary { "and" unary }
+//	unary      = "not" unary | "(" expr ")" | comparison
+//	comparison = field ( "=" | "!=" | ">" | ">=" | "<" | "<=" ) value
+//	           | field [ "not" ] "in" "(" value { "," value } ")"
+//	           | field "is" [ "not" ] ( "unknown" | "null" )
+//	value      = string | number
+package filterexpr
+
+import (
+	"fmt"
+
+	"enrich-fio/internal/models"
+)
+
+// SyntaxError is an error in filter expression at the given position.
+type SyntaxError struct {
+	// Pos is a 1-based position of the character, where error is found.
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+// Unwrap makes syntax errors match models.ErrInvalidFilter.
+func (e *SyntaxError) Unwrap() error {
+	return models.ErrInvalidFilter
+}
+
+// _comparisonOperators are expression operators and conditions they make.
+var _comparisonOperators = map[string]struct {
+	op  models.Operator
+	not bool
+}{
+	"=":  {op: models.OperatorEq},
+	"!=": {op: models.OperatorEq, not: true},
+	">":  {op: models.OperatorGt},
+	">=": {op: models.OperatorGte},
+	"<":  {op: models.OperatorLt},
+	"<=": {op: models.OperatorLte},
+}
+
+// _maxDepth is the deepest parentheses and negations may be nested, so deeply nested expression can't exhaust the stack.
+const _maxDepth = 32
+
+// Parse parses filter expression into a tree, validated against person fields.
+// Returns *SyntaxError, matching models.ErrInvalidFilter, if expression is malformed or nested too deep.
+func Parse(expression string) (models.Expr, error) {
+	tokens, err := lex(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, p.unexpected("end of expression")
+	}
+	return expr, nil
+}
+
+// parser is a recursive descent parser over tokens of filter expression.
+type parser struct {
+	tokens []token
+	next   int
+	// depth is how many parentheses and negations the next token is nested in.
+	depth int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+// unexpected returns syntax error about the next token, which is not what was expected.
+func (p *parser) unexpected(expected string) error {
+	t := p.peek()
+	if t.kind == tokenEOF {
+		return &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("expected %s, got end of expression", expected)}
+	}
+	return &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("expected %s, got %q", expected, t.text)}
+}
+
+func (p *parser) parseOr() (models.Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword() == "or" {
+		p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = models.OrExpr{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (models.Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword() == "and" {
+		p.advance()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = models.AndExpr{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (models.Expr, error) {
+	if p.peek().keyword() == "not" || p.peek().kind == tokenLParen {
+		if p.depth == _maxDepth {
+			return nil, &SyntaxError{Pos: p.peek().pos, Msg: fmt.Sprintf("expression is nested deeper than %d levels", _maxDepth)}
+		}
+		p.depth++
+		defer func() { p.depth-- }()
+	}
+	switch {
+	case p.peek().keyword() == "not":
+		p.advance()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return models.NotExpr{Operand: operand}, nil
+	case p.peek().kind == tokenLParen:
+		p.advance()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokenRParen {
+			return nil, p.unexpected(`")"`)
+		}
+		p.advance()
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (models.Expr, error) {
+	field := p.peek()
+	if field.kind != tokenIdent {
+		return nil, p.unexpected("field name")
+	}
+	if _, ok := models.FilterFields[field.text]; !ok {
+		return nil, &SyntaxError{Pos: field.pos, Msg: fmt.Sprintf("unknown field %q", field.text)}
+	}
+	p.advance()
+
+	c := models.Condition{Field: field.text}
+	operator := p.peek()
+	switch {
+	case operator.kind == tokenOperator:
+		p.advance()
+		comparison := _comparisonOperators[operator.text]
+		c.Op, c.Not = comparison.op, comparison.not
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		c.Values = []string{value}
+	case operator.keyword() == "not" || operator.keyword() == "in":
+		if operator.keyword() == "not" {
+			p.advance()
+			c.Not = true
+			if p.peek().keyword() != "in" {
+				return nil, p.unexpected(`"in"`)
+			}
+		}
+		p.advance()
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		c.Op, c.Values = models.OperatorIn, values
+	case operator.keyword() == "is":
+		p.advance()
+		if p.peek().keyword() == "not" {
+			p.advance()
+			c.Not = true
+		}
+		if keyword := p.peek().keyword(); keyword != "unknown" && keyword != "null" {
+			return nil, p.unexpected(`"unknown"`)
+		}
+		p.advance()
+		c.Op = models.OperatorUnknown
+	default:
+		return nil, p.unexpected("comparison operator")
+	}
+
+	err := c.Validate()
+	if err != nil {
+		return nil, &SyntaxError{Pos: operator.pos, Msg: err.Error()}
+	}
+	return c, nil
+}
+
+func (p *parser) parseValue() (string, error) {
+	value := p.peek()
+	if value.kind != tokenString && value.kind != tokenNumber {
+		return "", p.unexpected("quoted string or number")
+	}
+	p.advance()
+	return value.text, nil
+}
+
+func (p *parser) parseList() ([]string, error) {
+	if p.peek().kind != tokenLParen {
+		return nil, p.unexpected(`"("`)
+	}
+	p.advance()
+	values := []string{}
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		if p.peek().kind != tokenComma {
+			break
+		}
+		p.advance()
+	}
+	if p.peek().kind != tokenRParen {
+		return nil, p.unexpected(`"," or ")"`)
+	}
+	p.advance()
+	return values, nil
+}
@@ -0,0 +1,158 @@
+package filterexpr_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"enrich-fio/internal/filterexpr"
+	"enrich-fio/internal/models"
+)
+
+func eq(field string, value string) models.Condition {
+	return models.Condition{Field: field, Op: models.OperatorEq, Values: []string{value}}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		want       models.Expr
+	}{
+		{
+			name:       "comparison",
+			expression: `age>30`,
+			want:       models.Condition{Field: "age", Op: models.OperatorGt, Values: []string{"30"}},
+		},
+		{
+			name:       "not equal",
+			expression: `gender != "male"`,
+			want:       models.Condition{Field: "gender", Op: models.OperatorEq, Values: []string{"male"}, Not: true},
+		},
+		{
+			name:       "negative number",
+			expression: `age >= -1`,
+			want:       models.Condition{Field: "age", Op: models.OperatorGte, Values: []string{"-1"}},
+		},
+		{
+			name:       "in",
+			expression: `nationality in ("RU", 'KZ')`,
+			want:       models.Condition{Field: "nationality", Op: models.OperatorIn, Values: []string{"RU", "KZ"}},
+		},
+		{
+			name:       "not in",
+			expression: `nationality NOT IN ("RU")`,
+			want:       models.Condition{Field: "nationality", Op: models.OperatorIn, Values: []string{"RU"}, Not: true},
+		},
+		{
+			name:       "is unknown",
+			expression: `age is unknown`,
+			want:       models.Condition{Field: "age", Op: models.OperatorUnknown},
+		},
+		{
+			name:       "is not null",
+			expression: `patronymic Is Not Null`,
+			want:       models.Condition{Field: "patronymic", Op: models.OperatorUnknown, Not: true},
+		},
+		{
+			name:       "escaped quotes",
+			expression: `name = "Jo\"hn" or name = 'O\'Brien'`,
+			want:       models.OrExpr{Left: eq("name", `Jo"hn`), Right: eq("name", "O'Brien")},
+		},
+		{
+			name:       "other quotes inside string",
+			expression: `name = "O'Brien"`,
+			want:       eq("name", "O'Brien"),
+		},
+		{
+			name:       "keywords inside string",
+			expression: `name = "and or not"`,
+			want:       eq("name", "and or not"),
+		},
+		{
+			name:       "and binds tighter than or",
+			expression: `name="a" or name="b" and name="c"`,
+			want:       models.OrExpr{Left: eq("name", "a"), Right: models.AndExpr{Left: eq("name", "b"), Right: eq("name", "c")}},
+		},
+		{
+			name:       "not binds tighter than and",
+			expression: `not name="a" and name="b"`,
+			want:       models.AndExpr{Left: models.NotExpr{Operand: eq("name", "a")}, Right: eq("name", "b")},
+		},
+		{
+			name:       "and is left associative",
+			expression: `name="a" and name="b" and name="c"`,
+			want:       models.AndExpr{Left: models.AndExpr{Left: eq("name", "a"), Right: eq("name", "b")}, Right: eq("name", "c")},
+		},
+		{
+			name:       "parentheses override precedence",
+			expression: `(name="a" or name="b") and name="c"`,
+			want:       models.AndExpr{Left: models.OrExpr{Left: eq("name", "a"), Right: eq("name", "b")}, Right: eq("name", "c")},
+		},
+		{
+			name:       "double negation",
+			expression: `not not name="a"`,
+			want:       models.NotExpr{Operand: models.NotExpr{Operand: eq("name", "a")}},
+		},
+		{
+			name:       "nested as deep as allowed",
+			expression: strings.Repeat("(", 32) + `name="a"` + strings.Repeat(")", 32),
+			want:       eq("name", "a"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := filterexpr.Parse(tt.expression)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		wantPos    int
+	}{
+		{name: "empty", expression: ``, wantPos: 1},
+		{name: "unknown field", expression: `age>1 and height>2`, wantPos: 11},
+		{name: "missing value", expression: `age >`, wantPos: 6},
+		{name: "unquoted value", expression: `name = John`, wantPos: 8},
+		{name: "unterminated string", expression: `name = "John`, wantPos: 8},
+		{name: "unexpected character", expression: `age = 1 & age = 2`, wantPos: 9},
+		{name: "lone bang", expression: `age ! 1`, wantPos: 5},
+		{name: "lone minus", expression: `age = -`, wantPos: 7},
+		{name: "missing operator", expression: `age 1`, wantPos: 5},
+		{name: "not without in", expression: `nationality not ("RU")`, wantPos: 17},
+		{name: "unclosed list", expression: `nationality in ("RU" "KZ")`, wantPos: 22},
+		{name: "empty list", expression: `nationality in ()`, wantPos: 17},
+		{name: "is without unknown", expression: `age is 1`, wantPos: 8},
+		{name: "unclosed parenthesis", expression: `(age = 1`, wantPos: 9},
+		{name: "trailing tokens", expression: `age = 1)`, wantPos: 8},
+		{name: "string compared with greater", expression: `name > "a"`, wantPos: 6},
+		{name: "position counts characters, not bytes", expression: `name = "Иван" ?`, wantPos: 15},
+		{name: "parentheses nested too deep", expression: strings.Repeat("(", 33) + `name="a"` + strings.Repeat(")", 33), wantPos: 33},
+		{name: "negations nested too deep", expression: strings.Repeat("not ", 33) + `name="a"`, wantPos: 129},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := filterexpr.Parse(tt.expression)
+			var syntaxErr *filterexpr.SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("got %#v and error %v, want syntax error", got, err)
+			}
+			if syntaxErr.Pos != tt.wantPos {
+				t.Fatalf("got error %v, want it at position %d", err, tt.wantPos)
+			}
+			if !errors.Is(err, models.ErrInvalidFilter) {
+				t.Fatalf("got error %v, want it to match %v", err, models.ErrInvalidFilter)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrTestFailed is error occured if value, pointed by test operation, differs from the expected one.
+var ErrTestFailed = errors.New("test operation failed")
+
+// Operation is a single operation of JSON patch.
+type Operation struct {
+	// Op is one of add, remove, replace, move, copy and test.
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	// From is a source of move and copy operations.
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Patch is a JSON patch (RFC 6902), a list of operations applied in order.
+type Patch []Operation
+
+// Parse returns JSON patch, checking every operation is known and has the members it needs.
+func Parse(data []byte) (Patch, error) {
+	patch := Patch{}
+	err := json.Unmarshal(data, &patch)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal patch")
+	}
+	for i, op := range patch {
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, errors.Errorf("operation %d: %s needs value", i, op.Op)
+			}
+		case "remove", "move", "copy":
+		default:
+			return nil, errors.Errorf("operation %d: unknown op %q", i, op.Op)
+		}
+	}
+	return patch, nil
+}
+
+// Apply returns JSON document with patch applied. Operations are applied to the document
+// one after another, and if any of them fails the whole patch fails.
+func (p Patch) Apply(document []byte) ([]byte, error) {
+	doc, err := decode(document)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode document")
+	}
+	for i, op := range p {
+		doc, err = op.apply(doc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "operation %d (%s %s)", i, op.Op, op.Path)
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// apply returns document with operation applied.
+func (op Operation) apply(doc interface{}) (interface{}, error) {
+	switch op.Op {
+	case "add":
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode value")
+		}
+		return add(doc, op.Path, value)
+	case "remove":
+		doc, _, err := remove(doc, op.Path)
+		return doc, err
+	case "replace":
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode value")
+		}
+		if op.Path == "" {
+			return value, nil
+		}
+		doc, _, err = remove(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.Path, value)
+	case "move":
+		if op.Path == op.From {
+			return doc, nil
+		}
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, errors.New("can't move value into itself")
+		}
+		doc, value, err := remove(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.Path, value)
+	case "copy":
+		value, err := get(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		// Copy must not share nested objects with the source.
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "copy value")
+		}
+		value, err = decode(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "copy value")
+		}
+		return add(doc, op.Path, value)
+	case "test":
+		expected, err := decode(op.Value)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode value")
+		}
+		actual, err := get(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(actual, expected) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+	return nil, errors.Errorf("unknown op %q", op.Op)
+}
+
+// decode decodes JSON value, keeping numbers as they are written.
+func decode(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("trailing data after value")
+	}
+	return value, nil
+}
+
+// parsePointer splits JSON pointer (RFC 6901) into unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, errors.Errorf("pointer %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	unescaper := strings.NewReplacer("~1", "/", "~0", "~")
+	for i := range tokens {
+		tokens[i] = unescaper.Replace(tokens[i])
+	}
+	return tokens, nil
+}
+
+// index returns array index, referenced by token. Index must be less than size.
+func index(token string, size int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, errors.Errorf("invalid array index %q", token)
+	}
+	if i >= size {
+		return 0, errors.Errorf("array index %d is out of range", i)
+	}
+	return i, nil
+}
+
+// update returns document, which container, holding value pointed by tokens, is replaced by fn's result.
+// fn is given the container and the last token.
+func update(doc interface{}, tokens []string, fn func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[tokens[0]]
+		if !ok {
+			return nil, errors.Errorf("member %q not found", tokens[0])
+		}
+		child, err := update(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[tokens[0]] = child
+		return node, nil
+	case []interface{}:
+		i, err := index(tokens[0], len(node))
+		if err != nil {
+			return nil, err
+		}
+		child, err := update(node[i], tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	}
+	return nil, errors.Errorf("can't reference %q in a scalar value", tokens[0])
+}
+
+// get returns value, pointed by pointer.
+func get(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			child, ok := node[token]
+			if !ok {
+				return nil, errors.Errorf("member %q not found", token)
+			}
+			doc = child
+		case []interface{}:
+			i, err := index(token, len(node))
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, errors.Errorf("can't reference %q in a scalar value", token)
+		}
+	}
+	return doc, nil
+}
+
+// add returns document with value added at pointer. Existing member is replaced,
+// and array elements starting from the index are shifted.
+func add(doc interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return update(doc, tokens, func(parent interface{}, key string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[key] = value
+			return node, nil
+		case []interface{}:
+			if key == "-" {
+				return append(node, value), nil
+			}
+			i, err := index(key, len(node)+1)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+		return nil, errors.Errorf("can't add %q to a scalar value", key)
+	})
+}
+
+// remove returns document without value at pointer, and the removed value.
+func remove(doc interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, errors.New("can't remove the whole document")
+	}
+	var removed interface{}
+	doc, err = update(doc, tokens, func(parent interface{}, key string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			value, ok := node[key]
+			if !ok {
+				return nil, errors.Errorf("member %q not found", key)
+			}
+			removed = value
+			delete(node, key)
+			return node, nil
+		case []interface{}:
+			i, err := index(key, len(node))
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return append(node[:i:i], node[i+1:]...), nil
+		}
+		return nil, errors.Errorf("can't remove %q from a scalar value", key)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, removed, nil
+}
+
+// equal tells if JSON values are equal. Numbers are equal if they have the same value, however written.
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if a == b {
+			return true
+		}
+		x, errX := a.Float64()
+		y, errY := b.Float64()
+		return errX == nil && errY == nil && x == y
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
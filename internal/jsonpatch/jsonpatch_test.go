@@ -0,0 +1,250 @@
+package jsonpatch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"enrich-fio/internal/jsonpatch"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		patch    string
+		want     string
+	}{
+		{
+			name:     "add member",
+			document: `{"name":"Ivan"}`,
+			patch:    `[{"op":"add","path":"/surname","value":"Ivanov"}]`,
+			want:     `{"name":"Ivan","surname":"Ivanov"}`,
+		},
+		{
+			name:     "add replaces member",
+			document: `{"name":"Ivan"}`,
+			patch:    `[{"op":"add","path":"/name","value":"Petr"}]`,
+			want:     `{"name":"Petr"}`,
+		},
+		{
+			name:     "add shifts array elements",
+			document: `{"tags":["a","c"]}`,
+			patch:    `[{"op":"add","path":"/tags/1","value":"b"}]`,
+			want:     `{"tags":["a","b","c"]}`,
+		},
+		{
+			name:     "add after the last array element",
+			document: `{"tags":["a"]}`,
+			patch:    `[{"op":"add","path":"/tags/1","value":"b"}]`,
+			want:     `{"tags":["a","b"]}`,
+		},
+		{
+			name:     "add to the end of array with -",
+			document: `{"tags":["a","b"]}`,
+			patch:    `[{"op":"add","path":"/tags/-","value":"c"}]`,
+			want:     `{"tags":["a","b","c"]}`,
+		},
+		{
+			name:     "add with escaped slash",
+			document: `{"attributes":{}}`,
+			patch:    `[{"op":"add","path":"/attributes/a~1b","value":1}]`,
+			want:     `{"attributes":{"a/b":1}}`,
+		},
+		{
+			name:     "add with escaped tilde",
+			document: `{"attributes":{}}`,
+			patch:    `[{"op":"add","path":"/attributes/a~0b","value":1}]`,
+			want:     `{"attributes":{"a~b":1}}`,
+		},
+		{
+			name:     "tilde is unescaped after slash",
+			document: `{"attributes":{}}`,
+			patch:    `[{"op":"add","path":"/attributes/~01","value":1}]`,
+			want:     `{"attributes":{"~1":1}}`,
+		},
+		{
+			name:     "add replaces the whole document",
+			document: `{"name":"Ivan"}`,
+			patch:    `[{"op":"add","path":"","value":{"name":"Petr"}}]`,
+			want:     `{"name":"Petr"}`,
+		},
+		{
+			name:     "remove member",
+			document: `{"name":"Ivan","patronymic":"Ivanovich"}`,
+			patch:    `[{"op":"remove","path":"/patronymic"}]`,
+			want:     `{"name":"Ivan"}`,
+		},
+		{
+			name:     "remove array element",
+			document: `{"tags":["a","b","c"]}`,
+			patch:    `[{"op":"remove","path":"/tags/1"}]`,
+			want:     `{"tags":["a","c"]}`,
+		},
+		{
+			name:     "replace member",
+			document: `{"age":30}`,
+			patch:    `[{"op":"replace","path":"/age","value":31}]`,
+			want:     `{"age":31}`,
+		},
+		{
+			name:     "replace array element",
+			document: `{"tags":["a","b"]}`,
+			patch:    `[{"op":"replace","path":"/tags/0","value":"c"}]`,
+			want:     `{"tags":["c","b"]}`,
+		},
+		{
+			name:     "move member",
+			document: `{"attributes":{"old":1}}`,
+			patch:    `[{"op":"move","from":"/attributes/old","path":"/attributes/new"}]`,
+			want:     `{"attributes":{"new":1}}`,
+		},
+		{
+			name:     "move to itself",
+			document: `{"name":"Ivan"}`,
+			patch:    `[{"op":"move","from":"/name","path":"/name"}]`,
+			want:     `{"name":"Ivan"}`,
+		},
+		{
+			name:     "move to sibling with the same prefix",
+			document: `{"a":1}`,
+			patch:    `[{"op":"move","from":"/a","path":"/ab"}]`,
+			want:     `{"ab":1}`,
+		},
+		{
+			name:     "copy doesn't share nested values",
+			document: `{"a":{"b":1}}`,
+			patch:    `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`,
+			want:     `{"a":{"b":1},"c":{"b":2}}`,
+		},
+		{
+			name:     "copy into own child",
+			document: `{"a":{"b":1}}`,
+			patch:    `[{"op":"copy","from":"/a","path":"/a/c"}]`,
+			want:     `{"a":{"b":1,"c":{"b":1}}}`,
+		},
+		{
+			name:     "test passes",
+			document: `{"name":"Ivan","tags":["a"],"attributes":{"x":null}}`,
+			patch:    `[{"op":"test","path":"/name","value":"Ivan"},{"op":"test","path":"/tags","value":["a"]},{"op":"test","path":"/attributes","value":{"x":null}}]`,
+			want:     `{"name":"Ivan","tags":["a"],"attributes":{"x":null}}`,
+		},
+		{
+			name:     "test compares numbers by value",
+			document: `{"age":30}`,
+			patch:    `[{"op":"test","path":"/age","value":30.0}]`,
+			want:     `{"age":30}`,
+		},
+		{
+			name:     "numbers are kept as written",
+			document: `{"id":12345678901234567890}`,
+			patch:    `[{"op":"add","path":"/age","value":1e2}]`,
+			want:     `{"id":12345678901234567890,"age":1e2}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := jsonpatch.Parse([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			got, err := patch.Apply([]byte(tt.document))
+			if err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			if canonical(t, string(got)) != canonical(t, tt.want) {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyFails(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		patch    string
+		// testFailed tells error must be ErrTestFailed.
+		testFailed bool
+	}{
+		{name: "test of different value", document: `{"name":"Ivan"}`, patch: `[{"op":"test","path":"/name","value":"Petr"}]`, testFailed: true},
+		{name: "test of different type", document: `{"age":30}`, patch: `[{"op":"test","path":"/age","value":"30"}]`, testFailed: true},
+		{name: "test of longer array", document: `{"tags":["a"]}`, patch: `[{"op":"test","path":"/tags","value":["a","b"]}]`, testFailed: true},
+		{name: "test of object with other members", document: `{"a":{"b":1}}`, patch: `[{"op":"test","path":"/a","value":{"c":1}}]`, testFailed: true},
+		{name: "test of missing member", document: `{}`, patch: `[{"op":"test","path":"/name","value":"Ivan"}]`},
+		{name: "failed test discards earlier operations", document: `{"name":"Ivan"}`, patch: `[{"op":"replace","path":"/name","value":"Petr"},{"op":"test","path":"/name","value":"Ivan"}]`, testFailed: true},
+		{name: "pointer without leading slash", document: `{"name":"Ivan"}`, patch: `[{"op":"remove","path":"name"}]`},
+		{name: "remove missing member", document: `{}`, patch: `[{"op":"remove","path":"/name"}]`},
+		{name: "remove the whole document", document: `{}`, patch: `[{"op":"remove","path":""}]`},
+		{name: "remove out of range index", document: `{"tags":["a"]}`, patch: `[{"op":"remove","path":"/tags/1"}]`},
+		{name: "remove with -", document: `{"tags":["a"]}`, patch: `[{"op":"remove","path":"/tags/-"}]`},
+		{name: "replace out of range index", document: `{"tags":["a"]}`, patch: `[{"op":"replace","path":"/tags/1","value":"b"}]`},
+		{name: "replace missing member", document: `{}`, patch: `[{"op":"replace","path":"/name","value":"Ivan"}]`},
+		{name: "add past the end of array", document: `{"tags":["a"]}`, patch: `[{"op":"add","path":"/tags/2","value":"b"}]`},
+		{name: "add at negative index", document: `{"tags":["a"]}`, patch: `[{"op":"add","path":"/tags/-1","value":"b"}]`},
+		{name: "add at index with leading zero", document: `{"tags":["a","b"]}`, patch: `[{"op":"add","path":"/tags/01","value":"c"}]`},
+		{name: "add to missing parent", document: `{}`, patch: `[{"op":"add","path":"/attributes/a","value":1}]`},
+		{name: "add to scalar", document: `{"name":"Ivan"}`, patch: `[{"op":"add","path":"/name/a","value":1}]`},
+		{name: "get - of array", document: `{"tags":["a"]}`, patch: `[{"op":"test","path":"/tags/-","value":"a"}]`},
+		{name: "move into own child", document: `{"a":{"b":1}}`, patch: `[{"op":"move","from":"/a","path":"/a/c"}]`},
+		{name: "move missing member", document: `{}`, patch: `[{"op":"move","from":"/a","path":"/b"}]`},
+		{name: "copy missing member", document: `{}`, patch: `[{"op":"copy","from":"/a","path":"/b"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := jsonpatch.Parse([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			got, err := patch.Apply([]byte(tt.document))
+			if err == nil {
+				t.Fatalf("got %s, want error", got)
+			}
+			if errors.Is(err, jsonpatch.ErrTestFailed) != tt.testFailed {
+				t.Fatalf("got error %v, want test failed %v", err, tt.testFailed)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		wantErr bool
+	}{
+		{name: "all operations", patch: `[{"op":"add","path":"/a","value":1},{"op":"remove","path":"/a"},{"op":"replace","path":"/a","value":1},{"op":"move","from":"/a","path":"/b"},{"op":"copy","from":"/a","path":"/b"},{"op":"test","path":"/a","value":1}]`},
+		{name: "null value", patch: `[{"op":"add","path":"/a","value":null}]`},
+		{name: "empty patch", patch: `[]`},
+		{name: "not an array", patch: `{"op":"add","path":"/a","value":1}`, wantErr: true},
+		{name: "unknown operation", patch: `[{"op":"merge","path":"/a","value":1}]`, wantErr: true},
+		{name: "add without value", patch: `[{"op":"add","path":"/a"}]`, wantErr: true},
+		{name: "test without value", patch: `[{"op":"test","path":"/a"}]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jsonpatch.Parse([]byte(tt.patch))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// canonical returns JSON document with members sorted, so equal documents are equal strings. Numbers are kept as written.
+func canonical(t *testing.T, document string) string {
+	t.Helper()
+	decoder := json.NewDecoder(strings.NewReader(document))
+	decoder.UseNumber()
+	var value any
+	err := decoder.Decode(&value)
+	if err != nil {
+		t.Fatalf("unmarshal %s: %v", document, err)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("marshal %s: %v", document, err)
+	}
+	return string(data)
+}
@@ -0,0 +1,94 @@
+// Package jwt verifies JSON Web Tokens, signed with HS256, the only algorithm service accepts.
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidToken is error occured if token is malformed, isn't signed with the secret or isn't valid at the moment.
+var ErrInvalidToken = errors.New("invalid token")
+
+// header is the first part of token.
+type header struct {
+	Alg string `json:"alg"`
+}
+
+// Verify checks signature of token with secret, and its expiration and not-before times against now.
+// Returns claims of the token.
+func Verify(token string, secret []byte, now time.Time) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.Wrap(ErrInvalidToken, "token must have 3 parts")
+	}
+	var h header
+	err := decodePart(parts[0], &h)
+	if err != nil {
+		return nil, errors.Wrap(err, "header")
+	}
+	// Accepting other algorithms, "none" above all, lets anyone forge tokens.
+	if h.Alg != "HS256" {
+		return nil, errors.Wrapf(ErrInvalidToken, "unsupported algorithm %q", h.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidToken, "decode signature: %v", err)
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, errors.Wrap(ErrInvalidToken, "signature mismatch")
+	}
+
+	claims := map[string]any{}
+	err = decodePart(parts[1], &claims)
+	if err != nil {
+		return nil, errors.Wrap(err, "claims")
+	}
+	// JSON null unmarshals into nil map without error.
+	if claims == nil {
+		return nil, errors.Wrap(ErrInvalidToken, "claims must be an object")
+	}
+	if exp, ok := claims["exp"].(float64); ok && !now.Before(time.Unix(int64(exp), 0)) {
+		return nil, errors.Wrap(ErrInvalidToken, "token is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.Wrap(ErrInvalidToken, "token is not valid yet")
+	}
+	return claims, nil
+}
+
+// Sign returns token with given claims, signed with secret.
+func Sign(claims map[string]any, secret []byte) (string, error) {
+	h, err := json.Marshal(header{Alg: "HS256"})
+	if err != nil {
+		return "", errors.Wrap(err, "marshal header")
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal claims")
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// decodePart decodes base64url encoded JSON part of token into v.
+func decodePart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.Wrapf(ErrInvalidToken, "decode: %v", err)
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return errors.Wrapf(ErrInvalidToken, "unmarshal: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package jwt_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"enrich-fio/internal/jwt"
+)
+
+var _secret = []byte("secret")
+
+// token returns token with given header and claims, signed by HMAC-SHA256 with secret, whatever header says.
+func token(t *testing.T, header map[string]any, claims map[string]any, secret []byte) string {
+	t.Helper()
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatalf("marshal header: %v", err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshal claims: %v", err)
+	}
+	return signed(base64.RawURLEncoding.EncodeToString(h)+"."+base64.RawURLEncoding.EncodeToString(c), secret)
+}
+
+// signed returns unsigned header and claims of token with HMAC-SHA256 signature of them with secret.
+func signed(unsigned string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestSignVerify(t *testing.T) {
+	signed, err := jwt.Sign(map[string]any{"tenant": "acme", "sub": "alice"}, _secret)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	claims, err := jwt.Verify(signed, _secret, time.Now())
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if claims["tenant"] != "acme" || claims["sub"] != "alice" {
+		t.Fatalf("got claims %v, want tenant acme and subject alice", claims)
+	}
+}
+
+func TestVerifyTimes(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name    string
+		claims  map[string]any
+		wantErr bool
+	}{
+		{name: "no times", claims: map[string]any{}},
+		{name: "expires later", claims: map[string]any{"exp": now.Unix() + 1}},
+		{name: "expires now", claims: map[string]any{"exp": now.Unix()}, wantErr: true},
+		{name: "expired", claims: map[string]any{"exp": now.Unix() - 1}, wantErr: true},
+		{name: "valid from now", claims: map[string]any{"nbf": now.Unix()}},
+		{name: "valid since earlier", claims: map[string]any{"nbf": now.Unix() - 1}},
+		{name: "valid from later", claims: map[string]any{"nbf": now.Unix() + 1}, wantErr: true},
+		{name: "valid now", claims: map[string]any{"nbf": now.Unix() - 60, "exp": now.Unix() + 60}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.Verify(token(t, map[string]any{"alg": "HS256"}, tt.claims, _secret), _secret, now)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, jwt.ErrInvalidToken) {
+				t.Fatalf("got error %v, want %v", err, jwt.ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestVerifyInvalid(t *testing.T) {
+	claims := map[string]any{"tenant": "acme"}
+	valid := token(t, map[string]any{"alg": "HS256"}, claims, _secret)
+	parts := strings.Split(valid, ".")
+	encode := base64.RawURLEncoding.EncodeToString
+	tests := map[string]string{
+		"alg none":             token(t, map[string]any{"alg": "none"}, claims, _secret),
+		"alg none unsigned":    encode([]byte(`{"alg":"none"}`)) + "." + parts[1] + ".",
+		"alg lowercase":        token(t, map[string]any{"alg": "hs256"}, claims, _secret),
+		"alg HS512":            token(t, map[string]any{"alg": "HS512"}, claims, _secret),
+		"alg RS256":            token(t, map[string]any{"alg": "RS256"}, claims, _secret),
+		"no alg":               token(t, map[string]any{"typ": "JWT"}, claims, _secret),
+		"other secret":         token(t, map[string]any{"alg": "HS256"}, claims, []byte("other")),
+		"changed claims":       parts[0] + "." + encode([]byte(`{"tenant":"evil"}`)) + "." + parts[2],
+		"no signature":         parts[0] + "." + parts[1] + ".",
+		"truncated signature":  parts[0] + "." + parts[1] + "." + parts[2][:10],
+		"two parts":            parts[0] + "." + parts[1],
+		"four parts":           valid + "." + parts[2],
+		"empty":                "",
+		"header not base64":    "!!!." + parts[1] + "." + parts[2],
+		"header not JSON":      encode([]byte("HS256")) + "." + parts[1] + "." + parts[2],
+		"signature not base64": parts[0] + "." + parts[1] + ".!!!",
+		"claims null":          token(t, map[string]any{"alg": "HS256"}, nil, _secret),
+		"claims array":         signed(parts[0]+"."+encode([]byte(`["acme"]`)), _secret),
+		"claims not base64":    signed(parts[0]+".!!!", _secret),
+	}
+	for name, invalid := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims, err := jwt.Verify(invalid, _secret, time.Now())
+			if !errors.Is(err, jwt.ErrInvalidToken) {
+				t.Fatalf("got claims %v and error %v, want %v", claims, err, jwt.ErrInvalidToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package models
+
+import "context"
+
+// Audit is an information about who and how requested a change.
+type Audit struct {
+	Actor  string
+	Source Source
+	// Operation overrides the operation, recorded by storage. Empty means storage decides by itself.
+	Operation Operation
+}
+
+type auditKey struct{}
+
+// WithAudit returns copy of ctx, carrying given audit information.
+func WithAudit(ctx context.Context, audit Audit) context.Context {
+	return context.WithValue(ctx, auditKey{}, audit)
+}
+
+// WithActor returns copy of ctx, in which recorded actor is overriden with given one.
+func WithActor(ctx context.Context, actor string) context.Context {
+	audit := AuditFromContext(ctx)
+	audit.Actor = actor
+	return WithAudit(ctx, audit)
+}
+
+// WithOperation returns copy of ctx, in which recorded operation is overriden with given one.
+func WithOperation(ctx context.Context, operation Operation) context.Context {
+	audit := AuditFromContext(ctx)
+	audit.Operation = operation
+	return WithAudit(ctx, audit)
+}
+
+// AuditFromContext returns audit information, carried by ctx.
+// Unknown actor and source are filled with defaults.
+func AuditFromContext(ctx context.Context) Audit {
+	audit, _ := ctx.Value(auditKey{}).(Audit)
+	if audit.Actor == "" {
+		audit.Actor = "anonymous"
+	}
+	if audit.Source == "" {
+		audit.Source = SourceUnknown
+	}
+	return audit
+}
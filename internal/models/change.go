@@ -1,14 +1,208 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Opt is a change of a single field. Absent field stays the same, null field is cleared
+// to its zero value, which means unknown, and field with value is set to it.
+// In JSON absent member is absent, null member is null and anything else is a value.
+type Opt[T any] struct {
+	value   T
+	present bool
+	null    bool
+}
+
+// Some returns change, setting field to given value.
+func Some[T any](value T) Opt[T] {
+	return Opt[T]{value: value, present: true}
+}
+
+// Null returns change, clearing field.
+func Null[T any]() Opt[T] {
+	return Opt[T]{present: true, null: true}
+}
+
+// Present tells if field is changed, either set or cleared.
+func (o Opt[T]) Present() bool {
+	return o.present
+}
+
+// IsNull tells if field is cleared.
+func (o Opt[T]) IsNull() bool {
+	return o.null
+}
+
+// Get returns new value of field. Cleared field gets zero value.
+func (o Opt[T]) Get() T {
+	return o.value
+}
+
+// Apply returns value of field after the change, given its current value.
+func (o Opt[T]) Apply(current T) T {
+	if !o.present {
+		return current
+	}
+	return o.value
+}
+
+// MarshalJSON marshals cleared field as null. Absent field must be omitted by its owner.
+func (o Opt[T]) MarshalJSON() ([]byte, error) {
+	if !o.present || o.null {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.value)
+}
+
+// UnmarshalJSON unmarshals null as cleared field, and anything else as field's value.
+// It is not called for absent members, so they stay absent.
+func (o *Opt[T]) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		*o = Null[T]()
+		return nil
+	}
+	var value T
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	*o = Some(value)
+	return nil
+}
 
 // ChangeConfig is config with changes, which should be applyed to storage.
+// It is also a JSON merge patch (RFC 7396) of a person.
 type ChangeConfig struct {
-	ID          uuid.UUID `json:"id"`
-	Name        string    `json:"name"`
-	Surname     string    `json:"surname"`
-	Patronymic  string    `json:"patronymic"`
-	Age         int       `json:"age"`
-	Gender      Gender    `json:"gender"`
-	Nationality string    `json:"nationality"`
+	ID          Opt[uuid.UUID] `json:"id"`
+	Name        Opt[string]    `json:"name"`
+	Surname     Opt[string]    `json:"surname"`
+	Patronymic  Opt[string]    `json:"patronymic"`
+	Age         Opt[int]       `json:"age"`
+	Gender      Opt[Gender]    `json:"gender"`
+	Nationality Opt[string]    `json:"nationality"`
+	// Nationalities replace all person's nationalities, and the first of them becomes Nationality.
+	// Cleared nationalities leave Nationality as it is. Nationalities are dropped, if only Nationality changes,
+	// as they don't rank the new one.
+	Nationalities Opt[[]Nationality] `json:"nationalities"`
+	// Attributes are merged into person's attributes: attribute with value is set, and null attribute is removed.
+	// Null Attributes remove all of them.
+	Attributes Opt[map[string]*string] `json:"attributes"`
+	// Tags replace all person's tags.
+	Tags Opt[[]string] `json:"tags"`
+	// ExpectedVersion is a version person must have for changes to be applied.
+	// Zero means changes are applied to any version.
+	ExpectedVersion int64 `json:"-"`
+}
+
+// Validate returns ErrNoChangesMade if no field is changed,
+// and ErrInvalidChange if ID, name or surname are cleared.
+func (c ChangeConfig) Validate() error {
+	if !c.ID.Present() && !c.Name.Present() && !c.Surname.Present() && !c.Patronymic.Present() &&
+		!c.Age.Present() && !c.Gender.Present() && !c.Nationality.Present() && !c.Nationalities.Present() && !c.Attributes.Present() && !c.Tags.Present() {
+		return ErrNoChangesMade
+	}
+	if c.ID.Present() && c.ID.Get() == uuid.Nil {
+		return errors.Wrap(ErrInvalidChange, "id is required")
+	}
+	if c.Name.Present() && c.Name.Get() == "" {
+		return errors.Wrap(ErrInvalidChange, "name is required")
+	}
+	if c.Surname.Present() && c.Surname.Get() == "" {
+		return errors.Wrap(ErrInvalidChange, "surname is required")
+	}
+	if c.Age.Get() < 0 {
+		return errors.Wrap(ErrInvalidChange, "age can't be negative")
+	}
+	err := ValidateNationalities(c.Nationalities.Get())
+	if err != nil {
+		return err
+	}
+	primary := PrimaryNationality(c.Nationalities.Get())
+	if c.Nationality.Present() && primary != "" && c.Nationality.Get() != primary {
+		return errors.Wrapf(ErrInvalidChange, "nationality %q must be the first of nationalities", c.Nationality.Get())
+	}
+	attributes := make(map[string]string, len(c.Attributes.Get()))
+	for key := range c.Attributes.Get() {
+		attributes[key] = ""
+	}
+	return ValidateLabels(attributes, c.Tags.Get())
+}
+
+// Apply returns person with changes applied. Version is left as it is.
+func (c ChangeConfig) Apply(person Person) Person {
+	person.ID = c.ID.Apply(person.ID)
+	person.Name = c.Name.Apply(person.Name)
+	person.Surname = c.Surname.Apply(person.Surname)
+	person.Patronymic = c.Patronymic.Apply(person.Patronymic)
+	person.Age = c.Age.Apply(person.Age)
+	person.Gender = c.Gender.Apply(person.Gender)
+	nationality := c.Nationality.Apply(person.Nationality)
+	if c.Nationalities.Present() {
+		person.Nationalities = c.Nationalities.Get()
+		if len(person.Nationalities) != 0 {
+			nationality = person.Nationalities[0].Country
+		}
+	} else if nationality != person.Nationality {
+		person.Nationalities = nil
+	}
+	person.Nationality = nationality
+	person.Attributes = c.applyAttributes(person.Attributes)
+	person.Tags = c.Tags.Apply(person.Tags)
+	return person
+}
+
+// applyAttributes returns attributes after the change, given the current ones. Current attributes are not modified.
+func (c ChangeConfig) applyAttributes(current map[string]string) map[string]string {
+	if !c.Attributes.Present() {
+		return current
+	}
+	if c.Attributes.IsNull() {
+		return nil
+	}
+	attributes := maps.Clone(current)
+	if attributes == nil {
+		attributes = map[string]string{}
+	}
+	for key, value := range c.Attributes.Get() {
+		if value == nil {
+			delete(attributes, key)
+			continue
+		}
+		attributes[key] = *value
+	}
+	return attributes
+}
+
+// ReplaceAttributes returns change of attributes, which turns current attributes into target ones.
+func ReplaceAttributes(current map[string]string, target map[string]string) Opt[map[string]*string] {
+	attributes := make(map[string]*string, len(current)+len(target))
+	for key := range current {
+		attributes[key] = nil
+	}
+	for key, value := range target {
+		value := value
+		attributes[key] = &value
+	}
+	return Some(attributes)
+}
+
+// ParseMergePatch returns changes, described by JSON merge patch (RFC 7396) of a person.
+// Returns ErrInvalidPatch if patch is not an object or has unknown members.
+func ParseMergePatch(patch []byte) (ChangeConfig, error) {
+	decoder := json.NewDecoder(bytes.NewReader(patch))
+	decoder.DisallowUnknownFields()
+	changes := ChangeConfig{}
+	err := decoder.Decode(&changes)
+	if err != nil {
+		return ChangeConfig{}, errors.Wrapf(ErrInvalidPatch, "%v", err)
+	}
+	if decoder.More() {
+		return ChangeConfig{}, errors.Wrap(ErrInvalidPatch, "trailing data after patch")
+	}
+	return changes, nil
 }
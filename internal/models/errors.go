@@ -2,11 +2,139 @@ package models
 
 import "errors"
 
+// ErrorCode is a kind of error, telling clients how to react to it. It is the same for every API.
+type ErrorCode string
+
+const (
+	// CodeNotFound is code of errors, occured if requested person or its data doesn't exist.
+	CodeNotFound ErrorCode = "NOT_FOUND"
+	// CodeConflict is code of errors, occured if request conflicts with the current state of person.
+	CodeConflict ErrorCode = "CONFLICT"
+	// CodeValidation is code of errors, occured if request is malformed.
+	CodeValidation ErrorCode = "VALIDATION"
+	// CodeUpstreamUnavailable is code of errors, occured if APIs to enrich people with can't be reached. Retry may help.
+	CodeUpstreamUnavailable ErrorCode = "UPSTREAM_UNAVAILABLE"
+	// CodeEnrichmentFailed is code of errors, occured if APIs to enrich people with know nothing about the person.
+	CodeEnrichmentFailed ErrorCode = "ENRICHMENT_FAILED"
+	// CodeUnauthorized is code of errors, occured if request lacks credentials, the operation requires.
+	CodeUnauthorized ErrorCode = "UNAUTHORIZED"
+	// CodeQuotaExceeded is code of errors, occured if tenant has used up its quota. Retry may help for rate quotas.
+	CodeQuotaExceeded ErrorCode = "QUOTA_EXCEEDED"
+	// CodeInternal is code of all the other errors.
+	CodeInternal ErrorCode = "INTERNAL"
+)
+
+// Error is an error with code.
+type Error struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError returns error with given code and message.
+func NewError(code ErrorCode, message string) error {
+	return &Error{Code: code, Err: errors.New(message)}
+}
+
+// WithCode returns err with given code. Code of err itself, if any, is overriden.
+func WithCode(code ErrorCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// CodeOf returns code of err, the outermost if there are several. Errors without code are CodeInternal.
+func CodeOf(err error) ErrorCode {
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	return CodeInternal
+}
+
 // ErrPersonNotFound is error occured if no record for given person found in storage.
-var ErrPersonNotFound = errors.New("person not found")
+var ErrPersonNotFound = NewError(CodeNotFound, "person not found")
+
+// ErrPersonExists is error occured if person with the same ID is already stored.
+var ErrPersonExists = NewError(CodeConflict, "person already exists")
 
 // ErrNoChangesMade is error occured if no changes were made after change request.
-var ErrNoChangesMade = errors.New("no changes made")
+var ErrNoChangesMade = NewError(CodeValidation, "no changes made")
+
+// ErrInvalidChange is error occured if change would leave person without required field.
+var ErrInvalidChange = NewError(CodeValidation, "invalid change")
+
+// ErrInvalidPatch is error occured if patch of a person is malformed or can't be applied.
+var ErrInvalidPatch = NewError(CodeValidation, "invalid patch")
+
+// ErrPatchTestFailed is error occured if test operation of JSON patch doesn't match the person.
+var ErrPatchTestFailed = NewError(CodeConflict, "patch test failed")
+
+// ErrVersionConflict is error occured if person was changed by someone else since the expected version.
+var ErrVersionConflict = NewError(CodeConflict, "person was changed by someone else")
+
+// ErrInvalidCursor is error occured if given pagination cursor is malformed or doesn't match the listing.
+var ErrInvalidCursor = NewError(CodeValidation, "invalid cursor")
+
+// ErrInvalidTotalMode is error occured if unknown way of counting people is requested.
+var ErrInvalidTotalMode = NewError(CodeValidation, "invalid total mode")
+
+// ErrInvalidSortKey is error occured if people can't be ordered by requested field.
+var ErrInvalidSortKey = NewError(CodeValidation, "invalid sort key")
+
+// ErrInvalidSearchQuery is error occured if search query is empty or malformed.
+var ErrInvalidSearchQuery = NewError(CodeValidation, "invalid search query")
+
+// ErrInvalidFilter is error occured if filter can't be applied to people.
+var ErrInvalidFilter = NewError(CodeValidation, "invalid filter")
 
 // ErrCouldNotEnrich is error occured if request to API to enrich person could not find info to enrich with.
-var ErrCouldNotEnrich = errors.New("could not enrich, try another name")
+var ErrCouldNotEnrich = NewError(CodeEnrichmentFailed, "could not enrich, try another name")
+
+// ErrUpstreamUnavailable is error occured if API to enrich person with could not be reached or answered with an error.
+var ErrUpstreamUnavailable = NewError(CodeUpstreamUnavailable, "enrichment API is unavailable")
+
+// ErrRevisionNotFound is error occured if no such revision recorded in person's history.
+var ErrRevisionNotFound = NewError(CodeNotFound, "revision not found")
+
+// ErrRevisionNotRestorable is error occured if person can't be reverted to given revision.
+var ErrRevisionNotRestorable = NewError(CodeConflict, "revision can't be restored")
+
+// ErrUnauthorized is error occured if admin operation is requested without valid admin token,
+// or if request doesn't tell a known tenant, while tenants are configured.
+var ErrUnauthorized = NewError(CodeUnauthorized, "unauthorized")
+
+// ErrQuotaExceeded is error occured if tenant keeps as many people, as its quota allows, or enriches people too often.
+var ErrQuotaExceeded = NewError(CodeQuotaExceeded, "quota exceeded")
+
+// ErrInvalidTenant is error occured if tenant config has no ID, repeated IDs or API keys, or negative quotas.
+var ErrInvalidTenant = NewError(CodeValidation, "invalid tenant")
+
+// ErrInvalidRetentionRule is error occured if retention rule has unknown action, negative period or invalid filter.
+var ErrInvalidRetentionRule = NewError(CodeValidation, "invalid retention rule")
+
+// ErrInvalidStatsQuery is error occured if people can't be grouped the requested way.
+var ErrInvalidStatsQuery = NewError(CodeValidation, "invalid stats query")
+
+// ErrInvalidExportFormat is error occured if people can't be exported in requested format.
+var ErrInvalidExportFormat = NewError(CodeValidation, "invalid export format")
+
+// ErrInvalidImport is error occured if import options are invalid, or file can't be imported with them.
+var ErrInvalidImport = NewError(CodeValidation, "invalid import")
+
+// ErrImportNotFound is error occured if no import job with given ID found in storage.
+var ErrImportNotFound = NewError(CodeNotFound, "import not found")
+
+// ErrImportClaimed is error occured if import job is done, or is run by another run, the claim of which hasn't expired.
+var ErrImportClaimed = NewError(CodeConflict, "import is claimed by another run")
+
+// ErrOutboxLocked is error occured if outbox is held by another relay.
+var ErrOutboxLocked = NewError(CodeConflict, "outbox is locked by another relay")
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"maps"
+	"slices"
+)
+
+// EventType is a kind of event about a person.
+type EventType string
+
+const (
+	EventPersonCreated EventType = "PersonCreated"
+	EventPersonUpdated EventType = "PersonUpdated"
+	EventPersonDeleted EventType = "PersonDeleted"
+	// EventPersonAnonymized tells, that FIO of person is replaced with hashes, and its copies must be replaced too.
+	EventPersonAnonymized EventType = "PersonAnonymized"
+	// EventPersonErased tells, that person and all its history are removed, and its copies must be removed too.
+	EventPersonErased EventType = "PersonErased"
+)
+
+// Event tells other services about a change of a person. Events are written to outbox
+// together with the change, and are delivered at least once, in the order changes were made.
+type Event struct {
+	// ID grows with every event, so consumers can skip events they have already seen.
+	ID   int64     `json:"id"`
+	Type EventType `json:"type"`
+	// Tenant is ID of tenant, the person belongs to.
+	Tenant string `json:"tenant"`
+	Revision
+	// Diff are fields, changed by update, by their JSON names. Empty for other events.
+	Diff map[string]FieldChange `json:"diff,omitempty"`
+}
+
+// FieldChange is a change of a single field of a person.
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// NewEvent returns event with given ID about a change of person of given tenant, recorded as given revision.
+func NewEvent(id int64, tenant string, revision Revision) Event {
+	event := Event{ID: id, Tenant: tenant, Revision: revision}
+	switch {
+	case revision.Operation == OperationAnonymize:
+		event.Type = EventPersonAnonymized
+	case revision.Operation == OperationErase:
+		event.Type = EventPersonErased
+	case revision.OldValue == nil:
+		event.Type = EventPersonCreated
+	case revision.NewValue == nil:
+		event.Type = EventPersonDeleted
+	default:
+		event.Type = EventPersonUpdated
+		event.Diff = Diff(*revision.OldValue, *revision.NewValue)
+	}
+	return event
+}
+
+// Diff returns fields, which differ between old and new person, by their JSON names. Version is not compared.
+func Diff(old Person, new Person) map[string]FieldChange {
+	diff := map[string]FieldChange{}
+	compare := func(field string, oldValue interface{}, newValue interface{}) {
+		if oldValue != newValue {
+			diff[field] = FieldChange{Old: oldValue, New: newValue}
+		}
+	}
+	compare("id", old.ID, new.ID)
+	compare("name", old.Name, new.Name)
+	compare("surname", old.Surname, new.Surname)
+	compare("patronymic", old.Patronymic, new.Patronymic)
+	compare("age", old.Age, new.Age)
+	compare("gender", old.Gender, new.Gender)
+	compare("nationality", old.Nationality, new.Nationality)
+	// Maps and slices can't be compared as interfaces.
+	if !slices.Equal(old.Nationalities, new.Nationalities) {
+		diff["nationalities"] = FieldChange{Old: old.Nationalities, New: new.Nationalities}
+	}
+	if !maps.Equal(old.Attributes, new.Attributes) {
+		diff["attributes"] = FieldChange{Old: old.Attributes, New: new.Attributes}
+	}
+	if !slices.Equal(old.Tags, new.Tags) {
+		diff["tags"] = FieldChange{Old: old.Tags, New: new.Tags}
+	}
+	return diff
+}
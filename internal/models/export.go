@@ -0,0 +1,24 @@
+package models
+
+import "github.com/pkg/errors"
+
+// ExportFormat is a format, people are exported in.
+type ExportFormat string
+
+const (
+	// ExportCSV is comma separated values with a header. Nationalities and attributes are JSON, tags are JSON array.
+	ExportCSV ExportFormat = "csv"
+	// ExportNDJSON is a JSON object of person per line.
+	ExportNDJSON ExportFormat = "ndjson"
+	// ExportParquet is a parquet file with a row of person per line.
+	ExportParquet ExportFormat = "parquet"
+)
+
+// Validate returns ErrInvalidExportFormat if people can't be exported in format.
+func (f ExportFormat) Validate() error {
+	switch f {
+	case ExportCSV, ExportNDJSON, ExportParquet:
+		return nil
+	}
+	return errors.Wrapf(ErrInvalidExportFormat, "unknown format %q", f)
+}
@@ -0,0 +1,43 @@
+package models
+
+import "fmt"
+
+// Expr is a node of filter expression tree.
+// Leaves of the tree are Condition values.
+type Expr interface {
+	expr()
+}
+
+// AndExpr holds if both of its operands hold.
+type AndExpr struct {
+	Left  Expr
+	Right Expr
+}
+
+// OrExpr holds if any of its operands holds.
+type OrExpr struct {
+	Left  Expr
+	Right Expr
+}
+
+// NotExpr holds if its operand doesn't hold, including when operand's fields are unknown.
+type NotExpr struct {
+	Operand Expr
+}
+
+func (Condition) expr() {}
+func (AndExpr) expr()   {}
+func (OrExpr) expr()    {}
+func (NotExpr) expr()   {}
+
+func (e AndExpr) String() string {
+	return fmt.Sprintf("(%v and %v)", e.Left, e.Right)
+}
+
+func (e OrExpr) String() string {
+	return fmt.Sprintf("(%v or %v)", e.Left, e.Right)
+}
+
+func (e NotExpr) String() string {
+	return fmt.Sprintf("not %v", e.Operand)
+}
@@ -1,6 +1,13 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
 
 // FilterConfig is config with filters, that should be applyed during storage search.
 type FilterConfig struct {
@@ -11,10 +18,169 @@ type FilterConfig struct {
 	Age         FilterAge
 	Gender      Gender
 	Nationality string
+	// NationalityMatch tells, which of person's nationalities Nationality matches. Empty means the primary one.
+	NationalityMatch NationalityMatch
+	// Tags are tags, person must have all of.
+	Tags []string
+	// Attributes are attributes, person must have with the same values.
+	Attributes map[string]string
+	// Conditions are additional predicates, all of which must hold.
+	Conditions []Condition
+	// AnyOf are groups of predicates. Each group holds, if any of its predicates holds.
+	AnyOf [][]Condition
+	// Expr is an arbitrary filter expression, that must hold. Nil means no expression.
+	Expr Expr
 }
 
-// FilterAge is filter for age.
+// FilterAge is filter for age. Nil bound leaves the range open from that side.
 type FilterAge struct {
-	Min int
-	Max int
+	Min *int
+	Max *int
+}
+
+// Operator is a way condition compares person's field with values.
+type Operator string
+
+const (
+	// OperatorEq holds if field equals the value.
+	OperatorEq Operator = "eq"
+	// OperatorIn holds if field equals any of the values.
+	OperatorIn Operator = "in"
+	// OperatorGt holds if field is greater than the value.
+	OperatorGt Operator = "gt"
+	// OperatorGte holds if field is greater than or equal to the value.
+	OperatorGte Operator = "gte"
+	// OperatorLt holds if field is less than the value.
+	OperatorLt Operator = "lt"
+	// OperatorLte holds if field is less than or equal to the value.
+	OperatorLte Operator = "lte"
+	// OperatorUnknown holds if field's value is not known. Takes no values.
+	OperatorUnknown Operator = "unknown"
+)
+
+// FieldKind is a kind of values person's field holds.
+type FieldKind int
+
+const (
+	FieldString FieldKind = iota
+	FieldInt
+	FieldUUID
+)
+
+// FilterFields are person fields, people can be filtered by, with kinds of their values.
+var FilterFields = map[string]FieldKind{
+	"id":          FieldUUID,
+	"name":        FieldString,
+	"surname":     FieldString,
+	"patronymic":  FieldString,
+	"age":         FieldInt,
+	"gender":      FieldString,
+	"nationality": FieldString,
+	"version":     FieldInt,
+}
+
+// Condition is a single predicate over person's field.
+type Condition struct {
+	Field  string
+	Op     Operator
+	Values []string
+	// Not negates the condition. Negated condition holds for unknown values too.
+	Not bool
+}
+
+// Validate checks that condition can be applied to people.
+// Returns ErrInvalidFilter if it can't.
+func (c Condition) Validate() error {
+	kind, ok := FilterFields[c.Field]
+	if !ok {
+		return errors.Wrapf(ErrInvalidFilter, "unknown field %q", c.Field)
+	}
+	switch c.Op {
+	case OperatorEq:
+		if len(c.Values) != 1 {
+			return errors.Wrapf(ErrInvalidFilter, "%s %s takes exactly one value", c.Field, c.Op)
+		}
+	case OperatorIn:
+		if len(c.Values) == 0 {
+			return errors.Wrapf(ErrInvalidFilter, "%s %s takes at least one value", c.Field, c.Op)
+		}
+	case OperatorGt, OperatorGte, OperatorLt, OperatorLte:
+		if kind != FieldInt {
+			return errors.Wrapf(ErrInvalidFilter, "%s can't be compared with %s", c.Field, c.Op)
+		}
+		if len(c.Values) != 1 {
+			return errors.Wrapf(ErrInvalidFilter, "%s %s takes exactly one value", c.Field, c.Op)
+		}
+	case OperatorUnknown:
+		if len(c.Values) != 0 {
+			return errors.Wrapf(ErrInvalidFilter, "%s %s takes no values", c.Field, c.Op)
+		}
+	default:
+		return errors.Wrapf(ErrInvalidFilter, "unknown operator %q", c.Op)
+	}
+	for _, value := range c.Values {
+		var err error
+		switch kind {
+		case FieldInt:
+			_, err = strconv.Atoi(value)
+		case FieldUUID:
+			_, err = uuid.Parse(value)
+		}
+		if err != nil {
+			return errors.Wrapf(ErrInvalidFilter, "%s value %q: %v", c.Field, value, err)
+		}
+	}
+	return nil
+}
+
+// String returns condition in the form ParseCondition accepts.
+func (c Condition) String() string {
+	not := ""
+	if c.Not {
+		not = "!"
+	}
+	return fmt.Sprintf("%s[%s%s]:%s", c.Field, not, c.Op, strings.Join(c.Values, ","))
+}
+
+// ParseCondition parses condition from a key like "age[gte]" or "nationality[!in]" and its comma separated values.
+// Key without operator means equality. Leading exclamation mark negates the operator.
+// Returns ErrInvalidFilter if condition is malformed.
+func ParseCondition(key string, values string) (Condition, error) {
+	c := Condition{Field: key, Op: OperatorEq}
+	if open := strings.Index(key, "["); open != -1 {
+		if !strings.HasSuffix(key, "]") {
+			return Condition{}, errors.Wrapf(ErrInvalidFilter, "unclosed operator in %q", key)
+		}
+		c.Field = key[:open]
+		op := key[open+1 : len(key)-1]
+		c.Not = strings.HasPrefix(op, "!")
+		c.Op = Operator(strings.TrimPrefix(op, "!"))
+	}
+	switch {
+	case c.Op == OperatorUnknown:
+	case c.Op == OperatorIn:
+		c.Values = strings.Split(values, ",")
+	default:
+		c.Values = []string{values}
+	}
+	err := c.Validate()
+	if err != nil {
+		return Condition{}, err
+	}
+	return c, nil
+}
+
+// ParseConditionGroup parses "|" separated conditions of the form "key:values", like "age[gte]:60|nationality[in]:RU,KZ".
+// Returns ErrInvalidFilter if any condition is malformed.
+func ParseConditionGroup(group string) ([]Condition, error) {
+	conditions := []Condition{}
+	for _, item := range strings.Split(group, "|") {
+		key, values, _ := strings.Cut(item, ":")
+		c, err := ParseCondition(key, values)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions, nil
 }
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Operation is a kind of change, made to a person.
+type Operation string
+
+const (
+	OperationCreate Operation = "create"
+	OperationUpdate Operation = "update"
+	OperationEnrich Operation = "enrich"
+	OperationDelete Operation = "delete"
+	OperationRevert Operation = "revert"
+	// OperationAnonymize replaces FIO with hashes. History before it is forgotten.
+	OperationAnonymize Operation = "anonymize"
+	// OperationErase removes person with all its history, so it is never recorded in history itself.
+	OperationErase Operation = "erase"
+)
+
+// Source is a controller, through which the change was requested.
+type Source string
+
+const (
+	SourceUnknown Source = "unknown"
+	SourceREST    Source = "rest"
+	SourceGraphQL Source = "graphql"
+	SourceKafka   Source = "kafka"
+	// SourceCLI is admin command line.
+	SourceCLI Source = "cli"
+	// SourceRetention is retention rules, applied by the service itself.
+	SourceRetention Source = "retention"
+	// SourceImport is import of people from file.
+	SourceImport Source = "import"
+)
+
+// Revision is a single recorded change of a person.
+type Revision struct {
+	PersonID  uuid.UUID `json:"personId"`
+	Revision  int       `json:"revision"`
+	Operation Operation `json:"operation"`
+	// OldValue is a person before the change. Nil for created people.
+	OldValue *Person `json:"oldValue"`
+	// NewValue is a person after the change. Nil for deleted people.
+	NewValue  *Person   `json:"newValue"`
+	Actor     string    `json:"actor"`
+	Source    Source    `json:"source"`
+	ChangedAt time.Time `json:"changedAt"`
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// ImportFormat is a format of file, people are imported from.
+type ImportFormat string
+
+const (
+	// ImportCSV is comma separated values with a header, naming the columns.
+	ImportCSV ImportFormat = "csv"
+	// ImportNDJSON is a JSON object per line.
+	ImportNDJSON ImportFormat = "ndjson"
+)
+
+// ImportColumns are columns of CSV file, or members of NDJSON objects, FIO of people is read from.
+type ImportColumns struct {
+	Name       string `json:"name"`
+	Surname    string `json:"surname"`
+	Patronymic string `json:"patronymic"`
+}
+
+// ImportOptions are options of import job.
+type ImportOptions struct {
+	Format  ImportFormat  `json:"format"`
+	Columns ImportColumns `json:"columns"`
+	// Enrich tells to enrich imported people with age, gender and nationality. People are imported with FIO only otherwise.
+	Enrich bool `json:"enrich"`
+}
+
+// WithDefaults returns import options with defaults filled in: csv format and columns, named the same as FIO parts.
+// Returns ErrInvalidImport if format is unknown or FIO parts are read from the same column.
+func (o ImportOptions) WithDefaults() (ImportOptions, error) {
+	switch o.Format {
+	case "":
+		o.Format = ImportCSV
+	case ImportCSV, ImportNDJSON:
+	default:
+		return ImportOptions{}, errors.Wrapf(ErrInvalidImport, "unknown format %q", o.Format)
+	}
+	if o.Columns.Name == "" {
+		o.Columns.Name = "name"
+	}
+	if o.Columns.Surname == "" {
+		o.Columns.Surname = "surname"
+	}
+	if o.Columns.Patronymic == "" {
+		o.Columns.Patronymic = "patronymic"
+	}
+	if o.Columns.Name == o.Columns.Surname || o.Columns.Name == o.Columns.Patronymic || o.Columns.Surname == o.Columns.Patronymic {
+		return ImportOptions{}, errors.Wrapf(ErrInvalidImport, "FIO parts are read from the same column: %+v", o.Columns)
+	}
+	return o, nil
+}
+
+// ImportStatus is a state of import job.
+type ImportStatus string
+
+const (
+	// ImportPending is a job, which rows are read from file, but not imported yet.
+	ImportPending ImportStatus = "pending"
+	// ImportRunning is a job, which rows are being imported.
+	ImportRunning ImportStatus = "running"
+	// ImportPaused is a job, stopped by an error, which may go away, like unavailable enrichment API or exceeded quota.
+	// Resumed job imports the rows, left pending.
+	ImportPaused ImportStatus = "paused"
+	// ImportDone is a job, all rows of which are imported or failed.
+	ImportDone ImportStatus = "done"
+)
+
+// ImportJob is a job, importing people from a file. Rows of the file are kept along with the job, so it can be resumed.
+type ImportJob struct {
+	ID      uuid.UUID     `json:"id"`
+	Status  ImportStatus  `json:"status"`
+	Options ImportOptions `json:"options"`
+	// Error is why the job is paused.
+	Error string `json:"error,omitempty"`
+	// Rows is a number of rows, read from file. Rows, neither imported nor failed, are pending.
+	Rows      int       `json:"rows"`
+	Imported  int       `json:"imported"`
+	Failed    int       `json:"failed"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Runner is ID of the run, which claimed the job, so only it imports the rows. It's known to the run only.
+	Runner uuid.UUID `json:"-"`
+}
+
+// ImportClaim is a claim of import job by a run, so no two runs import its rows at once.
+type ImportClaim struct {
+	// Runner is ID of the run.
+	Runner uuid.UUID
+	// Until is when claim expires, unless it's renewed, so job of a crashed run can be claimed by another one.
+	Until time.Time
+	// Renew tells to extend the claim, the run holds already, rather than to claim the job anew.
+	Renew bool
+}
+
+// ImportRowStatus is a result of importing a row.
+type ImportRowStatus string
+
+const (
+	ImportRowPending  ImportRowStatus = "pending"
+	ImportRowImported ImportRowStatus = "imported"
+	ImportRowFailed   ImportRowStatus = "failed"
+)
+
+// ImportRow is a row of imported file and the result of its import.
+type ImportRow struct {
+	// Row is a number of row in file, starting from 1. Header of CSV file and blank lines are not counted.
+	Row    int             `json:"row"`
+	Status ImportRowStatus `json:"status"`
+	// PersonID is ID of person, the row is imported as. It's chosen when the row is read,
+	// so the row, imported again after a failure, overwrites the same person.
+	PersonID   uuid.UUID `json:"personId"`
+	Name       string    `json:"name"`
+	Surname    string    `json:"surname"`
+	Patronymic string    `json:"patronymic"`
+	// Error is why the row failed.
+	Error string `json:"error,omitempty"`
+}
+
+// ImportRowsQuery is a query of rows of import job.
+type ImportRowsQuery struct {
+	// After is a number of row, only rows after which are returned.
+	After int
+	// Limit is the most rows returned.
+	Limit int
+	// Pending tells to return only pending rows.
+	Pending bool
+}
@@ -0,0 +1,70 @@
+package models
+
+import "strings"
+
+// ListOptions configures pagination of people listing.
+type ListOptions struct {
+	// Page is a zero-based page number. Ignored if Cursor is set.
+	// Kept for compatibility, Cursor is faster on deep pages.
+	Page int
+	// PageSize is a number of people on a page. Zero means default page size.
+	PageSize int
+	// Cursor is an opaque position in listing, taken from previously returned PeoplePage.
+	Cursor string
+	// Total tells whether and how to count all people, matching the filter.
+	Total TotalMode
+	// Sort are person fields, people are ordered by. Empty means order by name.
+	Sort []SortKey
+}
+
+// SortKey is a person field, people listing is ordered by.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// ParseSort parses comma separated sort keys, like "-age,surname".
+// Leading minus means descending order. Fields are validated by storage.
+func ParseSort(sort string) []SortKey {
+	keys := []SortKey{}
+	for _, field := range strings.Split(sort, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key := SortKey{Field: strings.TrimPrefix(field, "-"), Desc: strings.HasPrefix(field, "-")}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// TotalMode tells whether and how people listing counts all matching people.
+type TotalMode string
+
+const (
+	// TotalNone doesn't count people.
+	TotalNone TotalMode = ""
+	// TotalExact counts people precisely, which is slow on large tables.
+	TotalExact TotalMode = "exact"
+	// TotalEstimated allows to take total from table statistics, if table is large and listing is not filtered.
+	TotalEstimated TotalMode = "estimated"
+)
+
+// PeoplePage is a single page of people listing.
+type PeoplePage struct {
+	People []Person
+	// NextCursor points to the next page. Empty if there is no next page.
+	NextCursor string
+	// PrevCursor points to the previous page. Empty if there is no previous page.
+	PrevCursor string
+	// Page is a zero-based page number. Nil if page was requested by cursor.
+	Page *int
+	// PageSize is a page size, actually used by the storage.
+	PageSize int
+	// HasMore is set if there are people after this page.
+	HasMore bool
+	// Total is a number of all people, matching the filter. Nil if not requested.
+	Total *int64
+	// TotalEstimated is set if Total is taken from statistics and is not precise.
+	TotalEstimated bool
+}
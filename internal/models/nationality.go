@@ -0,0 +1,60 @@
+package models
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Nationality is a country, person probably belongs to.
+type Nationality struct {
+	// Country is ISO 3166-1 alpha-2 code of the country.
+	Country string `json:"country"`
+	// Probability is from 0 to 1. Zero means unknown.
+	Probability float64 `json:"probability"`
+}
+
+// PrimaryNationality returns country of the first, the most likely, of nationalities, or empty string if there are none.
+func PrimaryNationality(nationalities []Nationality) string {
+	if len(nationalities) == 0 {
+		return ""
+	}
+	return nationalities[0].Country
+}
+
+// ValidateNationalities checks that nationalities have countries, which are not repeated, and probabilities from 0 to 1.
+// Returns ErrInvalidChange if they don't.
+func ValidateNationalities(nationalities []Nationality) error {
+	seen := make(map[string]bool, len(nationalities))
+	for _, n := range nationalities {
+		if n.Country == "" || len(n.Country) > 10 {
+			return errors.Wrapf(ErrInvalidChange, "country %q must be non-empty code of up to 10 characters", n.Country)
+		}
+		if seen[n.Country] {
+			return errors.Wrapf(ErrInvalidChange, "repeated country %q", n.Country)
+		}
+		seen[n.Country] = true
+		if n.Probability < 0 || n.Probability > 1 {
+			return errors.Wrapf(ErrInvalidChange, "probability of %q must be from 0 to 1", n.Country)
+		}
+	}
+	return nil
+}
+
+// NationalityMatch tells, which of person's nationalities the nationality filter matches.
+type NationalityMatch string
+
+const (
+	// NationalityPrimary matches the most likely nationality only. It's the default.
+	NationalityPrimary NationalityMatch = "primary"
+	// NationalityAny matches any of person's nationalities.
+	NationalityAny NationalityMatch = "any"
+)
+
+// Validate checks that match is known. Empty match is the primary one.
+// Returns ErrInvalidFilter if it's not.
+func (m NationalityMatch) Validate() error {
+	switch m {
+	case "", NationalityPrimary, NationalityAny:
+		return nil
+	}
+	return errors.Wrapf(ErrInvalidFilter, "unknown nationality match %q", m)
+}
@@ -1,6 +1,12 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"maps"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
 
 // Person a result of service's buisness logic.
 type Person struct {
@@ -11,6 +17,43 @@ type Person struct {
 	Age         int       `json:"age"`
 	Gender      Gender    `json:"gender"`
 	Nationality string    `json:"nationality"`
+	// Nationalities are countries, person probably belongs to, the most likely first. Nationality is the first of them.
+	// They are empty, if nationality is set without probabilities. Nil and empty nationalities are the same.
+	Nationalities []Nationality `json:"nationalities,omitempty"`
+	// Attributes are custom key-value data of a person, set by clients. Nil and empty attributes are the same.
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Tags are custom labels of a person, set by clients. Nil and empty tags are the same.
+	Tags []string `json:"tags,omitempty"`
+	// Version is incremented on every change of a person.
+	Version int64 `json:"version"`
+}
+
+// Equal tells if person has the same fields as other one. Nil and empty nationalities, attributes and tags are equal.
+func (p Person) Equal(other Person) bool {
+	return p.ID == other.ID && p.Name == other.Name && p.Surname == other.Surname && p.Patronymic == other.Patronymic &&
+		p.Age == other.Age && p.Gender == other.Gender && p.Nationality == other.Nationality && p.Version == other.Version &&
+		slices.Equal(p.Nationalities, other.Nationalities) && maps.Equal(p.Attributes, other.Attributes) && slices.Equal(p.Tags, other.Tags)
+}
+
+// ValidateLabels checks that attributes have non-empty keys, and tags are non-empty and not repeated.
+// Returns ErrInvalidChange if they don't.
+func ValidateLabels(attributes map[string]string, tags []string) error {
+	for key := range attributes {
+		if key == "" {
+			return errors.Wrap(ErrInvalidChange, "attribute key is required")
+		}
+	}
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if tag == "" {
+			return errors.Wrap(ErrInvalidChange, "tag can't be empty")
+		}
+		if seen[tag] {
+			return errors.Wrapf(ErrInvalidChange, "repeated tag %q", tag)
+		}
+		seen[tag] = true
+	}
+	return nil
 }
 
 // Gender is a type for gender value in a Person.
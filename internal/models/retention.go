@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Tombstone is a trace of erased person. It proves the erasure without keeping any personal data.
+type Tombstone struct {
+	PersonID uuid.UUID `json:"personId"`
+	ErasedAt time.Time `json:"erasedAt"`
+	Actor    string    `json:"actor"`
+	Source   Source    `json:"source"`
+}
+
+// RetentionAction is what is done with people, kept longer than retention rule allows.
+type RetentionAction string
+
+const (
+	// RetentionAnonymize replaces FIO with hashes, keeping the rest for statistics.
+	RetentionAnonymize RetentionAction = "anonymize"
+	// RetentionErase removes people with all their history.
+	RetentionErase RetentionAction = "erase"
+)
+
+// RetentionRule tells what to do with people, kept longer than given number of days.
+type RetentionRule struct {
+	Action RetentionAction `json:"action"`
+	// AfterDays is how many days after being added people are subject to the rule.
+	AfterDays int `json:"afterDays"`
+	// Filter is a filter expression, like in people listing, limiting the rule to matching people.
+	// Empty filter matches everyone.
+	Filter string `json:"filter,omitempty"`
+}
+
+// ExpiredQuery selects people, retention rule applies to.
+type ExpiredQuery struct {
+	// Action is action of the rule. Anonymize rules skip people, anonymized already, while erase rules don't.
+	Action RetentionAction
+	Filter FilterConfig
+	// AddedBefore selects people, added before the moment. People, added before history was kept, are always selected.
+	AddedBefore time.Time
+	// After selects people with greater IDs only, so people can be iterated in batches.
+	After uuid.UUID
+	Limit int
+}
+
+// RetentionResult tells what retention rule did.
+type RetentionResult struct {
+	Rule RetentionRule `json:"rule"`
+	// Matched is a number of people, the rule applies to.
+	Matched int `json:"matched"`
+	// Applied is a number of people, anonymized or erased. It is zero for dry run.
+	Applied int `json:"applied"`
+	Failed  int `json:"failed"`
+	// Errors tell why people failed to be anonymized or erased.
+	Errors []string `json:"errors,omitempty"`
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SearchMode is a way search text is matched against person's FIO.
+type SearchMode string
+
+const (
+	// SearchSimilar matches fields, similar to the text: "Ivan" finds "Iwan" and "Ivanov".
+	SearchSimilar SearchMode = "similar"
+	// SearchPrefix matches fields, starting with the text.
+	SearchPrefix SearchMode = "prefix"
+)
+
+// DefaultMinSimilarity is a similarity threshold, low enough for "Ivan" to find "Iwan".
+const DefaultMinSimilarity = 0.2
+
+// SearchableFields are person fields, search is performed over.
+var SearchableFields = []string{"name", "surname", "patronymic"}
+
+// SearchQuery is a query for searching people by FIO. Matching ignores case and accents.
+type SearchQuery struct {
+	Text string
+	// Mode is a way text is matched. Empty means SearchSimilar.
+	Mode SearchMode
+	// Fields to search in. Empty means all of SearchableFields.
+	Fields []string
+	// MinSimilarity is the lowest similarity from 0 to 1, field must have to match. Zero means default.
+	MinSimilarity float64
+}
+
+// WithDefaults returns search query with defaults filled in.
+// Returns ErrInvalidSearchQuery if query is empty or malformed.
+func (q SearchQuery) WithDefaults() (SearchQuery, error) {
+	q.Text = strings.TrimSpace(q.Text)
+	if q.Text == "" {
+		return SearchQuery{}, errors.Wrap(ErrInvalidSearchQuery, "empty text")
+	}
+	switch q.Mode {
+	case "":
+		q.Mode = SearchSimilar
+	case SearchSimilar, SearchPrefix:
+	default:
+		return SearchQuery{}, errors.Wrapf(ErrInvalidSearchQuery, "unknown mode %q", q.Mode)
+	}
+	if len(q.Fields) == 0 {
+		q.Fields = SearchableFields
+	}
+	for _, field := range q.Fields {
+		if !searchable(field) {
+			return SearchQuery{}, errors.Wrapf(ErrInvalidSearchQuery, "field %q is not searchable", field)
+		}
+	}
+	if q.MinSimilarity < 0 || q.MinSimilarity > 1 {
+		return SearchQuery{}, errors.Wrap(ErrInvalidSearchQuery, "similarity must be from 0 to 1")
+	}
+	if q.MinSimilarity == 0 {
+		q.MinSimilarity = DefaultMinSimilarity
+	}
+	return q, nil
+}
+
+func searchable(field string) bool {
+	for _, searchableField := range SearchableFields {
+		if field == searchableField {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchResult is a person, found by search, with its score.
+type SearchResult struct {
+	Person Person `json:"person"`
+	// Score is from 0 to 1, the higher the better person matches.
+	Score float64 `json:"score"`
+}
+
+// SearchPage is a single page of search results, the best matches first.
+type SearchPage struct {
+	Results  []SearchResult `json:"results"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"pageSize"`
+	HasMore  bool           `json:"hasMore"`
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// StatsGroup is a person's characteristic, people can be grouped by in statistics.
+type StatsGroup string
+
+const (
+	StatsByGender      StatsGroup = "gender"
+	StatsByNationality StatsGroup = "nationality"
+	// StatsByAge groups people by age buckets of StatsQuery.AgeBucketSize years.
+	StatsByAge StatsGroup = "age"
+)
+
+// DefaultAgeBucketSize is a number of years in an age bucket, if client didn't choose one.
+const DefaultAgeBucketSize = 10
+
+// StatsQuery is a query for statistics over people.
+type StatsQuery struct {
+	// GroupBy are characteristics to group people by. Empty means all people in a single group.
+	GroupBy []StatsGroup
+	// AgeBucketSize is a number of years in an age bucket. Zero means default.
+	AgeBucketSize int
+}
+
+// WithDefaults returns stats query with defaults filled in.
+// Returns ErrInvalidStatsQuery if people can't be grouped the requested way.
+func (q StatsQuery) WithDefaults() (StatsQuery, error) {
+	seen := map[StatsGroup]bool{}
+	for _, group := range q.GroupBy {
+		switch group {
+		case StatsByGender, StatsByNationality, StatsByAge:
+		default:
+			return StatsQuery{}, errors.Wrapf(ErrInvalidStatsQuery, "unknown group %q", group)
+		}
+		if seen[group] {
+			return StatsQuery{}, errors.Wrapf(ErrInvalidStatsQuery, "repeated group %q", group)
+		}
+		seen[group] = true
+	}
+	if q.AgeBucketSize < 0 {
+		return StatsQuery{}, errors.Wrapf(ErrInvalidStatsQuery, "negative age bucket size %d", q.AgeBucketSize)
+	}
+	if q.AgeBucketSize == 0 {
+		q.AgeBucketSize = DefaultAgeBucketSize
+	}
+	if q.GroupBy == nil {
+		q.GroupBy = []StatsGroup{}
+	}
+	return q, nil
+}
+
+// Groups tells if people are grouped by given characteristic.
+func (q StatsQuery) Groups(group StatsGroup) bool {
+	for _, queryGroup := range q.GroupBy {
+		if queryGroup == group {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseStatsGroups parses comma separated groups, like "gender,age".
+func ParseStatsGroups(groups string) []StatsGroup {
+	if groups == "" {
+		return nil
+	}
+	parsed := []StatsGroup{}
+	for _, group := range strings.Split(groups, ",") {
+		parsed = append(parsed, StatsGroup(strings.TrimSpace(group)))
+	}
+	return parsed
+}
+
+// StatsRow is statistics over a single group of people.
+// Only fields of characteristics, people were grouped by, are set. They are nil for unknown values too.
+type StatsRow struct {
+	Gender      *Gender `json:"gender,omitempty"`
+	Nationality *string `json:"nationality,omitempty"`
+	// AgeFrom and AgeTo are inclusive bounds of the age bucket.
+	AgeFrom *int  `json:"ageFrom,omitempty"`
+	AgeTo   *int  `json:"ageTo,omitempty"`
+	Count   int64 `json:"count"`
+	// AverageAge is nil if age of nobody in the group is known.
+	AverageAge *float64 `json:"averageAge,omitempty"`
+}
+
+// Stats is statistics over people, the largest groups first.
+type Stats struct {
+	GroupBy       []StatsGroup `json:"groupBy"`
+	AgeBucketSize int          `json:"ageBucketSize,omitempty"`
+	Rows          []StatsRow   `json:"rows"`
+}
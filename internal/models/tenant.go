@@ -0,0 +1,80 @@
+package models
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// DefaultTenant is a tenant of requests, which don't tell their tenant, and of people, added before tenants existed.
+const DefaultTenant = "default"
+
+// Principal is who makes a request, as told by its credentials.
+type Principal struct {
+	Tenant string
+	// Actor identifies credentials within the tenant. It's empty, if credentials tell nothing but the tenant.
+	Actor string
+}
+
+// Tenant is a team, sharing the deployment with others. Tenant sees and changes only its own people.
+type Tenant struct {
+	ID string `json:"id"`
+	// APIKeys authenticate requests of the tenant to REST and GraphQL APIs.
+	APIKeys []string `json:"apiKeys"`
+	// Providers override APIs, people of the tenant are enriched with.
+	Providers ProviderConfig `json:"providers"`
+	Quota     Quota          `json:"quota"`
+}
+
+// ProviderConfig is a config of APIs to enrich people with. Empty fields keep the default APIs.
+type ProviderConfig struct {
+	AgeURL         string `json:"ageUrl"`
+	GenderURL      string `json:"genderUrl"`
+	NationalityURL string `json:"nationalityUrl"`
+	// APIKey is passed to every API, so requests count against the tenant's own subscription.
+	APIKey string `json:"apiKey"`
+}
+
+// Quota limits what a tenant may do. Zero means no limit.
+type Quota struct {
+	// MaxPeople is the largest number of people the tenant may keep.
+	MaxPeople int64 `json:"maxPeople"`
+	// EnrichmentsPerMinute is the largest number of people, enriched for the tenant in a minute by a single instance.
+	EnrichmentsPerMinute int `json:"enrichmentsPerMinute"`
+}
+
+// PersonKey returns key of person with given ID of given tenant, unique across tenants, as "<tenant>:<id>".
+func PersonKey(tenant string, id uuid.UUID) string {
+	return tenant + ":" + id.String()
+}
+
+// ParsePersonKey returns tenant and ID of person, given key is returned by PersonKey for.
+func ParsePersonKey(key string) (string, uuid.UUID, error) {
+	tenant, rawID, ok := strings.Cut(key, ":")
+	if !ok || tenant == "" {
+		return "", uuid.Nil, errors.Errorf("no tenant in person key %q", key)
+	}
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		return "", uuid.Nil, errors.Wrapf(err, "parse ID in person key %q", key)
+	}
+	return tenant, id, nil
+}
+
+type tenantKey struct{}
+
+// WithTenant returns copy of ctx, carrying ID of tenant, the request is made by.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns ID of tenant, carried by ctx, or DefaultTenant if ctx doesn't carry any.
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	if tenant == "" {
+		return DefaultTenant
+	}
+	return tenant
+}